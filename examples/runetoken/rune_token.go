@@ -15,7 +15,12 @@
 // Package runetoken provides an ltl.Token containing a rune and a unique index.
 package runetoken
 
-import "fmt"
+import (
+	"fmt"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	"strconv"
+	"strings"
+)
 
 // RuneToken implements ltl.Token for rune tokens with indices.
 type RuneToken struct {
@@ -46,3 +51,33 @@ func (st *RuneToken) Index() int {
 func (st *RuneToken) String() string {
 	return fmt.Sprintf("%s (%d)", string(st.r), st.index)
 }
+
+// Codec is a codec.TokenCodec for RuneTokens.
+type Codec struct{}
+
+// Encode returns the encoding of the provided Token, and true, if it is a
+// RuneToken.
+func (Codec) Encode(tok ltl.Token) (string, bool) {
+	rt, ok := tok.(*RuneToken)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%d:%s", rt.index, string(rt.r)), true
+}
+
+// Decode returns the RuneToken with the provided encoding.
+func (Codec) Decode(s string) (ltl.Token, error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("malformed RuneToken '%s'", s)
+	}
+	index, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("malformed RuneToken index in '%s': %s", s, err)
+	}
+	r := []rune(parts[1])
+	if len(r) != 1 {
+		return nil, fmt.Errorf("malformed RuneToken value in '%s'", s)
+	}
+	return New(r[0], index), nil
+}
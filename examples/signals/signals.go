@@ -12,12 +12,11 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// Package signals defines an ltl.Token type and matcher for multi-channel
-// boolean signals.
+// Package signals defines ltl.Token types and matchers for multi-channel
+// boolean and numeric signals.
 package signals
 
 import (
-	"errors"
 	"fmt"
 	"github.com/ilhamster/ltl/pkg/ltl"
 	"strings"
@@ -83,20 +82,36 @@ func (sigm signalMatcher) Children() []ltl.Operator {
 }
 
 func (sigm signalMatcher) Match(t ltl.Token) (ltl.Operator, ltl.Environment) {
+	return nil, signals(sigm).match(t, ltl.NotMatching)
+}
+
+func (sigm signalMatcher) Reducible() bool {
+	return true
+}
+
+// match returns the Environment of a matcher for the receiver's signals on the
+// provided Token, returning missing if the Token lacks some of those signals,
+// and none it contains differ.
+func (sig signals) match(t ltl.Token, missing ltl.Environment) ltl.Environment {
+	if t.EOI() {
+		return ltl.NotMatching
+	}
 	sigt, ok := t.(SignalToken)
 	if !ok {
-		return nil, ltl.ErrEnv(errors.New("not a stok"))
+		return ltl.ErrEnv(ltl.NewTokenTypeError(t, "SignalToken"))
 	}
-	for k, v := range sigm {
-		if tv, ok := sigt[k]; !ok || tv != v {
-			return nil, ltl.NotMatching
+	var env ltl.Environment = ltl.Matching
+	for k, v := range sig {
+		tv, ok := sigt[k]
+		if !ok {
+			env = missing
+			continue
+		}
+		if tv != v {
+			return ltl.NotMatching
 		}
 	}
-	return nil, ltl.Matching
-}
-
-func (sigm signalMatcher) Reducible() bool {
-	return true
+	return env
 }
 
 // NewMatcher returns a new matcher matching a number of named boolean signals.
@@ -107,3 +122,104 @@ func (sigm signalMatcher) Reducible() bool {
 func NewMatcher(names ...string) ltl.Operator {
 	return signalMatcher(newSignal(names...))
 }
+
+type partialMatcher signals
+
+func (pm partialMatcher) String() string {
+	return fmt.Sprintf("M? %s", signals(pm))
+}
+
+func (pm partialMatcher) Children() []ltl.Operator {
+	return nil
+}
+
+func (pm partialMatcher) Match(t ltl.Token) (ltl.Operator, ltl.Environment) {
+	return nil, signals(pm).match(t, ltl.Unknown)
+}
+
+func (pm partialMatcher) Reducible() bool {
+	return false
+}
+
+// NewPartialMatcher is like NewMatcher, but for Tokens which may lack signals,
+// as when data is missing.  If the Token lacks some of the signals specified
+// by the matcher, and none it contains differ, the resulting environment is
+// ltl.Unknown rather than not matching, so that formulas over missing data
+// evaluate to Unknown rather than to false violations.
+func NewPartialMatcher(names ...string) ltl.Operator {
+	return partialMatcher(newSignal(names...))
+}
+
+// ValueToken is a Token type for multi-channel numeric signals.
+type ValueToken map[string]float64
+
+func (vt ValueToken) String() string {
+	var ret []string
+	for k, v := range vt {
+		ret = append(ret, fmt.Sprintf("%s:%g", k, v))
+	}
+	return "V " + strings.Join(ret, ", ")
+}
+
+// EOI returns false for all ValueTokens.
+func (vt ValueToken) EOI() bool {
+	return false
+}
+
+type thresholdMatcher struct {
+	name      string
+	threshold float64
+	above     bool
+}
+
+func (tm thresholdMatcher) String() string {
+	cmp := "<"
+	if tm.above {
+		cmp = ">"
+	}
+	return fmt.Sprintf("M %s%s%g", tm.name, cmp, tm.threshold)
+}
+
+func (tm thresholdMatcher) Children() []ltl.Operator {
+	return nil
+}
+
+func (tm thresholdMatcher) Match(t ltl.Token) (ltl.Operator, ltl.Environment) {
+	if t.EOI() {
+		return nil, ltl.NotMatching
+	}
+	vt, ok := t.(ValueToken)
+	if !ok {
+		return nil, ltl.ErrEnv(ltl.NewTokenTypeError(t, "ValueToken"))
+	}
+	v, ok := vt[tm.name]
+	if !ok {
+		return nil, ltl.Unknown
+	}
+	if tm.above {
+		return nil, ltl.Robust(v - tm.threshold)
+	}
+	return nil, ltl.Robust(tm.threshold - v)
+}
+
+func (tm thresholdMatcher) Reducible() bool {
+	return false
+}
+
+// Above returns a new matcher for ValueTokens whose named signal exceeds the
+// provided threshold.  On a Match, the resulting environment is ltl.Robust,
+// with robustness equal to the signal's excess over the threshold, so that
+// formulas of Above and Below matchers evaluate to their robustness under the
+// quantitative semantics of signal temporal logic.  If the Token lacks the
+// named signal, the resulting environment is ltl.Unknown.
+func Above(name string, threshold float64) ltl.Operator {
+	return thresholdMatcher{name, threshold, true}
+}
+
+// Below returns a new matcher for ValueTokens whose named signal is less than
+// the provided threshold.  On a Match, the resulting environment is
+// ltl.Robust, with robustness equal to the signal's shortfall from the
+// threshold.
+func Below(name string, threshold float64) ltl.Operator {
+	return thresholdMatcher{name, threshold, false}
+}
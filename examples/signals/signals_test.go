@@ -15,8 +15,10 @@
 package signals
 
 import (
+	"errors"
 	"github.com/ilhamster/ltl/pkg/ltl"
 	ops "github.com/ilhamster/ltl/pkg/operators"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -125,3 +127,121 @@ func TestSignals(t *testing.T) {
 		}
 	}
 }
+
+func parseValues(t *testing.T, s string) []ltl.Token {
+	var toks []ltl.Token
+	for _, tokStr := range strings.Split(s, ";") {
+		vt := ValueToken{}
+		for _, chStr := range strings.Split(tokStr, ",") {
+			parts := strings.Split(chStr, "=")
+			v, err := strconv.ParseFloat(parts[1], 64)
+			if err != nil {
+				t.Fatalf("bad value %q: %s", chStr, err)
+			}
+			vt[parts[0]] = v
+		}
+		toks = append(toks, vt)
+	}
+	return toks
+}
+
+func TestRobustness(t *testing.T) {
+	tests := []struct {
+		op      ltl.Operator
+		input   string
+		wantRho float64
+	}{
+		{Above("x", 1), "x=3", 2},
+		{Below("x", 1), "x=3", -2},
+		{ops.Not(Above("x", 1)), "x=3", -2},
+		{ops.And(Above("x", 1), Below("y", 5)), "x=3,y=4", 1},
+		{ops.Or(Above("x", 1), Below("y", 5)), "x=3,y=4", 2},
+		{ops.Then(Above("x", 1), Above("x", 2)), "x=3;x=2.5", 0.5},
+	}
+	for _, test := range tests {
+		t.Run(ops.PrettyPrint(test.op, ops.Inline())+" <- "+test.input, func(t *testing.T) {
+			op := test.op
+			var env ltl.Environment
+			for _, tok := range parseValues(t, test.input) {
+				if op == nil {
+					t.Fatalf("op became nil")
+				}
+				op, env = ltl.Match(op, tok)
+			}
+			rho, ok := ltl.RobustnessOf(env)
+			if !ok || rho != test.wantRho {
+				t.Errorf("Got robustness %g, %t, wanted %g, true", rho, ok, test.wantRho)
+			}
+			if env.Matching() != (test.wantRho > 0) {
+				t.Errorf("Got matching %t, wanted %t", env.Matching(), test.wantRho > 0)
+			}
+		})
+	}
+}
+
+func TestUnknown(t *testing.T) {
+	pm := func(s ...string) ltl.Operator {
+		return NewPartialMatcher(s...)
+	}
+	tests := []struct {
+		op          ltl.Operator
+		input       string
+		wantMatch   bool
+		wantUnknown bool
+	}{
+		{pm("a"), "b", false, true},
+		{pm("a"), "!a", false, false},
+		{sm("a"), "b", false, false},
+		{pm("a", "b"), "a", false, true},
+		{pm("a", "b"), "a,!b", false, false},
+		{ops.Not(pm("a")), "b", false, true},
+		{ops.And(pm("a"), pm("b")), "b", false, true},
+		{ops.And(pm("a"), pm("b")), "!b", false, false},
+		{ops.Or(pm("a"), pm("b")), "b", true, false},
+		{ops.Or(pm("a"), pm("b")), "!b", false, true},
+		{ops.Then(pm("a"), pm("b")), "c;b", false, true},
+		{ops.Globally(pm("a")), "a;b;a", false, true},
+		{ops.Globally(pm("a")), "a;b;!a", false, false},
+		{ops.Eventually(pm("a")), "!a;b;!a", false, true},
+		{ops.Eventually(pm("a")), "!a;b;a", true, false},
+		{ops.Release(pm("b"), pm("a")), "a;c;a,b", false, true},
+	}
+	for _, test := range tests {
+		t.Run(ops.PrettyPrint(test.op, ops.Inline())+" <- "+test.input, func(t *testing.T) {
+			op := test.op
+			var env ltl.Environment
+			for _, tok := range parseToks(test.input) {
+				if op == nil {
+					break
+				}
+				op, env = ltl.Match(op, tok)
+			}
+			if op != nil {
+				env = ltl.Finish(op)
+			}
+			if env.Matching() != test.wantMatch || ltl.IsUnknown(env) != test.wantUnknown {
+				t.Errorf("Got %s, wanted matching %t, unknown %t", env, test.wantMatch, test.wantUnknown)
+			}
+		})
+	}
+}
+
+func TestTokenTypeError(t *testing.T) {
+	for _, test := range []struct {
+		op   ltl.Operator
+		tok  ltl.Token
+		want string
+	}{
+		{sm("a"), ValueToken{"a": 1}, "SignalToken"},
+		{Above("a", 1), NewToken("a"), "ValueToken"},
+	} {
+		_, env := test.op.Match(test.tok)
+		var tte *ltl.TokenTypeError
+		if !errors.Is(env.Err(), ltl.ErrTokenType) || !errors.As(env.Err(), &tte) {
+			t.Fatalf("Got %v, wanted a TokenTypeError", env.Err())
+		}
+		if tte.Want != test.want || tte.Token == nil || tte.Index != -1 {
+			t.Errorf("Got %#v, wanted a TokenTypeError wanting %s", tte, test.want)
+		}
+	}
+}
@@ -19,19 +19,24 @@
 package stringmatcher
 
 import (
-	"errors"
 	"fmt"
 	rt "github.com/ilhamster/ltl/examples/runetoken"
 	"github.com/ilhamster/ltl/pkg/binder"
 	be "github.com/ilhamster/ltl/pkg/bindingenvironment"
 	"github.com/ilhamster/ltl/pkg/bindings"
+	"github.com/ilhamster/ltl/pkg/captures"
 	"github.com/ilhamster/ltl/pkg/ltl"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
 type config struct {
 	caseSensitive bool
 	capture       bool
+	integers      bool
+	policy        bindings.MergePolicy
+	captureOpts   []captures.Option
 }
 
 // Option specifies a configuration option for a StringMatcher.
@@ -45,6 +50,15 @@ func Capture(capture bool) Option {
 	}
 }
 
+// CaptureOptions configures captured tokens, as by bounding the memory held by
+// long matches or reporting tokens as they are captured.  Defaults to
+// retaining all captured tokens, and reporting none.
+func CaptureOptions(opts ...captures.Option) Option {
+	return func(c *config) {
+		c.captureOpts = opts
+	}
+}
+
 // CaseSensitive specifies whether string matches are case sensitive.  Defaults
 // to false.
 func CaseSensitive(caseSensitive bool) Option {
@@ -53,6 +67,25 @@ func CaseSensitive(caseSensitive bool) Option {
 	}
 }
 
+// Integers specifies whether decimal digit token values are bound and
+// referenced as integers, rather than as strings, so that they compare
+// numerically and may be referenced with offsets, as by '$n+1'.  Defaults to
+// false.
+func Integers(integers bool) Option {
+	return func(c *config) {
+		c.integers = integers
+	}
+}
+
+// MergePolicy specifies how values bound by the binders Generator produces
+// resolve conflicts with other values bound to the same names.  Defaults to
+// bindings.ErrorOnConflict.
+func MergePolicy(policy bindings.MergePolicy) Option {
+	return func(c *config) {
+		c.policy = policy
+	}
+}
+
 // StringMatcher is a string-matching Operator.
 type StringMatcher struct {
 	s string
@@ -99,6 +132,9 @@ func (sm *StringMatcher) matchInternal(rtok *rt.RuneToken) (ltl.Operator, ltl.En
 	}
 	opts := []be.Option{be.Matching(matching)}
 	if sm.c.capture {
+		if len(sm.c.captureOpts) > 0 {
+			opts = append(opts, be.CaptureOptions(sm.c.captureOpts...))
+		}
 		opts = append(opts, be.Captured(rtok))
 	}
 	env := be.New(opts...)
@@ -110,9 +146,12 @@ func (sm *StringMatcher) matchInternal(rtok *rt.RuneToken) (ltl.Operator, ltl.En
 
 // Match performs an LTL match on the receiving StringMatcher.
 func (sm *StringMatcher) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	if tok.EOI() {
+		return nil, be.New(be.Matching(false))
+	}
 	rtok, ok := tok.(*rt.RuneToken)
 	if !ok {
-		return nil, ltl.ErrEnv(errors.New("expected *rt.RuneToken"))
+		return nil, ltl.ErrEnv(ltl.NewTokenTypeError(tok, "*rt.RuneToken"))
 	}
 	return sm.matchInternal(rtok)
 }
@@ -126,9 +165,22 @@ func (sm *StringMatcher) Reducible() bool {
 	return true
 }
 
+// comparisons are the Comparisons that may suffix a reference, such as '$a>',
+// with two-character suffixes first.
+var comparisons = []bindings.Comparison{
+	bindings.NotEqual,
+	bindings.LessOrEqual,
+	bindings.GreaterOrEqual,
+	bindings.Less,
+	bindings.Greater,
+}
+
 // Generator returns a generator function producing string matchers with the
 // specified options.  The returned function accepts a string and returns a
-// matcher for that string (and possibly an error).
+// matcher for that string (and possibly an error).  Strings beginning with '$'
+// produce Operators binding and referencing token values, and those beginning
+// with '@', Operators binding and referencing token positions.  To match a
+// leading '$' or '@' literally, escape it with a backslash.
 func Generator(opts ...Option) func(s string) (ltl.Operator, error) {
 	c := &config{}
 	for _, opt := range opts {
@@ -137,29 +189,130 @@ func Generator(opts ...Option) func(s string) (ltl.Operator, error) {
 	bindingBuilder := binder.NewBuilder(c.capture, func(name string, tok ltl.Token) (*bindings.Bindings, error) {
 		rtok, ok := tok.(*rt.RuneToken)
 		if !ok {
-			return nil, fmt.Errorf("failed to make Bindings: require *rt.RuneToken")
+			return nil, ltl.NewTokenTypeError(tok, "*rt.RuneToken")
 		}
-		bs, err := bindings.New(bindings.String(name, string(rtok.Value())))
-		return bs, err
-	})
+		if r := rtok.Value(); c.integers && r >= '0' && r <= '9' {
+			return bindings.New(bindings.Int(name, int(r-'0')))
+		}
+		if !c.caseSensitive {
+			return bindings.New(bindings.CollatedString(name, string(rtok.Value()), bindings.CaseInsensitive))
+		}
+		return bindings.New(bindings.String(name, string(rtok.Value())))
+	}).WithPolicy(c.policy)
+
+	positionBuilder := binder.NewPositionBuilder(c.capture).WithPolicy(c.policy)
 
 	return func(s string) (ltl.Operator, error) {
+		// A leading '\$' or '\@' matches a literal '$' or '@'.
+		if strings.HasPrefix(s, `\$`) || strings.HasPrefix(s, `\@`) {
+			return new(s[1:], c), nil
+		}
 		if strings.HasPrefix(s, "$") {
-			s = strings.TrimPrefix(s, "$")
-			if strings.HasSuffix(s, "<-") {
-				s = strings.TrimSuffix(s, "<-")
-				s = strings.TrimSpace(s)
-				if len(s) == 0 {
-					return nil, fmt.Errorf("failed to make binding: no name specified")
-				}
-				return bindingBuilder.Bind(s), nil
-			}
-			s = strings.TrimSpace(s)
+			return generateBinding(strings.TrimPrefix(s, "$"), bindingBuilder)
+		}
+		if strings.HasPrefix(s, "@") {
+			return generateBinding(strings.TrimPrefix(s, "@"), positionBuilder)
+		}
+		return new(s, c), nil
+	}
+}
+
+// generateBinding returns the binding or referencing Operator, generated by
+// the provided Builder, for the provided matcher string, less its leading '$'
+// or '@'.
+func generateBinding(s string, bb *binder.Builder) (ltl.Operator, error) {
+	var re *regexp.Regexp
+	if idx := strings.Index(s, "<-/"); idx >= 0 && len(s) > idx+3 && strings.HasSuffix(s, "/") {
+		var err error
+		if re, err = regexp.Compile(s[idx+3 : len(s)-1]); err != nil {
+			return nil, fmt.Errorf("failed to make binding: %s", err)
+		}
+		s = s[:idx+2]
+	}
+	if strings.HasSuffix(s, "<<-") {
+		s = strings.TrimSuffix(s, "<<-")
+		s = strings.TrimSpace(s)
+		if len(s) == 0 {
+			return nil, fmt.Errorf("failed to make rebinding: no name specified")
+		}
+		return constrain(bb.Rebind(s), re), nil
+	}
+	if strings.HasSuffix(s, "<-") {
+		s = strings.TrimSuffix(s, "<-")
+		s = strings.TrimSpace(s)
+		if len(s) == 0 {
+			return nil, fmt.Errorf("failed to make binding: no name specified")
+		}
+		return constrain(bb.Bind(s), re), nil
+	}
+	if idx := strings.LastIndexAny(s, "+-"); idx > 0 {
+		if offset, err := strconv.Atoi(s[idx:]); err == nil {
+			s = strings.TrimSpace(s[:idx])
 			if len(s) == 0 {
 				return nil, fmt.Errorf("failed to make reference: no name specified")
 			}
-			return bindingBuilder.Reference(s), nil
+			return bb.Offset(s, offset), nil
 		}
-		return new(s, c), nil
 	}
+	cmp := bindings.Equal
+	for _, c := range comparisons {
+		if strings.HasSuffix(s, c.String()) {
+			s = strings.TrimSuffix(s, c.String())
+			cmp = c
+			break
+		}
+	}
+	s = strings.TrimSpace(s)
+	if len(s) == 0 {
+		return nil, fmt.Errorf("failed to make reference: no name specified")
+	}
+	return bb.Compare(s, cmp), nil
+}
+
+// constrain returns the provided Binder constrained by the provided regular
+// expression, if it is not nil.
+func constrain(b *binder.Binder, re *regexp.Regexp) *binder.Binder {
+	if re == nil {
+		return b
+	}
+	return b.Constrained(re)
+}
+
+// Codec is a codec.LeafCodec encoding StringMatchers, and the Binders and
+// Referencers produced by Generator, as the matcher strings Generator accepts.
+type Codec struct {
+	generate func(s string) (ltl.Operator, error)
+}
+
+// NewCodec returns a Codec decoding with a Generator using the specified
+// options.
+func NewCodec(opts ...Option) *Codec {
+	return &Codec{Generator(opts...)}
+}
+
+// Encode returns the matcher string for the provided Operator, and true, if it
+// is a StringMatcher, unguarded Binder of a single name, or Referencer.
+func (lc *Codec) Encode(op ltl.Operator) (string, bool) {
+	switch o := op.(type) {
+	case *StringMatcher:
+		if strings.HasPrefix(o.s, "$") {
+			return "", false
+		}
+		return o.s, true
+	case *binder.Binder:
+		// Generator produces no guarded Binders, or Binders of several names.
+		if o.Guard() != nil || len(o.Names()) > 1 {
+			return "", false
+		}
+		return strings.TrimSuffix(strings.TrimPrefix(o.String(), "["), "]"), true
+	case *binder.Referencer:
+		return strings.TrimSuffix(strings.TrimPrefix(o.String(), "["), "]"), true
+	}
+	return "", false
+}
+
+// Decode returns the Operator Generator produces for the provided matcher
+// string.
+func (lc *Codec) Decode(s string) (ltl.Operator, error) {
+	return lc.generate(s)
 }
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"github.com/ilhamster/ltl/examples/runetoken"
 	"github.com/ilhamster/ltl/pkg/ltl"
+	ltlstream "github.com/ilhamster/ltl/pkg/stream"
 	"os"
 	"runtime/pprof"
 	"testing"
@@ -41,8 +42,8 @@ const (
 // stream approximates matching against a continually streaming input by
 // applying the provided input, repeated by the specified count, to the parsed
 // provided expression.  A fresh instance of the expression is begun at each
-// token, and is fed subsequent tokens until it becomes nil.  Matches are
-// counted and, at the end, compared against an expected value.
+// token by a stream.Runner.  Matches are counted and, at the end, compared
+// against an expected value.
 // Maintaining multiple operators, from different starting points, is expensive.
 func stream(b *testing.B, expr, input string, count int, wantMatch int, profFile string) {
 	op, err := parse(expr)
@@ -58,25 +59,14 @@ func stream(b *testing.B, expr, input string, count int, wantMatch int, profFile
 		defer pprof.StopCPUProfile()
 	}
 	for i := 0; i < b.N; i++ {
-		var ops []ltl.Operator
 		gotMatch := 0
+		r := ltlstream.New(op, func(ltlstream.Match) {
+			gotMatch++
+		}, ltlstream.OnError(func(m ltlstream.Match) {
+			b.Fatalf("Unexpected error %s", m.Env.Err())
+		}))
 		for n := 0; n < count*len(input); n++ {
-			tok := runetoken.New(rune(input[n%len(input)]), n)
-			ops = append(ops, op)
-			var newOps []ltl.Operator
-			for _, op := range ops {
-				newOp, env := op.Match(tok)
-				if ltl.IsErroring(env) {
-					b.Fatalf("Unexpected error %s", env.Err())
-				}
-				if env.Matching() {
-					gotMatch++
-				}
-				if newOp != nil {
-					newOps = append(newOps, newOp)
-				}
-			}
-			ops = newOps
+			r.Match(runetoken.New(rune(input[n%len(input)]), n))
 		}
 		if gotMatch != wantMatch {
 			b.Fatalf("Expected %d matches, got %d", wantMatch, gotMatch)
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	rt "github.com/ilhamster/ltl/examples/runetoken"
 	smatch "github.com/ilhamster/ltl/examples/stringmatcher"
+	"github.com/ilhamster/ltl/pkg/binder"
 	be "github.com/ilhamster/ltl/pkg/bindingenvironment"
 	"github.com/ilhamster/ltl/pkg/bindings"
 	"github.com/ilhamster/ltl/pkg/ltl"
@@ -53,7 +54,7 @@ func b(args ...string) func(*testInput) {
 	}
 	bvs := make([]bindings.BoundValue, 0, len(args)/2)
 	for i := 0; i < len(args); i += 2 {
-		bvs = append(bvs, bindings.String(args[i], args[i+1]))
+		bvs = append(bvs, bindings.CollatedString(args[i], args[i+1], bindings.CaseInsensitive))
 	}
 	ret, err := bindings.New(bvs...)
 	if err != nil {
@@ -218,6 +219,12 @@ func TestExpressions(t *testing.T) {
 			m("12", b("a", "1"), i(0, 1)),
 			nm("11"),
 		),
+		// Bindings compare case-insensitively, like the string matchers.
+		tc("[$a<-] THEN [$a]",
+			m("Aa", b("a", "A"), i(0, 1)),
+			m("aA", b("a", "a"), i(0, 1)),
+			nm("ab"),
+		),
 		tc("[$a<-] THEN EVENTUALLY NOT [$a]",
 			m("12", b("a", "1"), i(0, 1)),
 			m("112", b("a", "1"), i(0, 2)),
@@ -227,6 +234,12 @@ func TestExpressions(t *testing.T) {
 			m("beefb", b("a", "b"), i(0, 1, 2, 3, 4)),
 			nm("beefa"),
 		),
+		tc("([b] OR [c]) RELEASE ([a] OR [b])",
+			m("abc", i(1)),
+			m("aab", i(2)),
+			m("bc", i(0)),
+			nm("ac"),
+		),
 		tc("[abc] THEN [def]",
 			m("abcdef", i(2, 5)),
 			nm("nope"),
@@ -282,6 +295,70 @@ func TestExpressions(t *testing.T) {
 			m("11", b("a", "1"), i(0, 1)),
 			err("12"),
 		),
+		tc("[$a<-] THEN [$a<<-]",
+			m("11", b("a", "1"), i(0, 1)),
+			m("12", b("a", "2"), i(0, 1)),
+		),
+		tc("[$a<-] THEN [$a<<-] THEN [$a]",
+			m("122", b("a", "2"), i(0, 1, 2)),
+			nm("121"),
+		),
+		tc("[$a<<-] THEN [$a<-]",
+			m("11", b("a", "1"), i(0, 1)),
+			err("12"),
+		),
+		tc("[$a<-] THEN [$a>]",
+			m("12", b("a", "1"), i(0, 1)),
+			nm("11"),
+			nm("21"),
+		),
+		tc("[$a<-] THEN [$a!=]",
+			m("12", b("a", "1"), i(0, 1)),
+			nm("11"),
+		),
+		tc("[$a<-] THEN [$a<=]",
+			m("11", b("a", "1"), i(0, 1)),
+			m("10", b("a", "1"), i(0, 1)),
+			nm("12"),
+		),
+		tc("[$a<-] THEN NOT [$a<]",
+			m("11", b("a", "1"), i(0, 1)),
+			nm("10"),
+		),
+		tc("[$a<-] THEN EVENTUALLY [$a>=]",
+			m("102", b("a", "1"), i(0, 2)),
+			nm("100"),
+		),
+		tc("[$id<-/[0-9]/] THEN [$id]",
+			m("11", b("id", "1"), i(0, 1)),
+			nm("aa"),
+		),
+		tc("[$a<-] THEN [$a<<-/[a-c]/]",
+			m("xb", b("a", "b"), i(0, 1)),
+			nm("xz"),
+		),
+		tc("[$a<-] THEN SCOPE($a) ([$a<-] THEN [$a]) THEN [$a]",
+			m("1221", b("a", "1"), i(0, 1, 2, 3)),
+			nm("1222"),
+			nm("1231"),
+		),
+		tc("SCOPE($a, $b) ([$a<-] THEN [$b<-] THEN [$c<-])",
+			m("123", b("c", "3"), i(0, 1, 2)),
+		),
+		tc("SCOPE($a) [$a]",
+			nm("1"),
+		),
+		tc("[$a<-] THEN SCOPE($a) NOT [$a]",
+			m("11", b("a", "1"), i(0, 1)),
+		),
+		// An expired LIMIT keeps its child's captures and references.
+		tc("NOT(EVENTUALLY [a] LIMIT 2)",
+			m("bb", i(1)),
+		),
+		tc("NOT GLOBALLY (([$y] UNTIL [$y]) LIMIT 2)",
+			nm("ca"),
+			nm("cac"),
+		),
 	}
 	for _, test := range tests {
 		for _, inputSet := range test.inputSets {
@@ -292,6 +369,244 @@ func TestExpressions(t *testing.T) {
 	}
 }
 
+// Tests references offset from integer bindings.
+func TestOffsetReferences(t *testing.T) {
+	n := func(v int) func(*testInput) {
+		return func(ti *testInput) {
+			ti.wantBindings, _ = bindings.New(bindings.Int("n", v))
+		}
+	}
+	tests := []struct {
+		opStr     string
+		inputSets []*testInput
+	}{{
+		"[$n<-] THEN [$n+1] THEN [$n+2]",
+		[]*testInput{
+			m("123", n(1), i(0, 1, 2)),
+			nm("124"),
+			nm("111"),
+		},
+	}, {
+		"[$n<-] THEN EVENTUALLY [$n-1]",
+		[]*testInput{
+			m("3x2", n(3), i(0, 2)),
+			nm("33"),
+		},
+	}, {
+		"[$n<-] THEN [$n+1]",
+		[]*testInput{
+			nm("ab"),
+		},
+	}}
+	for _, test := range tests {
+		l, err := parser.NewLexer(parser.DefaultTokens,
+			smatch.Generator(smatch.Capture(true), smatch.Integers(true)),
+			bufio.NewReader(strings.NewReader(test.opStr)))
+		if err != nil {
+			t.Fatalf("Failed to create lexer: %s", err)
+		}
+		op, err := parser.ParseLTL(l)
+		if err != nil {
+			t.Fatalf("Failed to parse: %s", err)
+		}
+		for _, inputSet := range test.inputSets {
+			t.Run(fmt.Sprintf("%s <- %s", test.opStr, inputSet.input), func(t *testing.T) {
+				expect(op, inputSet, t)
+			})
+		}
+	}
+}
+
+// Tests binders binding only where their guards match.
+func TestBindIf(t *testing.T) {
+	extractions := 0
+	bb := binder.NewBuilder(true, func(name string, tok ltl.Token) (*bindings.Bindings, error) {
+		extractions++
+		return bindings.New(bindings.String(name, string(tok.(*rt.RuneToken).Value())))
+	})
+	guard := ops.Or(smatch.New("x", smatch.Capture(true)), smatch.New("y", smatch.Capture(true)))
+	op := ops.Then(bb.BindIf("a", guard), bb.Reference("a"))
+	bound := func(v string) func(*testInput) {
+		return func(ti *testInput) {
+			ti.wantBindings, _ = bindings.New(bindings.String("a", v))
+		}
+	}
+	for _, inputSet := range []*testInput{
+		m("xx", bound("x"), i(0, 1)),
+		m("yy", bound("y"), i(0, 1)),
+		nm("xy"),
+		nm("zz"),
+	} {
+		t.Run(fmt.Sprintf("%s <- %s", ops.PrettyPrint(op, ops.Inline()), inputSet.input), func(t *testing.T) {
+			expect(op, inputSet, t)
+		})
+	}
+	extractions = 0
+	if _, env := ltl.Match(bb.BindIf("a", guard), rt.New('z', 0)); env.Matching() || extractions != 0 {
+		t.Errorf("Guarded binder failing its guard yielded matching %t after %d extractions, wanted false after none", env.Matching(), extractions)
+	}
+}
+
+// Tests binding and referencing token positions.
+func TestPositions(t *testing.T) {
+	at := func(name string, pos int) func(*testInput) {
+		return func(ti *testInput) {
+			ti.wantBindings, _ = bindings.New(bindings.Int(name, pos))
+		}
+	}
+	tests := []struct {
+		opStr     string
+		inputSets []*testInput
+	}{{
+		"[@p<-] THEN [x] THEN ([x] AND [@p+2])",
+		[]*testInput{
+			m("axx", at("p", 0), i(0, 1, 2)),
+		},
+	}, {
+		"[x] THEN ([@p<-] AND [y]) THEN ([z] OR [@p+1])",
+		[]*testInput{
+			m("xyw", at("p", 1), i(0, 1, 2)),
+			m("xyz", at("p", 1), i(0, 1, 2)),
+			nm("xxz"),
+		},
+	}, {
+		"[@p<-] THEN [@p+2]",
+		[]*testInput{
+			nm("ab"),
+		},
+	}}
+	for _, test := range tests {
+		op, err := parse(test.opStr)
+		if err != nil {
+			t.Fatalf("Failed to parse: %s", err)
+		}
+		for _, inputSet := range test.inputSets {
+			t.Run(fmt.Sprintf("%s <- %s", test.opStr, inputSet.input), func(t *testing.T) {
+				expect(op, inputSet, t)
+			})
+		}
+	}
+}
+
+// Tests that conflicting bindings are resolved by the formula's MergePolicy.
+func TestMergePolicies(t *testing.T) {
+	set := func(vs ...string) func(*testInput) {
+		return func(ti *testInput) {
+			members := []bindings.BoundValue{}
+			for _, v := range vs {
+				members = append(members, bindings.CollatedString("a", v, bindings.CaseInsensitive))
+			}
+			bs, err := bindings.Set("a", members...)
+			if err != nil {
+				t.Fatalf("Set() yielded unexpected error %s", err)
+			}
+			ti.wantBindings, _ = bindings.New(bs)
+		}
+	}
+	tests := []struct {
+		opStr     string
+		policy    bindings.MergePolicy
+		inputSets []*testInput
+	}{{
+		"[$a<-] THEN [$a<-]",
+		bindings.ErrorOnConflict,
+		[]*testInput{
+			m("11", b("a", "1"), i(0, 1)),
+			err("12"),
+		},
+	}, {
+		"[$a<-] THEN [$a<-]",
+		bindings.KeepFirst,
+		[]*testInput{
+			m("12", b("a", "1"), i(0, 1)),
+		},
+	}, {
+		"[$a<-] THEN [$a<-]",
+		bindings.KeepLast,
+		[]*testInput{
+			m("12", b("a", "2"), i(0, 1)),
+		},
+	}, {
+		"[$a<-] THEN [$a<-]",
+		bindings.CollectSet,
+		[]*testInput{
+			m("12", set("1", "2"), i(0, 1)),
+			m("11", b("a", "1"), i(0, 1)),
+		},
+	}, {
+		"[$a<-] THEN [$a<-] THEN [$a]",
+		bindings.CollectSet,
+		[]*testInput{
+			m("122", set("1", "2"), i(0, 1, 2)),
+			m("121", set("1", "2"), i(0, 1, 2)),
+			nm("123"),
+		},
+	}}
+	for _, test := range tests {
+		l, err := parser.NewLexer(parser.DefaultTokens,
+			smatch.Generator(smatch.Capture(true), smatch.MergePolicy(test.policy)),
+			bufio.NewReader(strings.NewReader(test.opStr)))
+		if err != nil {
+			t.Fatalf("Failed to create lexer: %s", err)
+		}
+		op, err := parser.ParseLTL(l)
+		if err != nil {
+			t.Fatalf("Failed to parse: %s", err)
+		}
+		for _, inputSet := range test.inputSets {
+			t.Run(fmt.Sprintf("%s (%s) <- %s", test.opStr, test.policy, inputSet.input), func(t *testing.T) {
+				expect(op, inputSet, t)
+			})
+		}
+	}
+}
+
+// Tests binders binding several names from each token.
+func TestBindAll(t *testing.T) {
+	// Each rune binds 'lower' and 'upper' to its lower- and upper-case forms.
+	extract := func(name string, tok ltl.Token) (*bindings.Bindings, error) {
+		r := string(tok.(*rt.RuneToken).Value())
+		if name == "upper" {
+			return bindings.New(bindings.String(name, strings.ToUpper(r)))
+		}
+		return bindings.New(bindings.String(name, strings.ToLower(r)))
+	}
+	extractions := 0
+	extractAll := func(names []string, tok ltl.Token) (*bindings.Bindings, error) {
+		extractions++
+		var bvs []bindings.BoundValue
+		for _, name := range names {
+			bs, err := extract(name, tok)
+			if err != nil {
+				return nil, err
+			}
+			bvs = append(bvs, bs.Values()...)
+		}
+		return bindings.New(bvs...)
+	}
+	bound := func(ti *testInput) {
+		ti.wantBindings, _ = bindings.New(bindings.String("lower", "a"), bindings.String("upper", "A"))
+	}
+	for _, bb := range []*binder.Builder{
+		binder.NewBuilder(false, extract),
+		binder.NewBuilder(false, extract).WithExtractAll(extractAll),
+	} {
+		op := ops.Then(bb.BindAll("lower", "upper"), ops.And(bb.Reference("upper"), bb.Reference("lower")))
+		for _, inputSet := range []*testInput{
+			m("aa", bound),
+			m("aA", bound),
+			nm("ab"),
+		} {
+			t.Run(fmt.Sprintf("%s <- %s", ops.PrettyPrint(op, ops.Inline()), inputSet.input), func(t *testing.T) {
+				expect(op, inputSet, t)
+			})
+		}
+	}
+	if extractions != 3 {
+		t.Errorf("Multi-name extraction ran %d times, wanted once per input", extractions)
+	}
+}
+
 // Tests that different formulae that should be equivalent actually are.
 func TestEquivalentFormulae(t *testing.T) {
 	type testCase struct {
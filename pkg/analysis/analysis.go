@@ -0,0 +1,167 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package analysis provides analyses of operator trees built from package
+// operators.
+//
+// Static analyses treat the leaves of an operator tree (matchers, predicates, and the
+// like) as atomic propositions, each holding or not on each Token
+// independently of the others.  Leaves that print identically are taken to be
+// the same proposition, so that, e.g., '[a] AND NOT [a]' is recognized as a
+// contradiction.  Relationships between distinct leaves are not known: '[a]
+// AND [b]' is considered satisfiable, even if no Token can match both.  Leaves
+// are assumed to accept a single Token, and any bindings they make are
+// ignored.
+package analysis
+
+import (
+	be "github.com/ilhamster/ltl/pkg/bindingenvironment"
+	"github.com/ilhamster/ltl/pkg/internal/atoms"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	ops "github.com/ilhamster/ltl/pkg/operators"
+)
+
+// MaxAtoms is the maximum number of distinct leaves an analyzed operator tree
+// may have.
+const MaxAtoms = 12
+
+const defaultDepth = 8
+
+type config struct {
+	depth int
+}
+
+// Option configures an analysis.
+type Option func(c *config)
+
+// MaxDepth specifies the length of the longest input considered by an
+// analysis.  The default is 8.
+func MaxDepth(depth int) Option {
+	return func(c *config) {
+		c.depth = depth
+	}
+}
+
+// Satisfiable returns true if some input, no longer than the configured
+// maximum depth, satisfies the provided Operator: that is, the Operator
+// resolves matching on the input, or matches at the end of the input.  A
+// false result means only that no such input was found within the depth.
+func Satisfiable(op ltl.Operator, opts ...Option) (bool, error) {
+	found, _, err := explore(op, opts...)
+	return found, err
+}
+
+// Dead returns true if the provided Operator, typically a continuation
+// returned by an earlier Match, can never match, whatever input follows, so
+// that a driver monitoring it may retire it.  A false result is conservative:
+// it means that either some input satisfies the Operator, or that this could
+// not be ruled out, because the Operator's reachable states could not all be
+// explored within the configured maximum depth, or because Environments it
+// retains have references that future bindings might yet resolve.  A nil
+// Operator is dead.
+func Dead(op ltl.Operator, opts ...Option) (bool, error) {
+	if op == nil {
+		return true, nil
+	}
+	if retainsReferences(op) {
+		return false, nil
+	}
+	found, exhausted, err := explore(op, opts...)
+	return !found && exhausted, err
+}
+
+// explore explores the states reachable from op, returning whether any
+// resolves matching, and whether all were explored within the configured
+// maximum depth.
+func explore(op ltl.Operator, opts ...Option) (found, exhausted bool, err error) {
+	c := &config{depth: defaultDepth}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if op == nil {
+		return false, true, nil
+	}
+	az := atoms.NewAtomizer("analyze", MaxAtoms, atoms.Shared(), atoms.Continuations())
+	atomized, err := az.Atomize(op)
+	if err != nil {
+		return false, false, err
+	}
+	valuations := atoms.Token(1) << uint(len(az.Leaves()))
+	// Explore the states reachable from op, breadth-first.  Since a state's
+	// future does not depend on how it was reached, each is explored once.
+	seen := map[string]bool{}
+	frontier := []ltl.Operator{atomized}
+	for depth := 0; len(frontier) > 0; depth++ {
+		var next []ltl.Operator
+		for _, op := range frontier {
+			key := ops.PrettyPrint(ops.Canonicalize(op), ops.Inline())
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			env := ltl.Finish(op)
+			if ltl.IsErroring(env) {
+				return false, false, env.Err()
+			}
+			if env.Matching() {
+				return true, false, nil
+			}
+			if depth == c.depth {
+				next = append(next, op)
+				continue
+			}
+			for at := atoms.Token(0); at < valuations; at++ {
+				newOp, env := op.Match(at)
+				if ltl.IsErroring(env) {
+					return false, false, env.Err()
+				}
+				if newOp == nil {
+					if env.Matching() {
+						return true, false, nil
+					}
+					continue
+				}
+				next = append(next, newOp)
+			}
+		}
+		if depth == c.depth {
+			return false, len(next) == 0, nil
+		}
+		frontier = next
+	}
+	return false, true, nil
+}
+
+// retainsReferences returns true if any Environment retained by the provided
+// operator tree has references.
+func retainsReferences(op ltl.Operator) bool {
+	for _, env := range retainedEnvs(op, nil) {
+		if be.PendingReferences(env).Length() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+
+// Tautology returns true if every input, no longer than the configured maximum
+// depth, satisfies the provided Operator.  It is equivalent to
+// !Satisfiable(Not(op)).
+func Tautology(op ltl.Operator, opts ...Option) (bool, error) {
+	if op == nil {
+		return false, nil
+	}
+	sat, err := Satisfiable(ops.Not(op), opts...)
+	return !sat && err == nil, err
+}
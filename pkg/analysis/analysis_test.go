@@ -0,0 +1,206 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analysis
+
+import (
+	"bufio"
+	"fmt"
+	rtok "github.com/ilhamster/ltl/examples/runetoken"
+	smatch "github.com/ilhamster/ltl/examples/stringmatcher"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	ops "github.com/ilhamster/ltl/pkg/operators"
+	"github.com/ilhamster/ltl/pkg/parser"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, s string) ltl.Operator {
+	t.Helper()
+	l, err := parser.NewLexer(parser.DefaultTokens, smatch.Generator(),
+		bufio.NewReader(strings.NewReader(s)))
+	if err != nil {
+		t.Fatalf("Failed to create lexer: %s", err)
+	}
+	op, err := parser.ParseLTL(l)
+	if err != nil {
+		t.Fatalf("Failed to parse '%s': %s", s, err)
+	}
+	return op
+}
+
+func TestAnalysis(t *testing.T) {
+	tests := []struct {
+		expr                           string
+		wantSatisfiable, wantTautology bool
+	}{
+		{"[a]", true, false},
+		{"[a] AND NOT [a]", false, false},
+		{"[a] OR NOT [a]", true, true},
+		{"[a] AND [b]", true, false},
+		{"(EVENTUALLY [a]) AND GLOBALLY NOT [a]", false, false},
+		{"(EVENTUALLY [a]) OR GLOBALLY NOT [a]", true, true},
+		{"[a] THEN NOT [a]", true, false},
+		{"([a] THEN [b]) AND ([a] THEN NOT [b])", false, false},
+		{"NEXT [a] AND NEXT NOT [a]", false, false},
+		{"GLOBALLY [a]", true, false},
+		{"(NOT [b]) UNTIL [a]", true, false},
+		{"(([b] UNTIL [a]) AND GLOBALLY NOT [a])", false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			sat, err := Satisfiable(parse(t, test.expr))
+			if err != nil {
+				t.Fatalf("Satisfiable() yielded unexpected error %s", err)
+			}
+			if sat != test.wantSatisfiable {
+				t.Errorf("Satisfiable() = %t, wanted %t", sat, test.wantSatisfiable)
+			}
+			taut, err := Tautology(parse(t, test.expr))
+			if err != nil {
+				t.Fatalf("Tautology() yielded unexpected error %s", err)
+			}
+			if taut != test.wantTautology {
+				t.Errorf("Tautology() = %t, wanted %t", taut, test.wantTautology)
+			}
+		})
+	}
+}
+
+func TestAnalysisDepth(t *testing.T) {
+	a := smatch.New("a")
+	op := ops.Accept(5, a)
+	if sat, _ := Satisfiable(op, MaxDepth(5)); sat {
+		t.Errorf("Satisfiable() at depth 5 = true, wanted false")
+	}
+	if sat, _ := Satisfiable(op, MaxDepth(6)); !sat {
+		t.Errorf("Satisfiable() at depth 6 = false, wanted true")
+	}
+	if _, err := Satisfiable(ops.NotFollowedBy(a, a)); err == nil {
+		t.Errorf("Expected an error analyzing NotFollowedBy")
+	}
+}
+
+func TestDead(t *testing.T) {
+	tests := []struct {
+		expr, input string
+		opts        []Option
+		want        bool
+	}{
+		{"[a] THEN [b]", "", nil, false},
+		{"[a] THEN [b]", "a", nil, false},
+		{"[a] THEN [b]", "x", nil, true},
+		{"[a] THEN EVENTUALLY [b]", "a", nil, false},
+		{"[a] THEN EVENTUALLY [b]", "x", nil, true},
+		{"GLOBALLY [a]", "ab", nil, true},
+		{"(EVENTUALLY [a]) AND GLOBALLY NOT [a]", "", nil, true},
+		{"(NEXT NEXT [a]) AND NEXT NEXT NOT [a]", "", nil, true},
+		{"(NEXT NEXT [a]) AND NEXT NEXT NOT [a]", "", []Option{MaxDepth(1)}, false},
+		// Pending references might be resolved by later bindings.
+		{"[$x] THEN [$x<-]", "a", nil, false},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s <- '%s'", test.expr, test.input), func(t *testing.T) {
+			op := parse(t, test.expr)
+			for idx, ch := range test.input {
+				if op == nil {
+					break
+				}
+				op, _ = ltl.Match(op, rtok.New(ch, idx))
+			}
+			got, err := Dead(op, test.opts...)
+			if err != nil {
+				t.Fatalf("Dead(%s) yielded unexpected error %s", op, err)
+			}
+			if got != test.want {
+				t.Errorf("Dead(%s) = %t, wanted %t", op, got, test.want)
+			}
+		})
+	}
+}
+
+func TestProgressOf(t *testing.T) {
+	tests := []struct {
+		expr, input string
+		want        string
+		wantCurrent string
+	}{
+		{"[a] THEN [b] THEN [c]", "", "0 of 3 steps matched", "[a]"},
+		{"[a] THEN [b] THEN [c]", "a", "1 of 3 steps matched", "[b]"},
+		{"[a] THEN [b] THEN [c]", "ab", "2 of 3 steps matched", "[c]"},
+		{"[a] THEN [b] THEN [c]", "abc", "3 of 3 steps matched", ""},
+		{"[a] THEN [b] THEN [c]", "x", "failed after 1 of 3 steps", "[b]"},
+		{"([a] THEN [b]) THEN [c]", "a", "1 of 3 steps matched", "[b]"},
+		{"(EVENTUALLY [a]) THEN [b]", "xx", "0 of 2 steps matched", "EVENTUALLY"},
+		{"[a]", "", "0 of 1 steps matched", "[a]"},
+		{"[$x<-] THEN [a] THEN [$y] THEN [b] THEN [$y<-]", "qab", "3 of 5 steps matched, waiting for $y", "[b]"},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s <- '%s'", test.expr, test.input), func(t *testing.T) {
+			formula := parse(t, test.expr)
+			op := formula
+			for idx, ch := range test.input {
+				if op == nil {
+					break
+				}
+				op, _ = ltl.Match(op, rtok.New(ch, idx))
+			}
+			p := ProgressOf(formula, op)
+			if p.String() != test.want {
+				t.Errorf("ProgressOf(%s) = '%s', wanted '%s'", op, p, test.want)
+			}
+			gotCurrent := ""
+			if p.Current != nil {
+				gotCurrent = p.Current.String()
+			}
+			if gotCurrent != test.wantCurrent {
+				t.Errorf("ProgressOf(%s).Current = '%s', wanted '%s'", op, gotCurrent, test.wantCurrent)
+			}
+		})
+	}
+}
+
+func TestVacuity(t *testing.T) {
+	a, b := smatch.New("a"), smatch.New("b")
+	tests := []struct {
+		op    ltl.Operator
+		input string
+		want  []string
+	}{
+		{ops.RespondsTo(a, b), "ccc", []string{"IMPLIES([a],EVENTUALLY([b])) at '/0': antecedent never matched"}},
+		{ops.RespondsTo(a, b), "cab", nil},
+		{ops.Or(a, b), "a", []string{"OR([a],[b]) at '': argument 1 never matched"}},
+		{ops.Or(a, b), "c", nil},
+		{ops.Until(a, b), "b", []string{"UNTIL([a],[b]) at '': left argument never matched"}},
+		{ops.Until(a, b), "aab", nil},
+	}
+	for _, test := range tests {
+		t.Run(ops.PrettyPrint(test.op, ops.Inline())+" on "+test.input, func(t *testing.T) {
+			op, activity := Instrument(test.op)
+			for idx, ch := range test.input {
+				if op == nil {
+					break
+				}
+				op, _ = ltl.Match(op, rtok.New(ch, idx))
+			}
+			var got []string
+			for _, v := range activity.Vacuities() {
+				got = append(got, v.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("Vacuities() = %v, wanted %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analysis
+
+import (
+	"fmt"
+	be "github.com/ilhamster/ltl/pkg/bindingenvironment"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	ops "github.com/ilhamster/ltl/pkg/operators"
+	"sort"
+	"strings"
+)
+
+// Progress describes how far an instance of a formula has resolved.
+type Progress struct {
+	// Steps is the number of top-level steps of the formula: the operands of
+	// its outermost chain of THENs and SEQUENCEs, or 1 if it has none.
+	Steps int
+	// Completed is the number of those steps that have resolved.
+	Completed int
+	// Failed is set if a completed step did not match, and no pending
+	// reference could change that, so that the instance cannot match.
+	Failed bool
+	// Current is the step against which the next Token will be matched, as
+	// partially evaluated so far, or nil if the instance has resolved.
+	Current ltl.Operator
+	// Waiting holds, in increasing order, the names referenced by completed
+	// steps that are not yet bound.
+	Waiting []string
+}
+
+func (p Progress) String() string {
+	if p.Failed {
+		return fmt.Sprintf("failed after %d of %d steps", p.Completed, p.Steps)
+	}
+	ret := fmt.Sprintf("%d of %d steps matched", p.Completed, p.Steps)
+	if len(p.Waiting) > 0 {
+		ret += fmt.Sprintf(", waiting for $%s", strings.Join(p.Waiting, ", $"))
+	}
+	return ret
+}
+
+// Progressor is implemented by Operators, generally defined outside package
+// operators, that report their own progress.
+type Progressor interface {
+	ltl.Operator
+	// Progress returns the progress of the receiver.  Its Waiting field is
+	// extended with any references retained around the receiver.
+	Progress() Progress
+}
+
+// ProgressOf returns the Progress of cont, a continuation returned by matching
+// Tokens against formula.  Steps are counted by comparing the steps remaining
+// in cont with those of formula, so cont should be a continuation of formula
+// itself, not of some other formula containing it.
+func ProgressOf(formula, cont ltl.Operator) Progress {
+	envs := retainedEnvs(cont, nil)
+	var p Progress
+	cont, failed := unwrap(cont)
+	if pr, ok := cont.(Progressor); ok {
+		p = pr.Progress()
+	} else {
+		p.Steps = len(steps(formula))
+		remaining := 0
+		if cont != nil {
+			rest := steps(cont)
+			remaining = len(rest)
+			var currentFailed bool
+			p.Current, currentFailed = unwrap(rest[0])
+			failed = failed || currentFailed
+		}
+		p.Completed = p.Steps - remaining
+		if p.Completed < 0 {
+			p.Completed = 0
+		}
+	}
+	p.Failed = p.Failed || failed
+	seen := map[string]bool{}
+	for _, name := range p.Waiting {
+		seen[name] = true
+	}
+	for _, env := range envs {
+		for _, name := range unboundReferences(env) {
+			if !seen[name] {
+				seen[name] = true
+				p.Waiting = append(p.Waiting, name)
+			}
+		}
+	}
+	sort.Strings(p.Waiting)
+	return p
+}
+
+// unwrap returns the provided Operator, stripped of any wrappers retaining
+// Environments from earlier steps, and true if any of those steps failed to
+// match, with no pending references.
+func unwrap(op ltl.Operator) (ltl.Operator, bool) {
+	failed := false
+	for {
+		s, ok := ops.StateOf(op)
+		if !ok || (s.Type != ops.AndEnvironmentType && s.Type != ops.OrEnvironmentType) {
+			return op, failed
+		}
+		if env := s.Envs[0]; s.Type == ops.AndEnvironmentType && !env.Matching() {
+			failed = failed || len(unboundReferences(env)) == 0
+		}
+		op = ops.Children(op)[0]
+	}
+}
+
+// retainedEnvs appends the Environments retained anywhere within the provided
+// operator tree to envs, and returns the result.
+func retainedEnvs(op ltl.Operator, envs []ltl.Environment) []ltl.Environment {
+	if s, ok := ops.StateOf(op); ok {
+		envs = append(envs, s.Envs...)
+	}
+	for _, child := range ops.Children(op) {
+		envs = retainedEnvs(child, envs)
+	}
+	return envs
+}
+
+// steps returns the top-level steps of the provided Operator.
+func steps(op ltl.Operator) []ltl.Operator {
+	switch ops.KindOf(op) {
+	case ops.ThenKind, ops.SequenceKind:
+		var ret []ltl.Operator
+		for _, child := range ops.Children(op) {
+			ret = append(ret, steps(child)...)
+		}
+		return ret
+	}
+	return []ltl.Operator{op}
+}
+
+// unboundReferences returns the names referenced, but not yet bound, within
+// the provided Environment.
+func unboundReferences(env ltl.Environment) []string {
+	var ret []string
+	for _, bv := range be.PendingReferences(env).Values() {
+		ret = append(ret, bv.Key())
+	}
+	return ret
+}
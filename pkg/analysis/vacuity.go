@@ -0,0 +1,173 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analysis
+
+import (
+	"fmt"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	ops "github.com/ilhamster/ltl/pkg/operators"
+	"sync/atomic"
+)
+
+// Activity records, for each subformula of an instrumented operator tree, how
+// many times it produced matching and non-matching Environments.  Activity is
+// safe for concurrent use.
+type Activity struct {
+	nodes []*node
+}
+
+type node struct {
+	path                 string
+	op                   ltl.Operator
+	children             []*node
+	matched, notMatching int64
+}
+
+// Counts returns the numbers of matching and non-matching Environments
+// produced by the subformula at the specified path (see Vacuity.Path), and
+// whether that path exists.
+func (a *Activity) Counts(path string) (matched, notMatching int64, ok bool) {
+	for _, n := range a.nodes {
+		if n.path == path {
+			return atomic.LoadInt64(&n.matched), atomic.LoadInt64(&n.notMatching), true
+		}
+	}
+	return 0, 0, false
+}
+
+// Vacuity describes a subformula that was satisfied vacuously during a run.
+type Vacuity struct {
+	// Path identifies the vacuous subformula: "" is the root, and "/1/0" is
+	// the first child of the second child of the root.
+	Path string
+	// Subformula is the vacuous subformula, printed inline.
+	Subformula string
+	// Reason explains why the subformula was vacuous.
+	Reason string
+}
+
+func (v Vacuity) String() string {
+	return fmt.Sprintf("%s at '%s': %s", v.Subformula, v.Path, v.Reason)
+}
+
+// Instrument returns an operator tree equivalent to the provided one, whose
+// subformulas record their activity into the returned Activity.  NotFollowedBy
+// subformulas themselves are not instrumented, though their children are.
+func Instrument(op ltl.Operator) (ltl.Operator, *Activity) {
+	a := &Activity{}
+	root, _ := a.instrument(op, "")
+	return root, a
+}
+
+func (a *Activity) instrument(op ltl.Operator, path string) (ltl.Operator, *node) {
+	if op == nil {
+		return nil, nil
+	}
+	n := &node{path: path, op: op}
+	a.nodes = append(a.nodes, n)
+	children := ops.Children(op)
+	if len(children) > 0 {
+		newChildren := make([]ltl.Operator, len(children))
+		for idx, child := range children {
+			var childNode *node
+			newChildren[idx], childNode = a.instrument(child, fmt.Sprintf("%s/%d", path, idx))
+			n.children = append(n.children, childNode)
+		}
+		op = ops.WithChildren(op, newChildren...)
+	}
+	if ops.KindOf(op) == ops.NotFollowedByKind {
+		// Then relies on NotFollowedBy's continuations being unwrapped.
+		return op, n
+	}
+	return &counted{ops.NewUnaryOperator(op), n}, n
+}
+
+// Vacuities returns the subformulas that have been satisfied vacuously so
+// far:
+//
+//   - an IMPLIES that matched, but whose antecedent never matched;
+//   - an OR that matched, but one of whose arguments never matched;
+//   - an UNTIL that matched, but whose left argument never matched; and
+//   - a RELEASE that matched, but whose left argument never matched, so that
+//     it acted as a GLOBALLY.
+func (a *Activity) Vacuities() []Vacuity {
+	var ret []Vacuity
+	never := func(n *node) bool {
+		return n != nil && atomic.LoadInt64(&n.matched) == 0
+	}
+	for _, n := range a.nodes {
+		if atomic.LoadInt64(&n.matched) == 0 || len(n.children) != 2 {
+			continue
+		}
+		var reason string
+		switch ops.KindOf(n.op) {
+		case ops.ImpliesKind:
+			if never(n.children[0]) {
+				reason = "antecedent never matched"
+			}
+		case ops.OrKind:
+			for idx, child := range n.children {
+				if never(child) {
+					reason = fmt.Sprintf("argument %d never matched", idx)
+				}
+			}
+		case ops.UntilKind:
+			if never(n.children[0]) {
+				reason = "left argument never matched"
+			}
+		case ops.ReleaseKind:
+			if never(n.children[0]) {
+				reason = "left argument never matched"
+			}
+		}
+		if reason != "" {
+			ret = append(ret, Vacuity{n.path, ops.PrettyPrint(n.op, ops.Inline()), reason})
+		}
+	}
+	return ret
+}
+
+// counted records the Environments returned by its child, and by its child's
+// continuations, into a node.
+type counted struct {
+	ops.UnaryOperator
+	n *node
+}
+
+func (c *counted) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	op, env := c.Child.Match(tok)
+	if env.Matching() {
+		atomic.AddInt64(&c.n.matched, 1)
+	} else {
+		atomic.AddInt64(&c.n.notMatching, 1)
+	}
+	if op == nil {
+		return nil, env
+	}
+	return &counted{ops.NewUnaryOperator(op), c.n}, env
+}
+
+func (c *counted) String() string {
+	return fmt.Sprintf("COUNTED(%s)", c.n.path)
+}
+
+// Clone implements ltl.Cloner.  Clones count into the receiver's node.
+func (c *counted) Clone() (ltl.Operator, bool) {
+	child, copied := ltl.Clone(c.Child)
+	if !copied {
+		return c, false
+	}
+	return &counted{ops.NewUnaryOperator(child), c.n}, true
+}
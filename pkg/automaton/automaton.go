@@ -0,0 +1,232 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package automaton compiles binding-free operator trees into deterministic
+// automata.
+//
+// The leaves of a compiled tree (matchers, predicates, and the like) are
+// treated as atomic propositions: on each Token, every leaf is evaluated once,
+// producing a bitset of the propositions that hold.  The automaton's
+// transition on that bitset is then looked up in a table.  Transitions are
+// computed lazily, by interpreting the operator tree with its leaves replaced
+// by propositions, and are shared by all instances of the automaton, so once
+// warmed up, matching involves no operator tree allocations.
+//
+// Leaves must be binding-free, single-Token Operators: on each Token, they
+// must resolve with a Reducible Environment.  A leaf violating this produces
+// an Erroring Environment at match time.
+package automaton
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ilhamster/ltl/pkg/internal/atoms"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	ops "github.com/ilhamster/ltl/pkg/operators"
+	"sync"
+)
+
+// MaxAtoms is the maximum number of leaves a compiled operator tree may have.
+const MaxAtoms = 64
+
+// transition is an automaton transition.  A nil next state indicates that the
+// automaton has terminated.
+type transition struct {
+	next *state
+	env  ltl.Environment
+}
+
+type state struct {
+	op    ltl.Operator
+	trans map[atoms.Token]transition
+	eoi   *transition
+	// inst is the automaton instance in this state.  Instances are immutable,
+	// so one suffices.
+	inst *compiled
+}
+
+type automaton struct {
+	mu     sync.Mutex
+	leaves []ltl.Operator
+	states map[string]*state
+}
+
+// Compile returns an Operator equivalent to the provided one, implemented as
+// a lazily-constructed deterministic automaton.  It returns an error if the
+// operator tree contains Operators whose state cannot be captured by the
+// automaton, such as bindings or real-time bounds, or if it has more than
+// MaxAtoms leaves.
+func Compile(op ltl.Operator) (ltl.Operator, error) {
+	if op == nil {
+		return nil, errors.New("cannot compile a nil Operator")
+	}
+	az := atoms.NewAtomizer("compile", MaxAtoms)
+	atomized, err := az.Atomize(op)
+	if err != nil {
+		return nil, err
+	}
+	a := &automaton{leaves: az.Leaves(), states: map[string]*state{}}
+	return a.intern(atomized).inst, nil
+}
+
+// intern returns the state for the provided atomized operator, creating it if
+// necessary.  States are identified by the printed form of their normalized
+// Operators.  The caller must hold a.mu, or have exclusive access to a.
+func (a *automaton) intern(op ltl.Operator) *state {
+	if op == nil {
+		return nil
+	}
+	op = normalize(op)
+	key := ops.PrettyPrint(op, ops.Inline())
+	if s, ok := a.states[key]; ok {
+		return s
+	}
+	s := &state{op: op, trans: map[atoms.Token]transition{}}
+	s.inst = &compiled{a, s}
+	a.states[key] = s
+	return s
+}
+
+// normalize returns a canonical form of op, with duplicate operands of ANDs
+// and ORs removed.  Without this, operators like Eventually would accumulate
+// identical pending instances, and the automaton would grow without bound.
+func normalize(op ltl.Operator) ltl.Operator {
+	return dedupe(ops.Canonicalize(op))
+}
+
+func dedupe(op ltl.Operator) ltl.Operator {
+	children := ops.Children(op)
+	if len(children) == 0 {
+		return op
+	}
+	kind := ops.KindOf(op)
+	if kind != ops.AndKind && kind != ops.OrKind {
+		newChildren := make([]ltl.Operator, len(children))
+		for idx, child := range children {
+			newChildren[idx] = dedupe(child)
+		}
+		return ops.WithChildren(op, newChildren...)
+	}
+	combine := ops.And
+	if kind == ops.OrKind {
+		combine = ops.Or
+	}
+	// Canonical chains are left-nested, with sorted operands.
+	var operands []ltl.Operator
+	for ops.KindOf(op) == kind {
+		children := ops.Children(op)
+		operands = append(operands, dedupe(children[1]))
+		op = children[0]
+	}
+	operands = append(operands, dedupe(op))
+	var ret ltl.Operator
+	lastKey := ""
+	for idx := len(operands) - 1; idx >= 0; idx-- {
+		key := ops.PrettyPrint(operands[idx], ops.Inline())
+		if ret != nil && key == lastKey {
+			continue
+		}
+		ret, lastKey = combine(ret, operands[idx]), key
+	}
+	return ret
+}
+
+// atoms evaluates the automaton's leaves against tok.
+func (a *automaton) atoms(tok ltl.Token) (atoms.Token, ltl.Environment) {
+	var at atoms.Token
+	for idx, leaf := range a.leaves {
+		op, env := leaf.Match(tok)
+		if ltl.IsErroring(env) {
+			return 0, env
+		}
+		if op != nil {
+			return 0, ltl.ErrEnv(fmt.Errorf("leaf %s accepts multiple tokens", leaf))
+		}
+		if !env.Reducible() {
+			return 0, ltl.ErrEnv(fmt.Errorf("leaf %s returned an irreducible environment", leaf))
+		}
+		if env.Matching() {
+			at |= 1 << uint(idx)
+		}
+	}
+	return at, nil
+}
+
+// step returns the transition from s on at, computing it if necessary.
+func (a *automaton) step(s *state, at atoms.Token) transition {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if t, ok := s.trans[at]; ok {
+		return t
+	}
+	op, env := s.op.Match(at)
+	t := transition{a.intern(op), env}
+	s.trans[at] = t
+	return t
+}
+
+// finish returns the Environment of s at the end of input.
+func (a *automaton) finish(s *state) ltl.Environment {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if s.eoi == nil {
+		_, env := s.op.Match(ltl.EOIToken{})
+		s.eoi = &transition{nil, env}
+	}
+	return s.eoi.env
+}
+
+// size returns the number of states the automaton has constructed so far.
+func (a *automaton) size() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.states)
+}
+
+// compiled is an instance of an automaton, in a particular state.
+type compiled struct {
+	a *automaton
+	s *state
+}
+
+func (c *compiled) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	if tok.EOI() {
+		return nil, c.a.finish(c.s)
+	}
+	at, errEnv := c.a.atoms(tok)
+	if errEnv != nil {
+		return nil, errEnv
+	}
+	t := c.a.step(c.s, at)
+	if t.next == nil {
+		return nil, t.env
+	}
+	return t.next.inst, t.env
+}
+
+func (c *compiled) String() string {
+	return fmt.Sprintf("AUTOMATON(%s)", ops.PrettyPrint(c.s.op, ops.Inline()))
+}
+
+// Clone implements ltl.Cloner.  An automaton's states are built lazily, but
+// safely for concurrent use, so instances need no copying.
+func (c *compiled) Clone() (ltl.Operator, bool) {
+	return c, false
+}
+
+// Reducible returns true for all compiled automata, since they only produce
+// Reducible Environments.
+func (c *compiled) Reducible() bool {
+	return true
+}
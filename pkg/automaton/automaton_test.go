@@ -0,0 +1,171 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package automaton
+
+import (
+	"bufio"
+	rtok "github.com/ilhamster/ltl/examples/runetoken"
+	smatch "github.com/ilhamster/ltl/examples/stringmatcher"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	ops "github.com/ilhamster/ltl/pkg/operators"
+	"github.com/ilhamster/ltl/pkg/parser"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func parse(t testing.TB, s string) ltl.Operator {
+	t.Helper()
+	l, err := parser.NewLexer(parser.DefaultTokens, smatch.Generator(),
+		bufio.NewReader(strings.NewReader(s)))
+	if err != nil {
+		t.Fatalf("Failed to create lexer: %s", err)
+	}
+	op, err := parser.ParseLTL(l)
+	if err != nil {
+		t.Fatalf("Failed to parse '%s': %s", s, err)
+	}
+	return op
+}
+
+// run applies input to op and returns the matching state after each Token,
+// and at the end of input.
+func run(t *testing.T, op ltl.Operator, input string) []bool {
+	t.Helper()
+	var ret []bool
+	var env ltl.Environment
+	for idx, ch := range input {
+		op, env = ltl.Match(op, rtok.New(ch, idx))
+		if ltl.IsErroring(env) {
+			t.Fatalf("Unexpected error: %s", env.Err())
+		}
+		ret = append(ret, env.Matching())
+	}
+	return append(ret, ltl.Finish(op).Matching())
+}
+
+func TestCompiledEquivalence(t *testing.T) {
+	exprs := []string{
+		"[a]",
+		"[a] THEN [b]",
+		"NOT [a] AND NEXT [b]",
+		"EVENTUALLY [a]",
+		"EVENTUALLY ([a] THEN [b] THEN [a])",
+		"GLOBALLY ([a] OR [b])",
+		"[a] UNTIL [b]",
+		"([a] OR [b]) RELEASE ([b] OR [c])",
+		"(EVENTUALLY [c]) LIMIT 3",
+		"EVENTUALLY ([a] THEN EVENTUALLY [c])",
+		"GLOBALLY ([a] THEN EVENTUALLY [b])",
+	}
+	rng := rand.New(rand.NewSource(1))
+	var inputs []string
+	for i := 0; i < 100; i++ {
+		var sb strings.Builder
+		for j := rng.Intn(12); j > 0; j-- {
+			sb.WriteByte("abc"[rng.Intn(3)])
+		}
+		inputs = append(inputs, sb.String())
+	}
+	for _, expr := range exprs {
+		t.Run(expr, func(t *testing.T) {
+			compiled, err := Compile(parse(t, expr))
+			if err != nil {
+				t.Fatalf("Failed to compile: %s", err)
+			}
+			for _, input := range inputs {
+				want, got := run(t, parse(t, expr), input), run(t, compiled, input)
+				for idx := range want {
+					if want[idx] != got[idx] {
+						t.Fatalf("On input '%s', interpreted %v, compiled %v", input, want, got)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCompiledStatesAreBounded(t *testing.T) {
+	op, err := Compile(parse(t, "EVENTUALLY ([a] THEN [a] THEN [b])"))
+	if err != nil {
+		t.Fatalf("Failed to compile: %s", err)
+	}
+	run(t, op, strings.Repeat("aaab", 100))
+	if size := op.(*compiled).a.size(); size > 10 {
+		t.Errorf("Automaton has %d states, wanted at most 10", size)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, op := range []ltl.Operator{
+		nil,
+		ops.NotFollowedBy(smatch.New("a"), smatch.New("b")),
+		ops.Eventually(ops.RecentGlobally(2, smatch.New("a"))),
+	} {
+		if _, err := Compile(op); err == nil {
+			t.Errorf("Compile(%s) succeeded, wanted an error", ops.PrettyPrint(op, ops.Inline()))
+		}
+	}
+	for _, test := range []struct {
+		op    ltl.Operator
+		input string
+	}{
+		// Multi-token leaves are not supported.
+		{parse(t, "EVENTUALLY [ab]"), "ab"},
+		// Neither are bindings.
+		{parse(t, "[$a<-] THEN [$a]"), "aa"},
+	} {
+		op, err := Compile(test.op)
+		if err != nil {
+			t.Fatalf("Failed to compile: %s", err)
+		}
+		var env ltl.Environment
+		for idx, ch := range test.input {
+			if op, env = ltl.Match(op, rtok.New(ch, idx)); op == nil {
+				break
+			}
+		}
+		if !ltl.IsErroring(env) {
+			t.Errorf("Expected an error running %s", ops.PrettyPrint(test.op, ops.Inline()))
+		}
+	}
+}
+
+func benchmarkStream(b *testing.B, op ltl.Operator) {
+	input := strings.Repeat("abacacbcdacadadbddcbabbdabcdadbabcbcaadbcab", 10)
+	for i := 0; i < b.N; i++ {
+		cur := op
+		for idx, ch := range input {
+			cur, _ = ltl.Match(cur, rtok.New(ch, idx))
+			if cur == nil {
+				cur = op
+			}
+		}
+	}
+}
+
+const benchExpr = "GLOBALLY ([a] THEN EVENTUALLY ([b] THEN [c]))"
+
+func BenchmarkInterpreted(b *testing.B) {
+	benchmarkStream(b, parse(b, benchExpr))
+}
+
+func BenchmarkCompiled(b *testing.B) {
+	op, err := Compile(parse(b, benchExpr))
+	if err != nil {
+		b.Fatalf("Failed to compile: %s", err)
+	}
+	benchmarkStream(b, op)
+}
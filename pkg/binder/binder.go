@@ -21,17 +21,37 @@ import (
 	be "github.com/ilhamster/ltl/pkg/bindingenvironment"
 	"github.com/ilhamster/ltl/pkg/bindings"
 	"github.com/ilhamster/ltl/pkg/ltl"
+	"regexp"
+	"strconv"
+	"strings"
 )
 
 // extractFunc extracts the bindings and tags from a token.
 type extractFunc func(name string, tok ltl.Token) (*bindings.Bindings, error)
 
+// extractAllFunc extracts the bindings for several names at once from a
+// token.
+type extractAllFunc func(names []string, tok ltl.Token) (*bindings.Bindings, error)
+
 // Binder is an Operator capable of binding values from tokens.  A bound value
-// satisfies other bound and referenced instances of the same value.
+// satisfies other bound and referenced instances of the same value.  A
+// rebinding Binder's value instead overwrites any value previously bound to
+// the same name.  A constrained Binder only binds values matching its regular
+// expression.  A Binder from Builder.BindAll binds several names at once.  A
+// guarded Binder, from Builder.BindIf, only binds where its guard matches.
 type Binder struct {
 	name         string
+	names        []string
+	sigil        string
 	capture      bool
+	rebind       bool
+	cmp          bindings.Comparison
+	offset       int
+	re           *regexp.Regexp
+	policy       bindings.MergePolicy
+	guard        ltl.Operator
 	extractToken extractFunc
+	extractAll   extractAllFunc
 }
 
 // Match performs an LTL match on the receiving Binder.
@@ -39,22 +59,99 @@ func (b *Binder) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
 	if tok.EOI() {
 		return nil, be.New(be.Matching(false))
 	}
-	bs, err := b.extractToken(b.name, tok)
+	var guardEnv ltl.Environment
+	if b.guard != nil {
+		// A guard that does not match this token leaves nothing to bind.
+		if _, guardEnv = ltl.Match(b.guard, tok); guardEnv.Err() != nil || !guardEnv.Matching() {
+			return nil, guardEnv
+		}
+	}
+	var bs *bindings.Bindings
+	var err error
+	if b.names != nil {
+		bs, err = b.extractAll(b.names, tok)
+	} else {
+		bs, err = b.extractToken(b.name, tok)
+	}
 	if err != nil {
 		return nil, ltl.ErrEnv(err)
 	}
-	if bs == nil {
+	if bs == nil || !b.admits(bs) {
 		return nil, ltl.NotMatching
 	}
+	if b.rebind {
+		bs = bs.Overwriting()
+	}
+	bs = bs.WithPolicy(b.policy)
 	ops := []be.Option{be.Bound(bs)}
 	if b.capture {
 		ops = append(ops, be.Captured(tok))
 	}
+	if guardEnv != nil {
+		return nil, guardEnv.And(be.New(ops...))
+	}
 	return nil, be.New(ops...)
 }
 
+// admits returns true if the receiver may bind all the provided Bindings'
+// values.
+func (b *Binder) admits(bs *bindings.Bindings) bool {
+	if b.re == nil {
+		return true
+	}
+	for _, bv := range bs.Values() {
+		var s string
+		switch v := bv.(type) {
+		case *bindings.BoundString:
+			s = v.Value()
+		case *bindings.BoundInt:
+			s = strconv.Itoa(v.Value())
+		default:
+			return false
+		}
+		if !b.re.MatchString(s) {
+			return false
+		}
+	}
+	return true
+}
+
+// Constrained returns a copy of the receiver that only binds values matching
+// the provided regular expression, not matching Tokens with other values.
+// Only string and integer values, the latter in decimal, may match.
+func (b *Binder) Constrained(re *regexp.Regexp) *Binder {
+	ret := *b
+	ret.re = re
+	return &ret
+}
+
+// Names returns the names the receiver binds.
+func (b *Binder) Names() []string {
+	if b.names != nil {
+		return b.names
+	}
+	return []string{b.name}
+}
+
 func (b *Binder) String() string {
-	return fmt.Sprintf("[$%s<-]", b.name)
+	arrow := "<-"
+	if b.rebind {
+		arrow = "<<-"
+	}
+	names := b.sigil + strings.Join(b.Names(), ", "+b.sigil)
+	ret := fmt.Sprintf("[%s%s]", names, arrow)
+	if b.re != nil {
+		ret = fmt.Sprintf("[%s%s/%s/]", names, arrow, b.re)
+	}
+	if b.guard != nil {
+		return fmt.Sprintf("%s IF %s", ret, b.guard)
+	}
+	return ret
+}
+
+// Guard returns the guard of the receiver, or nil if it is not guarded.
+func (b *Binder) Guard() ltl.Operator {
+	return b.guard
 }
 
 // Reducible returns false for all Binders.
@@ -63,7 +160,9 @@ func (b *Binder) Reducible() bool {
 }
 
 // Referencer is an Operator capable of referencing values from tokens.  A
-// referenced value is satisfied by a bound instance of the same value.
+// referenced value is satisfied by a bound instance of the same value, or, for
+// a comparing Referencer, of a value to which it compares as specified.  An
+// offset Referencer's value must instead be offset from the bound value.
 type Referencer Binder
 
 // Match performs an LTL match on the receiving Referencer.
@@ -78,7 +177,12 @@ func (r *Referencer) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
 	if bs == nil {
 		return nil, ltl.NotMatching
 	}
-	ops := []be.Option{be.Referenced(bs)}
+	if bs, err = bs.Offset(-r.offset); err != nil {
+		// Like a reference of the wrong type, a value that cannot be offset
+		// can never be satisfied.
+		return nil, ltl.NotMatching
+	}
+	ops := []be.Option{be.Referenced(bs.Comparing(r.cmp))}
 	if r.capture {
 		ops = append(ops, be.Captured(tok))
 	}
@@ -86,7 +190,13 @@ func (r *Referencer) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
 }
 
 func (r *Referencer) String() string {
-	return fmt.Sprintf("[$%s]", r.name)
+	if r.offset != 0 {
+		return fmt.Sprintf("[%s%s%+d]", r.sigil, r.name, r.offset)
+	}
+	if r.cmp != bindings.Equal {
+		return fmt.Sprintf("[%s%s%s]", r.sigil, r.name, r.cmp)
+	}
+	return fmt.Sprintf("[%s%s]", r.sigil, r.name)
 }
 
 // Reducible returns false for all Referencers.
@@ -94,10 +204,34 @@ func (r *Referencer) Reducible() bool {
 	return false
 }
 
+// Clone implements ltl.Cloner, cloning the receiver's guard.
+func (b *Binder) Clone() (ltl.Operator, bool) {
+	guard, copied := ltl.Clone(b.guard)
+	if !copied {
+		return b, false
+	}
+	ret := *b
+	ret.guard = guard
+	return &ret, true
+}
+
+// Clone implements ltl.Cloner, cloning the receiver's guard.
+func (r *Referencer) Clone() (ltl.Operator, bool) {
+	op, copied := (*Binder)(r).Clone()
+	if !copied {
+		return r, false
+	}
+	return (*Referencer)(op.(*Binder)), true
+}
+
 // Builder provides methods to generate binding and referencing Operators.
 type Builder struct {
 	extractToken extractFunc
-	capture      bool
+	extractAll   extractAllFunc
+	// sigil prefixes the names of the generated Operators in their Strings.
+	sigil   string
+	capture bool
+	policy  bindings.MergePolicy
 }
 
 // NewBuilder returns a Builder that uses the provided extraction function to
@@ -105,20 +239,123 @@ type Builder struct {
 func NewBuilder(capture bool, extractToken func(name string, tok ltl.Token) (*bindings.Bindings, error)) *Builder {
 	return &Builder{
 		extractToken: extractToken,
+		sigil:        "$",
+		capture:      capture,
+	}
+}
+
+// NewPositionBuilder returns a Builder whose Operators bind and reference the
+// positions of Tokens in their stream, rather than their values, as BoundInts.
+// Tokens must have an Index() method, as runetoken.RuneTokens do.  Since
+// positions can be offset and compared, this allows constraints such as 'two
+// tokens after the bound event'.  The names of its Operators are written with
+// an '@', as in '[@p<-]', though they share the names of other bindings.
+func NewPositionBuilder(capture bool) *Builder {
+	return &Builder{
+		extractToken: extractPosition,
+		sigil:        "@",
 		capture:      capture,
 	}
 }
 
+// extractPosition binds the provided name to the position of the provided
+// Token.
+func extractPosition(name string, tok ltl.Token) (*bindings.Bindings, error) {
+	it, ok := tok.(interface{ Index() int })
+	if !ok {
+		return nil, ltl.NewTokenTypeError(tok, "a Token with an Index")
+	}
+	return bindings.New(bindings.Int(name, it.Index()))
+}
+
+// WithPolicy returns a copy of the receiver whose binding Operators bind
+// values resolved by the provided MergePolicy, rather than erroring, when they
+// conflict with other values bound to the same name.  This allows a whole
+// formula to, for instance, keep the first value bound to each name.
+func (bb *Builder) WithPolicy(policy bindings.MergePolicy) *Builder {
+	ret := *bb
+	ret.policy = policy
+	return &ret
+}
+
+// WithExtractAll returns a copy of the receiver whose BindAll Operators use
+// the provided extraction function, which extracts the bindings for several
+// names at once, rather than applying the receiver's extraction function once
+// per name.
+func (bb *Builder) WithExtractAll(extractAll func(names []string, tok ltl.Token) (*bindings.Bindings, error)) *Builder {
+	ret := *bb
+	ret.extractAll = extractAll
+	return &ret
+}
+
 // Bind returns an Operator which, on Match, applies the receiver's extraction
 // function to the Token to extract its bindings, returning a matching
 // Environment with those bindings.
 func (bb *Builder) Bind(name string) *Binder {
-	return &Binder{name: name, capture: bb.capture, extractToken: bb.extractToken}
+	return &Binder{name: name, sigil: bb.sigil, capture: bb.capture, policy: bb.policy, extractToken: bb.extractToken}
+}
+
+// BindAll returns an Operator like Bind, but binding all the provided names
+// from each Token at once.  If the receiver has an extraction function for
+// several names (see WithExtractAll), it is applied once per Token; otherwise,
+// the receiver's extraction function is applied for each name.
+func (bb *Builder) BindAll(names ...string) *Binder {
+	extractAll := bb.extractAll
+	if extractAll == nil {
+		extractAll = func(names []string, tok ltl.Token) (*bindings.Bindings, error) {
+			var ret *bindings.Bindings
+			for _, name := range names {
+				bs, err := bb.extractToken(name, tok)
+				if err != nil || bs == nil {
+					return nil, err
+				}
+				if ret, err = ret.Combine(bs); err != nil {
+					return nil, err
+				}
+			}
+			return ret, nil
+		}
+	}
+	return &Binder{names: append([]string{}, names...), sigil: bb.sigil, capture: bb.capture, policy: bb.policy, extractToken: bb.extractToken, extractAll: extractAll}
+}
+
+// BindIf returns an Operator like Bind, but which only extracts and binds a
+// Token's value if the provided guard Operator matches that same Token;
+// otherwise, it yields the guard's Environment.  Unlike the AND of a guard and
+// a binder, the value of a Token failing the guard is never extracted.  Only
+// the guard's Environment for the first Token it is given is considered.
+func (bb *Builder) BindIf(name string, guard ltl.Operator) *Binder {
+	ret := bb.Bind(name)
+	ret.guard = guard
+	return ret
+}
+
+// Rebind returns an Operator like Bind, but whose bindings overwrite any
+// value previously bound to the same name, rather than conflicting with it.
+func (bb *Builder) Rebind(name string) *Binder {
+	return &Binder{name: name, sigil: bb.sigil, capture: bb.capture, rebind: true, policy: bb.policy, extractToken: bb.extractToken}
 }
 
 // Reference returns an Operator which, on Match, applies the receiver's
 // extraction function to the Token to extract its bindings, returning a
 // non-matching Environment with those, and referencing those bindings.
 func (bb *Builder) Reference(name string) *Referencer {
-	return &Referencer{name: name, capture: bb.capture, extractToken: bb.extractToken}
+	return &Referencer{name: name, sigil: bb.sigil, capture: bb.capture, extractToken: bb.extractToken}
+}
+
+// Compare returns an Operator like Reference, but whose references are
+// satisfied by bound values to which the Token's extracted value compares as
+// the provided Comparison specifies.  For instance, with bindings.Greater, a
+// Token is matched if its value is greater than the value bound to name.
+func (bb *Builder) Compare(name string, cmp bindings.Comparison) *Referencer {
+	return &Referencer{name: name, sigil: bb.sigil, capture: bb.capture, cmp: cmp, extractToken: bb.extractToken}
+}
+
+// Offset returns an Operator like Reference, but whose references are
+// satisfied by bound values offset from the Token's extracted value by the
+// provided amount: for instance, with an offset of 1, a Token is matched if
+// its value is one greater than the value bound to name.  Only BoundInts may
+// be offset; Tokens with other extracted values are not matched.
+func (bb *Builder) Offset(name string, offset int) *Referencer {
+	return &Referencer{name: name, sigil: bb.sigil, capture: bb.capture, offset: offset, extractToken: bb.extractToken}
 }
@@ -0,0 +1,173 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bindingenvironment
+
+import (
+	"github.com/ilhamster/ltl/pkg/ltl"
+	"sync"
+)
+
+// An Arena's first slab of each node type holds minSlabSize nodes; each
+// subsequent slab is twice the size of the last, up to maxSlabSize, so that
+// Arenas used by short-lived instances stay small.
+const (
+	minSlabSize = 8
+	maxSlabSize = 512
+)
+
+// Arena allocates binding Environment nodes in slabs, rather than one at a
+// time, reducing the number of objects the garbage collector must track when
+// a formula builds many short-lived Environments, as binding-heavy formulas
+// do.  Nodes built by ANDing, ORing, or negating Environments allocated by an
+// Arena are allocated by the same Arena, so an Arena need only be seeded, with
+// Adopt, with the Environments produced by a formula's terminals; see
+// operators.WithArena.  An Arena is meant to be scoped to a single instance of
+// a formula, and released with Release when that instance resolves.  It is
+// safe for concurrent use.  A nil *Arena allocates each node separately.
+//
+// Since a slab is reclaimed only once none of its nodes is referenced,
+// retaining an Environment allocated by an Arena, such as that of a reported
+// match, may retain up to a slab of other nodes with it.
+type Arena struct {
+	mu           sync.Mutex
+	released     bool
+	bindingNodes []BindingNode
+	binaryNodes  []binaryNode
+	// bindingSlabSize and binarySlabSize are the sizes of the most recent
+	// slabs of each type.
+	bindingSlabSize, binarySlabSize int
+}
+
+// NewArena returns a new, empty Arena.
+func NewArena() *Arena {
+	return &Arena{}
+}
+
+// Release releases the receiver's slabs.  Nodes it has already allocated
+// remain valid, and each slab is reclaimed by the garbage collector once none
+// of its nodes is referenced; nodes the receiver would subsequently allocate
+// are instead allocated separately.
+func (a *Arena) Release() {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.released = true
+	a.bindingNodes, a.binaryNodes = nil, nil
+}
+
+// Adopt returns an Environment equivalent to the provided one, but whose
+// subsequent combinations are allocated by the receiver.  Environments other
+// than binding Environments, and those already allocated by an Arena, are
+// returned unchanged.
+func (a *Arena) Adopt(env ltl.Environment) ltl.Environment {
+	if a == nil {
+		return env
+	}
+	switch e := env.(type) {
+	case *BindingNode:
+		if e.arena == nil {
+			return a.newBindingNode(*e)
+		}
+	case *binaryNode:
+		if e.arena == nil {
+			return a.newBinaryNode(*e)
+		}
+	}
+	return env
+}
+
+// newBindingNode returns a copy of the provided BindingNode allocated by the
+// receiver.
+func (a *Arena) newBindingNode(bn BindingNode) *BindingNode {
+	bn.arena = a
+	if a == nil {
+		ret := new(BindingNode)
+		*ret = bn
+		return ret
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.released {
+		ret := new(BindingNode)
+		*ret = bn
+		return ret
+	}
+	if len(a.bindingNodes) == 0 {
+		a.bindingSlabSize = nextSlabSize(a.bindingSlabSize)
+		a.bindingNodes = make([]BindingNode, a.bindingSlabSize)
+	}
+	ret := &a.bindingNodes[0]
+	a.bindingNodes = a.bindingNodes[1:]
+	*ret = bn
+	return ret
+}
+
+// newBinaryNode returns a copy of the provided binaryNode allocated by the
+// receiver.
+func (a *Arena) newBinaryNode(bn binaryNode) *binaryNode {
+	bn.arena = a
+	if a == nil {
+		ret := new(binaryNode)
+		*ret = bn
+		return ret
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.released {
+		ret := new(binaryNode)
+		*ret = bn
+		return ret
+	}
+	if len(a.binaryNodes) == 0 {
+		a.binarySlabSize = nextSlabSize(a.binarySlabSize)
+		a.binaryNodes = make([]binaryNode, a.binarySlabSize)
+	}
+	ret := &a.binaryNodes[0]
+	a.binaryNodes = a.binaryNodes[1:]
+	*ret = bn
+	return ret
+}
+
+// nextSlabSize returns the size of the slab to follow one of the provided
+// size, or of the first slab if it is zero.
+func nextSlabSize(size int) int {
+	switch {
+	case size == 0:
+		return minSlabSize
+	case size >= maxSlabSize:
+		return maxSlabSize
+	}
+	return 2 * size
+}
+
+// arenaOf returns the Arena that allocated the first of the provided
+// Environments allocated by one, or nil if none was.
+func arenaOf(envs ...ltl.Environment) *Arena {
+	for _, env := range envs {
+		switch e := env.(type) {
+		case *BindingNode:
+			if e.arena != nil {
+				return e.arena
+			}
+		case *binaryNode:
+			if e.arena != nil {
+				return e.arena
+			}
+		}
+	}
+	return nil
+}
@@ -19,7 +19,7 @@ import (
 	"github.com/ilhamster/ltl/pkg/bindings"
 	"github.com/ilhamster/ltl/pkg/captures"
 	"github.com/ilhamster/ltl/pkg/ltl"
-	"sort"
+	"github.com/ilhamster/ltl/pkg/tags"
 	"strings"
 )
 
@@ -36,6 +36,11 @@ type binaryNode struct {
 	hasRefs     bool
 	matching    bool
 	t           nodeType
+	// nodes and depth measure the tree rooted at the node.
+	nodes, depth int
+	// arena, if non-nil, allocated the node, and allocates nodes derived from
+	// it.
+	arena *Arena
 }
 
 func (bn *binaryNode) String() string {
@@ -47,16 +52,14 @@ func (bn *binaryNode) String() string {
 		ret = "BE_AND"
 	}
 	capStrs := []string{}
-	caps := bn.captures().Get(bn.matching)
-	if caps != nil {
-		for cap := range caps {
-			capStrs = append(capStrs, cap.String())
-		}
-		sort.Slice(capStrs, func(a, b int) bool {
-			return capStrs[a] < capStrs[b]
-		})
+	for _, cap := range bn.captures().Ordered(bn.matching) {
+		capStrs = append(capStrs, cap.String())
+	}
+	refStr := ""
+	if pending := bn.pendingReferences(); pending.Length() > 0 {
+		refStr = fmt.Sprintf(", REF(%s)", pending)
 	}
-	return ret + fmt.Sprintf("(r:%t\n    | M%t/%s,\n     |C[%s] | %s,\n    | %s)", bn.hasRefs, bn.Matching(), bn.bound, strings.Join(capStrs, ", "), bn.left, bn.right)
+	return ret + fmt.Sprintf("(r:%t%s\n    | M%t/%s,\n     |C[%s] | %s,\n    | %s)", bn.hasRefs, refStr, bn.Matching(), bn.bound, strings.Join(capStrs, ", "), bn.left, bn.right)
 }
 
 // And returns the AND of the receiver and argument.
@@ -106,6 +109,10 @@ func (bn *binaryNode) captures() *captures.Captures {
 	return Captures(bn.left).Union(Captures(bn.right))
 }
 
+func (bn *binaryNode) tagged() *tags.Tags {
+	return Tags(bn.left).Union(Tags(bn.right))
+}
+
 func (bn *binaryNode) bindings() *bindings.Bindings {
 	return bn.bound
 }
@@ -114,6 +121,27 @@ func (bn *binaryNode) hasReferences() bool {
 	return bn.hasRefs
 }
 
+func (bn *binaryNode) pendingReferences() *bindings.Bindings {
+	if !bn.hasRefs {
+		return nil
+	}
+	left, right := PendingReferences(bn.left), PendingReferences(bn.right)
+	if ret, err := left.Combine(right); err == nil {
+		return ret
+	}
+	// The branches reference some name with different values; keep the left
+	// branch's.
+	keys := left.Keys()
+	bvs := append([]bindings.BoundValue{}, left.Values()...)
+	for _, bv := range right.Values() {
+		if _, ok := keys[bv.Key()]; !ok {
+			bvs = append(bvs, bv)
+		}
+	}
+	ret, _ := bindings.New(bvs...)
+	return ret
+}
+
 func (bn *binaryNode) applyBindings(b *bindings.Bindings) ltl.Environment {
 	switch bn.t {
 	case orNode:
@@ -124,6 +152,16 @@ func (bn *binaryNode) applyBindings(b *bindings.Bindings) ltl.Environment {
 	return ltl.ErrEnv(fmt.Errorf("unknown binaryNode type %v", bn.t))
 }
 
+func (bn *binaryNode) scope(keys []string) ltl.Environment {
+	switch bn.t {
+	case orNode:
+		return or(Scope(bn.left, keys...), Scope(bn.right, keys...))
+	case andNode:
+		return and(Scope(bn.left, keys...), Scope(bn.right, keys...))
+	}
+	return ltl.ErrEnv(fmt.Errorf("unknown binaryNode type %v", bn.t))
+}
+
 // merge attempts to merge the receiver and argument into a new
 // bindingEnvironment, simplifying the Environment.  Two nodes may be merged
 // iff:
@@ -155,14 +193,38 @@ func (bn *binaryNode) merge(oe ltl.Environment) (bindingEnvironment, bool) {
 			return nil, false
 		}
 	}
-	return &binaryNode{
+	return sized(arenaOf(bn, obn).newBinaryNode(binaryNode{
 		bound:    bn.bound,
 		left:     newL,
 		right:    newR,
 		hasRefs:  bn.hasRefs,
 		matching: bn.matching,
 		t:        bn.t,
-	}, true
+	})), true
+}
+
+// EnvEq returns true if the argument is a binaryNode of the same type,
+// matching status, reference-holding status, and bindings as the receiver,
+// whose children are pairwise equivalent to the receiver's, in either order.
+func (bn *binaryNode) EnvEq(oe ltl.Environment) bool {
+	obn, ok := oe.(*binaryNode)
+	if !ok ||
+		bn.t != obn.t ||
+		bn.matching != obn.matching ||
+		bn.hasRefs != obn.hasRefs ||
+		!bn.bound.Eq(obn.bound) {
+		return false
+	}
+	return (ltl.EnvEq(bn.left, obn.left) && ltl.EnvEq(bn.right, obn.right)) ||
+		(ltl.EnvEq(bn.left, obn.right) && ltl.EnvEq(bn.right, obn.left))
+}
+
+// keepsState returns true if the provided Environment must be the receiver
+// when combined, to keep its state.
+func keepsState(env ltl.Environment) bool {
+	_, ok := ltl.PayloadOf(env)
+	_, limited := ltl.LimitedEnvironment(env)
+	return ok || limited || ltl.IsUnknown(env)
 }
 
 // and builds and returns a new andNode representing the AND of its two
@@ -173,6 +235,14 @@ func and(left, right ltl.Environment) ltl.Environment {
 	if errEnv := ltl.EitherErroring(left, right); errEnv != nil {
 		return errEnv
 	}
+	// Sideband, Unknown, and wrapping LimitExceeded Environments must be the
+	// receiver, to keep their state.
+	if keepsState(left) {
+		return left.And(right)
+	}
+	if keepsState(right) {
+		return right.And(left)
+	}
 	if red := ltl.Reduce(left, right, true); red != nil {
 		return red
 	}
@@ -190,14 +260,14 @@ func and(left, right ltl.Environment) ltl.Environment {
 	if !hasRefs {
 		matching = left.Matching() && right.Matching()
 	}
-	return &binaryNode{
+	return limited(arenaOf(left, right).newBinaryNode(binaryNode{
 		bound:    newB,
 		left:     left,
 		right:    right,
 		hasRefs:  hasRefs,
 		matching: matching,
 		t:        andNode,
-	}
+	}))
 }
 
 // or builds and returns a new orNode representing the OR of its two arguments.
@@ -208,6 +278,14 @@ func or(left, right ltl.Environment) ltl.Environment {
 	if errEnv := ltl.EitherErroring(left, right); errEnv != nil {
 		return errEnv
 	}
+	// Sideband, Unknown, and wrapping LimitExceeded Environments must be the
+	// receiver, to keep their state.
+	if keepsState(left) {
+		return left.Or(right)
+	}
+	if keepsState(right) {
+		return right.Or(left)
+	}
 	if red := ltl.Reduce(left, right, false); red != nil {
 		return red
 	}
@@ -225,12 +303,12 @@ func or(left, right ltl.Environment) ltl.Environment {
 	if !hasRefs {
 		matching = left.Matching() || right.Matching()
 	}
-	return &binaryNode{
+	return limited(arenaOf(left, right).newBinaryNode(binaryNode{
 		bound:    newB,
 		left:     left,
 		right:    right,
 		hasRefs:  hasRefs,
 		matching: matching,
 		t:        orNode,
-	}
+	}))
 }
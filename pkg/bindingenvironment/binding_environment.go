@@ -20,6 +20,7 @@ import (
     "github.com/ilhamster/ltl/pkg/bindings"
     "github.com/ilhamster/ltl/pkg/captures"
     "github.com/ilhamster/ltl/pkg/ltl"
+    "github.com/ilhamster/ltl/pkg/tags"
 )
 
 // bindingEnvironment describes an Environment capable of binding values to
@@ -27,12 +28,17 @@ import (
 type bindingEnvironment interface {
     ltl.Environment
     captures() *captures.Captures
+    // tagged returns the Tags attached to this bindingEnvironment.
+    tagged() *tags.Tags
     // bindings returns the set of Bindings in this Environment.  Bindings are
     // only provided by matching Environments.
     bindings() *bindings.Bindings
     // hasReference returns true iff this bindingEnvironment contains
     // references, either directly or indirectly.
     hasReferences() bool
+    // pendingReferences returns the references within this bindingEnvironment
+    // that are not yet satisfied.
+    pendingReferences() *bindings.Bindings
     // applyBindings returns a new ltl.Environment resulting from binding the
     // provided Bindings in the receiver.  applyBindings should simplify the
     // tree wherever possible, e.g. by demoting an intermediateNode to a
@@ -47,36 +53,91 @@ type bindingEnvironment interface {
     // are not equivalent, merge returns false, meaning the Environments cannot
     // be merged.
     merge(oe ltl.Environment) (bindingEnvironment, bool)
+    // scope returns a new ltl.Environment with the provided keys neither
+    // bound nor referenced by the receiver.
+    scope(keys []string) ltl.Environment
 }
 
 // Captures returns the set of captured Tokens in the provided Environment, or
-// nil if no tokens are captured.
+// nil if no tokens are captured.  The returned Captures holds both the Tokens
+// captured should the Environment match, and those captured should it not;
+// ANDs and ORs hold the union of their arguments' Captures under each.
 func Captures(env ltl.Environment) *captures.Captures {
-    if be, ok := env.(bindingEnvironment); ok {
+    if be, ok := unwrap(env).(bindingEnvironment); ok {
         return be.captures()
     }
     return nil
 }
 
+// Tags returns the Tags attached to the provided Environment, or nil if it has
+// none.  Like Captures, the returned Tags holds those applying should the
+// Environment match, and those applying should it not.
+func Tags(env ltl.Environment) *tags.Tags {
+    if be, ok := unwrap(env).(bindingEnvironment); ok {
+        return be.tagged()
+    }
+    return nil
+}
+
 // Bindings returns the set of Bindings bound by the provided Environment.  If
 // the provided Environment is not binding, a nil Bindings is returned.
 func Bindings(env ltl.Environment) *bindings.Bindings {
-    if be, ok := env.(bindingEnvironment); ok {
+    if be, ok := unwrap(env).(bindingEnvironment); ok {
         return be.bindings()
     }
     return nil
 }
 
+// PendingReferences returns the referenced names, and the values they must be
+// bound to, that are not yet satisfied within the provided Environment: its
+// matching state remains undetermined until these are bound.  If different
+// branches of the Environment reference the same name with different values,
+// only the leftmost is included.  If the provided Environment is not binding,
+// a nil Bindings is returned.
+func PendingReferences(env ltl.Environment) *bindings.Bindings {
+    if be, ok := unwrap(env).(bindingEnvironment); ok {
+        return be.pendingReferences()
+    }
+    return nil
+}
+
+// Scope returns the provided Environment with the provided keys unbound,
+// confining their bindings to the expression that produced it.  References to
+// those keys still pending within it can no longer be satisfied, so are
+// treated as unsatisfied.  If the provided Environment is not binding, it is
+// returned unchanged.
+func Scope(env ltl.Environment, keys ...string) ltl.Environment {
+    if inner, ok := ltl.LimitedEnvironment(env); ok {
+        return ltl.LimitExceededBy(Scope(inner, keys...))
+    }
+    if be, ok := env.(bindingEnvironment); ok && len(keys) > 0 {
+        return be.scope(keys)
+    }
+    return env
+}
+
 // Helper functions to safely handle Environments that may not be binding.
 
+// unwrap returns the Environment wrapped by a LimitExceeded Environment, or
+// the provided Environment otherwise.
+func unwrap(env ltl.Environment) ltl.Environment {
+    if inner, ok := ltl.LimitedEnvironment(env); ok {
+        return inner
+    }
+    return env
+}
+
 func hasReferences(env ltl.Environment) bool {
-    if be, ok := env.(bindingEnvironment); ok {
+    if be, ok := unwrap(env).(bindingEnvironment); ok {
         return be.hasReferences()
     }
     return false
 }
 
 func applyBindings(b *bindings.Bindings, env ltl.Environment) ltl.Environment {
+    if inner, ok := ltl.LimitedEnvironment(env); ok {
+        return ltl.LimitExceededBy(applyBindings(b, inner))
+    }
     if be, ok := env.(bindingEnvironment); ok {
         return be.applyBindings(b)
     }
@@ -92,6 +153,11 @@ func matchIfSatisfied(env ltl.Environment) bool {
 
 func merge(a, b ltl.Environment) (bindingEnvironment, bool) {
     if be, ok := a.(bindingEnvironment); ok {
+        // Identical Environments, such as those shared by an Interner, merge
+        // into themselves.
+        if a == b {
+            return be, true
+        }
         return be.merge(b)
     }
     return nil, false
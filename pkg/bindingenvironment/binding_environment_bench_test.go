@@ -17,6 +17,7 @@ package bindingenvironment
 import (
 	"fmt"
 	"github.com/ilhamster/ltl/pkg/bindings"
+	"github.com/ilhamster/ltl/pkg/ltl"
 	"testing"
 )
 
@@ -67,3 +68,33 @@ func Benchmark3(b *testing.B) {
 		want(result, bs(bA, bB))
 	}
 }
+
+// benchmarkRefs combines many references, as an instance of a formula
+// referencing bound values might over a stream, with Arenas returned by
+// newArena.
+func benchmarkRefs(b *testing.B, newArena func() *Arena) {
+	refs := make([]ltl.Environment, 100)
+	for n := range refs {
+		refs[n] = New(Referenced(bs(bindings.Int(fmt.Sprintf("k%d", n), n))))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		a := newArena()
+		for _, ref := range refs {
+			env := a.Adopt(refA).And(ref).Or(refB.And(ref)).Not()
+			if env.Matching() {
+				b.Fatalf("%s matched, wanted it pending", env)
+			}
+		}
+		a.Release()
+	}
+}
+
+func BenchmarkRefs(b *testing.B) {
+	benchmarkRefs(b, func() *Arena { return nil })
+}
+
+func BenchmarkRefsInArena(b *testing.B) {
+	benchmarkRefs(b, NewArena)
+}
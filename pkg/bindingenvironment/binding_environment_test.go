@@ -15,9 +15,14 @@
 package bindingenvironment
 
 import (
+	"errors"
 	"fmt"
 	"github.com/ilhamster/ltl/pkg/bindings"
+	"github.com/ilhamster/ltl/pkg/captures"
 	"github.com/ilhamster/ltl/pkg/ltl"
+	"github.com/ilhamster/ltl/pkg/tags"
+	"sort"
+	"strings"
 	"testing"
 )
 
@@ -111,6 +116,75 @@ func TestBindingCombinations(t *testing.T) {
 	}
 }
 
+func TestPendingReferences(t *testing.T) {
+	tests := []struct {
+		env  ltl.Environment
+		want string
+	}{
+		{ltl.Matching, "[]"},
+		{bind("a", "1"), "[]"},
+		{ref("a", "1"), "[a:1]"},
+		{bind("a", "1").And(ref("a", "1")), "[]"},
+		{bind("a", "1").And(ref("a", "1")).And(ref("b", "2")), "[b:2]"},
+		{ref("a", "1").And(ref("b", "2")), "[a:1, b:2]"},
+		{ref("a", "1").Or(ref("a", "2")), "[a:1]"},
+		{bind("b", "2").And(ref("a", "1").Or(ref("b", "2"))), "[a:1]"},
+	}
+	for idx, test := range tests {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			if got := PendingReferences(test.env).String(); got != test.want {
+				t.Errorf("PendingReferences(%s) = %s, wanted %s", test.env, got, test.want)
+			}
+		})
+	}
+}
+
+func TestLimitExceededOr(t *testing.T) {
+	pending := ref("a", "1")
+	for _, env := range []ltl.Environment{ltl.LimitExceeded.Or(pending), pending.Or(ltl.LimitExceeded)} {
+		if env.Reducible() {
+			t.Errorf("%s is reducible, wanted the pending reference kept", env)
+		}
+		if got := env.And(bind("a", "1")); !got.Matching() {
+			t.Errorf("%s AND [a:1] = %s, wanted a match", env, got)
+		}
+	}
+	if env := ltl.LimitExceeded.Or(ltl.NotMatching); !ltl.IsLimitExceeded(env) {
+		t.Errorf("LimitExceeded OR NotMatching = %s, wanted LimitExceeded", env)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	tests := []struct {
+		env  ltl.Environment
+		want string
+	}{
+		{ltl.NotMatching, "not matching\n"},
+		{bind("a", "1"), "matching; bound [a:1]\n"},
+		{ref("a", "1"), "waiting on references [a:1]\n"},
+		{bind("a", "1").And(ref("a", "2")), `AND: argument 1 did not match; bound [a:1]
+  matching; bound [a:1]
+  not matching; bound [a:1]
+`},
+		{bind("a", "1").And(ref("b", "2")), `AND: waiting on references [b:2]; bound [a:1]
+  matching; bound [a:1]
+  waiting on references [b:2]; bound [a:1]
+`},
+		{New(Matching(false), Bound(sb("a", "1"))).Or(New(Matching(false), Bound(sb("b", "2")))), `OR: no argument matched
+  not matching; bound [a:1]
+  not matching; bound [b:2]
+`},
+		{New(Captured(strTok("x"))).And(bind("a", "1")), "matching; bound [a:1]; captured x\n"},
+	}
+	for idx, test := range tests {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			if got := Explain(test.env).String(); got != test.want {
+				t.Errorf("Explain(%s) = \n%s\nwanted\n%s", test.env, got, test.want)
+			}
+		})
+	}
+}
+
 type strTok string
 
 func (st strTok) String() string {
@@ -152,6 +226,9 @@ func TestCaptures(t *testing.T) {
 		{cap(true, "a").And(cap(true, "b")), strs("a", "b")},
 		{cap(true, "a").And(cap(true, "a")), strs("a")},
 		{cap(false, "a").And(cap(true, "b")), strs("b")},
+		{New(CaptureOptions(captures.MaxTokens(1)), Captured(strTok("a"), strTok("b"))), strs("a")},
+		{New(Captured(strTok("a"), strTok("b")), CaptureOptions(captures.MaxTokens(1))), strs("a")},
+		{New(CaptureOptions(captures.MaxTokens(2)), Captured(strTok("a"))).And(cap(true, "b", "c")), strs("a", "b")},
 	}
 	for idx, test := range tests {
 		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
@@ -173,3 +250,245 @@ func TestCaptures(t *testing.T) {
 		})
 	}
 }
+
+func TestNotMatchingCaptures(t *testing.T) {
+	tests := []struct {
+		env                           ltl.Environment
+		wantMatching, wantNotMatching string
+	}{
+		{cap(false, "a").And(cap(true, "b")), "[b]", "[a]"},
+		{cap(false, "a").And(cap(true, "b")).Not(), "[a]", "[b]"},
+		{cap(false, "a").Or(cap(false, "b")), "[]", "[a b]"},
+		{cap(false, "a").Or(cap(false, "b")).Not().Or(cap(false, "c")), "[a b]", "[c]"},
+	}
+	for idx, test := range tests {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			for _, want := range []struct {
+				matching bool
+				caps     string
+			}{{true, test.wantMatching}, {false, test.wantNotMatching}} {
+				var got []string
+				for _, tok := range Captures(test.env).Ordered(want.matching) {
+					got = append(got, tok.String())
+				}
+				sort.Strings(got)
+				if fmt.Sprint(got) != want.caps {
+					t.Errorf("Got %t captures %v, wanted %s", want.matching, got, want.caps)
+				}
+			}
+		})
+	}
+}
+
+func TestTags(t *testing.T) {
+	tag := func(matching bool, labels ...string) ltl.Environment {
+		var ts []tags.Tag
+		for _, l := range labels {
+			ts = append(ts, tags.Label(l))
+		}
+		return New(Matching(matching), Tagged(ts...))
+	}
+	tests := []struct {
+		env                           ltl.Environment
+		wantMatching, wantNotMatching string
+	}{
+		{tag(true, "a"), "[#a]", "[]"},
+		{New(Tagged(tags.Label("a")), Matching(false)), "[]", "[#a]"},
+		{tag(true, "a").And(tag(true, "b")), "[#a #b]", "[]"},
+		{tag(false, "a").Or(tag(true, "b")).Not(), "[#a]", "[#b]"},
+		{tag(true, "a").And(New(Bound(sb("x", "1")))), "[#a]", "[]"},
+		{tag(true, "a").And(New(Referenced(sb("x", "1")))).And(New(Bound(sb("x", "1")))), "[#a]", "[]"},
+	}
+	for idx, test := range tests {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			if got := fmt.Sprint(Tags(test.env).Get(true)); got != test.wantMatching {
+				t.Errorf("Got matching tags %s, wanted %s", got, test.wantMatching)
+			}
+			if got := fmt.Sprint(Tags(test.env).Get(false)); got != test.wantNotMatching {
+				t.Errorf("Got not-matching tags %s, wanted %s", got, test.wantNotMatching)
+			}
+			s, ok := StateOf(test.env)
+			if !ok {
+				return
+			}
+			rt, err := FromState(s)
+			if err != nil {
+				t.Fatalf("FromState() yielded unexpected error %s", err)
+			}
+			if got, want := fmt.Sprint(Tags(rt).Get(true)), fmt.Sprint(Tags(test.env).Get(true)); got != want {
+				t.Errorf("Got matching tags %s after FromState, wanted %s", got, want)
+			}
+		})
+	}
+}
+
+func TestEnvEq(t *testing.T) {
+	tests := []struct {
+		a, b ltl.Environment
+		want bool
+	}{
+		{ltl.Matching, ltl.Matching, true},
+		{ltl.Matching, ltl.NotMatching, false},
+		{ltl.ErrEnv(fmt.Errorf("oops")), ltl.ErrEnv(fmt.Errorf("oops")), true},
+		{ltl.ErrEnv(fmt.Errorf("oops")), ltl.ErrEnv(fmt.Errorf("eek")), false},
+		{ltl.Matching, New(), true},
+		{ltl.Unknown, ltl.Unknown, true},
+		{ltl.Unknown, ltl.NotMatching, false},
+		{ltl.Unknown, bind("a", "1").And(ltl.Unknown), true},
+		{ltl.Unknown, bind("a", "1").Or(ltl.Unknown), false},
+		{bind("a", "1"), bind("a", "1"), true},
+		{bind("a", "1"), bind("a", "2"), false},
+		{bind("a", "1"), bind("a", "1").Not(), false},
+		{bind("a", "1"), ltl.Matching, false},
+		{ref("a", "1"), ref("a", "1"), true},
+		{ref("a", "1"), bind("a", "1"), false},
+		{cap(true, "a"), cap(true, "a"), true},
+		{cap(true, "a"), cap(false, "a"), false},
+		{cap(true, "a"), cap(true, "b"), false},
+		{New(Tagged(tags.Label("x"))), New(Tagged(tags.Label("x"))), true},
+		{New(Tagged(tags.Label("x"))), New(Tagged(tags.Label("y"))), false},
+		{ref("a", "1").Or(ref("b", "2")), ref("b", "2").Or(ref("a", "1")), true},
+		{ref("a", "1").Or(ref("b", "2")), ref("a", "1").And(ref("b", "2")), false},
+		{ref("a", "1").Or(ref("b", "2")), ref("a", "1").Or(ref("b", "3")), false},
+	}
+	for idx, test := range tests {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			if got := ltl.EnvEq(test.a, test.b); got != test.want {
+				t.Errorf("EnvEq(%s, %s) = %t, wanted %t", test.a, test.b, got, test.want)
+			}
+			if got := ltl.EnvEq(test.b, test.a); got != test.want {
+				t.Errorf("EnvEq(%s, %s) = %t, wanted %t", test.b, test.a, got, test.want)
+			}
+		})
+	}
+}
+
+func TestScope(t *testing.T) {
+	tests := []struct {
+		env, want ltl.Environment
+	}{
+		{bind("a", "1"), New()},
+		{bind("b", "1"), bind("b", "1")},
+		{bind("a", "1").And(bind("b", "2")), bind("b", "2")},
+		{ref("a", "1"), New(Matching(false))},
+		{ref("a", "1").Not(), New()},
+		{ref("a", "1").Or(ref("b", "2")), ref("b", "2")},
+		{ltl.NotMatching, ltl.NotMatching},
+	}
+	for idx, test := range tests {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			if got := Scope(test.env, "a"); !ltl.EnvEq(got, test.want) {
+				t.Errorf("Scope(%s) = %s, wanted %s", test.env, got, test.want)
+			}
+		})
+	}
+}
+
+func TestTreeLimits(t *testing.T) {
+	defer SetTreeLimits(0, 0)
+	// ORing distinct unresolved references grows the tree by two nodes, and
+	// one level, each time.
+	grow := func(n int) ltl.Environment {
+		var env ltl.Environment = ref("a", "0")
+		for idx := 1; idx < n; idx++ {
+			env = env.Or(ref("a", fmt.Sprint(idx)))
+		}
+		return env
+	}
+	if nodes, depth := TreeSize(grow(4)); nodes != 7 || depth != 4 {
+		t.Fatalf("TreeSize() = %d, %d, wanted 7, 4", nodes, depth)
+	}
+	tests := []struct {
+		nodes, depth int
+		wantErr      bool
+	}{
+		{0, 0, false},
+		{7, 4, false},
+		{6, 0, true},
+		{0, 3, true},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%d nodes, depth %d", test.nodes, test.depth), func(t *testing.T) {
+			SetTreeLimits(test.nodes, test.depth)
+			env := grow(4)
+			if gotErr := errors.Is(env.Err(), ErrTreeLimit); gotErr != test.wantErr {
+				t.Errorf("Got tree limit error %t, wanted %t (%v)", gotErr, test.wantErr, env.Err())
+			}
+		})
+	}
+}
+
+func TestInterner(t *testing.T) {
+	build := func() ltl.Environment {
+		return bind("a", "1").And(ref("b", "2")).Or(bind("a", "1").And(ref("b", "3")))
+	}
+	in := NewInterner()
+	first, second := build(), build()
+	if first == second {
+		t.Fatalf("Separately built Environments were already shared")
+	}
+	internedFirst, internedSecond := in.Intern(first), in.Intern(second)
+	if internedFirst != internedSecond {
+		t.Errorf("Identical Environments were not interned to the same node")
+	}
+	if !ltl.EnvEq(internedFirst, first) {
+		t.Errorf("Interned %s, wanted %s", internedFirst, first)
+	}
+	// The OR, both ANDs, and their children, of which the left are identical.
+	if got, want := in.Len(), 6; got != want {
+		t.Errorf("Interner held %d nodes, wanted %d", got, want)
+	}
+	if different := in.Intern(bind("a", "2").And(ref("b", "2"))); different == internedFirst {
+		t.Errorf("Different Environments were interned to the same node")
+	}
+	if merged, ok := merge(internedFirst, internedSecond); !ok || merged != internedFirst {
+		t.Errorf("Merging an interned node with itself yielded %s, %t, wanted the node itself", merged, ok)
+	}
+}
+
+func TestArena(t *testing.T) {
+	build := func(a *Arena) ltl.Environment {
+		return a.Adopt(bind("a", "1")).And(ref("b", "2")).Or(bind("a", "1").And(a.Adopt(ref("b", "3")))).Not()
+	}
+	a := NewArena()
+	want, got := build(nil), build(a)
+	if !ltl.EnvEq(got, want) {
+		t.Errorf("Built %s in an Arena, wanted %s", got, want)
+	}
+	if arenaOf(want) != nil {
+		t.Errorf("Environment built without an Arena was allocated by one")
+	}
+	if arenaOf(got) != a {
+		t.Errorf("Environment built from adopted Environments was not allocated by their Arena")
+	}
+	a.Release()
+	if released := build(a); !ltl.EnvEq(released, want) || !ltl.EnvEq(got, want) {
+		t.Errorf("After release, built %s and held %s, wanted %s", released, got, want)
+	}
+	if env := a.Adopt(ltl.Matching); env != ltl.Environment(ltl.Matching) {
+		t.Errorf("Adopt(Matching) = %s, wanted Matching", env)
+	}
+}
+
+func TestSprint(t *testing.T) {
+	env := bind("a", "1").Or(ref("b", "2"))
+	plain := Sprint(env)
+	lines := strings.Split(strings.TrimSuffix(plain, "\n"), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "Binding OR (false)") || !strings.HasPrefix(lines[1], "  ") {
+		t.Fatalf("Sprint() = %q, wanted three lines under an OR node", plain)
+	}
+	if got, want := Sprint(env, PrintPrefix("> ")), "> "+strings.ReplaceAll(strings.TrimSuffix(plain, "\n"), "\n", "\n> ")+"\n"; got != want {
+		t.Errorf("Sprint(PrintPrefix) = %q, wanted %q", got, want)
+	}
+	var buf strings.Builder
+	if err := Fprint(&buf, env); err != nil || buf.String() != plain {
+		t.Errorf("Fprint() wrote %q (%v), wanted %q", buf.String(), err, plain)
+	}
+	if got, want := Sprint(ltl.NotMatching), "NotMatching\n"; got != want {
+		t.Errorf("Sprint(NotMatching) = %q, wanted %q", got, want)
+	}
+	colored := Sprint(env, Colorize())
+	if !strings.Contains(colored, ansiBold+"OR"+ansiReset) || !strings.Contains(colored, ansiRed+"false"+ansiReset) {
+		t.Errorf("Sprint(Colorize) = %q, wanted colorized output", colored)
+	}
+}
@@ -19,7 +19,7 @@ import (
 	"github.com/ilhamster/ltl/pkg/bindings"
 	"github.com/ilhamster/ltl/pkg/captures"
 	"github.com/ilhamster/ltl/pkg/ltl"
-	"sort"
+	"github.com/ilhamster/ltl/pkg/tags"
 	"strings"
 )
 
@@ -29,8 +29,12 @@ import (
 type BindingNode struct {
 	matching   bool
 	caps       *captures.Captures
+	tags       *tags.Tags
 	bound      *bindings.Bindings
 	referenced *bindings.Bindings
+	// arena, if non-nil, allocated the node, and allocates nodes derived from
+	// it.
+	arena *Arena
 }
 
 // Option is used to build new bindingEnvironments.
@@ -42,6 +46,7 @@ func Matching(m bool) Option {
 		if bn.matching != m {
 			bn.matching = m
 			bn.caps = bn.caps.Not()
+			bn.tags = bn.tags.Not()
 		}
 	}
 }
@@ -49,15 +54,33 @@ func Matching(m bool) Option {
 // Captured sets the bindingEnvironment's captured tokens.
 func Captured(toks ...ltl.Token) Option {
 	return func(bn *BindingNode) {
-		cap := map[ltl.Token]struct{}{}
-		for _, tok := range toks {
-			cap[tok] = struct{}{}
-		}
-		bn.caps = captures.New()
+		bn.caps = bn.caps.Empty()
 		bn.caps.Capture(bn.matching, toks...)
 	}
 }
 
+// CaptureOptions configures the bindingEnvironment's captured tokens, and
+// those of Environments combining it, as by retaining only some of them or
+// reporting them with captures.OnCapture.  OnCapture only reports tokens
+// captured by later Captured Options.  Defaults to retaining all captured
+// tokens, and reporting none.
+func CaptureOptions(opts ...captures.Option) Option {
+	return func(bn *BindingNode) {
+		bn.caps = captures.New(opts...).Union(bn.caps)
+	}
+}
+
+// Tagged attaches the provided Tags to the bindingEnvironment, applying under
+// its matching state.
+func Tagged(ts ...tags.Tag) Option {
+	return func(bn *BindingNode) {
+		if bn.tags == nil {
+			bn.tags = tags.New()
+		}
+		bn.tags.Tag(bn.matching, ts...)
+	}
+}
+
 // Bound sets the bindingEnvironment's bindings.  Defaults to no bindings.
 func Bound(b *bindings.Bindings) Option {
 	bp := &b
@@ -99,18 +122,20 @@ func (bn *BindingNode) String() string {
 	if bn.referenced.Length() > 0 {
 		ret = append(ret, fmt.Sprintf("REF(%s)", bn.referenced))
 	}
-	caps := bn.captures().Get(bn.matching)
-	// caps := bn.matchingCaptured
-	if caps != nil && len(caps) > 0 {
+	if caps := bn.captures().Ordered(bn.matching); len(caps) > 0 {
 		capStrs := []string{}
-		for cap := range caps {
+		for _, cap := range caps {
 			capStrs = append(capStrs, cap.String())
 		}
-		sort.Slice(capStrs, func(a, b int) bool {
-			return capStrs[a] < capStrs[b]
-		})
 		ret = append(ret, fmt.Sprintf("CAP(%s)", strings.Join(capStrs, ", ")))
 	}
+	if ts := bn.tags.Get(bn.matching); len(ts) > 0 {
+		tagStrs := []string{}
+		for _, tag := range ts {
+			tagStrs = append(tagStrs, tag.String())
+		}
+		ret = append(ret, fmt.Sprintf("TAG(%s)", strings.Join(tagStrs, ", ")))
+	}
 	return fmt.Sprintf("(%s)", strings.Join(ret, ", "))
 }
 
@@ -128,11 +153,12 @@ func (bn *BindingNode) Or(oe ltl.Environment) ltl.Environment {
 func (bn *BindingNode) Not() ltl.Environment {
 	// Here and elsewhere, we avoid Options to avoid allocating a jillion
 	// closure functions in the critical path.
-	n := New()
+	n := bn.arena.newBindingNode(BindingNode{})
 	n.matching = !bn.matching
 	n.bound = bn.bound
 	n.referenced = bn.referenced
 	n.caps = bn.caps.Not()
+	n.tags = bn.tags.Not()
 	return n
 }
 
@@ -150,18 +176,23 @@ func (bn *BindingNode) Err() error {
 	return nil
 }
 
-// Reducible returns true for BindingNodes with no bound values, references, or
-// captures.
+// Reducible returns true for BindingNodes with no bound values, references,
+// captures, or tags.
 func (bn *BindingNode) Reducible() bool {
 	return bn.bound.Length() == 0 &&
 		bn.referenced.Length() == 0 &&
-		bn.caps.Reducible()
+		bn.caps.Reducible() &&
+		bn.tags.Reducible()
 }
 
 func (bn *BindingNode) captures() *captures.Captures {
 	return bn.caps
 }
 
+func (bn *BindingNode) tagged() *tags.Tags {
+	return bn.tags
+}
+
 func (bn *BindingNode) bindings() *bindings.Bindings {
 	if bn.Matching() {
 		return bn.bound
@@ -173,10 +204,15 @@ func (bn *BindingNode) hasReferences() bool {
 	return bn.referenced.Length() > 0
 }
 
+func (bn *BindingNode) pendingReferences() *bindings.Bindings {
+	return bn.referenced
+}
+
 // applyBindings applies the provided Bindings to the receiver.  This returns
 // a new BindingNode with:
 //  * its bound field set to the receiver's bound field combinec with the
-//    provided Bindings;
+//    provided Bindings, whose values resolve any conflicts under
+//    bindings.MergePolicies (see Bindings.Resolve);
 //  * its referenced field set to the receiver's referenced field satisfied with
 //    the provided Bindings;
 //  * its matching field set to:
@@ -191,7 +227,7 @@ func (bn *BindingNode) applyBindings(b *bindings.Bindings) ltl.Environment {
 	if b.Length() == 0 {
 		return bn
 	}
-	newB, err := bn.bound.Combine(b)
+	newB, err := bn.bound.Resolve(b)
 	if err != nil {
 		return ltl.ErrEnv(err)
 	}
@@ -202,14 +238,16 @@ func (bn *BindingNode) applyBindings(b *bindings.Bindings) ltl.Environment {
 			return bn
 		}
 		// If there's no references, we can simply combine bindings and return.
-		new := New()
+		new := bn.arena.newBindingNode(BindingNode{matching: true})
 		new.caps = bn.caps
+		new.tags = bn.tags
 		new.matching = bn.matching
 		new.bound = newB
 		return new
 	}
-	new := New()
+	new := bn.arena.newBindingNode(BindingNode{matching: true})
 	new.caps = bn.caps
+	new.tags = bn.tags
 	new.matching = bn.matching
 	// Otherwise, we must satisfy references.
 	newR, satisfied := bn.referenced.Satisfy(newB)
@@ -227,8 +265,9 @@ func (bn *BindingNode) merge(oe ltl.Environment) (bindingEnvironment, bool) {
 		if bn.matching == obn.matching &&
 			bn.bound.Eq(obn.bound) &&
 			bn.referenced.Eq(obn.referenced) {
-			new := New()
+			new := bn.arena.newBindingNode(BindingNode{matching: true})
 			new.caps = bn.caps.Union(obn.caps)
+			new.tags = bn.tags.Union(obn.tags)
 			new.matching = bn.matching
 			new.bound = bn.bound
 			new.referenced = bn.referenced
@@ -237,3 +276,34 @@ func (bn *BindingNode) merge(oe ltl.Environment) (bindingEnvironment, bool) {
 	}
 	return nil, false
 }
+
+func (bn *BindingNode) scope(keys []string) ltl.Environment {
+	newB, newR := bn.bound.Without(keys...), bn.referenced.Without(keys...)
+	if newB == bn.bound && newR == bn.referenced {
+		return bn
+	}
+	new := bn.arena.newBindingNode(BindingNode{matching: true})
+	new.caps = bn.caps
+	new.tags = bn.tags
+	new.matching = bn.matching
+	if newR != bn.referenced {
+		// A reference to a scoped key can no longer be satisfied.
+		newR = nil
+		new = new.Not().(*BindingNode)
+	}
+	new.bound = newB
+	new.referenced = newR
+	return new
+}
+
+// EnvEq returns true if the argument is a BindingNode with the same matching
+// status, bindings, references, captures, and tags as the receiver.
+func (bn *BindingNode) EnvEq(oe ltl.Environment) bool {
+	obn, ok := oe.(*BindingNode)
+	return ok &&
+		bn.matching == obn.matching &&
+		bn.bound.Eq(obn.bound) &&
+		bn.referenced.Eq(obn.referenced) &&
+		bn.caps.Eq(obn.caps) &&
+		bn.tags.Eq(obn.tags)
+}
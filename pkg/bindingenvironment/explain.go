@@ -0,0 +1,126 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bindingenvironment
+
+import (
+	"fmt"
+	"github.com/ilhamster/ltl/pkg/bindings"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	"strings"
+)
+
+// Explanation describes why an Environment does or does not match, branch by
+// branch.
+type Explanation struct {
+	// Op is "AND" or "OR" for the conjunctions and disjunctions of binding
+	// Environments, and "" for all other Environments.
+	Op string
+	// Matching is the Environment's Matching().
+	Matching bool
+	// Err is the Environment's Err().
+	Err error
+	// Bound holds the Environment's bound names, whether or not it matches.
+	Bound *bindings.Bindings
+	// Pending holds the Environment's unsatisfied references.
+	Pending *bindings.Bindings
+	// Captured holds the Tokens the Environment captures in its matching
+	// state, in stream order.
+	Captured []ltl.Token
+	// Children holds the Explanations of an AND or OR's arguments.
+	Children []*Explanation
+}
+
+// Explain returns an Explanation of the provided Environment.
+func Explain(env ltl.Environment) *Explanation {
+	if env == nil {
+		return nil
+	}
+	e := &Explanation{
+		Matching: env.Matching(),
+		Err:      env.Err(),
+		Pending:  PendingReferences(env),
+	}
+	switch v := env.(type) {
+	case *binaryNode:
+		e.Op = "AND"
+		if v.t == orNode {
+			e.Op = "OR"
+		}
+		e.Bound = v.bound
+		e.Children = []*Explanation{Explain(v.left), Explain(v.right)}
+	case *BindingNode:
+		e.Bound = v.bound
+	}
+	e.Captured = append(e.Captured, Captures(env).Ordered(e.Matching)...)
+	return e
+}
+
+// Reason returns a one-line summary of why the explained Environment does or
+// does not match.
+func (e *Explanation) Reason() string {
+	switch {
+	case e.Err != nil:
+		return fmt.Sprintf("error: %s", e.Err)
+	case e.Pending.Length() > 0:
+		return fmt.Sprintf("waiting on references %s", e.Pending)
+	case e.Op == "AND" && !e.Matching:
+		var failed []string
+		for idx, child := range e.Children {
+			if !child.Matching {
+				failed = append(failed, fmt.Sprintf("%d", idx))
+			}
+		}
+		return fmt.Sprintf("argument %s did not match", strings.Join(failed, " and "))
+	case e.Op == "OR" && !e.Matching:
+		return "no argument matched"
+	case e.Matching:
+		return "matching"
+	}
+	return "not matching"
+}
+
+// String returns a multi-line rendering of the receiver, one line per branch,
+// with branches indented beneath their parents.
+func (e *Explanation) String() string {
+	sb := &strings.Builder{}
+	e.write(sb, "")
+	return sb.String()
+}
+
+func (e *Explanation) write(sb *strings.Builder, indent string) {
+	if e == nil {
+		fmt.Fprintf(sb, "%s<nil>\n", indent)
+		return
+	}
+	sb.WriteString(indent)
+	if e.Op != "" {
+		sb.WriteString(e.Op + ": ")
+	}
+	sb.WriteString(e.Reason())
+	if e.Bound.Length() > 0 {
+		fmt.Fprintf(sb, "; bound %s", e.Bound)
+	}
+	if len(e.Captured) > 0 {
+		caps := make([]string, len(e.Captured))
+		for idx, tok := range e.Captured {
+			caps[idx] = tok.String()
+		}
+		fmt.Fprintf(sb, "; captured %s", strings.Join(caps, ", "))
+	}
+	sb.WriteString("\n")
+	for _, child := range e.Children {
+		child.write(sb, indent+"  ")
+	}
+}
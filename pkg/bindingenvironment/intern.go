@@ -0,0 +1,113 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bindingenvironment
+
+import "github.com/ilhamster/ltl/pkg/ltl"
+
+// Interner shares structurally identical binding Environment subtrees, so
+// that, over a long match, many identical subtrees are held as one.  Since
+// the children of interned ANDs and ORs are themselves interned, identical
+// interned subtrees are the same pointer, and merging them is immediate.  An
+// Interner retains every distinct subtree it has interned; discard it to
+// release them.  The zero Interner is not usable; use NewInterner.
+type Interner struct {
+	nodes map[uint64][]ltl.Environment
+}
+
+// NewInterner returns a new, empty Interner.
+func NewInterner() *Interner {
+	return &Interner{
+		nodes: map[uint64][]ltl.Environment{},
+	}
+}
+
+// Intern returns an Environment equivalent to the provided one, but sharing
+// any subtrees identical to those of previously interned Environments.
+// Environments other than binding Environments are returned unchanged.
+func (in *Interner) Intern(env ltl.Environment) ltl.Environment {
+	ret, _ := in.intern(env)
+	return ret
+}
+
+// Len returns the number of distinct subtrees the receiver holds.
+func (in *Interner) Len() int {
+	ret := 0
+	for _, envs := range in.nodes {
+		ret += len(envs)
+	}
+	return ret
+}
+
+// intern interns the provided Environment, returning the interned Environment
+// and its fingerprint, which is the same for identical subtrees.
+func (in *Interner) intern(env ltl.Environment) (ltl.Environment, uint64) {
+	var fp uint64
+	var same func(ltl.Environment) bool
+	switch e := env.(type) {
+	case *BindingNode:
+		fp = fingerprint(boolBit(e.matching), e.bound.Hash(), e.referenced.Hash())
+		same = e.EnvEq
+	case *binaryNode:
+		left, lfp := in.intern(e.left)
+		right, rfp := in.intern(e.right)
+		if left != e.left || right != e.right {
+			e = sized(&binaryNode{
+				bound:    e.bound,
+				left:     left,
+				right:    right,
+				hasRefs:  e.hasRefs,
+				matching: e.matching,
+				t:        e.t,
+			})
+		}
+		env = e
+		fp = fingerprint(boolBit(bool(e.t)), boolBit(e.matching), boolBit(e.hasRefs), e.bound.Hash(), lfp, rfp)
+		// The children of both are interned, so they are identical only if
+		// they are the same.
+		same = func(oe ltl.Environment) bool {
+			obn, ok := oe.(*binaryNode)
+			return ok && e.t == obn.t && e.matching == obn.matching &&
+				e.hasRefs == obn.hasRefs && e.left == obn.left &&
+				e.right == obn.right && e.bound.Eq(obn.bound)
+		}
+	default:
+		return env, 0
+	}
+	for _, candidate := range in.nodes[fp] {
+		if same(candidate) {
+			return candidate, fp
+		}
+	}
+	in.nodes[fp] = append(in.nodes[fp], env)
+	return env, fp
+}
+
+func boolBit(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// fingerprint combines the provided values into a single hash.
+func fingerprint(vs ...uint64) uint64 {
+	const prime = 1099511628211
+	h := uint64(14695981039346656037)
+	for _, v := range vs {
+		h = (h ^ v) * prime
+		h ^= h >> 32
+	}
+	return h
+}
@@ -0,0 +1,97 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bindingenvironment
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	"sync/atomic"
+)
+
+// ErrTreeLimit is matched, under errors.Is, by the error of Environments
+// exceeding the limits set by SetTreeLimits.
+var ErrTreeLimit = errors.New("environment tree limit exceeded")
+
+// TreeLimitError is the error of the Erroring Environment produced in place of
+// an Environment tree exceeding a limit set by SetTreeLimits.
+type TreeLimitError struct {
+	// Measure names the limited measure of the tree: "nodes" or "depth".
+	Measure string
+	// Used is the tree's measure, and Max its limit.
+	Used, Max int
+}
+
+func (tle *TreeLimitError) Error() string {
+	return fmt.Sprintf("%s: %d %s exceed the maximum of %d", ErrTreeLimit, tle.Used, tle.Measure, tle.Max)
+}
+
+// Is returns true for ErrTreeLimit.
+func (tle *TreeLimitError) Is(target error) bool {
+	return target == ErrTreeLimit
+}
+
+// treeLimits holds the limits set by SetTreeLimits.
+var treeLimits struct {
+	nodes, depth int64
+}
+
+// SetTreeLimits sets the maximum number of nodes in, and depth of, the trees
+// of binding Environments built by AND and OR.  Such trees can grow without
+// bound in streaming use, for instance under OR with unresolvable references;
+// a combination exceeding either limit instead yields an Erroring Environment
+// with a TreeLimitError, so that a single bad formula cannot exhaust a
+// monitor's memory.  Limits of zero or less, the defaults, are unbounded.  The
+// limits apply to all Environments in the process.
+func SetTreeLimits(nodes, depth int) {
+	atomic.StoreInt64(&treeLimits.nodes, int64(nodes))
+	atomic.StoreInt64(&treeLimits.depth, int64(depth))
+}
+
+// TreeSize returns the number of nodes in, and the depth of, the provided
+// Environment's tree.  Environments other than ANDs and ORs of binding
+// Environments count as a single node.
+func TreeSize(env ltl.Environment) (nodes, depth int) {
+	if bn, ok := env.(*binaryNode); ok {
+		return bn.nodes, bn.depth
+	}
+	return 1, 1
+}
+
+// sized sets the size of the provided binaryNode from those of its children,
+// and returns it.
+func sized(bn *binaryNode) *binaryNode {
+	ln, ld := TreeSize(bn.left)
+	rn, rd := TreeSize(bn.right)
+	bn.nodes = ln + rn + 1
+	bn.depth = ld + 1
+	if rd > ld {
+		bn.depth = rd + 1
+	}
+	return bn
+}
+
+// limited returns the provided binaryNode, sized, or an Erroring Environment
+// if it exceeds the limits set by SetTreeLimits.
+func limited(bn *binaryNode) ltl.Environment {
+	sized(bn)
+	if max := int(atomic.LoadInt64(&treeLimits.nodes)); max > 0 && bn.nodes > max {
+		return ltl.ErrEnv(&TreeLimitError{"nodes", bn.nodes, max})
+	}
+	if max := int(atomic.LoadInt64(&treeLimits.depth)); max > 0 && bn.depth > max {
+		return ltl.ErrEnv(&TreeLimitError{"depth", bn.depth, max})
+	}
+	return bn
+}
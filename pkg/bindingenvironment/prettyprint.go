@@ -17,20 +17,90 @@ package bindingenvironment
 import (
 	"fmt"
 	"github.com/ilhamster/ltl/pkg/ltl"
-	"sort"
+	"io"
+	"os"
 	"strings"
 )
 
-// PrettyPrint pretty-prints bindingEnvironments for easier debugging.
-// Non-binding Environments just get their matching state printed.
+// ANSI escape sequences used by Colorize.
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiRed   = "\x1b[31m"
+	ansiGreen = "\x1b[32m"
+)
+
+type ppOpts struct {
+	prefix string
+	color  bool
+}
+
+// PrintPrefix specifies that each printed line should begin with the
+// specified prefix.
+func PrintPrefix(p string) func(o *ppOpts) {
+	return func(o *ppOpts) {
+		o.prefix = p
+	}
+}
+
+// Colorize specifies that output should be colorized for ANSI terminals:
+// AND and OR nodes in bold, and matching states in green or, if not matching,
+// red.
+func Colorize() func(o *ppOpts) {
+	return func(o *ppOpts) {
+		o.color = true
+	}
+}
+
+func (po *ppOpts) bold(s string) string {
+	if !po.color {
+		return s
+	}
+	return ansiBold + s + ansiReset
+}
+
+// paint colors s green if m is true, or red otherwise.
+func (po *ppOpts) paint(s string, m bool) string {
+	if !po.color {
+		return s
+	}
+	if m {
+		return ansiGreen + s + ansiReset
+	}
+	return ansiRed + s + ansiReset
+}
+
+// PrettyPrint pretty-prints bindingEnvironments to standard output for easier
+// debugging.  Non-binding Environments just get their matching state printed.
 func PrettyPrint(env ltl.Environment, prefix ...string) {
-	prefixStr := ""
-	for _, p := range prefix {
-		prefixStr = prefixStr + p
+	Fprint(os.Stdout, env, PrintPrefix(strings.Join(prefix, "")))
+}
+
+// Sprint returns the pretty-printed form of the provided Environment, as
+// PrettyPrint prints it, under the provided options.
+func Sprint(env ltl.Environment, opts ...func(o *ppOpts)) string {
+	var sb strings.Builder
+	Fprint(&sb, env, opts...)
+	return sb.String()
+}
+
+// Fprint writes the pretty-printed form of the provided Environment, as
+// PrettyPrint prints it, under the provided options, to the provided Writer.
+func Fprint(w io.Writer, env ltl.Environment, opts ...func(o *ppOpts)) error {
+	o := &ppOpts{}
+	for _, opt := range opts {
+		opt(o)
 	}
-	fmt.Print(prefixStr)
+	var sb strings.Builder
+	o.print(&sb, env, o.prefix)
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func (po *ppOpts) print(sb *strings.Builder, env ltl.Environment, prefix string) {
+	sb.WriteString(prefix)
 	if env == nil {
-		fmt.Println("<nil>")
+		sb.WriteString("<nil>\n")
 		return
 	}
 	switch v := env.(type) {
@@ -43,21 +113,19 @@ func PrettyPrint(env ltl.Environment, prefix ...string) {
 			t = "OR"
 		}
 		capStrs := []string{}
-		caps := Captures(env).Get(env.Matching())
-		if caps != nil {
-			for cap := range caps {
-				capStrs = append(capStrs, cap.String())
-			}
-			sort.Slice(capStrs, func(a, b int) bool {
-				return capStrs[a] < capStrs[b]
-			})
+		for _, cap := range Captures(env).Ordered(env.Matching()) {
+			capStrs = append(capStrs, cap.String())
+		}
+		refStr := ""
+		if pending := v.pendingReferences(); pending.Length() > 0 {
+			refStr = fmt.Sprintf(" (r: %s)", pending)
 		}
-		fmt.Printf("Binding %s (%t) (b: %s) (c: %s)\n", t, v.Matching(), v.bound, strings.Join(capStrs, ", "))
-		PrettyPrint(v.left, prefixStr+"  ")
-		PrettyPrint(v.right, prefixStr+"  ")
+		fmt.Fprintf(sb, "Binding %s (%s) (b: %s)%s (c: %s)\n", po.bold(t), po.paint(fmt.Sprintf("%t", v.Matching()), v.Matching()), v.bound, refStr, strings.Join(capStrs, ", "))
+		po.print(sb, v.left, prefix+"  ")
+		po.print(sb, v.right, prefix+"  ")
 	case *BindingNode:
-		fmt.Println(v.String())
+		sb.WriteString(v.String() + "\n")
 	default:
-		fmt.Println(ltl.State(env.Matching()))
+		sb.WriteString(po.paint(ltl.State(env.Matching()).String(), env.Matching()) + "\n")
 	}
 }
@@ -0,0 +1,131 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bindingenvironment
+
+import (
+	"fmt"
+	"github.com/ilhamster/ltl/pkg/bindings"
+	"github.com/ilhamster/ltl/pkg/captures"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	"github.com/ilhamster/ltl/pkg/tags"
+)
+
+// StateType identifies the type of a bindingEnvironment.
+type StateType string
+
+// The types of bindingEnvironment.
+const (
+	NodeState StateType = "BE_NODE"
+	AndState  StateType = "BE_AND"
+	OrState   StateType = "BE_OR"
+)
+
+// State is the complete internal state of a bindingEnvironment, from which it
+// can be reconstructed with FromState.  It supports checkpointing
+// Environments.
+type State struct {
+	Type StateType
+	// Matching is the environment's own matching status, which for a
+	// BindingNode with references may differ from its Matching().
+	Matching bool
+	// HasRefs is true if an AND or OR node has references.
+	HasRefs bool
+	Bound   *bindings.Bindings
+	// Referenced is set only for BindingNodes.
+	Referenced *bindings.Bindings
+	// CapturedMatching and CapturedNotMatching are the Tokens captured by a
+	// BindingNode, under each matching state, in stream order.
+	CapturedMatching, CapturedNotMatching []ltl.Token
+	// TagsMatching and TagsNotMatching are the Tags attached to a BindingNode,
+	// under each matching state, in order of Kind.
+	TagsMatching, TagsNotMatching []tags.Tag
+	// Left and Right are the children of an AND or OR node.
+	Left, Right ltl.Environment
+}
+
+// StateOf returns the State of the provided Environment, and true, if it is a
+// bindingEnvironment, or false otherwise.
+func StateOf(env ltl.Environment) (State, bool) {
+	switch e := env.(type) {
+	case *BindingNode:
+		s := State{
+			Type:       NodeState,
+			Matching:   e.matching,
+			Bound:      e.bound,
+			Referenced: e.referenced,
+		}
+		s.CapturedMatching = append(s.CapturedMatching, e.caps.Ordered(true)...)
+		s.CapturedNotMatching = append(s.CapturedNotMatching, e.caps.Ordered(false)...)
+		s.TagsMatching = e.tags.Get(true)
+		s.TagsNotMatching = e.tags.Get(false)
+		return s, true
+	case *binaryNode:
+		s := State{
+			Type:     AndState,
+			Matching: e.matching,
+			HasRefs:  e.hasRefs,
+			Bound:    e.bound,
+			Left:     e.left,
+			Right:    e.right,
+		}
+		if e.t == orNode {
+			s.Type = OrState
+		}
+		return s, true
+	}
+	return State{}, false
+}
+
+// FromState returns the bindingEnvironment with the provided State.
+func FromState(s State) (ltl.Environment, error) {
+	switch s.Type {
+	case NodeState:
+		bn := &BindingNode{
+			matching:   s.Matching,
+			bound:      s.Bound,
+			referenced: s.Referenced,
+		}
+		if len(s.CapturedMatching) > 0 || len(s.CapturedNotMatching) > 0 {
+			bn.caps = captures.New()
+			if len(s.CapturedMatching) > 0 {
+				bn.caps.Capture(true, s.CapturedMatching...)
+			}
+			if len(s.CapturedNotMatching) > 0 {
+				bn.caps.Capture(false, s.CapturedNotMatching...)
+			}
+		}
+		if len(s.TagsMatching) > 0 || len(s.TagsNotMatching) > 0 {
+			bn.tags = tags.New().Tag(true, s.TagsMatching...).Tag(false, s.TagsNotMatching...)
+		}
+		return bn, nil
+	case AndState, OrState:
+		if s.Left == nil || s.Right == nil {
+			return nil, fmt.Errorf("%s state requires two children", s.Type)
+		}
+		t := andNode
+		if s.Type == OrState {
+			t = orNode
+		}
+		return sized(&binaryNode{
+			bound:    s.Bound,
+			left:     s.Left,
+			right:    s.Right,
+			hasRefs:  s.HasRefs,
+			matching: s.Matching,
+			t:        t,
+		}), nil
+	}
+	return nil, fmt.Errorf("unknown bindingEnvironment state type '%s'", s.Type)
+}
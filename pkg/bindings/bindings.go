@@ -22,61 +22,235 @@ import (
 	"strings"
 )
 
+// smallSize is the number of BoundValues a Bindings can hold without a
+// separately-allocated slice.  Most Bindings hold only one or two.
+const smallSize = 2
+
 // Bindings is a set of BoundValues.  A nil Bindings is treated as empty.
 type Bindings struct {
-	// b is stored by increasing key.
-	b []BoundValue
+	// b is stored by increasing key.  For Bindings built by newBuilder with
+	// no more than smallSize values, it is backed by small.
+	b     []entry
+	small [smallSize]entry
+	// hash combines the hashes of b's entries.  Bindings that are Eq have
+	// the same hash.
+	hash uint64
+	// overwriting holds the keys whose values overwrite, rather than conflict
+	// with, other values for the same key in Combine.
+	overwriting map[string]struct{}
+	// comparisons holds the keys whose values, as references, are satisfied
+	// by a Comparison other than Equal.
+	comparisons map[string]Comparison
+	// policies holds the keys whose conflicting values are resolved by a
+	// MergePolicy other than ErrorOnConflict.
+	policies map[string]MergePolicy
+}
+
+// entry is a BoundValue and its interned key, which allows keys to be tested
+// for equality without comparing strings, and the hash of both.
+type entry struct {
+	bv   BoundValue
+	id   keyID
+	hash uint64
+}
+
+// newEntry returns an entry for the provided BoundValue, whose key has the
+// provided keyID.
+func newEntry(bv BoundValue, id keyID) entry {
+	return entry{bv, id, mix(hashValue(bv), uint64(id))}
+}
+
+// compare compares the keys of the receiver and argument, returning a value
+// less than, equal to, or greater than zero as the receiver's key is less
+// than, equal to, or greater than the argument's.
+func (e entry) compare(oe entry) int {
+	if e.id == oe.id {
+		return 0
+	}
+	return strings.Compare(e.bv.Key(), oe.bv.Key())
 }
 
-func (b *Bindings) bindings() []BoundValue {
+func (b *Bindings) entries() []entry {
 	if b == nil {
 		return nil
 	}
 	return b.b
 }
 
-// newSorted returns a new Bindings with the provided BoundValue slice.  It
-// assumes the arguments are presented in (increasing) sorted order.
-func newSorted(bvs ...BoundValue) *Bindings {
-	if len(bvs) == 0 {
+// clone returns a new Bindings sharing the receiver's BoundValues.
+func (b *Bindings) clone() *Bindings {
+	return &Bindings{
+		b:    b.b,
+		hash: b.hash,
+	}
+}
+
+// newBuilder returns a new, empty Bindings to whose b up to the provided
+// number of entries may be appended, in increasing key order, without
+// further allocation.  Once they are appended, the Bindings must be finished
+// with built.  Sharing one allocation between a small Bindings and its values
+// halves the allocations of Combine, Satisfy, and the like in the common case.
+// (Pooling Bindings is not an option, as they are immutable and freely shared
+// once built, so it is never known when they may be reused.)
+func newBuilder(capacity int) *Bindings {
+	ret := &Bindings{}
+	if capacity <= smallSize {
+		ret.b = ret.small[:0]
+	} else {
+		ret.b = make([]entry, 0, capacity)
+	}
+	return ret
+}
+
+// built returns the receiver, which must have come from newBuilder, with its
+// hash set, or nil if no entries were appended to it.
+func (b *Bindings) built() *Bindings {
+	if len(b.b) == 0 {
 		return nil
 	}
-	return &Bindings{
-		b: bvs,
+	b.hash = fnvOffset
+	for _, e := range b.b {
+		b.hash = mix(b.hash, e.hash)
 	}
+	return b
 }
 
 // New returns a new Bindings with the provided BoundValues.
 func New(bvs ...BoundValue) (*Bindings, error) {
+	ret := newBuilder(len(bvs))
+	for _, bv := range bvs {
+		ret.b = append(ret.b, newEntry(bv, intern(bv.Key())))
+	}
 	var err error
-	sort.Slice(bvs, func(i, j int) bool {
-		cmp := strings.Compare(bvs[i].Key(), bvs[j].Key())
+	sort.Slice(ret.b, func(i, j int) bool {
+		cmp := ret.b[i].compare(ret.b[j])
 		if cmp == 0 {
-			err = fmt.Errorf("Key conflict between %s and %s", bvs[i], bvs[j])
+			err = &ConflictError{ret.b[i].bv.Key(), ret.b[i].bv, ret.b[j].bv}
 		}
 		return cmp < 0
 	})
-	return newSorted(bvs...), err
+	return ret.built(), err
 }
 
 func (b *Bindings) String() string {
-	ret := make([]string, 0, len(b.bindings()))
-	for _, bv := range b.bindings() {
-		ret = append(ret, bv.String())
+	ret := make([]string, 0, b.Length())
+	for _, e := range b.entries() {
+		bv := e.bv
+		if c := b.ComparisonOf(bv.Key()); c != Equal {
+			ret = append(ret, fmt.Sprintf("%s %s", c, bv))
+		} else {
+			ret = append(ret, bv.String())
+		}
 	}
 	return fmt.Sprintf("[%s]", strings.Join(ret, ", "))
 }
 
+// Values returns the receiver's BoundValues, in increasing key order.
+func (b *Bindings) Values() []BoundValue {
+	ret := make([]BoundValue, 0, b.Length())
+	for _, e := range b.entries() {
+		ret = append(ret, e.bv)
+	}
+	return ret
+}
+
+// Get returns the value bound to the provided key, and true, or false if the
+// receiver does not bind it.
+func (b *Bindings) Get(key string) (BoundValue, bool) {
+	es := b.entries()
+	idx := sort.Search(len(es), func(i int) bool {
+		return es[i].bv.Key() >= key
+	})
+	if idx < len(es) && es[idx].bv.Key() == key {
+		return es[idx].bv, true
+	}
+	return nil, false
+}
+
+// Range calls f for each of the receiver's BoundValues, in increasing key
+// order, until f returns false.
+func (b *Bindings) Range(f func(bv BoundValue) bool) {
+	for _, e := range b.entries() {
+		if !f(e.bv) {
+			return
+		}
+	}
+}
+
 // Length returns the number of bound names in the receiver.
 func (b *Bindings) Length() int {
-	return len(b.bindings())
+	return len(b.entries())
+}
+
+// Hash returns a hash of the receiver's keys and values, computed when it was
+// created.  Bindings that are Eq have the same Hash, so Bindings may be
+// bucketed by Hash before being compared with Eq.
+func (b *Bindings) Hash() uint64 {
+	if b == nil {
+		return 0
+	}
+	return b.hash
 }
 
 // Combine combines the receiver and argument Bindings, adding each key and
 // value in the argument into the receiver.  If the Binding types are
 // incompatible or if the same key exists in both combined Bindings, Combine
-// should return an error.
+// should return an error, unless the argument's value for that key is
+// overwriting (see Overwriting), in which case it replaces the receiver's, or
+// either value has a MergePolicy (see WithPolicy), which then resolves the
+// conflict.  The argument's MergePolicy takes precedence.
 func (b *Bindings) Combine(ob *Bindings) (*Bindings, error) {
+	return b.combine(ob, func(key string) MergePolicy {
+		if ob.Overwrites(key) {
+			return KeepLast
+		}
+		if p := ob.PolicyOf(key); p != ErrorOnConflict {
+			return p
+		}
+		return b.PolicyOf(key)
+	})
+}
+
+// CombineOverwriting combines the receiver and argument Bindings like Combine,
+// but where the same key exists in both, the argument's value replaces the
+// receiver's, even if the two are of different types.
+func (b *Bindings) CombineOverwriting(ob *Bindings) (*Bindings, error) {
+	return b.CombineWith(ob, KeepLast)
+}
+
+// CombineWith combines the receiver and argument Bindings like Combine, but
+// resolves every key existing in both with the provided MergePolicy,
+// regardless of the MergePolicies of their values.
+func (b *Bindings) CombineWith(ob *Bindings, policy MergePolicy) (*Bindings, error) {
+	return b.combine(ob, func(string) MergePolicy {
+		return policy
+	})
+}
+
+// Resolve combines the receiver and argument Bindings like Combine, but
+// treats the argument as already resolving any conflicts: where the same key
+// exists in both, and has a MergePolicy or is overwriting in either, the
+// argument's value replaces the receiver's, or, under CollectSet, is combined
+// with it.  Other conflicts are errors, as in Combine.
+func (b *Bindings) Resolve(ob *Bindings) (*Bindings, error) {
+	return b.combine(ob, func(key string) MergePolicy {
+		p := ob.PolicyOf(key)
+		if p == ErrorOnConflict {
+			p = b.PolicyOf(key)
+		}
+		switch {
+		case p == CollectSet:
+			return CollectSet
+		case p != ErrorOnConflict || b.Overwrites(key) || ob.Overwrites(key):
+			return KeepLast
+		}
+		return ErrorOnConflict
+	})
+}
+
+// combine combines the receiver and argument, resolving keys existing in both
+// with the MergePolicy policy returns for them.
+func (b *Bindings) combine(ob *Bindings, policy func(key string) MergePolicy) (*Bindings, error) {
 	// Performance: if b is empty, or it's the same as ob, we can just return
 	// ob.
 	if b.Length() == 0 || b.Eq(ob) {
@@ -86,41 +260,163 @@ func (b *Bindings) Combine(ob *Bindings) (*Bindings, error) {
 	if ob.Length() == 0 {
 		return b, nil
 	}
-	ret := make([]BoundValue, 0, b.Length()+ob.Length())
+	ret := newBuilder(b.Length() + ob.Length())
 	bIdx, obIdx := 0, 0
 	for bIdx < b.Length() && obIdx < ob.Length() {
-		bBV, oBV := b.bindings()[bIdx], ob.bindings()[obIdx]
-		cmp := strings.Compare(bBV.Key(), oBV.Key())
+		bE, oE := b.b[bIdx], ob.b[obIdx]
+		cmp := bE.compare(oE)
 		if cmp < 0 {
-			ret = append(ret, bBV)
+			ret.b = append(ret.b, bE)
 			bIdx++
 		}
 		if cmp > 0 {
-			ret = append(ret, oBV)
+			ret.b = append(ret.b, oE)
 			obIdx++
 		}
 		if cmp == 0 {
-			if cmp, err := bBV.CompareValues(oBV); err != nil {
+			bv, err := policy(bE.bv.Key()).merge(bE.bv, oE.bv)
+			if err != nil {
 				return nil, err
-			} else if cmp != 0 {
-				return nil, fmt.Errorf("Key %s conflicts in %s and %s", bBV.Key(), b, ob)
 			}
-			ret = append(ret, bBV)
+			ret.b = append(ret.b, newEntry(bv, bE.id))
 			bIdx++
 			obIdx++
 		}
 	}
-	ret = append(ret, b.bindings()[bIdx:]...)
-	ret = append(ret, ob.bindings()[obIdx:]...)
-	return newSorted(ret...), nil
+	ret.b = append(ret.b, b.b[bIdx:]...)
+	ret.b = append(ret.b, ob.b[obIdx:]...)
+	return ret.built().inherit(b, ob), nil
+}
+
+// Overwriting returns a copy of the receiver all of whose values are
+// overwriting: when the returned Bindings is the argument to Combine, its
+// values replace, rather than conflict with, the receiver's values for the
+// same keys.  The overwriting keys survive into the Bindings Combine returns.
+func (b *Bindings) Overwriting() *Bindings {
+	if b.Length() == 0 {
+		return b
+	}
+	ret := b.clone().inherit(b)
+	ret.overwriting = map[string]struct{}{}
+	for _, e := range b.b {
+		ret.overwriting[e.bv.Key()] = struct{}{}
+	}
+	return ret
+}
+
+// Overwrites returns true if the receiver's value for the provided key is
+// overwriting.
+func (b *Bindings) Overwrites(key string) bool {
+	if b == nil {
+		return false
+	}
+	_, ok := b.overwriting[key]
+	return ok
+}
+
+// Comparing returns a copy of the receiver all of whose values, as references,
+// are satisfied by bound values to which they compare as the provided
+// Comparison specifies, rather than only by equal values.
+func (b *Bindings) Comparing(c Comparison) *Bindings {
+	if b.Length() == 0 || c == Equal {
+		return b
+	}
+	ret := b.clone().inherit(b)
+	ret.comparisons = map[string]Comparison{}
+	for _, e := range b.b {
+		ret.comparisons[e.bv.Key()] = c
+	}
+	return ret
+}
+
+// WithPolicy returns a copy of the receiver all of whose values are resolved
+// by the provided MergePolicy when they conflict with other values for the
+// same keys in Combine.  The MergePolicies survive into the Bindings Combine
+// returns.
+func (b *Bindings) WithPolicy(p MergePolicy) *Bindings {
+	if b.Length() == 0 || p == ErrorOnConflict {
+		return b
+	}
+	ret := b.clone().inherit(b)
+	ret.policies = map[string]MergePolicy{}
+	for _, e := range b.b {
+		ret.policies[e.bv.Key()] = p
+	}
+	return ret
+}
+
+// PolicyOf returns the MergePolicy resolving conflicts with the receiver's
+// value for the provided key.
+func (b *Bindings) PolicyOf(key string) MergePolicy {
+	if b == nil {
+		return ErrorOnConflict
+	}
+	return b.policies[key]
+}
+
+// ComparisonOf returns the Comparison by which the receiver's value for the
+// provided key, as a reference, is satisfied.
+func (b *Bindings) ComparisonOf(key string) Comparison {
+	if b == nil {
+		return Equal
+	}
+	return b.comparisons[key]
+}
+
+// inherit sets the overwriting keys and Comparisons of the receiver, which
+// must be newly created, from those of the provided Bindings for the keys the
+// receiver holds, and returns the receiver.  Where several of the provided
+// Bindings have a Comparison or MergePolicy for the same key, the first is
+// used.
+func (b *Bindings) inherit(srcs ...*Bindings) *Bindings {
+	if b == nil {
+		return nil
+	}
+	var keys map[string]struct{}
+	for _, src := range srcs {
+		if src == nil || (src.overwriting == nil && src.comparisons == nil && src.policies == nil) {
+			continue
+		}
+		if keys == nil {
+			keys = b.Keys()
+		}
+		for key := range src.overwriting {
+			if _, ok := keys[key]; ok {
+				if b.overwriting == nil {
+					b.overwriting = map[string]struct{}{}
+				}
+				b.overwriting[key] = struct{}{}
+			}
+		}
+		for key, c := range src.comparisons {
+			if _, ok := keys[key]; ok && b.comparisons[key] == Equal {
+				if b.comparisons == nil {
+					b.comparisons = map[string]Comparison{}
+				}
+				b.comparisons[key] = c
+			}
+		}
+		for key, p := range src.policies {
+			if _, ok := keys[key]; ok && b.policies[key] == ErrorOnConflict {
+				if b.policies == nil {
+					b.policies = map[string]MergePolicy{}
+				}
+				b.policies[key] = p
+			}
+		}
+	}
+	return b
 }
 
 // Satisfy returns the relative complement of the argument in the receiver: that
 // is, a copy of the receiver with all keys also present in the argument (and
 // with the same value) removed.  It returns true if the receiver could be
 // satisfied by the argument: if every bound name present in both the receiver
-// and the argument binds to the same value in both.  Note that a return value
-// of true does not imply either that the returned Bindings is empty.
+// and the argument binds to the same value in both, or, for keys with a
+// Comparison other than Equal (see Comparing), if the receiver's value
+// compares to the argument's as that Comparison specifies.  Note that a
+// return value of true does not imply either that the returned Bindings is
+// empty.
 func (b *Bindings) Satisfy(ob *Bindings) (*Bindings, bool) {
 	// Performance: if either is empty, we can just return the receiver.
 	if b.Length() == 0 || ob.Length() == 0 {
@@ -131,53 +427,118 @@ func (b *Bindings) Satisfy(ob *Bindings) (*Bindings, bool) {
 	if b.Eq(ob) {
 		return nil, true
 	}
-	ret := make([]BoundValue, 0, b.Length())
+	ret := newBuilder(b.Length())
 	bIdx, obIdx := 0, 0
 	for bIdx < b.Length() && obIdx < ob.Length() {
-		bBV, oBV := b.bindings()[bIdx], ob.bindings()[obIdx]
-		cmp := strings.Compare(bBV.Key(), oBV.Key())
+		bE, oE := b.b[bIdx], ob.b[obIdx]
+		cmp := bE.compare(oE)
 		if cmp < 0 {
-			ret = append(ret, bBV)
+			ret.b = append(ret.b, bE)
 			bIdx++
 		}
 		if cmp > 0 {
 			obIdx++
 		}
 		if cmp == 0 {
-			if cmp, err := bBV.CompareValues(oBV); err != nil || cmp != 0 {
+			if !satisfiedBy(b.ComparisonOf(bE.bv.Key()), bE.bv, oE.bv) {
 				return nil, false
 			}
 			bIdx++
 			obIdx++
 		}
 	}
-	ret = append(ret, b.bindings()[bIdx:]...)
-	return newSorted(ret...), true
+	ret.b = append(ret.b, b.b[bIdx:]...)
+	return ret.built().inherit(b), true
+}
+
+// satisfiedBy returns true if the provided reference is satisfied under the
+// provided Comparison by the provided bound value, or, if it is a BoundSet, by
+// any of its members.
+func satisfiedBy(c Comparison, ref, bound BoundValue) bool {
+	if set, ok := bound.(*BoundSet); ok {
+		for _, m := range set.members {
+			if satisfiedBy(c, ref, m) {
+				return true
+			}
+		}
+		return false
+	}
+	cmp, err := ref.CompareValues(bound)
+	return err == nil && c.Holds(cmp)
 }
 
 // Eq compares the receiver and the argument.  Bindings are identical iff they
-// are of the same type and have the same keys bound to the same values.
+// are of the same type and have the same keys bound to the same values, with
+// the same Comparisons; whether those values are overwriting is not
+// considered.  Bindings with different Hashes are never identical.
 func (b *Bindings) Eq(ob *Bindings) bool {
-	if b.Length() != ob.Length() {
+	if b == ob {
+		return true
+	}
+	if b.Length() != ob.Length() || b.Hash() != ob.Hash() {
 		return false
 	}
 	for idx := 0; idx < b.Length(); idx++ {
-		bBV, oBV := b.bindings()[idx], ob.bindings()[idx]
-		if bBV.Key() != oBV.Key() {
+		bE, oE := b.b[idx], ob.b[idx]
+		if bE.id != oE.id {
 			return false
 		}
-		if cmp, err := bBV.CompareValues(oBV); cmp != 0 || err != nil {
+		if cmp, err := bE.bv.CompareValues(oE.bv); cmp != 0 || err != nil {
+			return false
+		}
+		if b.ComparisonOf(bE.bv.Key()) != ob.ComparisonOf(oE.bv.Key()) {
 			return false
 		}
 	}
 	return true
 }
 
+// Offset returns a copy of the receiver with n added to each of its values,
+// all of which must be BoundInts.
+func (b *Bindings) Offset(n int) (*Bindings, error) {
+	if b.Length() == 0 || n == 0 {
+		return b, nil
+	}
+	ret := newBuilder(b.Length())
+	for _, e := range b.b {
+		bi, ok := e.bv.(*BoundInt)
+		if !ok {
+			return nil, &TypeMismatchError{e.bv.Key(), e.bv, "int"}
+		}
+		ret.b = append(ret.b, newEntry(Int(bi.key, bi.value+n), e.id))
+	}
+	return ret.built().inherit(b), nil
+}
+
+// Without returns a copy of the receiver with the provided keys, if present,
+// removed.
+func (b *Bindings) Without(keys ...string) *Bindings {
+	ret := newBuilder(b.Length())
+	for _, e := range b.entries() {
+		if !contains(keys, e.bv.Key()) {
+			ret.b = append(ret.b, e)
+		}
+	}
+	if len(ret.b) == b.Length() {
+		return b
+	}
+	return ret.built().inherit(b)
+}
+
+func contains(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
 // Keys returns the set of bound names in the receiver.
 func (b *Bindings) Keys() map[string]struct{} {
 	ret := map[string]struct{}{}
-	for _, bv := range b.bindings() {
-		ret[bv.Key()] = struct{}{}
+	for _, e := range b.entries() {
+		ret[e.bv.Key()] = struct{}{}
 	}
 	return ret
 }
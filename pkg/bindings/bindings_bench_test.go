@@ -41,6 +41,7 @@ type testType int
 const (
 	combine testType = iota
 	satisfy
+	eq
 )
 
 func (tt testType) String() string {
@@ -49,6 +50,8 @@ func (tt testType) String() string {
 		return "combine"
 	case satisfy:
 		return "satisfy"
+	case eq:
+		return "eq"
 	default:
 		return "unknown"
 	}
@@ -70,6 +73,7 @@ func bench(b *testing.B, tt testType, boundValues [][]BoundValue, profFile strin
 		pprof.StartCPUProfile(f)
 		defer pprof.StopCPUProfile()
 	}
+	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
 		cursor = bindings[0]
 		for _, binding := range bindings[1:] {
@@ -80,6 +84,9 @@ func bench(b *testing.B, tt testType, boundValues [][]BoundValue, profFile strin
 				newCursor, err = cursor.Combine(binding)
 			case satisfy:
 				newCursor, _ = cursor.Satisfy(binding)
+			case eq:
+				cursor.Eq(binding)
+				newCursor = cursor
 			default:
 				b.Fatalf("Unsupported test type %v", tt)
 			}
@@ -104,6 +111,36 @@ var shortKeyInts = [][]BoundValue{
 	},
 }
 
+// singleInts are the small Bindings most common in practice.
+var singleInts = [][]BoundValue{
+	{
+		Int("a", 1),
+	}, {
+		Int("b", 2),
+	},
+}
+
+// veryLongKey returns a long key, whose equality to another is expensive to
+// test, with the provided suffix.  Each call returns a distinct string, as keys
+// parsed from different parts of an expression are.
+func veryLongKey(suffix string) string {
+	return fmt.Sprintf("the.quite.deeply.nested.and.therefore.rather.lengthy.variable.%s", suffix)
+}
+
+var veryLongKeyInts = [][]BoundValue{
+	{
+		Int(veryLongKey("a"), 1),
+		Int(veryLongKey("b"), 2),
+	}, {
+		Int(veryLongKey("a"), 1),
+		Int(veryLongKey("b"), 2),
+		Int(veryLongKey("c"), 3),
+	}, {
+		Int(veryLongKey("b"), 2),
+		Int(veryLongKey("c"), 3),
+	},
+}
+
 var longKeyInts = [][]BoundValue{
 	{
 		Int("Phenomenal", 1),
@@ -216,3 +253,23 @@ func BenchmarkCombineLongKeyLongStrings(b *testing.B) {
 func BenchmarkSatisfyLongKeyLongStrings(b *testing.B) {
 	bench(b, satisfy, longKeyLongStrings, noProf)
 }
+
+func BenchmarkCombineSingleInts(b *testing.B) {
+	bench(b, combine, singleInts, noProf)
+}
+
+func BenchmarkSatisfySingleInts(b *testing.B) {
+	bench(b, satisfy, singleInts, noProf)
+}
+
+func BenchmarkCombineVeryLongKeyInts(b *testing.B) {
+	bench(b, combine, veryLongKeyInts, noProf)
+}
+
+func BenchmarkSatisfyVeryLongKeyInts(b *testing.B) {
+	bench(b, satisfy, veryLongKeyInts, noProf)
+}
+
+func BenchmarkEqVeryLongKeyInts(b *testing.B) {
+	bench(b, eq, veryLongKeyInts, noProf)
+}
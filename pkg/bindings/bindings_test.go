@@ -15,6 +15,8 @@
 package bindings
 
 import (
+    "encoding/json"
+    "errors"
     "fmt"
     "testing"
 )
@@ -104,6 +106,249 @@ func TestCombineBindings(t *testing.T) {
     }
 }
 
+func TestOverwriting(t *testing.T) {
+    tests := []struct {
+        desc                   string
+        a, b                   *Bindings
+        overwriting            bool
+        want                   *Bindings
+        wantErr, wantOverwrite bool
+    }{
+        {"CombineOverwriting replaces", b(t, String("a", "1"), String("b", "2")), b(t, String("a", "3")), true, b(t, String("a", "3"), String("b", "2")), false, false},
+        {"CombineOverwriting replaces types", b(t, Int("a", 1)), b(t, String("a", "1")), true, b(t, String("a", "1")), false, false},
+        {"overwriting argument replaces", b(t, String("a", "1")), b(t, String("a", "2")).Overwriting(), false, b(t, String("a", "2")), false, true},
+        {"overwriting receiver conflicts", b(t, String("a", "1")).Overwriting(), b(t, String("a", "2")), false, nil, true, false},
+        {"overwriting receiver survives", b(t, String("a", "1")).Overwriting(), b(t, String("b", "2")), false, b(t, String("a", "1"), String("b", "2")), false, true},
+    }
+    for _, test := range tests {
+        t.Run(test.desc, func(t *testing.T) {
+            combine := test.a.Combine
+            if test.overwriting {
+                combine = test.a.CombineOverwriting
+            }
+            got, err := combine(test.b)
+            if (err != nil) != test.wantErr {
+                t.Fatalf("Got error %v, wanted error %t", err, test.wantErr)
+            }
+            if test.wantErr {
+                return
+            }
+            if !got.Eq(test.want) {
+                t.Fatalf("Wanted %s, got %s", test.want, got)
+            }
+            if got.Overwrites("a") != test.wantOverwrite {
+                t.Errorf("Got Overwrites(\"a\") %t, wanted %t", got.Overwrites("a"), test.wantOverwrite)
+            }
+        })
+    }
+}
+
+func TestComparisons(t *testing.T) {
+    tests := []struct {
+        ref           *Bindings
+        cmp           Comparison
+        bound         *Bindings
+        wantSatisfied bool
+    }{
+        {b(t, Int("a", 2)), Greater, b(t, Int("a", 1)), true},
+        {b(t, Int("a", 1)), Greater, b(t, Int("a", 1)), false},
+        {b(t, Int("a", 1)), GreaterOrEqual, b(t, Int("a", 1)), true},
+        {b(t, Int("a", 1)), Less, b(t, Int("a", 2)), true},
+        {b(t, Int("a", 2)), LessOrEqual, b(t, Int("a", 1)), false},
+        {b(t, String("a", "x")), NotEqual, b(t, String("a", "y")), true},
+        {b(t, String("a", "x")), NotEqual, b(t, String("a", "x")), false},
+        {b(t, String("a", "x")), NotEqual, b(t, Int("a", 1)), false},
+        {b(t, Int("a", 2), Int("b", 1)), Greater, b(t, Int("a", 1)), true},
+    }
+    for _, test := range tests {
+        ref := test.ref.Comparing(test.cmp)
+        t.Run(fmt.Sprintf("Satisfy(%s, %s)", ref, test.bound), func(t *testing.T) {
+            got, satisfied := ref.Satisfy(test.bound)
+            if satisfied != test.wantSatisfied {
+                t.Fatalf("Got satisfied %t, wanted %t", satisfied, test.wantSatisfied)
+            }
+            for key := range got.Keys() {
+                if got.ComparisonOf(key) != test.cmp {
+                    t.Errorf("Remaining reference %s has comparison %s, wanted %s", key, got.ComparisonOf(key), test.cmp)
+                }
+            }
+        })
+    }
+    if b(t, Int("a", 1)).Eq(b(t, Int("a", 1)).Comparing(Greater)) {
+        t.Errorf("Bindings with different comparisons were equal")
+    }
+}
+
+func TestOffset(t *testing.T) {
+    got, err := b(t, Int("a", 1), Int("b", 5)).Comparing(Greater).Offset(-2)
+    if err != nil {
+        t.Fatalf("Offset() yielded unexpected error %s", err)
+    }
+    if want := b(t, Int("a", -1), Int("b", 3)).Comparing(Greater); !got.Eq(want) {
+        t.Errorf("Wanted %s, got %s", want, got)
+    }
+    if _, err := b(t, String("a", "1")).Offset(1); !errors.Is(err, ErrTypeMismatch) {
+        t.Errorf("Got error %v offsetting a string, wanted %v", err, ErrTypeMismatch)
+    }
+}
+
+func TestAccessors(t *testing.T) {
+    bs := b(t, String("c", "3"), Int("a", 1), String("b", "2"))
+    if bv, ok := bs.Get("b"); !ok || bv.String() != "b:2" {
+        t.Errorf("Get(b) = %v, %t, wanted b:2, true", bv, ok)
+    }
+    if bv, ok := bs.Get("d"); ok {
+        t.Errorf("Get(d) = %v, %t, wanted nil, false", bv, ok)
+    }
+    var nilBindings *Bindings
+    if _, ok := nilBindings.Get("a"); ok {
+        t.Errorf("Get(a) on nil Bindings returned true")
+    }
+    var keys []string
+    bs.Range(func(bv BoundValue) bool {
+        keys = append(keys, bv.Key())
+        return bv.Key() != "b"
+    })
+    if got := fmt.Sprint(keys); got != "[a b]" {
+        t.Errorf("Range visited %s, wanted [a b]", got)
+    }
+    if got, want := bs.Without("a", "c", "d"), b(t, String("b", "2")); !got.Eq(want) {
+        t.Errorf("Without(a, c, d) = %s, wanted %s", got, want)
+    }
+    if got := bs.Without(); got != bs {
+        t.Errorf("Without() = %s, wanted the receiver", got)
+    }
+}
+
+func TestIntern(t *testing.T) {
+    key := fmt.Sprintf("%s.%s", "long", "key")
+    if intern(key) != intern("long.key") {
+        t.Errorf("Equal keys were interned differently")
+    }
+    if intern(key) == intern("long.keys") {
+        t.Errorf("Different keys were interned the same")
+    }
+}
+
+func TestHash(t *testing.T) {
+    rec := func(a, b int) BoundValue {
+        r, err := Record("r", Int("a", a), Int("b", b))
+        if err != nil {
+            t.Fatalf("Record() yielded unexpected error %s", err)
+        }
+        return r
+    }
+    combined, err := b(t, String("a", "1")).Combine(b(t, rec(1, 2)))
+    if err != nil {
+        t.Fatalf("Combine() yielded unexpected error %s", err)
+    }
+    same := b(t, rec(1, 2), String("a", "1"))
+    if !combined.Eq(same) || combined.Hash() != same.Hash() {
+        t.Errorf("Equal Bindings %s and %s had hashes %x and %x", combined, same, combined.Hash(), same.Hash())
+    }
+    for _, other := range []*Bindings{
+        b(t, rec(2, 1), String("a", "1")),
+        b(t, rec(1, 2), String("b", "1")),
+        b(t, rec(1, 2)),
+    } {
+        if other.Hash() == same.Hash() {
+            t.Errorf("Different Bindings %s and %s had the same hash", other, same)
+        }
+    }
+    var nilBindings *Bindings
+    if nilBindings.Hash() != (&Bindings{}).Hash() {
+        t.Errorf("Empty Bindings had different hashes")
+    }
+}
+
+func TestCollation(t *testing.T) {
+    upper, lower := CollatedString("a", "X", CaseInsensitive), CollatedString("a", "x", CaseInsensitive)
+    if cmp, err := upper.CompareValues(lower); err != nil || cmp != 0 {
+        t.Errorf("%s.CompareValues(%s) = %d, %v, wanted 0, nil", upper, lower, cmp, err)
+    }
+    if cmp, err := upper.CompareValues(CollatedString("a", "y", CaseInsensitive)); err != nil || cmp >= 0 {
+        t.Errorf("%s.CompareValues(a:y) = %d, %v, wanted less than 0, nil", upper, cmp, err)
+    }
+    if _, err := upper.CompareValues(String("a", "X")); !errors.Is(err, ErrTypeMismatch) {
+        t.Errorf("Comparing differently-collated strings yielded error %v, wanted %v", err, ErrTypeMismatch)
+    }
+    if bu, bl := b(t, upper), b(t, lower); !bu.Eq(bl) || bu.Hash() != bl.Hash() {
+        t.Errorf("Case-insensitively equal Bindings %s and %s were not Eq with equal Hashes", bu, bl)
+    }
+    if _, ok := b(t, upper).Satisfy(b(t, lower)); !ok {
+        t.Errorf("Case-insensitive reference was not satisfied by a value differing in case")
+    }
+}
+
+func TestMergePolicies(t *testing.T) {
+    set := func(key string, members ...BoundValue) BoundValue {
+        bs, err := Set(key, members...)
+        if err != nil {
+            t.Fatalf("Set() yielded unexpected error %s", err)
+        }
+        return bs
+    }
+    first, last := b(t, String("a", "1"), Int("b", 2)), b(t, String("a", "2"))
+    tests := []struct {
+        policy  MergePolicy
+        want    *Bindings
+        wantErr bool
+    }{
+        {ErrorOnConflict, nil, true},
+        {KeepFirst, first, false},
+        {KeepLast, b(t, String("a", "2"), Int("b", 2)), false},
+        {CollectSet, b(t, set("a", String("a", "1"), String("a", "2")), Int("b", 2)), false},
+    }
+    for _, test := range tests {
+        t.Run(test.policy.String(), func(t *testing.T) {
+            got, err := first.CombineWith(last, test.policy)
+            if (err != nil) != test.wantErr {
+                t.Fatalf("CombineWith() yielded error %v, wanted error %t", err, test.wantErr)
+            }
+            if err == nil && !got.Eq(test.want) {
+                t.Errorf("CombineWith() = %s, wanted %s", got, test.want)
+            }
+            // Per-key policies on the argument apply to Combine.
+            got, err = first.Combine(last.WithPolicy(test.policy))
+            if (err != nil) != test.wantErr {
+                t.Fatalf("Combine() yielded error %v, wanted error %t", err, test.wantErr)
+            }
+            if err == nil && !got.Eq(test.want) {
+                t.Errorf("Combine() = %s, wanted %s", got, test.want)
+            }
+        })
+    }
+    // Sets of equal members collapse, and nested sets flatten.
+    if got := set("a", String("a", "1"), set("a", String("a", "1"))); got.String() != "a:{1}" {
+        t.Errorf("Set() = %s, wanted a:{1}", got)
+    }
+    // Resolve lets values with a policy replace, or join, those they conflict
+    // with.
+    got, err := b(t, String("a", "1")).Resolve(b(t, String("a", "2")).WithPolicy(KeepFirst))
+    if err != nil {
+        t.Fatalf("Resolve() yielded unexpected error %s", err)
+    }
+    if want := b(t, String("a", "2")); !got.Eq(want) {
+        t.Errorf("Resolve() = %s, wanted %s", got, want)
+    }
+    if _, err := b(t, String("a", "1")).Resolve(b(t, String("a", "2"))); err == nil {
+        t.Errorf("Resolve() of conflicting values yielded no error")
+    }
+    // A set satisfies a reference if any of its members does.
+    bound := b(t, set("a", String("a", "1"), String("a", "2")))
+    for _, test := range []struct {
+        ref           *Bindings
+        wantSatisfied bool
+    }{
+        {b(t, String("a", "2")), true},
+        {b(t, String("a", "3")), false},
+    } {
+        if _, satisfied := test.ref.Satisfy(bound); satisfied != test.wantSatisfied {
+            t.Errorf("%s.Satisfy(%s) = %t, wanted %t", test.ref, bound, satisfied, test.wantSatisfied)
+        }
+    }
+}
+
 func TestSatisfyBindings(t *testing.T) {
     tests := []struct {
         a, b, want    *Bindings
@@ -175,3 +420,185 @@ func TestCompareBindings(t *testing.T) {
         })
     }
 }
+
+func TestErrors(t *testing.T) {
+    tests := []struct {
+        a, b    *Bindings
+        wantIs  error
+        wantKey string
+    }{
+        {b(t, String("a", "1")), b(t, String("a", "2")), ErrConflict, "a"},
+        {b(t, Int("b", 1)), b(t, Int("b", 2)), ErrConflict, "b"},
+        {b(t, Int("a", 1)), b(t, String("a", "1")), ErrTypeMismatch, "a"},
+    }
+    for _, test := range tests {
+        t.Run(fmt.Sprintf("Combine(%s, %s)", test.a, test.b), func(t *testing.T) {
+            _, err := test.a.Combine(test.b)
+            if !errors.Is(err, test.wantIs) {
+                t.Fatalf("Got error %v, wanted %v", err, test.wantIs)
+            }
+            var key string
+            var ce *ConflictError
+            var tme *TypeMismatchError
+            if errors.As(err, &ce) {
+                key = ce.Key
+            } else if errors.As(err, &tme) {
+                key = tme.Key
+            }
+            if key != test.wantKey {
+                t.Errorf("Got key %q, wanted %q", key, test.wantKey)
+            }
+        })
+    }
+    if _, err := New(String("a", "1"), Int("a", 1)); !errors.Is(err, ErrConflict) {
+        t.Errorf("Got error %v from New, wanted %v", err, ErrConflict)
+    }
+}
+
+func TestRecords(t *testing.T) {
+    rec := func(key string, fields ...BoundValue) *BoundRecord {
+        r, err := Record(key, fields...)
+        if err != nil {
+            t.Fatalf("Failed to create record: %s", err)
+        }
+        return r
+    }
+    tests := []struct {
+        a, b    *Bindings
+        wantErr error
+    }{
+        {b(t, rec("r", Int("pid", 1), Int("tid", 2))), b(t, rec("r", Int("tid", 2), Int("pid", 1))), nil},
+        {b(t, rec("r", Int("pid", 1), Int("tid", 2))), b(t, rec("r", Int("pid", 1), Int("tid", 3))), ErrConflict},
+        {b(t, rec("r", Int("pid", 1), Int("tid", 2))), b(t, rec("r", Int("pid", 1))), ErrTypeMismatch},
+        {b(t, rec("r", Int("pid", 1))), b(t, rec("r", String("pid", "1"))), ErrTypeMismatch},
+        {b(t, rec("r", Int("pid", 1))), b(t, Int("r", 1)), ErrTypeMismatch},
+        {b(t, rec("r", rec("p", Int("pid", 1)))), b(t, rec("r", rec("p", Int("pid", 2)))), ErrConflict},
+    }
+    for _, test := range tests {
+        t.Run(fmt.Sprintf("Combine(%s, %s)", test.a, test.b), func(t *testing.T) {
+            _, err := test.a.Combine(test.b)
+            if test.wantErr == nil && err != nil {
+                t.Fatalf("Expected no error but got %s", err)
+            }
+            if test.wantErr != nil && !errors.Is(err, test.wantErr) {
+                t.Fatalf("Got error %v, wanted %v", err, test.wantErr)
+            }
+        })
+    }
+    r := rec("r", Int("pid", 1), String("name", "x"))
+    if got, want := r.String(), "r:{name:x, pid:1}"; got != want {
+        t.Errorf("Got %s, wanted %s", got, want)
+    }
+    if f, ok := r.Field("pid"); !ok || f.String() != "pid:1" {
+        t.Errorf("Field(pid) = %v, %t, wanted pid:1", f, ok)
+    }
+    if _, ok := r.Field("tid"); ok {
+        t.Errorf("Field(tid) unexpectedly found")
+    }
+    if _, err := Record("r", Int("pid", 1), Int("pid", 2)); err == nil {
+        t.Errorf("Record() with duplicate fields yielded no error")
+    }
+}
+
+func TestStructs(t *testing.T) {
+    type pt struct{ x, y int }
+    cmp := func(a, b interface{}) int {
+        pa, pb := a.(pt), b.(pt)
+        if pa.x != pb.x {
+            return pa.x - pb.x
+        }
+        return pa.y - pb.y
+    }
+    p := func(x, y int) *Bindings {
+        return b(t, Struct("p", "pt", pt{x, y}, cmp))
+    }
+    if _, err := p(1, 2).Combine(p(1, 2)); err != nil {
+        t.Errorf("Combining equal structs yielded unexpected error %s", err)
+    }
+    if _, err := p(1, 2).Combine(p(1, 3)); !errors.Is(err, ErrConflict) {
+        t.Errorf("Combining differing structs yielded %v, wanted %v", err, ErrConflict)
+    }
+    if _, err := p(1, 2).Combine(b(t, Struct("p", "other", pt{1, 2}, cmp))); !errors.Is(err, ErrTypeMismatch) {
+        t.Errorf("Combining structs of different types yielded %v, wanted %v", err, ErrTypeMismatch)
+    }
+}
+
+func TestJSON(t *testing.T) {
+    type point struct{ x, y int }
+    cmpPoints := func(a, b interface{}) int {
+        pa, pb := a.(point), b.(point)
+        if pa.x != pb.x {
+            return pa.x - pb.x
+        }
+        return pa.y - pb.y
+    }
+    rec, err := Record("r", Int("pid", 1), String("name", "x"))
+    if err != nil {
+        t.Fatalf("Record() yielded unexpected error %s", err)
+    }
+    set, err := Set("s", Int("s", 1), Int("s", 2))
+    if err != nil {
+        t.Fatalf("Set() yielded unexpected error %s", err)
+    }
+    plain := b(t, String("a", "1"), Int("b", 2), rec, set)
+    withFlags, err := b(t, String("c", "3")).Overwriting().Combine(b(t, Int("d", 4)).Comparing(Greater))
+    if err != nil {
+        t.Fatalf("Combine() yielded unexpected error %s", err)
+    }
+    withPolicy := b(t, String("e", "5")).WithPolicy(CollectSet)
+    collated := b(t, CollatedString("f", "F", CaseInsensitive))
+    for _, want := range []*Bindings{plain, withFlags, withPolicy, collated, nil} {
+        t.Run(fmt.Sprintf("%s", want), func(t *testing.T) {
+            data, err := json.Marshal(want)
+            if err != nil {
+                t.Fatalf("Marshal() yielded unexpected error %s", err)
+            }
+            got := &Bindings{}
+            if err := json.Unmarshal(data, got); err != nil {
+                t.Fatalf("Unmarshal(%s) yielded unexpected error %s", data, err)
+            }
+            if !got.Eq(want) {
+                t.Errorf("Unmarshal(%s) = %s, wanted %s", data, got, want)
+            }
+            for key := range want.Keys() {
+                if got.Overwrites(key) != want.Overwrites(key) {
+                    t.Errorf("Unmarshal(%s) lost overwriting for %s", data, key)
+                }
+                if got.PolicyOf(key) != want.PolicyOf(key) {
+                    t.Errorf("Unmarshal(%s) lost the policy for %s", data, key)
+                }
+            }
+        })
+    }
+    pt := Struct("p", "point", point{1, 2}, cmpPoints)
+    if _, err := MarshalBoundValue(pt); err == nil {
+        t.Errorf("MarshalBoundValue() of an unregistered type yielded no error")
+    }
+    RegisterJSONType("point", &JSONType{
+        Encode: func(bv BoundValue) (interface{}, bool) {
+            if bs, ok := bv.(*BoundStruct); ok && bs.Type() == "point" {
+                p := bs.Value().(point)
+                return []int{p.x, p.y}, true
+            }
+            return nil, false
+        },
+        Decode: func(key string, value json.RawMessage) (BoundValue, error) {
+            var xy []int
+            if err := json.Unmarshal(value, &xy); err != nil {
+                return nil, err
+            }
+            return Struct(key, "point", point{xy[0], xy[1]}, cmpPoints), nil
+        },
+    })
+    data, err := MarshalBoundValue(pt)
+    if err != nil {
+        t.Fatalf("MarshalBoundValue() yielded unexpected error %s", err)
+    }
+    got, err := UnmarshalBoundValue(data)
+    if err != nil {
+        t.Fatalf("UnmarshalBoundValue(%s) yielded unexpected error %s", data, err)
+    }
+    if cmp, err := got.CompareValues(pt); err != nil || cmp != 0 {
+        t.Errorf("UnmarshalBoundValue(%s) = %s, wanted %s", data, got, pt)
+    }
+}
@@ -41,11 +41,16 @@ func (bi *BoundInt) Type() string {
 func (bi *BoundInt) CompareValues(obv BoundValue) (int, error) {
 	obi, ok := obv.(*BoundInt)
 	if !ok {
-		return 0, fmt.Errorf("BoundValue %s had type %T, expected *BoundInt", obv, obv)
+		return 0, &TypeMismatchError{bi.key, obv, bi.Type()}
 	}
 	return bi.value - obi.value, nil
 }
 
+// Value returns the int value of the receiver.
+func (bi *BoundInt) Value() int {
+	return bi.value
+}
+
 // Key returns the key of the receiver.
 func (bi *BoundInt) Key() string {
 	return bi.key
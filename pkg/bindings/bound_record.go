@@ -0,0 +1,107 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bindings
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// BoundRecord is a set of named fields, each itself a BoundValue, bound
+// together to a single key, so that a single binder can capture a whole
+// record, such as a process and thread ID pair.  BoundRecords compare
+// field-by-field, so they are equal only if all their fields are.
+type BoundRecord struct {
+	key string
+	// fields is stored by increasing field name.
+	fields []BoundValue
+}
+
+// Record returns a BoundRecord binding the provided fields to a key.  Each
+// field's Key is its field name.  It returns an error if two fields have the
+// same name.
+func Record(key string, fields ...BoundValue) (*BoundRecord, error) {
+	fields = append([]BoundValue{}, fields...)
+	sort.Slice(fields, func(a, b int) bool {
+		return fields[a].Key() < fields[b].Key()
+	})
+	for idx := 1; idx < len(fields); idx++ {
+		if fields[idx-1].Key() == fields[idx].Key() {
+			return nil, fmt.Errorf("record %s has duplicate field %s", key, fields[idx].Key())
+		}
+	}
+	return &BoundRecord{
+		key:    key,
+		fields: fields,
+	}, nil
+}
+
+// Type returns 'record{...}' for BoundRecords, listing their fields' names
+// and types, so that records with different fields have different Types.
+func (br *BoundRecord) Type() string {
+	fieldTypes := make([]string, len(br.fields))
+	for idx, field := range br.fields {
+		fieldTypes[idx] = field.Key() + ":" + field.Type()
+	}
+	return fmt.Sprintf("record{%s}", strings.Join(fieldTypes, ", "))
+}
+
+// CompareValues compares the receiver and argument field-by-field, in order
+// of field name.
+func (br *BoundRecord) CompareValues(obv BoundValue) (int, error) {
+	obr, ok := obv.(*BoundRecord)
+	if !ok || br.Type() != obr.Type() {
+		return 0, &TypeMismatchError{br.key, obv, br.Type()}
+	}
+	for idx, field := range br.fields {
+		cmp, err := field.CompareValues(obr.fields[idx])
+		if err != nil || cmp != 0 {
+			return cmp, err
+		}
+	}
+	return 0, nil
+}
+
+// Field returns the field of the receiver with the provided name, and true,
+// or false if it has none.
+func (br *BoundRecord) Field(name string) (BoundValue, bool) {
+	idx := sort.Search(len(br.fields), func(idx int) bool {
+		return br.fields[idx].Key() >= name
+	})
+	if idx < len(br.fields) && br.fields[idx].Key() == name {
+		return br.fields[idx], true
+	}
+	return nil, false
+}
+
+// Fields returns the fields of the receiver, in order of field name.  The
+// returned slice must not be modified.
+func (br *BoundRecord) Fields() []BoundValue {
+	return br.fields
+}
+
+// Key returns the key of the receiver.
+func (br *BoundRecord) Key() string {
+	return br.key
+}
+
+func (br *BoundRecord) String() string {
+	fieldStrs := make([]string, len(br.fields))
+	for idx, field := range br.fields {
+		fieldStrs[idx] = field.String()
+	}
+	return fmt.Sprintf("%s:{%s}", br.key, strings.Join(fieldStrs, ", "))
+}
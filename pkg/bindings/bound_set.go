@@ -0,0 +1,126 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bindings
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// BoundSet is a set of distinct values, all of the same type, bound together
+// to a single key, as collected under the CollectSet MergePolicy.  A reference
+// is satisfied by a BoundSet if it is satisfied by any of its members.
+type BoundSet struct {
+	key string
+	// members is stored in increasing order, and holds no BoundSets.
+	members []BoundValue
+}
+
+// Set returns a BoundSet binding the provided members, which must all have
+// the provided key and the same type, to that key.  Members that are
+// themselves BoundSets contribute their own members.
+func Set(key string, members ...BoundValue) (*BoundSet, error) {
+	var flat []BoundValue
+	for _, m := range members {
+		if m.Key() != key {
+			return nil, fmt.Errorf("set %s has member %s with a different key", key, m)
+		}
+		if bs, ok := m.(*BoundSet); ok {
+			flat = append(flat, bs.members...)
+		} else {
+			flat = append(flat, m)
+		}
+	}
+	var err error
+	sort.SliceStable(flat, func(a, b int) bool {
+		cmp, cmpErr := flat[a].CompareValues(flat[b])
+		if cmpErr != nil && err == nil {
+			err = cmpErr
+		}
+		return cmp < 0
+	})
+	if err != nil {
+		return nil, err
+	}
+	ret := &BoundSet{key: key}
+	for _, m := range flat {
+		if len(ret.members) > 0 {
+			if cmp, _ := ret.members[len(ret.members)-1].CompareValues(m); cmp == 0 {
+				continue
+			}
+		}
+		ret.members = append(ret.members, m)
+	}
+	return ret, nil
+}
+
+// collect returns the union of the provided values, which may be BoundSets,
+// or the single value they hold if they are equal.
+func collect(a, b BoundValue) (BoundValue, error) {
+	set, err := Set(a.Key(), a, b)
+	if err != nil {
+		return nil, err
+	}
+	if len(set.members) == 1 {
+		return set.members[0], nil
+	}
+	return set, nil
+}
+
+// Type returns 'set{...}' for BoundSets, with the type of their members.
+func (bs *BoundSet) Type() string {
+	memberType := ""
+	if len(bs.members) > 0 {
+		memberType = bs.members[0].Type()
+	}
+	return fmt.Sprintf("set{%s}", memberType)
+}
+
+// CompareValues compares the receiver and argument member-by-member, in
+// increasing order; where one's members are a prefix of the other's, the
+// shorter BoundSet is less.
+func (bs *BoundSet) CompareValues(obv BoundValue) (int, error) {
+	obs, ok := obv.(*BoundSet)
+	if !ok || bs.Type() != obs.Type() {
+		return 0, &TypeMismatchError{bs.key, obv, bs.Type()}
+	}
+	for idx := 0; idx < len(bs.members) && idx < len(obs.members); idx++ {
+		cmp, err := bs.members[idx].CompareValues(obs.members[idx])
+		if err != nil || cmp != 0 {
+			return cmp, err
+		}
+	}
+	return len(bs.members) - len(obs.members), nil
+}
+
+// Members returns the members of the receiver, in increasing order.  The
+// returned slice must not be modified.
+func (bs *BoundSet) Members() []BoundValue {
+	return bs.members
+}
+
+// Key returns the key of the receiver.
+func (bs *BoundSet) Key() string {
+	return bs.key
+}
+
+func (bs *BoundSet) String() string {
+	memberStrs := make([]string, len(bs.members))
+	for idx, m := range bs.members {
+		memberStrs[idx] = strings.TrimPrefix(m.String(), bs.key+":")
+	}
+	return fmt.Sprintf("%s:{%s}", bs.key, strings.Join(memberStrs, ", "))
+}
@@ -19,9 +19,11 @@ import (
 	"strings"
 )
 
-// BoundString is a single string bound to a key.
+// BoundString is a single string bound to a key.  Its value may compare
+// under a Collation, such as CaseInsensitive.
 type BoundString struct {
 	key, value string
+	collation  Collation
 }
 
 // String returns an string value bound to a key.
@@ -32,20 +34,48 @@ func String(key, value string) *BoundString {
 	}
 }
 
-// Type returns 'string' for BoundStrings.
+// CollatedString returns a string value bound to a key, which compares under
+// the provided Collation.
+func CollatedString(key, value string, collation Collation) *BoundString {
+	return &BoundString{
+		key:       key,
+		value:     value,
+		collation: collation,
+	}
+}
+
+// Type returns 'string' for BoundStrings, or, for those with a Collation,
+// 'string/' followed by the Collation's Name.
 func (bs *BoundString) Type() string {
+	if bs.collation != nil {
+		return "string/" + bs.collation.Name()
+	}
 	return "string"
 }
 
-// CompareValues compares the receiver and argument.
+// CompareValues compares the receiver and argument, under their Collation if
+// they have one.  BoundStrings with different Collations cannot be compared.
 func (bs *BoundString) CompareValues(obv BoundValue) (int, error) {
 	obs, ok := obv.(*BoundString)
-	if !ok {
-		return 0, fmt.Errorf("BoundValue %s had type %T, expected *BoundString", obv, obv)
+	if !ok || bs.Type() != obs.Type() {
+		return 0, &TypeMismatchError{bs.key, obv, bs.Type()}
+	}
+	if bs.collation != nil {
+		return bs.collation.Compare(bs.value, obs.value), nil
 	}
 	return strings.Compare(bs.value, obs.value), nil
 }
 
+// Value returns the string value of the receiver.
+func (bs *BoundString) Value() string {
+	return bs.value
+}
+
+// Collation returns the Collation of the receiver, or nil if it has none.
+func (bs *BoundString) Collation() Collation {
+	return bs.collation
+}
+
 // Key returns the key of the receiver.
 func (bs *BoundString) Key() string {
 	return bs.key
@@ -0,0 +1,72 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bindings
+
+import (
+	"fmt"
+)
+
+// Comparator returns <0, 0, or >0 if a compares less than, equal to, or
+// greater than b, respectively.
+type Comparator func(a, b interface{}) int
+
+// BoundStruct is an arbitrary value, such as a struct, bound to a key, and
+// compared by a user-provided Comparator.
+type BoundStruct struct {
+	key, typ string
+	value    interface{}
+	cmp      Comparator
+}
+
+// Struct returns a BoundStruct binding the provided value to a key.  typ names
+// the value's type, and must be distinct for values that cmp cannot compare;
+// cmp is only ever invoked with two values of the same typ.
+func Struct(key, typ string, value interface{}, cmp Comparator) *BoundStruct {
+	return &BoundStruct{
+		key:   key,
+		typ:   typ,
+		value: value,
+		cmp:   cmp,
+	}
+}
+
+// Type returns the type name provided to Struct.
+func (bs *BoundStruct) Type() string {
+	return bs.typ
+}
+
+// CompareValues compares the receiver and argument with the receiver's
+// Comparator.
+func (bs *BoundStruct) CompareValues(obv BoundValue) (int, error) {
+	obs, ok := obv.(*BoundStruct)
+	if !ok || bs.typ != obs.typ {
+		return 0, &TypeMismatchError{bs.key, obv, bs.Type()}
+	}
+	return bs.cmp(bs.value, obs.value), nil
+}
+
+// Value returns the value of the receiver.
+func (bs *BoundStruct) Value() interface{} {
+	return bs.value
+}
+
+// Key returns the key of the receiver.
+func (bs *BoundStruct) Key() string {
+	return bs.key
+}
+
+func (bs *BoundStruct) String() string {
+	return fmt.Sprintf("%s:%v", bs.key, bs.value)
+}
@@ -0,0 +1,50 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bindings
+
+import "strings"
+
+// Collation specifies how the values of BoundStrings compare, such as
+// case-insensitively or according to the rules of a locale.  Locale-aware
+// Collations may be built on a package like golang.org/x/text/collate.
+type Collation interface {
+	// Name identifies the Collation.  BoundStrings under Collations with
+	// different Names are of different Types, and do not compare.
+	Name() string
+	// Compare returns a value less than, equal to, or greater than zero as a
+	// is less than, equal to, or greater than b.
+	Compare(a, b string) int
+	// Key returns a form of the provided string that is the same for any two
+	// strings Compare finds equal, such as its lower-cased form.
+	Key(s string) string
+}
+
+// CaseInsensitive is a Collation under which strings differing only in case
+// are equal.
+var CaseInsensitive Collation = caseInsensitive{}
+
+type caseInsensitive struct{}
+
+func (caseInsensitive) Name() string {
+	return "case-insensitive"
+}
+
+func (ci caseInsensitive) Compare(a, b string) int {
+	return strings.Compare(ci.Key(a), ci.Key(b))
+}
+
+func (caseInsensitive) Key(s string) string {
+	return strings.ToLower(s)
+}
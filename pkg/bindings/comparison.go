@@ -0,0 +1,69 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bindings
+
+// Comparison specifies how a referenced value must compare to the value bound
+// to the same key for the reference to be satisfied.
+type Comparison int
+
+// Comparisons supported by references.  A reference with a Comparison c is
+// satisfied when its own value, compared with the bound value, is c: for
+// instance, a Greater reference is satisfied by a smaller bound value.
+const (
+	Equal Comparison = iota
+	NotEqual
+	Less
+	LessOrEqual
+	Greater
+	GreaterOrEqual
+)
+
+func (c Comparison) String() string {
+	switch c {
+	case Equal:
+		return "="
+	case NotEqual:
+		return "!="
+	case Less:
+		return "<"
+	case LessOrEqual:
+		return "<="
+	case Greater:
+		return ">"
+	case GreaterOrEqual:
+		return ">="
+	}
+	return "?"
+}
+
+// Holds returns true if cmp, the result of comparing a referenced value with
+// a bound value by CompareValues, satisfies the receiver.
+func (c Comparison) Holds(cmp int) bool {
+	switch c {
+	case Equal:
+		return cmp == 0
+	case NotEqual:
+		return cmp != 0
+	case Less:
+		return cmp < 0
+	case LessOrEqual:
+		return cmp <= 0
+	case Greater:
+		return cmp > 0
+	case GreaterOrEqual:
+		return cmp >= 0
+	}
+	return false
+}
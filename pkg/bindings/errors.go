@@ -0,0 +1,66 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bindings
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrConflict is matched, under errors.Is, by every ConflictError.
+	ErrConflict = errors.New("binding conflict")
+	// ErrTypeMismatch is matched, under errors.Is, by every
+	// TypeMismatchError.
+	ErrTypeMismatch = errors.New("binding type mismatch")
+)
+
+// ConflictError is returned when a key is bound to two different values, as
+// when combining Bindings.
+type ConflictError struct {
+	// Key is the conflicting key.
+	Key string
+	// Left and Right are the conflicting BoundValues.
+	Left, Right BoundValue
+}
+
+func (ce *ConflictError) Error() string {
+	return fmt.Sprintf("Key %s conflicts in %s and %s", ce.Key, ce.Left, ce.Right)
+}
+
+// Is returns true for ErrConflict.
+func (ce *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// TypeMismatchError is returned when two BoundValues of different types are
+// compared.
+type TypeMismatchError struct {
+	// Key is the key of the compared BoundValues.
+	Key string
+	// Got is the BoundValue of the unexpected type.
+	Got BoundValue
+	// Want is the type expected, as returned by BoundValue.Type.
+	Want string
+}
+
+func (tme *TypeMismatchError) Error() string {
+	return fmt.Sprintf("BoundValue %s had type %s, expected %s", tme.Got, tme.Got.Type(), tme.Want)
+}
+
+// Is returns true for ErrTypeMismatch.
+func (tme *TypeMismatchError) Is(target error) bool {
+	return target == ErrTypeMismatch
+}
@@ -0,0 +1,63 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bindings
+
+// FNV-1a parameters, used to hash BoundValues.
+const (
+	fnvOffset uint64 = 14695981039346656037
+	fnvPrime  uint64 = 1099511628211
+)
+
+// mix returns the provided hash updated with the provided value.  Unlike
+// FNV-1a proper, it consumes the value a word, not a byte, at a time.
+func mix(h, v uint64) uint64 {
+	h = (h ^ v) * fnvPrime
+	return h ^ h>>32
+}
+
+// hashString returns the provided hash updated with the provided string.
+func hashString(h uint64, s string) uint64 {
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= fnvPrime
+	}
+	return h
+}
+
+// hashValue returns a hash of the provided BoundValue's value, such that
+// BoundValues whose CompareValues is 0 have the same hash.  Values of types
+// it cannot hash, such as BoundStructs, all hash alike.
+func hashValue(bv BoundValue) uint64 {
+	h := fnvOffset
+	switch v := bv.(type) {
+	case *BoundString:
+		if v.collation != nil {
+			h = hashString(h, v.collation.Key(v.value))
+		} else {
+			h = hashString(h, v.value)
+		}
+	case *BoundInt:
+		h = mix(h, uint64(v.value))
+	case *BoundRecord:
+		for _, field := range v.fields {
+			h = mix(hashString(h, field.Key()), hashValue(field))
+		}
+	case *BoundSet:
+		for _, member := range v.members {
+			h = mix(h, hashValue(member))
+		}
+	}
+	return h
+}
@@ -0,0 +1,47 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bindings
+
+import "sync"
+
+// keyID is the interned identity of a key: two keys are equal iff their
+// keyIDs are.
+type keyID uint32
+
+var (
+	internMu sync.Mutex
+	// internedKeys maps interned keys to their keyIDs.  It is only added to,
+	// under internMu, and is otherwise read without locking.
+	internedKeys sync.Map
+	nextKeyID    keyID
+)
+
+// intern returns the keyID of the provided key, assigning it one if it has
+// none.  Keys are the names of bound variables, of which any program uses only
+// a few, so interned keys are never released.
+func intern(key string) keyID {
+	if id, ok := internedKeys.Load(key); ok {
+		return id.(keyID)
+	}
+	internMu.Lock()
+	defer internMu.Unlock()
+	if id, ok := internedKeys.Load(key); ok {
+		return id.(keyID)
+	}
+	id := nextKeyID
+	nextKeyID++
+	internedKeys.Store(key, id)
+	return id
+}
@@ -0,0 +1,317 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bindings
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// JSONType specifies how BoundValues of one type are encoded as JSON.
+type JSONType struct {
+	// Encode returns a JSON-encodable value representing the value of the
+	// provided BoundValue, and true, if it is of this type, or false
+	// otherwise.
+	Encode func(bv BoundValue) (interface{}, bool)
+	// Decode returns the BoundValue binding the value encoded in the provided
+	// JSON to the provided key.
+	Decode func(key string, value json.RawMessage) (BoundValue, error)
+}
+
+var (
+	jsonTypesMu sync.RWMutex
+	jsonTypes   = map[string]*JSONType{}
+	// jsonTypeNames holds the names of jsonTypes in registration order, in
+	// which encoding tries them.
+	jsonTypeNames []string
+)
+
+// RegisterJSONType registers the JSON encoding of a type of BoundValue under
+// the provided name, replacing any previously registered under that name, so
+// that Bindings holding BoundValues of that type may be marshaled to and
+// unmarshaled from JSON.  The types "string", "string/case-insensitive",
+// "int", "record", and "set", for BoundStrings, those with the
+// CaseInsensitive Collation, BoundInts, BoundRecords, and BoundSets, are
+// registered by default; others, such as BoundStructs and BoundStrings with
+// other Collations, must be registered before use.
+func RegisterJSONType(name string, jt *JSONType) {
+	jsonTypesMu.Lock()
+	defer jsonTypesMu.Unlock()
+	if _, ok := jsonTypes[name]; !ok {
+		jsonTypeNames = append(jsonTypeNames, name)
+	}
+	jsonTypes[name] = jt
+}
+
+func init() {
+	RegisterJSONType("string", &JSONType{
+		Encode: func(bv BoundValue) (interface{}, bool) {
+			if bs, ok := bv.(*BoundString); ok && bs.Collation() == nil {
+				return bs.Value(), true
+			}
+			return nil, false
+		},
+		Decode: func(key string, value json.RawMessage) (BoundValue, error) {
+			var s string
+			if err := json.Unmarshal(value, &s); err != nil {
+				return nil, err
+			}
+			return String(key, s), nil
+		},
+	})
+	RegisterJSONType("string/case-insensitive", &JSONType{
+		Encode: func(bv BoundValue) (interface{}, bool) {
+			if bs, ok := bv.(*BoundString); ok && bs.Collation() == CaseInsensitive {
+				return bs.Value(), true
+			}
+			return nil, false
+		},
+		Decode: func(key string, value json.RawMessage) (BoundValue, error) {
+			var s string
+			if err := json.Unmarshal(value, &s); err != nil {
+				return nil, err
+			}
+			return CollatedString(key, s, CaseInsensitive), nil
+		},
+	})
+	RegisterJSONType("int", &JSONType{
+		Encode: func(bv BoundValue) (interface{}, bool) {
+			if bi, ok := bv.(*BoundInt); ok {
+				return bi.Value(), true
+			}
+			return nil, false
+		},
+		Decode: func(key string, value json.RawMessage) (BoundValue, error) {
+			var i int
+			if err := json.Unmarshal(value, &i); err != nil {
+				return nil, err
+			}
+			return Int(key, i), nil
+		},
+	})
+	RegisterJSONType("record", &JSONType{
+		Encode: func(bv BoundValue) (interface{}, bool) {
+			if br, ok := bv.(*BoundRecord); ok {
+				return jsonFields(br.Fields()), true
+			}
+			return nil, false
+		},
+		Decode: func(key string, value json.RawMessage) (BoundValue, error) {
+			fields, err := decodeJSONList(value)
+			if err != nil {
+				return nil, err
+			}
+			return Record(key, fields...)
+		},
+	})
+	RegisterJSONType("set", &JSONType{
+		Encode: func(bv BoundValue) (interface{}, bool) {
+			if bs, ok := bv.(*BoundSet); ok {
+				return jsonFields(bs.Members()), true
+			}
+			return nil, false
+		},
+		Decode: func(key string, value json.RawMessage) (BoundValue, error) {
+			members, err := decodeJSONList(value)
+			if err != nil {
+				return nil, err
+			}
+			return Set(key, members...)
+		},
+	})
+}
+
+// decodeJSONList decodes a list of BoundValues encoded as jsonFields.
+func decodeJSONList(value json.RawMessage) ([]BoundValue, error) {
+	var jbvs []jsonBoundValue
+	if err := json.Unmarshal(value, &jbvs); err != nil {
+		return nil, err
+	}
+	ret := make([]BoundValue, len(jbvs))
+	for idx, jbv := range jbvs {
+		var err error
+		if ret[idx], err = jbv.decode(); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// jsonFields is a record's fields, or a set's members, marshaled as a list of
+// jsonBoundValues.
+type jsonFields []BoundValue
+
+func (jf jsonFields) MarshalJSON() ([]byte, error) {
+	jbvs := make([]jsonBoundValue, len(jf))
+	for idx, field := range jf {
+		var err error
+		if jbvs[idx], err = encodeJSON(field); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(jbvs)
+}
+
+// jsonBoundValue is the JSON encoding of a BoundValue.
+type jsonBoundValue struct {
+	Key   string          `json:"key"`
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+	// Overwriting, Comparison, and Policy are set for the values of
+	// overwriting and comparing Bindings, and those with MergePolicies.
+	Overwriting bool   `json:"overwriting,omitempty"`
+	Comparison  string `json:"comparison,omitempty"`
+	Policy      string `json:"policy,omitempty"`
+}
+
+func encodeJSON(bv BoundValue) (jsonBoundValue, error) {
+	name, v, ok := encodeValue(bv)
+	if !ok {
+		return jsonBoundValue{}, fmt.Errorf("no JSON type registered for bound value %s of type %s", bv, bv.Type())
+	}
+	// v is marshaled without holding jsonTypesMu, since it may itself hold
+	// BoundValues, as records do.
+	value, err := json.Marshal(v)
+	if err != nil {
+		return jsonBoundValue{}, err
+	}
+	return jsonBoundValue{Key: bv.Key(), Type: name, Value: value}, nil
+}
+
+// encodeValue returns the name of the registered JSONType of the provided
+// BoundValue and its encodable value, and true, or false if no JSONType
+// encodes it.
+func encodeValue(bv BoundValue) (string, interface{}, bool) {
+	jsonTypesMu.RLock()
+	defer jsonTypesMu.RUnlock()
+	for _, name := range jsonTypeNames {
+		if v, ok := jsonTypes[name].Encode(bv); ok {
+			return name, v, true
+		}
+	}
+	return "", nil, false
+}
+
+func (jbv jsonBoundValue) decode() (BoundValue, error) {
+	jsonTypesMu.RLock()
+	jt, ok := jsonTypes[jbv.Type]
+	jsonTypesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no JSON type registered as %q for bound value %s", jbv.Type, jbv.Key)
+	}
+	return jt.Decode(jbv.Key, jbv.Value)
+}
+
+// MarshalBoundValue returns the JSON encoding of the provided BoundValue,
+// whose type must be registered with RegisterJSONType.
+func MarshalBoundValue(bv BoundValue) ([]byte, error) {
+	jbv, err := encodeJSON(bv)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jbv)
+}
+
+// UnmarshalBoundValue returns the BoundValue encoded by MarshalBoundValue in
+// the provided data.
+func UnmarshalBoundValue(data []byte) (BoundValue, error) {
+	var jbv jsonBoundValue
+	if err := json.Unmarshal(data, &jbv); err != nil {
+		return nil, err
+	}
+	return jbv.decode()
+}
+
+// MarshalJSON encodes the receiver as a JSON list of its BoundValues, in
+// increasing key order, each with its key, registered type name, and value.
+func (b *Bindings) MarshalJSON() ([]byte, error) {
+	jbvs := make([]jsonBoundValue, 0, b.Length())
+	for _, bv := range b.Values() {
+		jbv, err := encodeJSON(bv)
+		if err != nil {
+			return nil, err
+		}
+		jbv.Overwriting = b.Overwrites(bv.Key())
+		if c := b.ComparisonOf(bv.Key()); c != Equal {
+			jbv.Comparison = c.String()
+		}
+		if p := b.PolicyOf(bv.Key()); p != ErrorOnConflict {
+			jbv.Policy = p.String()
+		}
+		jbvs = append(jbvs, jbv)
+	}
+	return json.Marshal(jbvs)
+}
+
+// UnmarshalJSON sets the receiver to the Bindings encoded by MarshalJSON in
+// the provided data.
+func (b *Bindings) UnmarshalJSON(data []byte) error {
+	var jbvs []jsonBoundValue
+	if err := json.Unmarshal(data, &jbvs); err != nil {
+		return err
+	}
+	var ret *Bindings
+	for _, jbv := range jbvs {
+		bv, err := jbv.decode()
+		if err != nil {
+			return err
+		}
+		single, _ := New(bv)
+		if jbv.Overwriting {
+			single = single.Overwriting()
+		}
+		if jbv.Comparison != "" {
+			c, err := parseComparison(jbv.Comparison)
+			if err != nil {
+				return err
+			}
+			single = single.Comparing(c)
+		}
+		if jbv.Policy != "" {
+			p, err := parsePolicy(jbv.Policy)
+			if err != nil {
+				return err
+			}
+			single = single.WithPolicy(p)
+		}
+		if ret, err = ret.Combine(single); err != nil {
+			return err
+		}
+	}
+	if ret == nil {
+		ret = &Bindings{}
+	}
+	*b = *ret
+	return nil
+}
+
+func parseComparison(s string) (Comparison, error) {
+	for c := Equal; c <= GreaterOrEqual; c++ {
+		if c.String() == s {
+			return c, nil
+		}
+	}
+	return Equal, fmt.Errorf("unknown comparison %q", s)
+}
+
+func parsePolicy(s string) (MergePolicy, error) {
+	for p := ErrorOnConflict; p <= CollectSet; p++ {
+		if p.String() == s {
+			return p, nil
+		}
+	}
+	return ErrorOnConflict, fmt.Errorf("unknown merge policy %q", s)
+}
@@ -0,0 +1,64 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bindings
+
+// MergePolicy specifies how Combine resolves a key bound to different values
+// in the two Bindings it combines.
+type MergePolicy int
+
+// MergePolicies supported by Combine.
+const (
+	// ErrorOnConflict makes conflicting values an error.  It is the default.
+	ErrorOnConflict MergePolicy = iota
+	// KeepFirst keeps the receiver's value.
+	KeepFirst
+	// KeepLast keeps the argument's value.
+	KeepLast
+	// CollectSet keeps both values, in a BoundSet.
+	CollectSet
+)
+
+func (p MergePolicy) String() string {
+	switch p {
+	case ErrorOnConflict:
+		return "error"
+	case KeepFirst:
+		return "keep-first"
+	case KeepLast:
+		return "keep-last"
+	case CollectSet:
+		return "collect"
+	}
+	return "?"
+}
+
+// merge returns the value resolving a conflict between the provided values,
+// first and last, for the same key under the receiver.
+func (p MergePolicy) merge(first, last BoundValue) (BoundValue, error) {
+	switch p {
+	case KeepFirst:
+		return first, nil
+	case KeepLast:
+		return last, nil
+	case CollectSet:
+		return collect(first, last)
+	}
+	if cmp, err := first.CompareValues(last); err != nil {
+		return nil, err
+	} else if cmp != 0 {
+		return nil, &ConflictError{first.Key(), first, last}
+	}
+	return first, nil
+}
@@ -16,23 +16,125 @@
 // in matches.
 package captures
 
-import "github.com/ilhamster/ltl/pkg/ltl"
+import (
+	"github.com/ilhamster/ltl/pkg/ltl"
+	"sort"
+	"sync"
+)
 
-// Captures stores sets of tokens captured by Environments.
+// Indexed is implemented by Tokens that know their position in their stream.
+// Captures orders such Tokens by Index.
+type Indexed interface {
+	ltl.Token
+	Index() int
+}
+
+// Captures stores sets of tokens captured by Environments.  Within each set,
+// tokens are also kept in stream order: by Index for Indexed tokens, by
+// Timestamp for ltl.TimedTokens, and otherwise in the order they were
+// captured.
+//
+// Captures are shared, not copied, by the Captures built from them: without
+// retention Options, Union defers computing its result until it is needed, so
+// that a set of n tokens accumulated over n Unions costs O(n), not O(n^2).
 type Captures struct {
 	// Caps stores two sets of captured tokens: one captured if the Environment
 	// matches, and one captured if it does not match.
 	caps map[bool]map[ltl.Token]struct{}
+	// order holds the tokens of each set of caps, in stream order.
+	order map[bool][]ltl.Token
+	// unions holds, for each set not yet computed, the deferred union
+	// producing it.  A set with a deferred union is not empty.
+	unions map[bool]*union
+	// ranges and dropped are only populated under retention Options, from r.
+	ranges  map[bool][]Range
+	dropped map[bool]int
+	r       *config
+	// mu guards caps, order, and unions, which deferred unions update when
+	// computed.
+	mu sync.Mutex
+}
+
+// union is a deferred union of the sets of two Captures captured under the
+// same matching state.
+type union struct {
+	a, b     *Captures
+	matching bool
+}
+
+// set identifies the set of a Captures captured under a matching state.
+type set struct {
+	c        *Captures
+	matching bool
+}
+
+// compute computes the set of tokens captured under the provided matching
+// state, if its union was deferred.  The receiver's lock must be held.
+func (c *Captures) compute(matching bool) {
+	u := c.unions[matching]
+	if u == nil {
+		return
+	}
+	// Gather the computed sets under u, left to right, visiting each once, and
+	// sort their tokens into stream order.  The order of tokens with no known
+	// order is that in which they are gathered.
+	var order []ltl.Token
+	caps := map[ltl.Token]struct{}{}
+	visited := map[set]bool{}
+	stack := []set{{u.b, u.matching}, {u.a, u.matching}}
+	for len(stack) > 0 {
+		s := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if visited[s] {
+			continue
+		}
+		visited[s] = true
+		s.c.mu.Lock()
+		su, toks := s.c.unions[s.matching], s.c.order[s.matching]
+		s.c.mu.Unlock()
+		if su != nil {
+			stack = append(stack, set{su.b, su.matching}, set{su.a, su.matching})
+			continue
+		}
+		for _, tok := range toks {
+			if _, ok := caps[tok]; !ok {
+				caps[tok] = struct{}{}
+				order = append(order, tok)
+			}
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return before(order[a], order[b])
+	})
+	c.caps[matching] = caps
+	c.order[matching] = order
+	delete(c.unions, matching)
+}
+
+// deferrable returns true if unions with the receiver may be deferred: if it
+// holds no ranges or dropped tokens, and has no retention Options.
+func (c *Captures) deferrable() bool {
+	return c.ranges == nil && c.dropped == nil &&
+		(c.r == nil || (c.r.maxTokens <= 0 && !c.r.firstLast && !c.r.ranges))
 }
 
-// New returns a new, empty Captures set.
-func New() *Captures {
-	return &Captures{
+// New returns a new, empty Captures set, retaining tokens as specified by the
+// provided Options.  By default, all captured tokens are retained.
+func New(opts ...Option) *Captures {
+	ret := &Captures{
 		caps: map[bool]map[ltl.Token]struct{}{
 			true:  nil,
 			false: nil,
 		},
+		order: map[bool][]ltl.Token{},
+	}
+	if len(opts) > 0 {
+		ret.r = &config{}
+		for _, opt := range opts {
+			opt(ret.r)
+		}
 	}
+	return ret
 }
 
 // Get returns the set of tokens captured under the provided matching state.
@@ -41,23 +143,61 @@ func (c *Captures) Get(matching bool) map[ltl.Token]struct{} {
 	if c == nil {
 		return nil
 	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.compute(matching)
 	return c.caps[matching]
 }
 
+// Ordered returns the tokens captured under the provided matching state, in
+// stream order.  The returned slice may be nil, and must not be modified.
+func (c *Captures) Ordered(matching bool) []ltl.Token {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.compute(matching)
+	return c.order[matching]
+}
+
 // Capture captures the provided set of tokens under the specified matching
-// state.  It returns itself, for chaining.
+// state.  It returns itself, for chaining.  Since the results of Union and Not
+// share the sets of their arguments, Capture should only be used to build new
+// Captures, before they are combined.
 func (c *Captures) Capture(matching bool, toks ...ltl.Token) *Captures {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.compute(matching)
 	if c.caps[matching] == nil {
 		c.caps[matching] = map[ltl.Token]struct{}{}
 	}
 	for _, tok := range toks {
+		if _, ok := c.caps[matching][tok]; ok {
+			continue
+		}
+		if c.r != nil && c.r.onCapture != nil {
+			c.r.onCapture(matching, tok)
+		}
+		if it, ok := tok.(Indexed); ok && c.r != nil && c.r.ranges {
+			c.addRange(matching, it.Index())
+			continue
+		}
 		c.caps[matching][tok] = struct{}{}
+		order := append(c.order[matching], tok)
+		// Tokens are generally captured in stream order, so this rarely moves
+		// tok far.
+		for idx := len(order) - 1; idx > 0 && before(tok, order[idx-1]); idx-- {
+			order[idx], order[idx-1] = order[idx-1], order[idx]
+		}
+		c.order[matching] = order
 	}
+	c.retain(matching)
 	return c
 }
 
 // Union returns a new Capture comprised of the union of the receiver and the
-// argument.
+// argument, with the receiver's Options, or if it has none, the argument's.
 func (c *Captures) Union(oc *Captures) *Captures {
 	if c == nil {
 		return oc
@@ -65,21 +205,112 @@ func (c *Captures) Union(oc *Captures) *Captures {
 	if oc == nil {
 		return c
 	}
-	ret := &Captures{map[bool]map[ltl.Token]struct{}{}}
-
-	for _, captureMap := range []map[bool]map[ltl.Token]struct{}{c.caps, oc.caps} {
-		for matchingState := range captureMap {
-			if captureMap[matchingState] != nil {
-				for tok := range captureMap[matchingState] {
-					ret.Capture(matchingState, tok)
-				}
+	ret := New()
+	ret.r = c.r
+	if ret.r == nil {
+		ret.r = oc.r
+	}
+	if c.deferrable() && oc.deferrable() && ret.deferrable() {
+		for _, matchingState := range []bool{true, false} {
+			ret.deferUnion(c, oc, matchingState)
+		}
+		return ret
+	}
+	ranges := ret.r != nil && ret.r.ranges
+	for _, matchingState := range []bool{true, false} {
+		if d := c.dropped[matchingState] + oc.dropped[matchingState]; d > 0 {
+			if ret.dropped == nil {
+				ret.dropped = map[bool]int{}
+			}
+			ret.dropped[matchingState] = d
+		}
+		rs := append(append([]Range{}, c.ranges[matchingState]...), oc.ranges[matchingState]...)
+		a, b := c.Ordered(matchingState), oc.Ordered(matchingState)
+		merged := make([]ltl.Token, 0, len(a)+len(b))
+		add := func(tok ltl.Token) {
+			if it, ok := tok.(Indexed); ok && ranges {
+				idx := it.Index()
+				rs = append(rs, Range{idx, idx})
+				return
+			}
+			if ret.caps[matchingState] == nil {
+				ret.caps[matchingState] = make(map[ltl.Token]struct{}, len(a)+len(b))
+			}
+			if _, ok := ret.caps[matchingState][tok]; !ok {
+				ret.caps[matchingState][tok] = struct{}{}
+				merged = append(merged, tok)
 			}
 		}
+		for len(a) > 0 && len(b) > 0 {
+			if before(b[0], a[0]) {
+				add(b[0])
+				b = b[1:]
+			} else {
+				add(a[0])
+				a = a[1:]
+			}
+		}
+		for _, rest := range [][]ltl.Token{a, b} {
+			for _, tok := range rest {
+				add(tok)
+			}
+		}
+		if len(rs) > 0 {
+			if ret.ranges == nil {
+				ret.ranges = map[bool][]Range{}
+			}
+			ret.ranges[matchingState] = normalize(rs)
+		}
+		ret.order[matchingState] = merged
+		ret.retain(matchingState)
 	}
-
 	return ret
 }
 
+// deferUnion sets the receiver's set of tokens captured under the provided
+// matching state to the union of those of a and b, deferring computing it if
+// both are non-empty.  The receiver must not yet be shared.
+func (c *Captures) deferUnion(a, b *Captures, matching bool) {
+	aEmpty, bEmpty := a.empty(matching), b.empty(matching)
+	switch {
+	case aEmpty && bEmpty:
+	case aEmpty:
+		c.share(b, matching, matching)
+	case bEmpty:
+		c.share(a, matching, matching)
+	default:
+		if c.unions == nil {
+			c.unions = map[bool]*union{}
+		}
+		c.unions[matching] = &union{a, b, matching}
+	}
+}
+
+// share sets the receiver's set of tokens captured under the provided
+// matching state to the set oc captured under from.  The receiver must not
+// yet be shared.
+func (c *Captures) share(oc *Captures, matching, from bool) {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+	c.caps[matching] = oc.caps[from]
+	// Clip the order, so that later captures into c do not overwrite it.
+	c.order[matching] = oc.order[from][:len(oc.order[from]):len(oc.order[from])]
+	if u := oc.unions[from]; u != nil {
+		if c.unions == nil {
+			c.unions = map[bool]*union{}
+		}
+		c.unions[matching] = u
+	}
+}
+
+// empty returns true if the receiver captured no tokens under the provided
+// matching state.
+func (c *Captures) empty(matching bool) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.caps[matching]) == 0 && c.unions[matching] == nil
+}
+
 // Not returns a new Capture in which the captured tokens' matching states are
 // inverted.
 func (c *Captures) Not() *Captures {
@@ -87,12 +318,62 @@ func (c *Captures) Not() *Captures {
 		return nil
 	}
 	ret := New()
-	ret.caps[true] = c.caps[false]
-	ret.caps[false] = c.caps[true]
+	ret.share(c, true, false)
+	ret.share(c, false, true)
+	ret.r = c.r
+	if c.ranges != nil {
+		ret.ranges = map[bool][]Range{true: c.ranges[false], false: c.ranges[true]}
+	}
+	if c.dropped != nil {
+		ret.dropped = map[bool]int{true: c.dropped[false], false: c.dropped[true]}
+	}
 	return ret
 }
 
 // Reducible returns true if the receiver contains no captured tokens.
 func (c *Captures) Reducible() bool {
-	return c == nil || (len(c.caps[true]) == 0 && len(c.caps[false]) == 0)
+	return c == nil || (c.empty(true) && c.empty(false) &&
+		len(c.ranges[true]) == 0 && len(c.ranges[false]) == 0)
+}
+
+// Eq returns true if the receiver and argument captured the same tokens, and
+// recorded the same ranges and numbers of dropped tokens, under each matching
+// state.  Their Options are not compared.
+func (c *Captures) Eq(oc *Captures) bool {
+	for _, matching := range []bool{true, false} {
+		caps, ocaps := c.Get(matching), oc.Get(matching)
+		if len(caps) != len(ocaps) || c.Dropped(matching) != oc.Dropped(matching) {
+			return false
+		}
+		for tok := range caps {
+			if _, ok := ocaps[tok]; !ok {
+				return false
+			}
+		}
+		ranges, oranges := c.Ranges(matching), oc.Ranges(matching)
+		if len(ranges) != len(oranges) {
+			return false
+		}
+		for idx := range ranges {
+			if ranges[idx] != oranges[idx] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// before returns true if a is known to precede b in their stream.
+func before(a, b ltl.Token) bool {
+	if ia, ok := a.(Indexed); ok {
+		if ib, ok := b.(Indexed); ok {
+			return ia.Index() < ib.Index()
+		}
+	}
+	if ta, ok := a.(ltl.TimedToken); ok {
+		if tb, ok := b.(ltl.TimedToken); ok {
+			return ta.Timestamp().Before(tb.Timestamp())
+		}
+	}
+	return false
 }
@@ -0,0 +1,36 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package captures
+
+import (
+	"testing"
+)
+
+// benchmarkUnions accumulates n tokens, one Union per token, reading the
+// result.
+func benchmarkUnions(b *testing.B, n int) {
+	for i := 0; i < b.N; i++ {
+		c := New()
+		for idx := 0; idx < n; idx++ {
+			c = c.Union(New().Capture(true, idxTok(idx)))
+		}
+		if got := len(c.Ordered(true)); got != n {
+			b.Fatalf("Got %d tokens, wanted %d", got, n)
+		}
+	}
+}
+
+func BenchmarkUnions1000(b *testing.B)  { benchmarkUnions(b, 1000) }
+func BenchmarkUnions10000(b *testing.B) { benchmarkUnions(b, 10000) }
@@ -16,6 +16,7 @@ package captures
 
 import (
 	"fmt"
+	"github.com/ilhamster/ltl/pkg/ltl"
 	"testing"
 )
 
@@ -83,3 +84,141 @@ func TestCaptures(t *testing.T) {
 		})
 	}
 }
+
+type idxTok int
+
+func (it idxTok) String() string {
+	return fmt.Sprintf("%d", int(it))
+}
+
+func (it idxTok) EOI() bool {
+	return false
+}
+
+func (it idxTok) Index() int {
+	return int(it)
+}
+
+var shared = New().Capture(true, idxTok(3), idxTok(1)).Union(New().Capture(true, idxTok(2)))
+
+func TestOrdered(t *testing.T) {
+	for idx, test := range []struct {
+		cap  *Captures
+		want []string
+	}{
+		{nil, nil},
+		{New().Capture(true, idxTok(3), idxTok(1), idxTok(2)), []string{"1", "2", "3"}},
+		{New().Capture(true, idxTok(1), idxTok(4)).Union(
+			New().Capture(true, idxTok(2), idxTok(4), idxTok(5)),
+		), []string{"1", "2", "4", "5"}},
+		{New().Capture(true, strTok("b"), strTok("a")).Union(
+			New().Capture(true, strTok("c"), strTok("a")),
+		), []string{"b", "a", "c"}},
+		{New().Capture(false, idxTok(2), idxTok(0)).Not(), []string{"0", "2"}},
+		{New().Capture(false, idxTok(3)).Union(
+			New().Capture(true, idxTok(5)).Not(),
+		).Not().Union(
+			New().Capture(true, idxTok(1), idxTok(5)),
+		), []string{"1", "3", "5"}},
+		{shared.Union(shared.Union(New().Capture(true, idxTok(0)))).Union(shared),
+			[]string{"0", "1", "2", "3"}},
+	} {
+		t.Run(fmt.Sprintf("case %d", idx), func(t *testing.T) {
+			var got []string
+			for _, tok := range test.cap.Ordered(true) {
+				got = append(got, tok.String())
+			}
+			if fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("Got ordered captures %v, wanted %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestUnionAccumulation(t *testing.T) {
+	// Accumulate tokens as a long match would, one Union per token, with
+	// intermediate results shared by several later ones.
+	const n = 20000
+	c := New()
+	var intermediate []*Captures
+	for idx := n - 1; idx >= 0; idx-- {
+		c = New().Capture(true, idxTok(idx)).Union(c)
+		if idx%1000 == 0 {
+			intermediate = append(intermediate, c.Not().Not())
+		}
+	}
+	done := make(chan struct{})
+	for _, ic := range intermediate {
+		go func(ic *Captures) {
+			ic.Get(true)
+			done <- struct{}{}
+		}(ic)
+	}
+	for range intermediate {
+		<-done
+	}
+	got := c.Ordered(true)
+	if len(got) != n || c.Reducible() || len(c.Get(false)) != 0 {
+		t.Fatalf("Got %d tokens captured matching and %d not, wanted %d and 0", len(got), len(c.Get(false)), n)
+	}
+	for idx, tok := range got {
+		if tok != idxTok(idx) {
+			t.Fatalf("Got token %s at position %d", tok, idx)
+		}
+	}
+}
+
+func TestRetention(t *testing.T) {
+	toks := func(idxs ...int) []ltl.Token {
+		var ret []ltl.Token
+		for _, idx := range idxs {
+			ret = append(ret, idxTok(idx))
+		}
+		return ret
+	}
+	for idx, test := range []struct {
+		cap         *Captures
+		want        string
+		wantDropped int
+	}{
+		{New(MaxTokens(2)).Capture(true, toks(3, 1, 2)...), "[1 2] []", 1},
+		{New(FirstAndLast()).Capture(true, toks(1, 2, 3, 4)...), "[1 4] []", 2},
+		{New(FirstAndLast()).Capture(true, toks(1, 3)...).Union(
+			New().Capture(true, toks(2, 5)...),
+		), "[1 5] []", 2},
+		{New(IndexRanges()).Capture(true, toks(1, 2, 3, 7, 5)...).Capture(true, strTok("a")), "[a] [1-3 5 7]", 0},
+		{New(IndexRanges()).Capture(true, toks(1, 2)...).Union(
+			New().Capture(true, toks(3, 6)...),
+		), "[] [1-3 6]", 0},
+		{New(MaxTokens(1)).Capture(false, toks(2, 1)...).Not(), "[1] []", 1},
+	} {
+		t.Run(fmt.Sprintf("case %d", idx), func(t *testing.T) {
+			var got []string
+			for _, tok := range test.cap.Ordered(true) {
+				got = append(got, tok.String())
+			}
+			if gotStr := fmt.Sprintf("%v %v", got, test.cap.Ranges(true)); gotStr != test.want {
+				t.Errorf("Got retained captures %s, wanted %s", gotStr, test.want)
+			}
+			if got := test.cap.Dropped(true); got != test.wantDropped {
+				t.Errorf("Got %d dropped captures, wanted %d", got, test.wantDropped)
+			}
+			if got := len(test.cap.Get(true)); got != len(test.cap.Ordered(true)) {
+				t.Errorf("Got %d captures in the set, but %d ordered", got, len(test.cap.Ordered(true)))
+			}
+		})
+	}
+}
+
+func TestOnCapture(t *testing.T) {
+	var got []string
+	c := New(MaxTokens(1), OnCapture(func(matching bool, tok ltl.Token) {
+		got = append(got, fmt.Sprintf("%s/%t", tok, matching))
+	}))
+	c.Capture(true, idxTok(1), idxTok(2)).Capture(false, idxTok(3)).Capture(true, idxTok(1))
+	c.Union(New().Capture(true, idxTok(4)))
+	want := "[1/true 2/true 3/false]"
+	if fmt.Sprint(got) != want {
+		t.Errorf("Got reported captures %v, wanted %s", got, want)
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package captures
+
+import (
+	"fmt"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	"sort"
+)
+
+// config holds the Options of a Captures.
+type config struct {
+	maxTokens int
+	firstLast bool
+	ranges    bool
+	onCapture func(matching bool, tok ltl.Token)
+}
+
+// Option configures a Captures: how it retains tokens, bounding the memory it
+// holds over long matches, and how it reports them.  Retention applies
+// separately to the tokens captured under each matching state.  Options are
+// inherited by the results of Union, Not, and Empty.
+type Option func(r *config)
+
+// OnCapture specifies a function invoked with each token newly captured by
+// Capture, and the matching state it is captured under, before any retention
+// Options apply, so that tokens may be processed as they are captured rather
+// than once a match resolves.  Union does not invoke it.  It may be invoked
+// concurrently, if Environments are built concurrently.
+func OnCapture(f func(matching bool, tok ltl.Token)) Option {
+	return func(r *config) {
+		r.onCapture = f
+	}
+}
+
+// MaxTokens specifies that at most n tokens are retained: once n are, later
+// tokens in stream order are dropped.  n <= 0 retains all tokens.
+func MaxTokens(n int) Option {
+	return func(r *config) {
+		r.maxTokens = n
+	}
+}
+
+// FirstAndLast specifies that only the first and last tokens in stream order
+// are retained.
+func FirstAndLast() Option {
+	return func(r *config) {
+		r.firstLast = true
+	}
+}
+
+// IndexRanges specifies that Indexed tokens are not retained themselves, but
+// recorded as ranges of indices, available from Ranges.  Other tokens are
+// retained as usual.  Since bindingenvironment.State holds only tokens, ranges
+// do not survive bindingenvironment.FromState, nor checkpointing.
+func IndexRanges() Option {
+	return func(r *config) {
+		r.ranges = true
+	}
+}
+
+// Range is an inclusive range of token indices.
+type Range struct {
+	Start, End int
+}
+
+func (r Range) String() string {
+	if r.Start == r.End {
+		return fmt.Sprintf("%d", r.Start)
+	}
+	return fmt.Sprintf("%d-%d", r.Start, r.End)
+}
+
+// Ranges returns, in increasing order, the disjoint ranges of indices of the
+// Indexed tokens captured under the provided matching state with IndexRanges.
+// The returned slice must not be modified.
+func (c *Captures) Ranges(matching bool) []Range {
+	if c == nil {
+		return nil
+	}
+	return c.ranges[matching]
+}
+
+// Dropped returns the number of tokens captured under the provided matching
+// state that were not retained under the receiver's Options.  Tokens dropped
+// by both arguments of a Union are counted twice.
+func (c *Captures) Dropped(matching bool) int {
+	if c == nil {
+		return 0
+	}
+	return c.dropped[matching]
+}
+
+// Empty returns a new, empty Captures with the receiver's Options.
+func (c *Captures) Empty() *Captures {
+	ret := New()
+	if c != nil {
+		ret.r = c.r
+	}
+	return ret
+}
+
+// addRange records the provided index under the provided matching state.
+func (c *Captures) addRange(matching bool, idx int) {
+	if c.ranges == nil {
+		c.ranges = map[bool][]Range{}
+	}
+	c.ranges[matching] = normalize(append(c.ranges[matching], Range{idx, idx}))
+}
+
+// normalize sorts the provided ranges, merging those that overlap or abut.
+func normalize(rs []Range) []Range {
+	sort.Slice(rs, func(a, b int) bool {
+		return rs[a].Start < rs[b].Start
+	})
+	ret := rs[:0]
+	for _, r := range rs {
+		if last := len(ret) - 1; last >= 0 && r.Start <= ret[last].End+1 {
+			if r.End > ret[last].End {
+				ret[last].End = r.End
+			}
+			continue
+		}
+		ret = append(ret, r)
+	}
+	return ret
+}
+
+// retain drops the tokens captured under the provided matching state that the
+// receiver's Options do not retain.
+func (c *Captures) retain(matching bool) {
+	if c.r == nil {
+		return
+	}
+	order := c.order[matching]
+	kept := order
+	if c.r.firstLast && len(kept) > 2 {
+		kept = []ltl.Token{kept[0], kept[len(kept)-1]}
+	}
+	if c.r.maxTokens > 0 && len(kept) > c.r.maxTokens {
+		kept = kept[:c.r.maxTokens:c.r.maxTokens]
+	}
+	if len(kept) == len(order) {
+		return
+	}
+	set := make(map[ltl.Token]struct{}, len(kept))
+	for _, tok := range kept {
+		set[tok] = struct{}{}
+	}
+	if c.dropped == nil {
+		c.dropped = map[bool]int{}
+	}
+	c.dropped[matching] += len(order) - len(kept)
+	c.caps[matching] = set
+	c.order[matching] = kept
+}
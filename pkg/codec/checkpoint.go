@@ -0,0 +1,379 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codec
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	be "github.com/ilhamster/ltl/pkg/bindingenvironment"
+	"github.com/ilhamster/ltl/pkg/bindings"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	ops "github.com/ilhamster/ltl/pkg/operators"
+	"time"
+)
+
+// TokenCodec encodes and decodes Tokens of some type.  Checkpoints include the
+// Tokens captured by Environments and buffered by lookaheads.
+type TokenCodec interface {
+	// Encode returns the encoding of the provided Token, and true, if the Token
+	// is of the codec's type, or false otherwise.
+	Encode(tok ltl.Token) (string, bool)
+	// Decode returns the Token with the provided encoding.
+	Decode(s string) (ltl.Token, error)
+}
+
+// RegisterToken registers the provided TokenCodec under the provided name, and
+// returns the receiver.  When encoding, TokenCodecs are tried in the order
+// they were registered.  Registering a name again replaces its TokenCodec.
+func (r *Registry) RegisterToken(name string, c TokenCodec) *Registry {
+	if _, ok := r.tokenCodecs[name]; !ok {
+		r.tokenNames = append(r.tokenNames, name)
+	}
+	r.tokenCodecs[name] = c
+	return r
+}
+
+type checkpoint struct {
+	// Tokens holds each distinct Token in the checkpoint, so that Tokens
+	// shared by several Environments remain shared once restored.
+	Tokens []tokenNode `json:"tokens,omitempty"`
+	Op     *stateNode  `json:"op"`
+}
+
+type tokenNode struct {
+	EOI   bool   `json:"eoi,omitempty"`
+	Codec string `json:"codec,omitempty"`
+	Tok   string `json:"tok,omitempty"`
+}
+
+// stateNode is the encoded form of a partially-evaluated Operator.
+type stateNode struct {
+	Type     string        `json:"type,omitempty"`
+	Count    int64         `json:"n,omitempty"`
+	Parallel bool          `json:"parallel,omitempty"`
+	Started  bool          `json:"started,omitempty"`
+	Lo       time.Duration `json:"lo,omitempty"`
+	Hi       time.Duration `json:"hi,omitempty"`
+	Start    *time.Time    `json:"start,omitempty"`
+	Envs     []*envNode    `json:"envs,omitempty"`
+	Tokens   []int         `json:"tokens,omitempty"`
+	Live     []bool        `json:"live,omitempty"`
+	Args     []*stateNode  `json:"args,omitempty"`
+	Codec    string        `json:"codec,omitempty"`
+	Leaf     string        `json:"leaf,omitempty"`
+}
+
+const (
+	matchingEnv      = "MATCHING"
+	notMatchingEnv   = "NOT_MATCHING"
+	limitExceededEnv = "LIMIT_EXCEEDED"
+	errorEnv         = "ERROR"
+)
+
+// envNode is the encoded form of an Environment.
+type envNode struct {
+	Type           string             `json:"type"`
+	Err            string             `json:"err,omitempty"`
+	Matching       bool               `json:"matching,omitempty"`
+	HasRefs        bool               `json:"has_refs,omitempty"`
+	Bound          *bindings.Bindings `json:"bound,omitempty"`
+	Referenced     *bindings.Bindings `json:"referenced,omitempty"`
+	CapMatching    []int              `json:"cap_matching,omitempty"`
+	CapNotMatching []int              `json:"cap_not_matching,omitempty"`
+	Left           *envNode           `json:"left,omitempty"`
+	Right          *envNode           `json:"right,omitempty"`
+}
+
+// Checkpoint returns the JSON encoding of the provided Operator, which may be a
+// partially-evaluated continuation, including the Environments, bindings, and
+// captured Tokens it retains.  Restore resumes it.  Beyond the requirements of
+// Marshal, leaves must be encoded with their current state, Tokens must be
+// encodable by a registered TokenCodec, and bound values must be of types
+// registered with bindings.RegisterJSONType.  Errors held by Erroring
+// Environments are restored as plain errors with the same messages.
+func (r *Registry) Checkpoint(op ltl.Operator) ([]byte, error) {
+	if op == nil {
+		return nil, errors.New("cannot checkpoint a nil Operator")
+	}
+	ce := &checkpointEncoder{r: r, tokIdx: map[ltl.Token]int{}}
+	n, err := ce.encodeOp(op)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&checkpoint{Tokens: ce.toks, Op: n})
+}
+
+type checkpointEncoder struct {
+	r      *Registry
+	tokIdx map[ltl.Token]int
+	toks   []tokenNode
+}
+
+func (ce *checkpointEncoder) encodeOp(op ltl.Operator) (*stateNode, error) {
+	if op == nil {
+		return nil, nil
+	}
+	s, ok := ops.StateOf(op)
+	if !ok {
+		if len(ops.Children(op)) > 0 {
+			return nil, fmt.Errorf("cannot checkpoint operator %s", op)
+		}
+		n, err := ce.r.encode(op)
+		if err != nil {
+			return nil, err
+		}
+		return &stateNode{Codec: n.Codec, Leaf: n.Leaf}, nil
+	}
+	n := &stateNode{
+		Type:     s.Type,
+		Count:    s.Count,
+		Parallel: s.Parallel,
+		Started:  s.Started,
+		Lo:       s.Lo,
+		Hi:       s.Hi,
+		Live:     s.Live,
+	}
+	if !s.Start.IsZero() {
+		n.Start = &s.Start
+	}
+	for _, env := range s.Envs {
+		envN, err := ce.encodeEnv(env)
+		if err != nil {
+			return nil, err
+		}
+		n.Envs = append(n.Envs, envN)
+	}
+	var err error
+	if n.Tokens, err = ce.encodeTokens(s.Tokens); err != nil {
+		return nil, err
+	}
+	for _, child := range ops.Children(op) {
+		arg, err := ce.encodeOp(child)
+		if err != nil {
+			return nil, err
+		}
+		n.Args = append(n.Args, arg)
+	}
+	return n, nil
+}
+
+func (ce *checkpointEncoder) encodeTokens(toks []ltl.Token) ([]int, error) {
+	var ret []int
+	for _, tok := range toks {
+		idx, ok := ce.tokIdx[tok]
+		if !ok {
+			tn, err := ce.r.encodeToken(tok)
+			if err != nil {
+				return nil, err
+			}
+			idx = len(ce.toks)
+			ce.toks = append(ce.toks, tn)
+			ce.tokIdx[tok] = idx
+		}
+		ret = append(ret, idx)
+	}
+	return ret, nil
+}
+
+func (r *Registry) encodeToken(tok ltl.Token) (tokenNode, error) {
+	if _, ok := tok.(ltl.EOIToken); ok {
+		return tokenNode{EOI: true}, nil
+	}
+	for _, name := range r.tokenNames {
+		if s, ok := r.tokenCodecs[name].Encode(tok); ok {
+			return tokenNode{Codec: name, Tok: s}, nil
+		}
+	}
+	return tokenNode{}, fmt.Errorf("no codec registered for token %s", tok)
+}
+
+func (ce *checkpointEncoder) encodeEnv(env ltl.Environment) (*envNode, error) {
+	if env == nil {
+		return nil, nil
+	}
+	if ltl.IsLimitExceeded(env) {
+		n := &envNode{Type: limitExceededEnv}
+		if inner, ok := ltl.LimitedEnvironment(env); ok {
+			var err error
+			if n.Left, err = ce.encodeEnv(inner); err != nil {
+				return nil, err
+			}
+		}
+		return n, nil
+	}
+	if err := env.Err(); err != nil {
+		return &envNode{Type: errorEnv, Err: err.Error()}, nil
+	}
+	if s, ok := env.(ltl.State); ok {
+		if s {
+			return &envNode{Type: matchingEnv}, nil
+		}
+		return &envNode{Type: notMatchingEnv}, nil
+	}
+	s, ok := be.StateOf(env)
+	if !ok {
+		return nil, fmt.Errorf("cannot checkpoint environment %s", env)
+	}
+	if len(s.TagsMatching) > 0 || len(s.TagsNotMatching) > 0 {
+		return nil, fmt.Errorf("cannot checkpoint tagged environment %s", env)
+	}
+	n := &envNode{
+		Type:       string(s.Type),
+		Matching:   s.Matching,
+		HasRefs:    s.HasRefs,
+		Bound:      s.Bound,
+		Referenced: s.Referenced,
+	}
+	var err error
+	if n.CapMatching, err = ce.encodeTokens(s.CapturedMatching); err != nil {
+		return nil, err
+	}
+	if n.CapNotMatching, err = ce.encodeTokens(s.CapturedNotMatching); err != nil {
+		return nil, err
+	}
+	if n.Left, err = ce.encodeEnv(s.Left); err != nil {
+		return nil, err
+	}
+	if n.Right, err = ce.encodeEnv(s.Right); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// Restore returns the Operator checkpointed with Checkpoint in the provided
+// data.
+func (r *Registry) Restore(data []byte) (ltl.Operator, error) {
+	c := &checkpoint{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	cd := &checkpointDecoder{r: r}
+	for _, tn := range c.Tokens {
+		if tn.EOI {
+			cd.toks = append(cd.toks, ltl.EOIToken{})
+			continue
+		}
+		tc, ok := r.tokenCodecs[tn.Codec]
+		if !ok {
+			return nil, fmt.Errorf("no token codec registered as '%s'", tn.Codec)
+		}
+		tok, err := tc.Decode(tn.Tok)
+		if err != nil {
+			return nil, err
+		}
+		cd.toks = append(cd.toks, tok)
+	}
+	if c.Op == nil {
+		return nil, errors.New("checkpoint has no operator")
+	}
+	return cd.decodeOp(c.Op)
+}
+
+type checkpointDecoder struct {
+	r    *Registry
+	toks []ltl.Token
+}
+
+func (cd *checkpointDecoder) decodeOp(n *stateNode) (ltl.Operator, error) {
+	if n == nil {
+		return nil, nil
+	}
+	if n.Type == "" {
+		return cd.r.decode(&node{Codec: n.Codec, Leaf: n.Leaf})
+	}
+	s := ops.State{
+		Type:     n.Type,
+		Count:    n.Count,
+		Parallel: n.Parallel,
+		Started:  n.Started,
+		Lo:       n.Lo,
+		Hi:       n.Hi,
+		Live:     n.Live,
+	}
+	if n.Start != nil {
+		s.Start = *n.Start
+	}
+	for _, envN := range n.Envs {
+		env, err := cd.decodeEnv(envN)
+		if err != nil {
+			return nil, err
+		}
+		s.Envs = append(s.Envs, env)
+	}
+	var err error
+	if s.Tokens, err = cd.decodeTokens(n.Tokens); err != nil {
+		return nil, err
+	}
+	children := make([]ltl.Operator, len(n.Args))
+	for idx, arg := range n.Args {
+		if children[idx], err = cd.decodeOp(arg); err != nil {
+			return nil, err
+		}
+	}
+	return ops.FromState(s, children...)
+}
+
+func (cd *checkpointDecoder) decodeTokens(idxs []int) ([]ltl.Token, error) {
+	var ret []ltl.Token
+	for _, idx := range idxs {
+		if idx < 0 || idx >= len(cd.toks) {
+			return nil, fmt.Errorf("token index %d out of range", idx)
+		}
+		ret = append(ret, cd.toks[idx])
+	}
+	return ret, nil
+}
+
+func (cd *checkpointDecoder) decodeEnv(n *envNode) (ltl.Environment, error) {
+	if n == nil {
+		return nil, nil
+	}
+	switch n.Type {
+	case matchingEnv:
+		return ltl.Matching, nil
+	case notMatchingEnv:
+		return ltl.NotMatching, nil
+	case limitExceededEnv:
+		inner, err := cd.decodeEnv(n.Left)
+		if err != nil {
+			return nil, err
+		}
+		return ltl.LimitExceededBy(inner), nil
+	case errorEnv:
+		return ltl.ErrEnv(errors.New(n.Err)), nil
+	}
+	s := be.State{
+		Type:       be.StateType(n.Type),
+		Matching:   n.Matching,
+		HasRefs:    n.HasRefs,
+		Bound:      n.Bound,
+		Referenced: n.Referenced,
+	}
+	var err error
+	if s.CapturedMatching, err = cd.decodeTokens(n.CapMatching); err != nil {
+		return nil, err
+	}
+	if s.CapturedNotMatching, err = cd.decodeTokens(n.CapNotMatching); err != nil {
+		return nil, err
+	}
+	if s.Left, err = cd.decodeEnv(n.Left); err != nil {
+		return nil, err
+	}
+	if s.Right, err = cd.decodeEnv(n.Right); err != nil {
+		return nil, err
+	}
+	return be.FromState(s)
+}
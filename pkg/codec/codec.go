@@ -0,0 +1,202 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package codec encodes operator trees built from package operators to JSON,
+// and decodes them back, so that formulas can be distributed without their
+// source strings or a parser.
+//
+// The structure of a tree, and the built-in terminals TRUE, FALSE and ANY, are
+// encoded directly.  Other leaves, such as matchers and binders, are encoded
+// by LeafCodecs registered with a Registry under a name, which is recorded
+// alongside each leaf's encoding; the decoding Registry must have a LeafCodec
+// registered under the same name.
+//
+// A Registry can also checkpoint a partially-evaluated Operator, with the
+// Environments it retains, so that a long-running match can be resumed later.
+package codec
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	ops "github.com/ilhamster/ltl/pkg/operators"
+)
+
+// LeafCodec encodes and decodes leaf Operators of some type.
+type LeafCodec interface {
+	// Encode returns the encoding of the provided Operator, and true, if the
+	// Operator is of the codec's type, or false otherwise.
+	Encode(op ltl.Operator) (string, bool)
+	// Decode returns the Operator with the provided encoding.
+	Decode(s string) (ltl.Operator, error)
+}
+
+// Registry encodes and decodes operator trees, using its registered
+// LeafCodecs for leaves.
+type Registry struct {
+	names       []string
+	codecs      map[string]LeafCodec
+	tokenNames  []string
+	tokenCodecs map[string]TokenCodec
+}
+
+// NewRegistry returns a new Registry with no LeafCodecs or TokenCodecs.
+func NewRegistry() *Registry {
+	return &Registry{
+		codecs:      map[string]LeafCodec{},
+		tokenCodecs: map[string]TokenCodec{},
+	}
+}
+
+// Register registers the provided LeafCodec under the provided name, and
+// returns the receiver.  When encoding, LeafCodecs are tried in the order they
+// were registered.  Registering a name again replaces its LeafCodec.
+func (r *Registry) Register(name string, c LeafCodec) *Registry {
+	if _, ok := r.codecs[name]; !ok {
+		r.names = append(r.names, name)
+	}
+	r.codecs[name] = c
+	return r
+}
+
+// node is the encoded form of an Operator.
+type node struct {
+	Op    ops.Kind `json:"op,omitempty"`
+	N     int64    `json:"n,omitempty"`
+	Args  []*node  `json:"args,omitempty"`
+	Codec string   `json:"codec,omitempty"`
+	Leaf  string   `json:"leaf,omitempty"`
+}
+
+// Marshal returns the JSON encoding of the provided operator tree.  It returns
+// an error if the tree contains an Operator that cannot be encoded, such as a
+// predicate, a leaf no registered LeafCodec accepts, or one of the internal
+// Operators appearing in partially-evaluated continuations.
+func (r *Registry) Marshal(op ltl.Operator) ([]byte, error) {
+	n, err := r.encode(op)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(n)
+}
+
+func (r *Registry) encode(op ltl.Operator) (*node, error) {
+	if op == nil {
+		return nil, errors.New("cannot encode a nil Operator")
+	}
+	kind := ops.KindOf(op)
+	switch kind {
+	case ops.TrueKind, ops.FalseKind, ops.AnyTokenKind:
+		return &node{Op: kind}, nil
+	case ops.PredicateKind:
+		return nil, fmt.Errorf("cannot encode predicate %s", op)
+	case ops.Other:
+		if len(ops.Children(op)) > 0 {
+			return nil, fmt.Errorf("cannot encode operator %s", op)
+		}
+		for _, name := range r.names {
+			if s, ok := r.codecs[name].Encode(op); ok {
+				return &node{Codec: name, Leaf: s}, nil
+			}
+		}
+		return nil, fmt.Errorf("no codec registered for leaf %s", op)
+	}
+	n := &node{Op: kind}
+	n.N, _ = ops.Count(op)
+	for _, child := range ops.Children(op) {
+		arg, err := r.encode(child)
+		if err != nil {
+			return nil, err
+		}
+		n.Args = append(n.Args, arg)
+	}
+	return n, nil
+}
+
+// Unmarshal returns the operator tree with the provided JSON encoding.
+func (r *Registry) Unmarshal(data []byte) (ltl.Operator, error) {
+	n := &node{}
+	if err := json.Unmarshal(data, n); err != nil {
+		return nil, err
+	}
+	return r.decode(n)
+}
+
+// builders constructs Operators of each Kind from their arguments.
+var builders = map[ops.Kind]struct {
+	arity int // -1 for one or more arguments
+	build func(n int64, args []ltl.Operator) ltl.Operator
+}{
+	ops.NotKind:           {1, func(_ int64, args []ltl.Operator) ltl.Operator { return ops.Not(args[0]) }},
+	ops.AndKind:           {2, func(_ int64, args []ltl.Operator) ltl.Operator { return ops.And(args[0], args[1]) }},
+	ops.OrKind:            {2, func(_ int64, args []ltl.Operator) ltl.Operator { return ops.Or(args[0], args[1]) }},
+	ops.ImpliesKind:       {2, buildImplies},
+	ops.FirstOfKind:       {2, func(_ int64, args []ltl.Operator) ltl.Operator { return ops.FirstOf(args[0], args[1]) }},
+	ops.LimitKind:         {1, func(n int64, args []ltl.Operator) ltl.Operator { return ops.Limit(n, args[0]) }},
+	ops.NextKind:          {1, func(_ int64, args []ltl.Operator) ltl.Operator { return ops.Next(args[0]) }},
+	ops.AcceptKind:        {1, func(n int64, args []ltl.Operator) ltl.Operator { return ops.Accept(n, args[0]) }},
+	ops.ThenKind:          {2, func(_ int64, args []ltl.Operator) ltl.Operator { return ops.Then(args[0], args[1]) }},
+	ops.SequenceKind:      {-1, func(_ int64, args []ltl.Operator) ltl.Operator { return ops.Sequence(args...) }},
+	ops.EventuallyKind:    {1, func(_ int64, args []ltl.Operator) ltl.Operator { return ops.Eventually(args[0]) }},
+	ops.GloballyKind:      {1, func(_ int64, args []ltl.Operator) ltl.Operator { return ops.Globally(args[0]) }},
+	ops.UntilKind:         {2, func(_ int64, args []ltl.Operator) ltl.Operator { return ops.Until(args[0], args[1]) }},
+	ops.ReleaseKind:       {2, func(_ int64, args []ltl.Operator) ltl.Operator { return ops.Release(args[0], args[1]) }},
+	ops.NotFollowedByKind: {2, func(_ int64, args []ltl.Operator) ltl.Operator { return ops.NotFollowedBy(args[0], args[1]) }},
+}
+
+// buildImplies builds an IMPLIES, which has no constructor of its own, but
+// appears within RespondsTo and RespondsToWithin.
+func buildImplies(_ int64, args []ltl.Operator) ltl.Operator {
+	op, _ := ops.FromState(ops.State{Type: string(ops.ImpliesKind)}, args...)
+	return op
+}
+
+func (r *Registry) decode(n *node) (ltl.Operator, error) {
+	if n == nil {
+		return nil, errors.New("cannot decode a null operator")
+	}
+	switch n.Op {
+	case ops.TrueKind:
+		return ops.True(), nil
+	case ops.FalseKind:
+		return ops.False(), nil
+	case ops.AnyTokenKind:
+		return ops.AnyToken(), nil
+	case ops.Other:
+		c, ok := r.codecs[n.Codec]
+		if !ok {
+			return nil, fmt.Errorf("no codec registered as '%s'", n.Codec)
+		}
+		return c.Decode(n.Leaf)
+	}
+	b, ok := builders[n.Op]
+	if !ok {
+		return nil, fmt.Errorf("unknown operator '%s'", n.Op)
+	}
+	if b.arity >= 0 && len(n.Args) != b.arity {
+		return nil, fmt.Errorf("operator '%s' takes %d arguments, got %d", n.Op, b.arity, len(n.Args))
+	}
+	if b.arity < 0 && len(n.Args) == 0 {
+		return nil, fmt.Errorf("operator '%s' takes at least one argument", n.Op)
+	}
+	args := make([]ltl.Operator, len(n.Args))
+	for idx, arg := range n.Args {
+		var err error
+		if args[idx], err = r.decode(arg); err != nil {
+			return nil, err
+		}
+	}
+	return b.build(n.N, args), nil
+}
@@ -0,0 +1,270 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codec_test
+
+import (
+	"bufio"
+	"fmt"
+	rtok "github.com/ilhamster/ltl/examples/runetoken"
+	smatch "github.com/ilhamster/ltl/examples/stringmatcher"
+	be "github.com/ilhamster/ltl/pkg/bindingenvironment"
+	"github.com/ilhamster/ltl/pkg/bindings"
+	"github.com/ilhamster/ltl/pkg/codec"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	ops "github.com/ilhamster/ltl/pkg/operators"
+	"github.com/ilhamster/ltl/pkg/parser"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, s string) ltl.Operator {
+	t.Helper()
+	l, err := parser.NewLexer(parser.DefaultTokens, smatch.Generator(),
+		bufio.NewReader(strings.NewReader(s)))
+	if err != nil {
+		t.Fatalf("Failed to create lexer: %s", err)
+	}
+	op, err := parser.ParseLTL(l)
+	if err != nil {
+		t.Fatalf("Failed to parse '%s': %s", s, err)
+	}
+	return op
+}
+
+func pp(op ltl.Operator) string {
+	return ops.PrettyPrint(op, ops.Inline())
+}
+
+func TestRoundTrip(t *testing.T) {
+	r := codec.NewRegistry().Register("smatch", smatch.NewCodec())
+	a, b := smatch.New("a"), smatch.New("b")
+	tests := []ltl.Operator{
+		parse(t, "[a] THEN [b]"),
+		parse(t, "(EVENTUALLY [a] AND NOT [b]) LIMIT 10"),
+		parse(t, "[$a<-] THEN ([$b<-] UNTIL [$a]) OR GLOBALLY [c[d]]"),
+		ops.Sequence(a, ops.True(), ops.AnyToken(), ops.Accept(3, b)),
+		ops.FirstOf(ops.RespondsTo(a, ops.False()), ops.NotFollowedBy(a, b)),
+	}
+	for _, op := range tests {
+		t.Run(pp(op), func(t *testing.T) {
+			data, err := r.Marshal(op)
+			if err != nil {
+				t.Fatalf("Marshal() yielded unexpected error %s", err)
+			}
+			got, err := r.Unmarshal(data)
+			if err != nil {
+				t.Fatalf("Unmarshal(%s) yielded unexpected error %s", data, err)
+			}
+			if pp(got) != pp(op) {
+				t.Errorf("Unmarshal(%s) = %s, wanted %s", data, pp(got), pp(op))
+			}
+		})
+	}
+}
+
+func TestDecodedBehavior(t *testing.T) {
+	r := codec.NewRegistry().Register("smatch", smatch.NewCodec(smatch.Capture(true)))
+	data, err := r.Marshal(parse(t, "[$a<-] THEN [2] THEN [$a]"))
+	if err != nil {
+		t.Fatalf("Marshal() yielded unexpected error %s", err)
+	}
+	op, err := r.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal() yielded unexpected error %s", err)
+	}
+	var env ltl.Environment
+	for idx, ch := range "121" {
+		op, env = ltl.Match(op, rtok.New(ch, idx))
+	}
+	if op != nil || !env.Matching() {
+		t.Errorf("Decoded operator did not match '121'")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	r := codec.NewRegistry().Register("smatch", smatch.NewCodec())
+	a := smatch.New("a")
+	p := ops.Predicate(func(ltl.Token) (bool, error) { return true, nil })
+	for _, op := range []ltl.Operator{
+		nil,
+		p,
+		ops.Then(a, p),
+		ops.LimitConsumed(3, a),
+	} {
+		if data, err := r.Marshal(op); err == nil {
+			t.Errorf("Marshal(%s) = %s, wanted error", pp(op), data)
+		}
+	}
+	if _, err := codec.NewRegistry().Marshal(a); err == nil {
+		t.Errorf("Marshal() with no codecs registered yielded no error")
+	}
+	for _, data := range []string{
+		`{"codec":"regexp","leaf":"a+"}`,
+		`{"op":"WHEREUPON","args":[{"codec":"smatch","leaf":"a"}]}`,
+		`{"op":"THEN","args":[{"codec":"smatch","leaf":"a"}]}`,
+		`{"op":"NOT","args":[null]}`,
+		`{"op":"SEQUENCE"}`,
+		`{"op":"SEQUENCE","args":[]}`,
+		`[`,
+	} {
+		if op, err := r.Unmarshal([]byte(data)); err == nil {
+			t.Errorf("Unmarshal(%s) = %s, wanted error", data, pp(op))
+		}
+	}
+}
+
+// describe summarizes an Environment's matching state, bindings, and
+// captured Tokens.
+func describe(env ltl.Environment) string {
+	if env == nil {
+		return "<nil>"
+	}
+	var caps []string
+	for tok := range be.Captures(env).Get(env.Matching()) {
+		caps = append(caps, tok.String())
+	}
+	sort.Strings(caps)
+	return fmt.Sprintf("%t %v %s [%s]", env.Matching(), env.Err(), be.Bindings(env), strings.Join(caps, ", "))
+}
+
+// run matches op against input, checkpointing and restoring it after the
+// first split Tokens if split >= 0.  It returns the description of the final
+// Environment.
+func run(t *testing.T, r *codec.Registry, op ltl.Operator, input string, split int) string {
+	t.Helper()
+	var env ltl.Environment
+	for idx, ch := range input {
+		if idx == split && op != nil {
+			data, err := r.Checkpoint(op)
+			if err != nil {
+				t.Fatalf("Checkpoint() yielded unexpected error %s", err)
+			}
+			if op, err = r.Restore(data); err != nil {
+				t.Fatalf("Restore(%s) yielded unexpected error %s", data, err)
+			}
+		}
+		op, env = ltl.Match(op, rtok.New(ch, idx))
+		if op == nil {
+			break
+		}
+	}
+	if op != nil {
+		env = ltl.Finish(op)
+	}
+	return describe(env)
+}
+
+func TestCheckpoint(t *testing.T) {
+	r := codec.NewRegistry().
+		Register("smatch", smatch.NewCodec(smatch.Capture(true))).
+		RegisterToken("rune", rtok.Codec{})
+	gen := smatch.Generator(smatch.Capture(true))
+	tests := []struct {
+		expr   string
+		inputs []string
+	}{
+		{"[$a<-] THEN (([1] THEN [2]) UNTIL [$a])", []string{"312123", "1121", "3121"}},
+		{"[$a<-] THEN EVENTUALLY NOT [$a]", []string{"12", "112", "111"}},
+		{"(EVENTUALLY [1]) AND (EVENTUALLY [2]) AND EVENTUALLY [3]", []string{"414342", "41434"}},
+		{"[$a<-] THEN ([$b<-] UNTIL [$a])", []string{"abba", "ccc", "cabc"}},
+		{"([a] RELEASE [b]) THEN [c]", []string{"bbabc", "bbc"}},
+		{"GLOBALLY ([ab] OR [c])", []string{"abcab", "abca"}},
+	}
+	for _, test := range tests {
+		l, err := parser.NewLexer(parser.DefaultTokens, gen, bufio.NewReader(strings.NewReader(test.expr)))
+		if err != nil {
+			t.Fatalf("Failed to create lexer: %s", err)
+		}
+		op, err := parser.ParseLTL(l)
+		if err != nil {
+			t.Fatalf("Failed to parse '%s': %s", test.expr, err)
+		}
+		for _, input := range test.inputs {
+			want := run(t, r, op, input, -1)
+			for split := 0; split < len(input); split++ {
+				t.Run(fmt.Sprintf("%s <- %s|%s", test.expr, input[:split], input[split:]), func(t *testing.T) {
+					if got := run(t, r, op, input, split); got != want {
+						t.Errorf("Got %s, wanted %s", got, want)
+					}
+				})
+			}
+		}
+	}
+	// Exercise Operators that only appear in continuations.
+	cm := func(s string) ltl.Operator {
+		return smatch.New(s, smatch.Capture(true))
+	}
+	for _, internal := range []ltl.Operator{
+		ops.LimitConsumed(2, ops.FirstOf(ops.Then(ops.NotFollowedBy(cm("a"), cm("b")), cm("c")), ops.RecentGlobally(2, cm("c")))),
+		ops.RecentGlobally(2, ops.Eventually(cm("c"))),
+	} {
+		for _, input := range []string{"acc", "ab", "aca", "ccc", "aacac"} {
+			want := run(t, r, internal, input, -1)
+			for split := 0; split < len(input); split++ {
+				if got := run(t, r, internal, input, split); got != want {
+					t.Errorf("%s <- %s|%s: got %s, wanted %s", pp(internal), input[:split], input[split:], got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestCheckpointRecords(t *testing.T) {
+	rec, err := bindings.Record("r", bindings.Int("pid", 1), bindings.String("name", "x"))
+	if err != nil {
+		t.Fatalf("Record() yielded unexpected error %s", err)
+	}
+	b, err := bindings.New(rec)
+	if err != nil {
+		t.Fatalf("New() yielded unexpected error %s", err)
+	}
+	env := be.New(be.Bound(b.Overwriting()))
+	r := codec.NewRegistry()
+	data, err := r.Checkpoint(ops.AndEnvironment(env, ops.AnyToken()))
+	if err != nil {
+		t.Fatalf("Checkpoint() yielded unexpected error %s", err)
+	}
+	op, err := r.Restore(data)
+	if err != nil {
+		t.Fatalf("Restore() yielded unexpected error %s", err)
+	}
+	s, ok := ops.StateOf(op)
+	if !ok || len(s.Envs) != 1 || !ltl.EnvEq(s.Envs[0], env) {
+		t.Errorf("Got restored state %v, wanted environment %s", s, env)
+	} else if !be.Bindings(s.Envs[0]).Overwrites("r") {
+		t.Errorf("Restored bindings %s are not overwriting", be.Bindings(s.Envs[0]))
+	}
+}
+
+func TestCheckpointErrors(t *testing.T) {
+	r := codec.NewRegistry().Register("smatch", smatch.NewCodec(smatch.Capture(true)))
+	op, _ := ops.Then(smatch.New("a", smatch.Capture(true)), smatch.New("b")).Match(rtok.New('a', 0))
+	if _, err := r.Checkpoint(op); err == nil {
+		t.Errorf("Checkpoint() of a capture with no token codec yielded no error")
+	}
+	if _, err := r.Checkpoint(nil); err == nil {
+		t.Errorf("Checkpoint() of nil yielded no error")
+	}
+	if _, err := r.Restore([]byte(`{"op":{"type":"BOGUS"}}`)); err == nil {
+		t.Errorf("Restore() of an unknown type yielded no error")
+	}
+	if _, err := r.Restore([]byte(`{"op":{"type":"AND_ENVIRONMENT","args":[{"type":"TRUE"}]}}`)); err == nil {
+		t.Errorf("Restore() of an AND_ENVIRONMENT with no environment yielded no error")
+	}
+	if _, err := r.Restore([]byte(`{"op":{"type":"SEQUENCE"}}`)); err == nil {
+		t.Errorf("Restore() of a SEQUENCE with no children yielded no error")
+	}
+}
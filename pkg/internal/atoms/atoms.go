@@ -0,0 +1,161 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package atoms replaces the leaves of operator trees (matchers, predicates,
+// and the like) with atomic propositions, for packages that interpret
+// operator trees over valuations of their leaves rather than over Tokens.
+package atoms
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	ops "github.com/ilhamster/ltl/pkg/operators"
+)
+
+// Token is the Token provided to an atomized operator tree.  Bit i is set iff
+// Atom i holds.
+type Token uint64
+
+func (at Token) String() string {
+	return fmt.Sprintf("ATOMS(%b)", uint64(at))
+}
+
+// EOI returns false for all Tokens.
+func (at Token) EOI() bool {
+	return false
+}
+
+// Atom is a leaf holding when its bit is set in a Token.
+type Atom int
+
+// Match implements ltl.Operator.
+func (a Atom) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	if tok.EOI() {
+		return nil, ltl.NotMatching
+	}
+	return nil, ltl.State(uint64(tok.(Token))&(1<<uint(a)) != 0)
+}
+
+func (a Atom) String() string {
+	return fmt.Sprintf("ATOM(%d)", int(a))
+}
+
+// Reducible returns true for all Atoms.
+func (a Atom) Reducible() bool {
+	return true
+}
+
+// Atomizer replaces the leaves of operator trees with Atoms, numbered in the
+// order their leaves are first encountered.
+type Atomizer struct {
+	// verb describes the Atomizer's client in errors, as in 'cannot compile'.
+	verb string
+	max  int
+	// If shared is true, leaves that print identically share an Atom.
+	shared bool
+	// If continuations is true, partially-evaluated continuations are
+	// atomized like any other operator with children.
+	continuations bool
+	leaves        []ltl.Operator
+	byKey         map[string]Atom
+}
+
+// Option configures an Atomizer.
+type Option func(az *Atomizer)
+
+// Shared specifies that leaves that print identically are taken to be the
+// same proposition, and share an Atom.
+func Shared() Option {
+	return func(az *Atomizer) {
+		az.shared = true
+	}
+}
+
+// Continuations specifies that partially-evaluated continuations from
+// package operators, such as those returned by RecentGlobally, may be
+// atomized.  Otherwise, they produce an error.
+func Continuations() Option {
+	return func(az *Atomizer) {
+		az.continuations = true
+	}
+}
+
+// NewAtomizer returns a new Atomizer, allowing up to max Atoms and describing
+// its client with verb, such as 'compile', in errors.
+func NewAtomizer(verb string, max int, opts ...Option) *Atomizer {
+	az := &Atomizer{verb: verb, max: max, byKey: map[string]Atom{}}
+	for _, opt := range opts {
+		opt(az)
+	}
+	return az
+}
+
+// Atomize returns a copy of op with its leaves replaced by Atoms.  True,
+// False, and AnyToken, whose behavior doesn't depend on the Token's value, are
+// left in place.  It returns an error if the tree contains Operators that
+// can't be atomized, or more than the receiver's maximum number of Atoms.
+func (az *Atomizer) Atomize(op ltl.Operator) (ltl.Operator, error) {
+	children := ops.Children(op)
+	switch ops.KindOf(op) {
+	case ops.TrueKind, ops.FalseKind, ops.AnyTokenKind:
+		return op, nil
+	case ops.NotFollowedByKind:
+		return nil, fmt.Errorf("cannot %s NotFollowedBy", az.verb)
+	case ops.PredicateKind, ops.Other:
+		if _, ok := ops.StateOf(op); ok && len(children) > 0 && az.continuations {
+			// A partially-evaluated continuation from package operators.
+			break
+		}
+		if len(children) > 0 {
+			return nil, fmt.Errorf("cannot %s operator %s", az.verb, op)
+		}
+		return az.newAtom(op)
+	}
+	newChildren := make([]ltl.Operator, len(children))
+	for idx, child := range children {
+		newChild, err := az.Atomize(child)
+		if err != nil {
+			return nil, err
+		}
+		newChildren[idx] = newChild
+	}
+	return ops.WithChildren(op, newChildren...), nil
+}
+
+func (az *Atomizer) newAtom(leaf ltl.Operator) (ltl.Operator, error) {
+	key := leaf.String()
+	if a, ok := az.byKey[key]; ok && az.shared {
+		return a, nil
+	}
+	if len(az.leaves) == az.max {
+		return nil, errors.New(az.tooMany())
+	}
+	a := Atom(len(az.leaves))
+	az.leaves = append(az.leaves, leaf)
+	az.byKey[key] = a
+	return a, nil
+}
+
+func (az *Atomizer) tooMany() string {
+	if az.shared {
+		return fmt.Sprintf("cannot %s more than %d distinct leaves", az.verb, az.max)
+	}
+	return fmt.Sprintf("cannot %s more than %d leaves", az.verb, az.max)
+}
+
+// Leaves returns the leaves replaced so far, indexed by Atom.
+func (az *Atomizer) Leaves() []ltl.Operator {
+	return az.leaves
+}
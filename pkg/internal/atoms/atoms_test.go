@@ -0,0 +1,81 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package atoms
+
+import (
+	smatch "github.com/ilhamster/ltl/examples/stringmatcher"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	ops "github.com/ilhamster/ltl/pkg/operators"
+	"testing"
+)
+
+func TestAtomize(t *testing.T) {
+	op := ops.And(ops.Or(smatch.New("a"), smatch.New("b")), ops.Eventually(ops.And(smatch.New("a"), ops.AnyToken())))
+	for _, test := range []struct {
+		desc       string
+		opts       []Option
+		want       string
+		wantLeaves int
+	}{{
+		"unshared", nil,
+		"AND(OR(ATOM(0),ATOM(1)),EVENTUALLY(AND(ATOM(2),ANY)))", 3,
+	}, {
+		"shared", []Option{Shared()},
+		"AND(OR(ATOM(0),ATOM(1)),EVENTUALLY(AND(ATOM(0),ANY)))", 2,
+	}} {
+		t.Run(test.desc, func(t *testing.T) {
+			az := NewAtomizer("test", 3, test.opts...)
+			atomized, err := az.Atomize(op)
+			if err != nil {
+				t.Fatalf("Atomize(%s) yielded unexpected error %s", op, err)
+			}
+			if got := ops.PrettyPrint(atomized, ops.Inline()); got != test.want {
+				t.Errorf("Atomize(%s) = %s, wanted %s", op, got, test.want)
+			}
+			if got := len(az.Leaves()); got != test.wantLeaves {
+				t.Errorf("Atomize(%s) replaced %d leaves, wanted %d", op, got, test.wantLeaves)
+			}
+		})
+	}
+	if _, env := Atom(1).Match(Token(2)); !env.Matching() {
+		t.Errorf("ATOM(1) didn't match %s, wanted it to", Token(2))
+	}
+	if _, env := Atom(1).Match(Token(1)); env.Matching() {
+		t.Errorf("ATOM(1) matched %s, wanted it not to", Token(1))
+	}
+}
+
+func TestAtomizeErrors(t *testing.T) {
+	for _, test := range []struct {
+		desc string
+		az   *Atomizer
+		op   ltl.Operator
+	}{{
+		"too many leaves", NewAtomizer("test", 1),
+		ops.Or(smatch.New("a"), smatch.New("a")),
+	}, {
+		"continuation", NewAtomizer("test", 2),
+		ops.RecentGlobally(2, smatch.New("a")),
+	}} {
+		t.Run(test.desc, func(t *testing.T) {
+			if _, err := test.az.Atomize(test.op); err == nil {
+				t.Errorf("Atomize(%s) succeeded, wanted an error", test.op)
+			}
+		})
+	}
+	if _, err := NewAtomizer("test", 2, Continuations()).Atomize(ops.RecentGlobally(2, smatch.New("a"))); err != nil {
+		t.Errorf("Atomize with Continuations yielded unexpected error %s", err)
+	}
+}
@@ -0,0 +1,29 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ltl
+
+// EOIToken is a Token marking the end of an input stream.  It carries no other
+// data, and may be provided to any Operator regardless of the Token type that
+// Operator otherwise accepts.
+type EOIToken struct{}
+
+func (et EOIToken) String() string {
+	return "EOI"
+}
+
+// EOI returns true for all EOITokens.
+func (et EOIToken) EOI() bool {
+	return true
+}
@@ -0,0 +1,60 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ltl
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrTokenType is matched, under errors.Is, by every TokenTypeError.
+var ErrTokenType = errors.New("unexpected token type")
+
+// TokenTypeError is the error of an Environment returned by an Operator
+// provided a Token of a type it cannot handle, as when a matcher for one
+// Token type is provided another.  Use errors.As to retrieve it from an
+// Environment's Err.
+type TokenTypeError struct {
+	// Token is the offending Token.
+	Token Token
+	// Index is the Token's position in its stream, or -1 if it is not known.
+	Index int
+	// Want describes the type expected.
+	Want string
+}
+
+// NewTokenTypeError returns a TokenTypeError for the provided Token, which
+// was expected to be of the type described by want.  If the Token has an
+// Index method, it is used to populate the error's Index.
+func NewTokenTypeError(tok Token, want string) *TokenTypeError {
+	idx := -1
+	if it, ok := tok.(interface{ Index() int }); ok {
+		idx = it.Index()
+	}
+	return &TokenTypeError{tok, idx, want}
+}
+
+func (tte *TokenTypeError) Error() string {
+	at := ""
+	if tte.Index >= 0 {
+		at = fmt.Sprintf(" at index %d", tte.Index)
+	}
+	return fmt.Sprintf("token %s%s has type %T, expected %s", tte.Token, at, tte.Token, tte.Want)
+}
+
+// Is returns true for ErrTokenType.
+func (tte *TokenTypeError) Is(target error) bool {
+	return target == ErrTokenType
+}
@@ -0,0 +1,67 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ltl
+
+// Cloner is implemented by Operators that can copy themselves.  Operators are
+// expected to be immutable: Match returns a continuation rather than
+// modifying its receiver, so that one operator tree may be matched by many
+// streams at once.  An Operator holding state that Match does modify, such as
+// a terminal counting the Tokens it sees, must implement Cloner, so that an
+// OperatorFactory can provide each stream its own copy.  All built-in
+// Operators implement Cloner, cloning their children.
+type Cloner interface {
+	// Clone returns an independent copy of the receiver, and true, or, if
+	// neither the receiver nor any of its descendants holds state modified by
+	// Match, the receiver itself and false.
+	Clone() (Operator, bool)
+}
+
+// Clone clones the provided Operator with its Clone method, if it has one,
+// and otherwise returns it and false.
+func Clone(op Operator) (Operator, bool) {
+	if c, ok := op.(Cloner); ok {
+		return c.Clone()
+	}
+	return op, false
+}
+
+// OperatorFactory produces instances of an operator tree, such as one
+// parsed once at startup, that may each be matched against a separate stream
+// concurrently.  An OperatorFactory is safe for concurrent use.
+type OperatorFactory struct {
+	root Operator
+	// If stateful is true, root holds state modified by Match, so each
+	// instance is a clone.
+	stateful bool
+}
+
+// NewOperatorFactory returns an OperatorFactory producing instances of the
+// provided operator tree.  The tree should not be matched directly once
+// provided.
+func NewOperatorFactory(root Operator) *OperatorFactory {
+	_, stateful := Clone(root)
+	return &OperatorFactory{root: root, stateful: stateful}
+}
+
+// New returns a new instance of the receiver's operator tree, independent of
+// all others.  If the tree holds no state modified by Match, New returns the
+// tree itself, since it may be shared.
+func (f *OperatorFactory) New() Operator {
+	if !f.stateful {
+		return f.root
+	}
+	op, _ := Clone(f.root)
+	return op
+}
@@ -0,0 +1,126 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ltl
+
+import "fmt"
+
+// LimitExceeded is a non-Matching Environment indicating that a query was cut
+// off by a limit before it could resolve, rather than failing to match on its
+// own.  It is otherwise equivalent to NotMatching.  Use IsLimitExceeded to
+// detect it, and LimitExceededBy to carry the sideband state, such as
+// captures and pending references, of the Environment that was cut off.
+var LimitExceeded Environment = limitExceeded{}
+
+// LimitExceededBy returns a LimitExceeded Environment wrapping the provided
+// one, which must not be Matching, so that its sideband state survives the
+// limit.  If the provided Environment is nil or Reducible, LimitExceeded is
+// returned; if it is Matching or Erroring, it is returned unchanged.
+func LimitExceededBy(env Environment) Environment {
+	if env == nil || (env.Reducible() && !env.Matching()) {
+		return LimitExceeded
+	}
+	if env.Matching() || IsErroring(env) {
+		return env
+	}
+	if le, ok := env.(limitExceeded); ok {
+		return le
+	}
+	return limitExceeded{env}
+}
+
+// LimitedEnvironment returns the Environment wrapped by the provided
+// LimitExceeded Environment, and true, or nil and false if it wraps none.
+func LimitedEnvironment(env Environment) (Environment, bool) {
+	if le, ok := env.(limitExceeded); ok && le.env != nil {
+		return le.env, true
+	}
+	return nil, false
+}
+
+type limitExceeded struct {
+	env Environment
+}
+
+func (le limitExceeded) String() string {
+	if le.env != nil {
+		return fmt.Sprintf("LimitExceeded(%s)", le.env)
+	}
+	return "LimitExceeded"
+}
+
+// And returns the receiver, unless its argument is Erroring.  If the receiver
+// wraps an Environment, the AND of that and the argument is wrapped instead.
+func (le limitExceeded) And(env Environment) Environment {
+	if IsErroring(env) {
+		return env
+	}
+	if le.env != nil {
+		return LimitExceededBy(le.env.And(unwrapLimit(env)))
+	}
+	return le
+}
+
+// Or returns its argument if it is Matching, Erroring, Unknown, or
+// irreducible, and otherwise the receiver, so that the limit remains visible.
+// An irreducible argument, such as one with pending references, may yet
+// match.  If the receiver wraps an Environment, the OR of that and the
+// argument is returned, wrapped unless it is Matching, Erroring, or Unknown.
+func (le limitExceeded) Or(env Environment) Environment {
+	if le.env != nil {
+		ret := le.env.Or(unwrapLimit(env))
+		if IsUnknown(ret) {
+			return ret
+		}
+		return LimitExceededBy(ret)
+	}
+	if env.Matching() || !env.Reducible() || IsErroring(env) || IsUnknown(env) {
+		return env
+	}
+	return le
+}
+
+// Not returns Matching, or the NOT of the wrapped Environment, if any.
+func (le limitExceeded) Not() Environment {
+	if le.env != nil {
+		return le.env.Not()
+	}
+	return Matching
+}
+
+func (le limitExceeded) Matching() bool {
+	return false
+}
+
+func (le limitExceeded) Err() error {
+	return nil
+}
+
+func (le limitExceeded) Reducible() bool {
+	return le.env == nil
+}
+
+// EnvEq returns true if the argument is a LimitExceeded Environment wrapping
+// an equivalent Environment.
+func (le limitExceeded) EnvEq(env Environment) bool {
+	ole, ok := env.(limitExceeded)
+	return ok && EnvEq(le.env, ole.env)
+}
+
+func unwrapLimit(env Environment) Environment {
+	if inner, ok := LimitedEnvironment(env); ok {
+		return inner
+	}
+	return env
+}
@@ -0,0 +1,68 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ltl
+
+import (
+	"math"
+)
+
+// robustness is the payload of Robust Environments.
+type robustness float64
+
+var robustnessOps = &PayloadOps{
+	And: func(a, b interface{}) interface{} {
+		return robustness(math.Min(float64(a.(robustness)), float64(b.(robustness))))
+	},
+	Or: func(a, b interface{}) interface{} {
+		return robustness(math.Max(float64(a.(robustness)), float64(b.(robustness))))
+	},
+	Not: func(p interface{}) interface{} {
+		return -p.(robustness)
+	},
+	Of: func(env Environment) interface{} {
+		if env.Matching() {
+			return robustness(math.Inf(1))
+		}
+		return robustness(math.Inf(-1))
+	},
+}
+
+// Robust returns an Environment carrying the provided robustness value, as in
+// the quantitative semantics of signal temporal logic (STL): how strongly a
+// formula is satisfied, if rho is positive, or violated, if it is not.  The
+// Environment matches iff rho is positive.  Robustness values combine as
+// their matching states do: And takes the minimum, Or the maximum, and Not
+// negates, so that, for instance, Globally yields the least robustness over
+// its input, and Eventually the greatest.  Environments without robustness
+// are taken to have a robustness of +Inf if they match, and -Inf otherwise.
+// Retrieve the robustness with RobustnessOf.
+//
+// Since matching resolves as soon as it can, the robustness of a match
+// reflects only the input needed to resolve it.  To evaluate a formula's
+// robustness over an entire input, use package robustness.
+func Robust(rho float64) Environment {
+	return Sideband(State(rho > 0), robustness(rho), robustnessOps)
+}
+
+// RobustnessOf returns the robustness of the provided Environment, and true,
+// if it is Robust, or false otherwise.
+func RobustnessOf(env Environment) (float64, bool) {
+	p, ok := PayloadOf(env)
+	if !ok {
+		return 0, false
+	}
+	rho, ok := p.(robustness)
+	return float64(rho), ok
+}
@@ -0,0 +1,84 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ltl
+
+// Run matches the provided Tokens against op in order until it resolves,
+// finishing its input with an EOIToken if the Tokens run out first, and
+// returns its final Environment.  If that Environment is Erroring, its error
+// is also returned.
+func Run(op Operator, toks []Token) (Environment, error) {
+	env := Environment(NotMatching)
+	for _, tok := range toks {
+		if op == nil {
+			break
+		}
+		op, env = op.Match(tok)
+		if IsErroring(env) {
+			return env, env.Err()
+		}
+	}
+	if op != nil {
+		env = Finish(op)
+	}
+	return env, env.Err()
+}
+
+// MatchResult describes a match found by MatchAll.
+type MatchResult struct {
+	// Start is the index of the Token at which the matching instance began.
+	Start int
+	// End is the index of the Token on which the instance matched.  For a match
+	// at the end of input, it is the index of the last Token.
+	End int
+	// Env is the matching Environment, carrying any bindings and captures of
+	// the match.
+	Env Environment
+}
+
+// MatchAll begins a fresh instance of op at each index in toks, matching it
+// against the Tokens from that index on, and returns every match of every
+// instance, ordered by Start and then by End.  At most one match is reported
+// for each span.  An instance that errors is
+// abandoned, and its error returned along with the matches found so far.
+func MatchAll(op Operator, toks []Token) ([]MatchResult, error) {
+	var ret []MatchResult
+	f := NewOperatorFactory(op)
+	for start := range toks {
+		inst := f.New()
+		var env Environment
+		end := start
+		for ; end < len(toks) && inst != nil; end++ {
+			inst, env = inst.Match(toks[end])
+			if IsErroring(env) {
+				return ret, env.Err()
+			}
+			if env.Matching() {
+				ret = append(ret, MatchResult{start, end, env})
+			}
+		}
+		if inst != nil {
+			if env = Finish(inst); IsErroring(env) {
+				return ret, env.Err()
+			}
+			// A match at the end of input shares its span with any match on the
+			// last Token, so it is reported only if there was none.
+			matchedLast := len(ret) > 0 && ret[len(ret)-1].Start == start && ret[len(ret)-1].End == len(toks)-1
+			if env.Matching() && !matchedLast {
+				ret = append(ret, MatchResult{start, len(toks) - 1, env})
+			}
+		}
+	}
+	return ret, nil
+}
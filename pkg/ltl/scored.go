@@ -0,0 +1,62 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ltl
+
+import (
+	"math"
+)
+
+// score is the payload of Scored Environments, distinguishing it from other
+// float64 payloads.
+type score float64
+
+var scoreOps = &PayloadOps{
+	And: func(a, b interface{}) interface{} {
+		return score(math.Min(float64(a.(score)), float64(b.(score))))
+	},
+	Or: func(a, b interface{}) interface{} {
+		return score(math.Max(float64(a.(score)), float64(b.(score))))
+	},
+	Not: func(p interface{}) interface{} {
+		return 1 - p.(score)
+	},
+	Of: func(env Environment) interface{} {
+		if env.Matching() {
+			return score(1)
+		}
+		return score(0)
+	},
+}
+
+// Scored returns an Environment equivalent to the provided one, but also
+// carrying a score in [0, 1] describing how well it matches, for best-effort
+// matching of noisy input.  Scores combine with fuzzy-logic semantics: And
+// takes the minimum score, Or the maximum, and Not inverts a score s to 1-s.
+// Unscored Environments are taken to score 1 if they match and 0 otherwise.
+// Scores outside [0, 1] are clamped.  Retrieve the score with ScoreOf.
+func Scored(env Environment, s float64) Environment {
+	return Sideband(env, score(math.Max(0, math.Min(1, s))), scoreOps)
+}
+
+// ScoreOf returns the score of the provided Environment, and true, if it is
+// Scored, or false otherwise.
+func ScoreOf(env Environment) (float64, bool) {
+	p, ok := PayloadOf(env)
+	if !ok {
+		return 0, false
+	}
+	s, ok := p.(score)
+	return float64(s), ok
+}
@@ -0,0 +1,146 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ltl
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// PayloadOps specifies how the payloads of Sideband Environments combine.  A
+// nil function leaves the receiver's payload unchanged.
+type PayloadOps struct {
+	// And returns the payload of the AND of two Sideband Environments with
+	// the provided payloads.
+	And func(a, b interface{}) interface{}
+	// Or returns the payload of the OR of two Sideband Environments with the
+	// provided payloads.
+	Or func(a, b interface{}) interface{}
+	// Not returns the payload of the NOT of a Sideband Environment with the
+	// provided payload.
+	Not func(p interface{}) interface{}
+	// Of returns the payload a non-Sideband Environment is taken to carry
+	// when combined with a Sideband Environment.  If Of is nil, such
+	// combinations leave the Sideband Environment's payload unchanged.
+	Of func(env Environment) interface{}
+}
+
+// Sideband returns an Environment equivalent to the provided one, but also
+// carrying the provided payload, such as a cost estimate or a set of matched
+// record IDs, which combines with the payloads of other Sideband Environments
+// as specified by ops.  Retrieve it with PayloadOf.
+//
+// When a Sideband Environment is combined with a non-Sideband Environment, its
+// payload combines with the one ops.Of assigns the other, if any.  The other Environment's own And and Or methods
+// determine whether a Sideband Environment passed to them remains visible to
+// PayloadOf; State and bindingenvironment Environments defer to it.
+func Sideband(env Environment, payload interface{}, ops *PayloadOps) Environment {
+	if env.Err() != nil {
+		return env
+	}
+	if ops == nil {
+		ops = &PayloadOps{}
+	}
+	return &sideband{env, payload, ops}
+}
+
+// PayloadOf returns the payload of the provided Environment, and true, if it
+// is a Sideband Environment, or false otherwise.
+func PayloadOf(env Environment) (interface{}, bool) {
+	if sb, ok := env.(*sideband); ok {
+		return sb.payload, true
+	}
+	return nil, false
+}
+
+type sideband struct {
+	env     Environment
+	payload interface{}
+	ops     *PayloadOps
+}
+
+func (sb *sideband) String() string {
+	return fmt.Sprintf("SIDEBAND(%s, %v)", sb.env, sb.payload)
+}
+
+// And returns the AND of the receiver and argument, combining their payloads
+// with the receiver's PayloadOps.
+func (sb *sideband) And(env Environment) Environment {
+	if errEnv := EitherErroring(sb, env); errEnv != nil {
+		return errEnv
+	}
+	return sb.combine(env, Environment.And, sb.ops.And)
+}
+
+// Or returns the OR of the receiver and argument, combining their payloads
+// with the receiver's PayloadOps.
+func (sb *sideband) Or(env Environment) Environment {
+	if errEnv := EitherErroring(sb, env); errEnv != nil {
+		return errEnv
+	}
+	return sb.combine(env, Environment.Or, sb.ops.Or)
+}
+
+func (sb *sideband) combine(
+	env Environment,
+	envOp func(a, b Environment) Environment,
+	payloadOp func(a, b interface{}) interface{},
+) Environment {
+	payload := sb.payload
+	if payloadOp != nil {
+		if osb, ok := env.(*sideband); ok {
+			env = osb.env
+			payload = payloadOp(sb.payload, osb.payload)
+		} else if sb.ops.Of != nil {
+			payload = payloadOp(sb.payload, sb.ops.Of(env))
+		}
+	} else if osb, ok := env.(*sideband); ok {
+		env = osb.env
+	}
+	return Sideband(envOp(sb.env, env), payload, sb.ops)
+}
+
+// Not returns the NOT of the receiver, inverting its payload with its
+// PayloadOps.
+func (sb *sideband) Not() Environment {
+	payload := sb.payload
+	if sb.ops.Not != nil {
+		payload = sb.ops.Not(payload)
+	}
+	return Sideband(sb.env.Not(), payload, sb.ops)
+}
+
+// Matching returns the matching status of the wrapped Environment.
+func (sb *sideband) Matching() bool {
+	return sb.env.Matching()
+}
+
+// Err returns the error of the wrapped Environment.
+func (sb *sideband) Err() error {
+	return sb.env.Err()
+}
+
+// Reducible is false for all Sideband Environments, since their payloads
+// cannot safely be discarded.
+func (sb *sideband) Reducible() bool {
+	return false
+}
+
+// EnvEq returns true if the argument is a Sideband Environment wrapping an
+// equivalent Environment, with a deeply equal payload.
+func (sb *sideband) EnvEq(env Environment) bool {
+	osb, ok := env.(*sideband)
+	return ok && EnvEq(sb.env, osb.env) && reflect.DeepEqual(sb.payload, osb.payload)
+}
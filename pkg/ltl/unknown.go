@@ -0,0 +1,77 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ltl
+
+// Unknown is a non-Matching Environment indicating that whether a query
+// matches cannot be determined, as when a Token lacks a field a matcher
+// examines.  It combines with other Environments under Kleene's three-valued
+// logic: Unknown AND NotMatching is NotMatching, Unknown OR Matching is
+// Matching, and otherwise And and Or yield Unknown, as does its Not.  Use
+// IsUnknown to detect it.
+var Unknown Environment = unknown{}
+
+type unknown struct{}
+
+func (u unknown) String() string {
+	return "Unknown"
+}
+
+// And returns its argument if it is Erroring or not Matching, and otherwise
+// the receiver.
+func (u unknown) And(env Environment) Environment {
+	if _, ok := PayloadOf(env); ok {
+		return env.And(u)
+	}
+	if IsErroring(env) || (!env.Matching() && !IsUnknown(env)) {
+		return env
+	}
+	return u
+}
+
+// Or returns its argument if it is Matching or Erroring, and otherwise the
+// receiver.
+func (u unknown) Or(env Environment) Environment {
+	if _, ok := PayloadOf(env); ok {
+		return env.Or(u)
+	}
+	if env.Matching() || IsErroring(env) {
+		return env
+	}
+	return u
+}
+
+// Not returns the receiver.
+func (u unknown) Not() Environment {
+	return u
+}
+
+func (u unknown) Matching() bool {
+	return false
+}
+
+func (u unknown) Err() error {
+	return nil
+}
+
+// Reducible returns false, so that Unknown is not discarded as an ordinary
+// non-match would be.
+func (u unknown) Reducible() bool {
+	return false
+}
+
+// EnvEq returns true if the argument is Unknown.
+func (u unknown) EnvEq(env Environment) bool {
+	return IsUnknown(env)
+}
@@ -25,11 +25,32 @@ func Match(op Operator, tok Token) (Operator, Environment) {
 	return nil, NotMatching
 }
 
+// Finish closes out the input stream of the provided Operator, applying an
+// EOIToken to it and returning its final Environment.  op should be the
+// continuation returned by the most recent Match; if it is nil, the stream has
+// already resolved, and NotMatching is returned.
+func Finish(op Operator) Environment {
+	_, env := Match(op, EOIToken{})
+	return env
+}
+
 // IsErroring returns true if the provided Environment's state is Erroring.
 func IsErroring(e Environment) bool {
 	return e.Err() != nil
 }
 
+// IsLimitExceeded returns true if the provided Environment is LimitExceeded.
+func IsLimitExceeded(e Environment) bool {
+	_, ok := e.(limitExceeded)
+	return ok
+}
+
+// IsUnknown returns true if the provided Environment is Unknown.
+func IsUnknown(e Environment) bool {
+	_, ok := e.(unknown)
+	return ok
+}
+
 // EitherErroring returns nil if neither of the provided Environments is
 // Erroring.  Otherwise, it returns one of the Erroring arguments.
 func EitherErroring(a, b Environment) Environment {
@@ -63,3 +84,42 @@ func Reduce(left, right Environment, matching bool) Environment {
 	}
 	return nil
 }
+
+// EnvEqualer is implemented by Environments carrying sideband state, so that
+// EnvEq can compare them.
+type EnvEqualer interface {
+	Environment
+	// EnvEq returns true if the receiver is equivalent to the provided
+	// Environment.  Both are irreducible.
+	EnvEq(env Environment) bool
+}
+
+// EnvEq returns true if the provided Environments are equivalent: they have
+// the same matching state, equivalent errors, and equivalent sideband state.
+// Reducible Environments, such as States, are equivalent if they match alike,
+// are both LimitExceeded or both not, and both error with the same message or
+// both do not.  A Reducible Environment is never equivalent to an irreducible
+// one.  Irreducible Environments are compared by the EnvEq method of either;
+// if neither is an EnvEqualer, they are not equivalent.
+func EnvEq(a, b Environment) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if a.Reducible() && b.Reducible() {
+		if (a.Err() == nil) != (b.Err() == nil) ||
+			(a.Err() != nil && a.Err().Error() != b.Err().Error()) {
+			return false
+		}
+		return a.Matching() == b.Matching() && IsLimitExceeded(a) == IsLimitExceeded(b)
+	}
+	if a.Reducible() || b.Reducible() {
+		return false
+	}
+	if eq, ok := a.(EnvEqualer); ok {
+		return eq.EnvEq(b)
+	}
+	if eq, ok := b.(EnvEqualer); ok {
+		return eq.EnvEq(a)
+	}
+	return false
+}
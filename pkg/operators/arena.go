@@ -0,0 +1,63 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operators
+
+import (
+	be "github.com/ilhamster/ltl/pkg/bindingenvironment"
+	"github.com/ilhamster/ltl/pkg/ltl"
+)
+
+// WithArena returns an operator tree equivalent to the provided one, whose
+// binding Environments are allocated by the provided Arena.  The Environments
+// produced by each terminal of the tree, and by each Operator not defined in
+// this package, are adopted by the Arena, so that the Environments built by
+// combining them are allocated by it too.  The returned tree should be used
+// for a single instance of the formula, and the Arena released once that
+// instance resolves.
+func WithArena(op ltl.Operator, a *be.Arena) ltl.Operator {
+	if op == nil {
+		return nil
+	}
+	if children := Children(op); len(children) > 0 {
+		newChildren := make([]ltl.Operator, len(children))
+		for idx, child := range children {
+			newChildren[idx] = WithArena(child, a)
+		}
+		if newOp := WithChildren(op, newChildren...); newOp != op {
+			return newOp
+		}
+	}
+	return &inArena{NewUnaryOperator(op), a}
+}
+
+// inArena adopts the Environments produced by its child into its Arena, and
+// wraps its child's continuations likewise.
+type inArena struct {
+	UnaryOperator
+	a *be.Arena
+}
+
+func (ia *inArena) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	op, env := ia.Child.Match(tok)
+	env = ia.a.Adopt(env)
+	if op == nil {
+		return nil, env
+	}
+	return &inArena{NewUnaryOperator(op), ia.a}, env
+}
+
+func (ia *inArena) String() string {
+	return "IN_ARENA"
+}
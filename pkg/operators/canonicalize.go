@@ -0,0 +1,180 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operators
+
+import (
+	"github.com/ilhamster/ltl/pkg/ltl"
+	"sort"
+)
+
+// Canonicalize returns an Operator equivalent to the provided one, in a
+// canonical form: chains of ANDs and of ORs are flattened, their operands
+// sorted, and the chains rebuilt left-nested; nested Sequences are flattened;
+// and double negations are removed.  Two Operators differing only in these
+// respects canonicalize to Operators with identical PrettyPrint output.
+// Operators not defined in this package are treated as leaves and returned
+// as-is.
+func Canonicalize(op ltl.Operator) ltl.Operator {
+	if op == nil {
+		return nil
+	}
+	switch o := op.(type) {
+	case *not:
+		if inner, ok := o.Child.(*not); ok {
+			return Canonicalize(inner.Child)
+		}
+		return Not(Canonicalize(o.Child))
+	case *and:
+		return canonicalChain(o, o.with)
+	case *or:
+		return canonicalChain(o, o.with)
+	case *sequence:
+		var children []ltl.Operator
+		for _, child := range o.ChildSlice {
+			child = Canonicalize(child)
+			if seq, ok := child.(*sequence); ok {
+				children = append(children, seq.ChildSlice...)
+			} else {
+				children = append(children, child)
+			}
+		}
+		return Sequence(children...)
+	}
+	ppo, ok := op.(prettyPrintableOperator)
+	if !ok || len(ppo.Children()) == 0 {
+		return op
+	}
+	children := ppo.Children()
+	newChildren := make([]ltl.Operator, len(children))
+	for idx, child := range children {
+		newChildren[idx] = Canonicalize(child)
+	}
+	return withChildren(op, newChildren)
+}
+
+// canonicalChain canonicalizes a chain of the same commutative, associative
+// binary operator (AND or OR), rebuilding it with combine.
+func canonicalChain(op ltl.Operator, combine func(left, right ltl.Operator) ltl.Operator) ltl.Operator {
+	var operands []ltl.Operator
+	var collect func(o ltl.Operator)
+	collect = func(o ltl.Operator) {
+		if sameType(o, op) {
+			for _, child := range o.(prettyPrintableOperator).Children() {
+				collect(child)
+			}
+			return
+		}
+		operands = append(operands, Canonicalize(o))
+	}
+	collect(op)
+	// Operators need not be hashable, so keys are carried alongside them.
+	keyed := make([]struct {
+		key string
+		op  ltl.Operator
+	}, len(operands))
+	for idx, operand := range operands {
+		keyed[idx].key, keyed[idx].op = PrettyPrint(operand, Inline()), operand
+	}
+	sort.SliceStable(keyed, func(a, b int) bool {
+		return keyed[a].key < keyed[b].key
+	})
+	ret := keyed[0].op
+	for _, operand := range keyed[1:] {
+		ret = combine(ret, operand.op)
+	}
+	return ret
+}
+
+func sameType(a, b ltl.Operator) bool {
+	switch a.(type) {
+	case *and:
+		ob, ok := b.(*and)
+		return ok && ob.parallel == a.(*and).parallel
+	case *or:
+		ob, ok := b.(*or)
+		return ok && ob.parallel == a.(*or).parallel
+	}
+	return false
+}
+
+// withChildren returns a copy of op, which must be defined in this package,
+// with its children replaced by the provided ones.  Any other state of op is
+// preserved.  If op is not defined in this package, it is returned unchanged.
+func withChildren(op ltl.Operator, children []ltl.Operator) ltl.Operator {
+	switch o := op.(type) {
+	case *not:
+		return Not(children[0])
+	case *and:
+		return o.with(children[0], children[1])
+	case *or:
+		return o.with(children[0], children[1])
+	case *impliesOp:
+		return implies(children[0], children[1])
+	case *firstOf:
+		return &firstOf{NewBinaryOperator(children[0], children[1])}
+	case *heldFirstOf:
+		return &heldFirstOf{NewUnaryOperator(children[0]), o.held}
+	case *limit:
+		return &limit{NewUnaryOperator(children[0]), o.n}
+	case *deferredLimit:
+		return &deferredLimit{NewUnaryOperator(children[0]), o.n, o.started, o.onlyConsumed}
+	case *next:
+		return Next(children[0])
+	case *accept:
+		return &accept{NewUnaryOperator(children[0]), o.n}
+	case *andEnvironment:
+		return &andEnvironment{NewUnaryOperator(children[0]), o.env}
+	case *orEnvironment:
+		return &orEnvironment{NewUnaryOperator(children[0]), o.env}
+	case *then:
+		return Then(children[0], children[1])
+	case *sequence:
+		return Sequence(children...)
+	case *eventually:
+		return Eventually(children[0])
+	case *globally:
+		return Globally(children[0])
+	case *recentGlobally:
+		envs, live := o.slots()
+		return restoreRecentGlobally(o.n, children[0], envs, live, children[1:])
+	case *until:
+		return Until(children[0], children[1])
+	case *release:
+		return Release(children[0], children[1])
+	case *releaseStepOp:
+		return releaseStep(children[0], children[1])
+	case *releaseAndOp:
+		return releaseAnd(children[0], children[1])
+	case *untilWithin:
+		return &untilWithin{NewBinaryOperator(children[0], children[1]), o.lo, o.hi, o.start, o.started}
+	case *notFollowedBy:
+		return NotFollowedBy(children[0], children[1])
+	case *lookahead:
+		return &lookahead{NewUnaryOperator(children[0]), o.env, o.buf}
+	case *replay:
+		return &replay{NewUnaryOperator(children[0]), o.buf}
+	case *tagged:
+		return &tagged{NewUnaryOperator(children[0]), o.tags, o.f}
+	case *located:
+		return &located{NewUnaryOperator(children[0]), o.loc}
+	case *scope:
+		return &scope{NewUnaryOperator(children[0]), o.names}
+	case *hooked:
+		return &hooked{NewUnaryOperator(children[0]), o.h}
+	case *inArena:
+		return &inArena{NewUnaryOperator(children[0]), o.a}
+	}
+	return op
+}
@@ -0,0 +1,207 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operators
+
+import (
+	"github.com/ilhamster/ltl/pkg/ltl"
+)
+
+// cloneTree implements ltl.Cloner for the composite Operators of this
+// package, which hold no state modified by Match: it copies the provided
+// Operator only if one of its descendants must be copied.
+func cloneTree(op ltl.Operator) (ltl.Operator, bool) {
+	children := Children(op)
+	cloned := make([]ltl.Operator, len(children))
+	copied := false
+	for idx, child := range children {
+		var childCopied bool
+		cloned[idx], childCopied = ltl.Clone(child)
+		copied = copied || childCopied
+	}
+	if !copied {
+		return op, false
+	}
+	return withChildren(op, cloned), true
+}
+
+// Clone implements ltl.Cloner.
+func (n *not) Clone() (ltl.Operator, bool) {
+	return cloneTree(n)
+}
+
+// Clone implements ltl.Cloner.
+func (a *and) Clone() (ltl.Operator, bool) {
+	return cloneTree(a)
+}
+
+// Clone implements ltl.Cloner.
+func (o *or) Clone() (ltl.Operator, bool) {
+	return cloneTree(o)
+}
+
+// Clone implements ltl.Cloner.
+func (i *impliesOp) Clone() (ltl.Operator, bool) {
+	return cloneTree(i)
+}
+
+// Clone implements ltl.Cloner.
+func (fo *firstOf) Clone() (ltl.Operator, bool) {
+	return cloneTree(fo)
+}
+
+// Clone implements ltl.Cloner.
+func (hfo *heldFirstOf) Clone() (ltl.Operator, bool) {
+	return cloneTree(hfo)
+}
+
+// Clone implements ltl.Cloner.
+func (l *limit) Clone() (ltl.Operator, bool) {
+	return cloneTree(l)
+}
+
+// Clone implements ltl.Cloner.
+func (dl *deferredLimit) Clone() (ltl.Operator, bool) {
+	return cloneTree(dl)
+}
+
+// Clone implements ltl.Cloner.
+func (n *next) Clone() (ltl.Operator, bool) {
+	return cloneTree(n)
+}
+
+// Clone implements ltl.Cloner.
+func (a *accept) Clone() (ltl.Operator, bool) {
+	return cloneTree(a)
+}
+
+// Clone implements ltl.Cloner.
+func (ae *andEnvironment) Clone() (ltl.Operator, bool) {
+	return cloneTree(ae)
+}
+
+// Clone implements ltl.Cloner.
+func (oe *orEnvironment) Clone() (ltl.Operator, bool) {
+	return cloneTree(oe)
+}
+
+// Clone implements ltl.Cloner.
+func (t *then) Clone() (ltl.Operator, bool) {
+	return cloneTree(t)
+}
+
+// Clone implements ltl.Cloner.
+func (s *sequence) Clone() (ltl.Operator, bool) {
+	return cloneTree(s)
+}
+
+// Clone implements ltl.Cloner.
+func (e *eventually) Clone() (ltl.Operator, bool) {
+	return cloneTree(e)
+}
+
+// Clone implements ltl.Cloner.
+func (g *globally) Clone() (ltl.Operator, bool) {
+	return cloneTree(g)
+}
+
+// Clone implements ltl.Cloner.
+func (rg *recentGlobally) Clone() (ltl.Operator, bool) {
+	return cloneTree(rg)
+}
+
+// Clone implements ltl.Cloner.
+func (u *until) Clone() (ltl.Operator, bool) {
+	return cloneTree(u)
+}
+
+// Clone implements ltl.Cloner.
+func (r *release) Clone() (ltl.Operator, bool) {
+	return cloneTree(r)
+}
+
+// Clone implements ltl.Cloner.
+func (rs *releaseStepOp) Clone() (ltl.Operator, bool) {
+	return cloneTree(rs)
+}
+
+// Clone implements ltl.Cloner.
+func (ra *releaseAndOp) Clone() (ltl.Operator, bool) {
+	return cloneTree(ra)
+}
+
+// Clone implements ltl.Cloner.
+func (uw *untilWithin) Clone() (ltl.Operator, bool) {
+	return cloneTree(uw)
+}
+
+// Clone implements ltl.Cloner.
+func (nfb *notFollowedBy) Clone() (ltl.Operator, bool) {
+	return cloneTree(nfb)
+}
+
+// Clone implements ltl.Cloner.
+func (la *lookahead) Clone() (ltl.Operator, bool) {
+	return cloneTree(la)
+}
+
+// Clone implements ltl.Cloner.
+func (r *replay) Clone() (ltl.Operator, bool) {
+	return cloneTree(r)
+}
+
+// Clone implements ltl.Cloner.
+func (t *tagged) Clone() (ltl.Operator, bool) {
+	return cloneTree(t)
+}
+
+// Clone implements ltl.Cloner.
+func (l *located) Clone() (ltl.Operator, bool) {
+	return cloneTree(l)
+}
+
+// Clone implements ltl.Cloner.
+func (s *scope) Clone() (ltl.Operator, bool) {
+	return cloneTree(s)
+}
+
+// Clone implements ltl.Cloner.
+func (ho *hooked) Clone() (ltl.Operator, bool) {
+	return cloneTree(ho)
+}
+
+// Clone implements ltl.Cloner.  Clones share the receiver's Arena.
+func (ia *inArena) Clone() (ltl.Operator, bool) {
+	return cloneTree(ia)
+}
+
+// Clone implements ltl.Cloner.  Terminals hold no state modified by Match.
+func (c constant) Clone() (ltl.Operator, bool) {
+	return c, false
+}
+
+// Clone implements ltl.Cloner.
+func (at anyToken) Clone() (ltl.Operator, bool) {
+	return at, false
+}
+
+// Clone implements ltl.Cloner.
+func (p *predicate) Clone() (ltl.Operator, bool) {
+	return p, false
+}
+
+// Clone implements ltl.Cloner.
+func (sp *scoredPredicate) Clone() (ltl.Operator, bool) {
+	return sp, false
+}
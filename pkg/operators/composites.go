@@ -0,0 +1,44 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operators
+
+import (
+	"github.com/ilhamster/ltl/pkg/ltl"
+)
+
+// Precedes matches if b does not hold before a has held.  a and b may hold on
+// the same Token.  Precedes resolves matching as soon as a holds, and resolves
+// not matching as soon as b holds first.  If neither ever holds, Precedes
+// matches at the end of input.
+func Precedes(a, b ltl.Operator) ltl.Operator {
+	return Release(a, Or(Not(b), a))
+}
+
+// RespondsTo matches if every time a holds, b holds on the same Token or
+// later.  While a response is outstanding, RespondsTo does not match.  Only
+// one instance of b is pending at a time, since any response to an earlier a
+// also answers subsequent ones.  At the end of input, RespondsTo matches if no
+// response is outstanding.
+func RespondsTo(a, b ltl.Operator) ltl.Operator {
+	return Globally(implies(a, Eventually(b)))
+}
+
+// RespondsToWithin is like RespondsTo, except that each response must occur
+// within n Tokens, counting the Token on which a holds.  Unlike RespondsTo,
+// RespondsToWithin detects a missing response without waiting for the end of
+// input, which suits unbounded streams.
+func RespondsToWithin(n int64, a, b ltl.Operator) ltl.Operator {
+	return Globally(implies(a, Limit(n, Eventually(b))))
+}
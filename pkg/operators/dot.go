@@ -0,0 +1,102 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operators
+
+import (
+	"fmt"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	"strings"
+)
+
+type dotOpts struct {
+	name         string
+	continuation ltl.Operator
+}
+
+// GraphName specifies the name of the graph produced by ToDot.  The default is
+// 'ltl'.
+func GraphName(name string) func(o *dotOpts) {
+	return func(o *dotOpts) {
+		o.name = name
+	}
+}
+
+// WithContinuation specifies that ToDot should also draw the provided
+// Operator, typically a continuation returned by matching the formula against
+// some input, alongside the formula.
+func WithContinuation(cont ltl.Operator) func(o *dotOpts) {
+	return func(o *dotOpts) {
+		o.continuation = cont
+	}
+}
+
+// ToDot returns a Graphviz DOT graph of the specified operator tree, with one
+// node per Operator, labeled with its String(), and edges to its children in
+// order.  If a continuation is provided with WithContinuation, the formula and
+// the continuation are drawn as separate clusters.
+func ToDot(op ltl.Operator, opts ...func(o *dotOpts)) string {
+	o := &dotOpts{name: "ltl"}
+	for _, opt := range opts {
+		opt(o)
+	}
+	d := &dotWriter{}
+	fmt.Fprintf(&d.sb, "digraph %s {\n", dotQuote(o.name))
+	d.sb.WriteString("  ordering=out;\n")
+	d.sb.WriteString("  node [shape=box];\n")
+	if o.continuation == nil {
+		d.node(op, "  ")
+	} else {
+		for idx, cluster := range []struct {
+			label string
+			op    ltl.Operator
+		}{{"formula", op}, {"continuation", o.continuation}} {
+			fmt.Fprintf(&d.sb, "  subgraph cluster_%d {\n", idx)
+			fmt.Fprintf(&d.sb, "    label=%s;\n", dotQuote(cluster.label))
+			d.node(cluster.op, "    ")
+			d.sb.WriteString("  }\n")
+		}
+	}
+	d.sb.WriteString("}\n")
+	return d.sb.String()
+}
+
+type dotWriter struct {
+	sb    strings.Builder
+	nodes int
+}
+
+// node writes op and its descendants, returning op's node ID.
+func (d *dotWriter) node(op ltl.Operator, indent string) string {
+	id := fmt.Sprintf("n%d", d.nodes)
+	d.nodes++
+	label := "<nil>"
+	if op != nil {
+		label = op.String()
+	}
+	fmt.Fprintf(&d.sb, "%s%s [label=%s];\n", indent, id, dotQuote(label))
+	for _, child := range Children(op) {
+		childID := d.node(child, indent)
+		fmt.Fprintf(&d.sb, "%s%s -> %s;\n", indent, id, childID)
+	}
+	return id
+}
+
+// dotQuote returns s as a quoted DOT string.
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
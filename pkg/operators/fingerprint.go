@@ -0,0 +1,48 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operators
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/ilhamster/ltl/pkg/ltl"
+)
+
+// Fingerprint returns a hash, as a hexadecimal string, of the canonical form
+// of the provided Operator, as produced by Canonicalize.  Operators that
+// canonicalize identically, such as 'AND([a],[b])' and 'AND([b],[a])', share
+// a fingerprint, as do Operators differing only in the source Locations
+// attached with Located.  Fingerprints are stable across processes, so they
+// may serve as cache keys, or reveal when a deployed set of formulas changes.
+func Fingerprint(op ltl.Operator) string {
+	sum := sha256.Sum256([]byte(PrettyPrint(Canonicalize(unlocated(op)), Inline())))
+	return hex.EncodeToString(sum[:])
+}
+
+// unlocated returns the provided Operator with any Located wrappers removed.
+func unlocated(op ltl.Operator) ltl.Operator {
+	if l, ok := op.(*located); ok {
+		return unlocated(l.Child)
+	}
+	children := Children(op)
+	if len(children) == 0 {
+		return op
+	}
+	newChildren := make([]ltl.Operator, len(children))
+	for idx, child := range children {
+		newChildren[idx] = unlocated(child)
+	}
+	return WithChildren(op, newChildren...)
+}
@@ -0,0 +1,136 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operators
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	"github.com/ilhamster/ltl/pkg/tags"
+)
+
+// Format returns an expression in the syntax accepted by parser.ParseLTL,
+// using its default tokens, that parses back into the specified operator
+// tree.  Leaf Operators are emitted as their String(), so must print as they
+// would be written in the expression; string matchers and binders, which print
+// as their bracketed matcher text, do.  Leaf Operators Tagged only with
+// tags.Labels are emitted with the labels appended, and Located Operators as
+// their children.  Scopes are emitted as SCOPE prefixes.  Sequences are emitted as equivalent chains of THEN.  Format
+// returns an error if the tree contains an Operator with no parser syntax,
+// such as IMPLIES or FIRST_OF, or one of the internal Operators appearing in
+// partially-evaluated continuations.
+func Format(op ltl.Operator) (string, error) {
+	if op == nil {
+		return "", errors.New("cannot format a nil Operator")
+	}
+	switch o := op.(type) {
+	case *not:
+		return formatPrefix("NOT", o.Child)
+	case *next:
+		return formatPrefix("NEXT", o.Child)
+	case *eventually:
+		return formatPrefix("EVENTUALLY", o.Child)
+	case *globally:
+		return formatPrefix("GLOBALLY", o.Child)
+	case *limit:
+		child, err := formatOperand(o.Child)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s LIMIT %d", child, o.n), nil
+	case *and:
+		return formatInfix("AND", o.Left, o.Right)
+	case *or:
+		return formatInfix("OR", o.Left, o.Right)
+	case *until:
+		return formatInfix("UNTIL", o.Left, o.Right)
+	case *release:
+		return formatInfix("RELEASE", o.Left, o.Right)
+	case *then:
+		return formatInfix("THEN", o.Left, o.Right)
+	case *sequence:
+		switch len(o.ChildSlice) {
+		case 0:
+			return "", errors.New("cannot format an empty SEQUENCE")
+		case 1:
+			return Format(o.ChildSlice[0])
+		case 2:
+			return formatInfix("THEN", o.ChildSlice[0], o.ChildSlice[1])
+		}
+		return formatInfix("THEN", o.ChildSlice[0], Sequence(o.ChildSlice[1:]...))
+	case *tagged:
+		if o.f != nil {
+			return "", fmt.Errorf("operator %s has no parser syntax", op)
+		}
+		if len(Children(o.Child)) > 0 {
+			return "", fmt.Errorf("operator %s has no parser syntax: only matchers may be tagged", op)
+		}
+		s, err := Format(o.Child)
+		if err != nil {
+			return "", err
+		}
+		for _, tag := range o.tags {
+			name, ok := tags.LabelName(tag)
+			if !ok {
+				return "", fmt.Errorf("tag %s has no parser syntax", tag)
+			}
+			s += "#" + name
+		}
+		return s, nil
+	case *located:
+		return Format(o.Child)
+	case *scope:
+		return formatPrefix(o.String(), o.Child)
+	}
+	if len(Children(op)) > 0 || KindOf(op) != Other {
+		return "", fmt.Errorf("operator %s has no parser syntax", op)
+	}
+	return op.String(), nil
+}
+
+// formatOperand formats op, parenthesizing it unless it is a leaf.
+func formatOperand(op ltl.Operator) (string, error) {
+	s, err := Format(op)
+	if err != nil {
+		return "", err
+	}
+	if l, ok := op.(*located); ok {
+		op = l.Child
+	}
+	if _, ok := op.(*tagged); ok || len(Children(op)) == 0 {
+		return s, nil
+	}
+	return "(" + s + ")", nil
+}
+
+func formatPrefix(keyword string, child ltl.Operator) (string, error) {
+	c, err := formatOperand(child)
+	if err != nil {
+		return "", err
+	}
+	return keyword + " " + c, nil
+}
+
+func formatInfix(keyword string, left, right ltl.Operator) (string, error) {
+	l, err := formatOperand(left)
+	if err != nil {
+		return "", err
+	}
+	r, err := formatOperand(right)
+	if err != nil {
+		return "", err
+	}
+	return l + " " + keyword + " " + r, nil
+}
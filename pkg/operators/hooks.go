@@ -0,0 +1,96 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operators
+
+import (
+	"github.com/ilhamster/ltl/pkg/ltl"
+)
+
+// Hooks observe the Match calls of an operator tree instrumented with
+// WithHooks.  Each hook receives the instance being matched: a subformula of
+// the instrumented tree, or one of its continuations.  Hooks may be invoked
+// concurrently, as by ParallelAnd, and must not modify the instances they
+// receive.
+type Hooks struct {
+	// BeforeMatch, if non-nil, is invoked before each Match call with the
+	// instance and the Token it is about to match.
+	BeforeMatch func(op ltl.Operator, tok ltl.Token)
+	// OnMatch, if non-nil, is invoked after each Match call with the instance,
+	// the Token it matched, and the Environment it produced.
+	OnMatch func(op ltl.Operator, tok ltl.Token, env ltl.Environment)
+}
+
+// WithHooks returns an operator tree equivalent to the provided one, in which
+// every Match call, on every subformula and on each of their continuations,
+// is observed by the provided Hooks.
+func WithHooks(op ltl.Operator, h Hooks) ltl.Operator {
+	if op == nil {
+		return nil
+	}
+	if children := Children(op); len(children) > 0 {
+		newChildren := make([]ltl.Operator, len(children))
+		for idx, child := range children {
+			newChildren[idx] = WithHooks(child, h)
+		}
+		op = WithChildren(op, newChildren...)
+	}
+	return &hooked{NewUnaryOperator(op), &h}
+}
+
+// hooked invokes its Hooks around each Match call on its child, and wraps its
+// child's continuations likewise.
+type hooked struct {
+	UnaryOperator
+	h *Hooks
+}
+
+func (ho *hooked) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	if ho.h.BeforeMatch != nil {
+		ho.h.BeforeMatch(ho.Child, tok)
+	}
+	op, env := ho.Child.Match(tok)
+	if ho.h.OnMatch != nil {
+		ho.h.OnMatch(ho.Child, tok, env)
+	}
+	if op == nil {
+		return nil, env
+	}
+	return &hooked{NewUnaryOperator(op), ho.h}, env
+}
+
+// matchLookahead forwards to the child, so that a hooked lookahead may still
+// be matched by Then.  For other children, it matches like Match.
+func (ho *hooked) matchLookahead(tok ltl.Token) (ltl.Operator, ltl.Environment, []ltl.Token) {
+	lm, ok := ho.Child.(lookaheadMatcher)
+	if !ok {
+		op, env := ho.Match(tok)
+		return op, env, nil
+	}
+	if ho.h.BeforeMatch != nil {
+		ho.h.BeforeMatch(ho.Child, tok)
+	}
+	op, env, toks := lm.matchLookahead(tok)
+	if ho.h.OnMatch != nil {
+		ho.h.OnMatch(ho.Child, tok, env)
+	}
+	if op == nil {
+		return nil, env, toks
+	}
+	return &hooked{NewUnaryOperator(op), ho.h}, env, nil
+}
+
+func (ho *hooked) String() string {
+	return "HOOKED"
+}
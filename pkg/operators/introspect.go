@@ -0,0 +1,130 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operators
+
+import (
+	"github.com/ilhamster/ltl/pkg/ltl"
+)
+
+// Kind identifies the operation performed by an Operator from this package,
+// so that operator trees may be inspected and transformed from outside it.
+type Kind string
+
+// Kinds of the Operators defined in this package.  Operators defined
+// elsewhere, such as matchers, and the internal continuations of the
+// Operators in this package, are of kind Other.
+const (
+	Other             Kind = ""
+	NotKind           Kind = "NOT"
+	AndKind           Kind = "AND"
+	OrKind            Kind = "OR"
+	ImpliesKind       Kind = "IMPLIES"
+	FirstOfKind       Kind = "FIRST_OF"
+	LimitKind         Kind = "LIMIT"
+	NextKind          Kind = "NEXT"
+	AcceptKind        Kind = "ACCEPT"
+	ThenKind          Kind = "THEN"
+	SequenceKind      Kind = "SEQUENCE"
+	EventuallyKind    Kind = "EVENTUALLY"
+	GloballyKind      Kind = "GLOBALLY"
+	UntilKind         Kind = "UNTIL"
+	ReleaseKind       Kind = "RELEASE"
+	NotFollowedByKind Kind = "NOT_FOLLOWED_BY"
+	TrueKind          Kind = "TRUE"
+	FalseKind         Kind = "FALSE"
+	AnyTokenKind      Kind = "ANY"
+	PredicateKind     Kind = "PREDICATE"
+)
+
+// KindOf returns the Kind of the provided Operator.  Parameterized variants of
+// an operation, such as LimitAfterStart or RecentGlobally, are of kind Other,
+// as are nil Operators.
+func KindOf(op ltl.Operator) Kind {
+	switch o := op.(type) {
+	case *not:
+		return NotKind
+	case *and:
+		return AndKind
+	case *or:
+		return OrKind
+	case *impliesOp:
+		return ImpliesKind
+	case *firstOf:
+		return FirstOfKind
+	case *limit:
+		return LimitKind
+	case *next:
+		return NextKind
+	case *accept:
+		return AcceptKind
+	case *then:
+		return ThenKind
+	case *sequence:
+		return SequenceKind
+	case *eventually:
+		return EventuallyKind
+	case *globally:
+		return GloballyKind
+	case *until:
+		return UntilKind
+	case *release:
+		return ReleaseKind
+	case *notFollowedBy:
+		return NotFollowedByKind
+	case constant:
+		if o {
+			return TrueKind
+		}
+		return FalseKind
+	case anyToken:
+		return AnyTokenKind
+	case *predicate:
+		return PredicateKind
+	}
+	return Other
+}
+
+// Children returns the children of the provided Operator, or nil if it has
+// none or does not expose them.
+func Children(op ltl.Operator) []ltl.Operator {
+	if ppo, ok := op.(prettyPrintableOperator); ok {
+		return ppo.Children()
+	}
+	return nil
+}
+
+// WithChildren returns a copy of the provided Operator with its children
+// replaced by the provided ones, in the order returned by Children.  Any other
+// state of the Operator, such as a Limit's count, is preserved.  Operators not
+// defined in this package, and Operators without children, are returned
+// unchanged.
+func WithChildren(op ltl.Operator, children ...ltl.Operator) ltl.Operator {
+	if len(Children(op)) != len(children) || len(children) == 0 {
+		return op
+	}
+	return withChildren(op, children)
+}
+
+// Count returns the count parameter of a Limit or Accept Operator, and true,
+// or false for any other Operator.
+func Count(op ltl.Operator) (int64, bool) {
+	switch o := op.(type) {
+	case *limit:
+		return o.n, true
+	case *accept:
+		return o.n, true
+	}
+	return 0, false
+}
@@ -0,0 +1,96 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operators
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ilhamster/ltl/pkg/ltl"
+)
+
+// Location identifies the text of an expression from which an Operator was
+// parsed.
+type Location struct {
+	// Start and End are the offsets of the text in the expression, with End
+	// exclusive.
+	Start, End int
+	// Text is the text itself.
+	Text string
+}
+
+func (l Location) String() string {
+	return fmt.Sprintf("%s at offset %d", l.Text, l.Start)
+}
+
+// LocationError is the error of an Erroring Environment produced by an
+// Operator wrapped with Located, identifying where in its expression the
+// Operator was written.  Use errors.As to retrieve it from an Environment's
+// Err; the original error is available from Unwrap.
+type LocationError struct {
+	Location
+	Err error
+}
+
+func (le *LocationError) Error() string {
+	return fmt.Sprintf("%s: %s", le.Location, le.Err)
+}
+
+// Unwrap returns the original error.
+func (le *LocationError) Unwrap() error {
+	return le.Err
+}
+
+// Located matches its child, wrapping the errors of any Erroring
+// Environments its child produces in a LocationError for the provided
+// Location.  Errors already carrying a LocationError, from a more deeply
+// nested Located, are left alone.
+func Located(child ltl.Operator, loc Location) ltl.Operator {
+	if child == nil {
+		return nil
+	}
+	return &located{NewUnaryOperator(child), loc}
+}
+
+// LocationOf returns the Location of the provided Operator, and true, if it
+// is Located, or false otherwise.
+func LocationOf(op ltl.Operator) (Location, bool) {
+	if l, ok := op.(*located); ok {
+		return l.loc, true
+	}
+	return Location{}, false
+}
+
+type located struct {
+	UnaryOperator
+	loc Location
+}
+
+func (l *located) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	op, env := ltl.Match(l.Child, tok)
+	if err := env.Err(); err != nil {
+		var le *LocationError
+		if !errors.As(err, &le) {
+			env = ltl.ErrEnv(&LocationError{l.loc, err})
+		}
+	}
+	if op == nil {
+		return nil, env
+	}
+	return &located{NewUnaryOperator(op), l.loc}, env
+}
+
+func (l *located) String() string {
+	return fmt.Sprintf("LOCATED(%d-%d)", l.loc.Start, l.loc.End)
+}
@@ -0,0 +1,195 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operators
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ilhamster/ltl/pkg/ltl"
+)
+
+// errMisplacedLookahead is produced by NotFollowedBy, and its continuations,
+// when matched other than before the right child of a Then.
+var errMisplacedLookahead = errors.New("NOT_FOLLOWED_BY must be followed by the right child of a THEN")
+
+// lookaheadMatcher is implemented by Operators which may consume Tokens beyond
+// their own extent, such as lookaheads, and by Operators which may contain
+// them, such as Then.  Such Operators must be matched by Then, as its left
+// child, which replays those Tokens to its right child.
+type lookaheadMatcher interface {
+	// matchLookahead matches tok like Match.  If the receiver resolves, it
+	// also returns the Tokens, including tok, that it consumed beyond its
+	// extent.
+	matchLookahead(tok ltl.Token) (ltl.Operator, ltl.Environment, []ltl.Token)
+}
+
+// NotFollowedBy matches its child, then checks that its lookahead does not
+// match starting at the next Token.  It matches if its child matched and its
+// lookahead did not.  Tokens examined by the lookahead are not consumed: they
+// are replayed to the right child of the enclosing Then once the lookahead
+// resolves.  Consequently, a match by the enclosing Then may be reported only
+// once the lookahead has resolved.  NotFollowedBy must be the left child of
+// Then, or be followed within a Then's left child, as in
+// Then(Then(NotFollowedBy(a, b), c), d), or in a Sequence; matched anywhere
+// else, it produces an error, since the Tokens it examined could not be
+// replayed.
+func NotFollowedBy(child, lookahead ltl.Operator) ltl.Operator {
+	if child == nil || lookahead == nil {
+		return child
+	}
+	return &notFollowedBy{NewBinaryOperator(child, lookahead)}
+}
+
+type notFollowedBy struct {
+	BinaryOperator
+}
+
+func (nfb *notFollowedBy) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	return nil, ltl.ErrEnv(errMisplacedLookahead)
+}
+
+func (nfb *notFollowedBy) matchLookahead(tok ltl.Token) (ltl.Operator, ltl.Environment, []ltl.Token) {
+	op, env := ltl.Match(nfb.Left, tok)
+	if tok.EOI() {
+		// The lookahead sees an empty input stream.
+		_, laEnv := ltl.Match(nfb.Right, tok)
+		return nil, env.And(laEnv.Not()), nil
+	}
+	if op != nil {
+		return NotFollowedBy(op, nfb.Right), env, nil
+	}
+	// Short-circuit: if the child resolved not matching, and carries no other
+	// state, the lookahead cannot change the result.
+	if env.Reducible() && !env.Matching() {
+		return nil, env, nil
+	}
+	return &lookahead{NewUnaryOperator(nfb.Right), env, nil}, ltl.NotMatching, nil
+}
+
+func (nfb *notFollowedBy) String() string {
+	return "NOT_FOLLOWED_BY"
+}
+
+// lookahead is the continuation of a NotFollowedBy whose child has resolved,
+// but whose lookahead has not.  It buffers the Tokens consumed by the
+// lookahead for later replay.
+type lookahead struct {
+	UnaryOperator
+	env ltl.Environment
+	buf []ltl.Token
+}
+
+func (la *lookahead) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	return nil, ltl.ErrEnv(errMisplacedLookahead)
+}
+
+func (la *lookahead) matchLookahead(tok ltl.Token) (ltl.Operator, ltl.Environment, []ltl.Token) {
+	// Copy, so that continuations never share a buffer.
+	buf := make([]ltl.Token, len(la.buf), len(la.buf)+1)
+	copy(buf, la.buf)
+	buf = append(buf, tok)
+	op, laEnv := ltl.Match(la.Child, tok)
+	if op == nil || tok.EOI() {
+		return nil, la.env.And(laEnv.Not()), buf
+	}
+	return &lookahead{NewUnaryOperator(op), la.env, buf}, ltl.NotMatching, nil
+}
+
+// matchMaybeLookahead matches tok against op, with matchLookahead if op
+// implements it.
+func matchMaybeLookahead(op ltl.Operator, tok ltl.Token) (ltl.Operator, ltl.Environment, []ltl.Token) {
+	if lm, ok := op.(lookaheadMatcher); ok {
+		return lm.matchLookahead(tok)
+	}
+	op, env := ltl.Match(op, tok)
+	return op, env, nil
+}
+
+// replayTokens matches op against toks in turn, with matchLookahead if
+// lookahead is true.  If op resolves before the last Token, the Tokens it did
+// not see are returned, after any op itself consumed beyond its extent.  If
+// op matches before the last Token without resolving, its Environment is
+// returned, and the remaining Tokens are buffered in the returned
+// continuation, to be replayed ahead of the next Token, so that the match is
+// not lost.
+func replayTokens(op ltl.Operator, toks []ltl.Token, lookahead bool) (ltl.Operator, ltl.Environment, []ltl.Token) {
+	var env ltl.Environment
+	for idx, tok := range toks {
+		var rest []ltl.Token
+		if lookahead {
+			op, env, rest = matchMaybeLookahead(op, tok)
+		} else {
+			op, env = ltl.Match(op, tok)
+		}
+		if ltl.IsErroring(env) {
+			return nil, env, nil
+		}
+		remaining := toks[idx+1:]
+		if op == nil {
+			if len(remaining) == 0 {
+				return nil, env, rest
+			}
+			leftover := make([]ltl.Token, 0, len(rest)+len(remaining))
+			leftover = append(leftover, rest...)
+			return nil, env, append(leftover, remaining...)
+		}
+		if env.Matching() && len(remaining) > 0 && !remaining[len(remaining)-1].EOI() {
+			return &replay{NewUnaryOperator(op), remaining}, env, nil
+		}
+	}
+	return op, env, nil
+}
+
+func (la *lookahead) String() string {
+	return fmt.Sprintf("LOOKAHEAD(%s, %d buffered)", la.env, len(la.buf))
+}
+
+// Reducible returns true if the receiver's resolved Environment and its
+// lookahead are reducible.
+func (la *lookahead) Reducible() bool {
+	return la.env.Reducible() && la.UnaryOperator.Reducible()
+}
+
+// replay is the continuation of an Operator that matched while Tokens
+// consumed by a lookahead were replayed to it.  It replays the remaining
+// Tokens ahead of the next one.
+type replay struct {
+	UnaryOperator
+	buf []ltl.Token
+}
+
+func (r *replay) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	op, env, _ := r.matchBuffered(tok, false)
+	return op, env
+}
+
+func (r *replay) matchLookahead(tok ltl.Token) (ltl.Operator, ltl.Environment, []ltl.Token) {
+	return r.matchBuffered(tok, true)
+}
+
+func (r *replay) matchBuffered(tok ltl.Token, lookahead bool) (ltl.Operator, ltl.Environment, []ltl.Token) {
+	// Copy, so that continuations never share a buffer.
+	toks := make([]ltl.Token, len(r.buf), len(r.buf)+1)
+	copy(toks, r.buf)
+	op, env, rest := replayTokens(r.Child, append(toks, tok), lookahead)
+	if tok.EOI() {
+		op = nil
+	}
+	return op, env, rest
+}
+
+func (r *replay) String() string {
+	return fmt.Sprintf("REPLAY(%d buffered)", len(r.buf))
+}
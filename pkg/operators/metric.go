@@ -0,0 +1,90 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operators
+
+import (
+	"fmt"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	"time"
+)
+
+// Metric operators bound their matches by the timestamps of their input
+// Tokens, rather than by Token counts as Limit does.  Their input Tokens must
+// be ltl.TimedTokens; any other Token produces an error.  Intervals are
+// measured from the timestamp of the first Token an operator receives.
+
+// UntilWithin is a real-time-bounded Until.  It matches if its right argument
+// holds, starting at a Token whose timestamp falls between lo and hi
+// (inclusive) after its first Token, and its left argument holds until then.
+// UntilWithin resolves not matching once hi has elapsed.
+func UntilWithin(lo, hi time.Duration, left, right ltl.Operator) ltl.Operator {
+	if left == nil {
+		left = True()
+	}
+	if right == nil {
+		return nil
+	}
+	return &untilWithin{NewBinaryOperator(left, right), lo, hi, time.Time{}, false}
+}
+
+// EventuallyWithinDuration matches if its argument holds, starting at a Token
+// whose timestamp is no more than d after its first Token.  It is equivalent
+// to UntilWithin(0, d, True(), child).
+func EventuallyWithinDuration(d time.Duration, child ltl.Operator) ltl.Operator {
+	return UntilWithin(0, d, True(), child)
+}
+
+type untilWithin struct {
+	BinaryOperator
+	lo, hi  time.Duration
+	start   time.Time
+	started bool
+}
+
+func timestamp(tok ltl.Token) (time.Time, error) {
+	ttok, ok := tok.(ltl.TimedToken)
+	if !ok {
+		return time.Time{}, ltl.NewTokenTypeError(tok, "ltl.TimedToken")
+	}
+	return ttok.Timestamp(), nil
+}
+
+func (uw *untilWithin) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	if tok.EOI() {
+		return nil, ltl.NotMatching
+	}
+	ts, err := timestamp(tok)
+	if err != nil {
+		return nil, ltl.ErrEnv(err)
+	}
+	start := uw.start
+	if !uw.started {
+		start = ts
+	}
+	elapsed := ts.Sub(start)
+	if elapsed > uw.hi {
+		return nil, ltl.NotMatching
+	}
+	next := &untilWithin{uw.BinaryOperator, uw.lo, uw.hi, start, true}
+	if elapsed < uw.lo {
+		// It's too early for the right argument to hold.
+		return Then(uw.Left, next).Match(tok)
+	}
+	return StopAtFirstMatch(tok, Or(uw.Right, Then(uw.Left, next)))
+}
+
+func (uw *untilWithin) String() string {
+	return fmt.Sprintf("UNTIL_WITHIN(%s, %s)", uw.lo, uw.hi)
+}
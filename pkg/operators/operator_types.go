@@ -22,9 +22,45 @@ import (
 // New ltl.Operator definitions can embed the appropriate type for PrettyPrint
 // support.
 
+// reducibility caches whether an operator tree is reducible.  Since operators
+// are immutable, it is computed once, when the operator is constructed; the
+// zero value indicates that it was not, and must be computed on demand.
+type reducibility int8
+
+const (
+	unknownReducibility reducibility = iota
+	reducible
+	irreducible
+)
+
+func reducibilityOf(children ...ltl.Operator) reducibility {
+	for _, child := range children {
+		if !ltl.Reducible(child) {
+			return irreducible
+		}
+	}
+	return reducible
+}
+
+// get returns the receiver if known, and otherwise that of the provided
+// children.
+func (r reducibility) get(children ...ltl.Operator) bool {
+	if r == unknownReducibility {
+		r = reducibilityOf(children...)
+	}
+	return r == reducible
+}
+
 // UnaryOperator is a base type for ltl.Operators with one child ltl.Operator.
+// UnaryOperators should be created with NewUnaryOperator.
 type UnaryOperator struct {
-	Child ltl.Operator
+	Child     ltl.Operator
+	reducible reducibility
+}
+
+// NewUnaryOperator returns a new UnaryOperator with the provided child.
+func NewUnaryOperator(child ltl.Operator) UnaryOperator {
+	return UnaryOperator{child, reducibilityOf(child)}
 }
 
 // Children returns the child of the receiver in a slice.
@@ -34,12 +70,19 @@ func (uo UnaryOperator) Children() []ltl.Operator {
 
 // Reducible returns true if the receiver's child is reducible.
 func (uo UnaryOperator) Reducible() bool {
-	return uo.Child.Reducible()
+	return uo.reducible.get(uo.Child)
 }
 
 // BinaryOperator is a base type for ltl.Operators with two child ltl.Operators.
+// BinaryOperators should be created with NewBinaryOperator.
 type BinaryOperator struct {
 	Left, Right ltl.Operator
+	reducible   reducibility
+}
+
+// NewBinaryOperator returns a new BinaryOperator with the provided children.
+func NewBinaryOperator(left, right ltl.Operator) BinaryOperator {
+	return BinaryOperator{left, right, reducibilityOf(left, right)}
 }
 
 // Children returns the children of the receiver in a slice.
@@ -49,7 +92,7 @@ func (bo BinaryOperator) Children() []ltl.Operator {
 
 // Reducible returns true if the receiver's children are reducible.
 func (bo BinaryOperator) Reducible() bool {
-	return bo.Left.Reducible() && bo.Right.Reducible()
+	return bo.reducible.get(bo.Left, bo.Right)
 }
 
 // MatchBoth applies the provided ltl.Token to both child ltl.Operators of the
@@ -60,10 +103,37 @@ func (bo BinaryOperator) MatchBoth(tok ltl.Token) (newLeft, newRight ltl.Operato
 	return
 }
 
+// MatchBothParallel is like MatchBoth, except that it matches the receiver's
+// children concurrently.  Their Match methods must be safe to call
+// concurrently with each other.
+func (bo BinaryOperator) MatchBothParallel(tok ltl.Token) (newLeft, newRight ltl.Operator, leftEnv, rightEnv ltl.Environment) {
+	done := make(chan struct{})
+	go func() {
+		newLeft, leftEnv = ltl.Match(bo.Left, tok)
+		close(done)
+	}()
+	newRight, rightEnv = ltl.Match(bo.Right, tok)
+	<-done
+	return
+}
+
+func (bo BinaryOperator) matchBoth(tok ltl.Token, parallel bool) (newLeft, newRight ltl.Operator, leftEnv, rightEnv ltl.Environment) {
+	if parallel {
+		return bo.MatchBothParallel(tok)
+	}
+	return bo.MatchBoth(tok)
+}
+
 // NaryOperator is a base type for ltl.Operators with arbitrary child
-// ltl.Operators.
+// ltl.Operators.  NaryOperators should be created with NewNaryOperator.
 type NaryOperator struct {
 	ChildSlice []ltl.Operator
+	reducible  reducibility
+}
+
+// NewNaryOperator returns a new NaryOperator with the provided children.
+func NewNaryOperator(children []ltl.Operator) NaryOperator {
+	return NaryOperator{children, reducibilityOf(children...)}
 }
 
 // Children returns the children of the receiver in a slice.
@@ -73,10 +143,5 @@ func (no NaryOperator) Children() []ltl.Operator {
 
 // Reducible returns true if the receiver's children are reducible.
 func (no NaryOperator) Reducible() bool {
-	for _, child := range no.ChildSlice {
-		if !child.Reducible() {
-			return false
-		}
-	}
-	return true
+	return no.reducible.get(no.ChildSlice...)
 }
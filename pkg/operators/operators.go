@@ -26,7 +26,12 @@ import (
 // helps Operators terminate as soon as they've matched, a necessary property
 // for temporal operators like Then to work.
 func StopAtFirstMatch(tok ltl.Token, op ltl.Operator) (ltl.Operator, ltl.Environment) {
-	op, env := op.Match(tok)
+	return stopAtMatch(op.Match(tok))
+}
+
+// stopAtMatch returns the provided Operator and Environment, except that if
+// the Environment is Matching, a nil Operator is returned.
+func stopAtMatch(op ltl.Operator, env ltl.Environment) (ltl.Operator, ltl.Environment) {
 	if env.Matching() {
 		op = nil
 	}
@@ -37,10 +42,17 @@ func StopAtFirstMatch(tok ltl.Token, op ltl.Operator) (ltl.Operator, ltl.Environ
 // The resulting Operation and Environment are returned, except if the
 // Environment is not Matching, in which case a nil Operator is returned.  This
 // helps Operators terminate as soon as they've matched, a necessary property
-// for temporal operators like Then to work.
+// for temporal operators like Then to work.  An Unknown Environment does not
+// stop the Operator, since later input may yet show it not to match.
 func StopAtFirstNotMatch(tok ltl.Token, op ltl.Operator) (ltl.Operator, ltl.Environment) {
-	op, env := op.Match(tok)
-	if !env.Matching() {
+	return stopAtNotMatch(op.Match(tok))
+}
+
+// stopAtNotMatch returns the provided Operator and Environment, except that
+// if the Environment is neither Matching nor Unknown, a nil Operator is
+// returned.
+func stopAtNotMatch(op ltl.Operator, env ltl.Environment) (ltl.Operator, ltl.Environment) {
+	if !env.Matching() && !ltl.IsUnknown(env) {
 		op = nil
 	}
 	return op, env
@@ -52,7 +64,7 @@ func Not(child ltl.Operator) ltl.Operator {
 	if child == nil {
 		return nil
 	}
-	return &not{UnaryOperator{child}}
+	return &not{NewUnaryOperator(child)}
 }
 
 type not struct {
@@ -76,15 +88,45 @@ func And(left, right ltl.Operator) ltl.Operator {
 	if right == nil {
 		return left
 	}
-	return &and{BinaryOperator{left, right}}
+	return &and{NewBinaryOperator(left, right), false}
+}
+
+// ParallelAnd is equivalent to And, except that on each Token, its arguments
+// are matched concurrently.  This is worthwhile only when both arguments are
+// expensive to match, and their Match methods must be safe to call
+// concurrently with each other.
+func ParallelAnd(left, right ltl.Operator) ltl.Operator {
+	if left == nil {
+		return right
+	}
+	if right == nil {
+		return left
+	}
+	return &and{NewBinaryOperator(left, right), true}
 }
 
 type and struct {
 	BinaryOperator
+	parallel bool
+}
+
+func (a *and) with(left, right ltl.Operator) ltl.Operator {
+	if a.parallel {
+		return ParallelAnd(left, right)
+	}
+	return And(left, right)
 }
 
 func (a *and) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
-	newLeft, newRight, leftEnv, rightEnv := a.BinaryOperator.MatchBoth(tok)
+	newLeft, newRight, leftEnv, rightEnv := a.BinaryOperator.matchBoth(tok, a.parallel)
+	return andResults(newLeft, newRight, leftEnv, rightEnv, a.parallel)
+}
+
+// andResults returns the continuation and Environment of an And whose
+// children produced the provided continuations and Environments.  Like
+// orResults, it permits temporal operators defined in terms of And to match
+// without first building it.
+func andResults(newLeft, newRight ltl.Operator, leftEnv, rightEnv ltl.Environment, parallel bool) (ltl.Operator, ltl.Environment) {
 	if errEnv := ltl.EitherErroring(leftEnv, rightEnv); errEnv != nil {
 		return nil, errEnv
 	}
@@ -99,6 +141,9 @@ func (a *and) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
 	if newRight == nil {
 		return AndEnvironment(rightEnv, newLeft), newEnv
 	}
+	if parallel {
+		return ParallelAnd(newLeft, newRight), newEnv
+	}
 	return And(newLeft, newRight), newEnv
 }
 
@@ -114,19 +159,57 @@ func Or(left, right ltl.Operator) ltl.Operator {
 	if right == nil {
 		return left
 	}
-	return &or{BinaryOperator{left, right}}
+	return &or{NewBinaryOperator(left, right), false}
+}
+
+// ParallelOr is equivalent to Or, except that on each Token, its arguments are
+// matched concurrently, as with ParallelAnd.
+func ParallelOr(left, right ltl.Operator) ltl.Operator {
+	if left == nil {
+		return right
+	}
+	if right == nil {
+		return left
+	}
+	return &or{NewBinaryOperator(left, right), true}
 }
 
 type or struct {
 	BinaryOperator
+	parallel bool
+}
+
+func (o *or) with(left, right ltl.Operator) ltl.Operator {
+	if o.parallel {
+		return ParallelOr(left, right)
+	}
+	return Or(left, right)
 }
 
 func (o *or) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
-	newLeft, newRight, leftEnv, rightEnv := o.BinaryOperator.MatchBoth(tok)
+	newLeft, newRight, leftEnv, rightEnv := o.BinaryOperator.matchBoth(tok, o.parallel)
+	return orResults(newLeft, newRight, leftEnv, rightEnv, o.parallel)
+}
+
+// orResults returns the continuation and Environment of an Or whose children
+// produced the provided continuations and Environments.  It permits temporal
+// operators defined in terms of Or to match without first building it.
+func orResults(newLeft, newRight ltl.Operator, leftEnv, rightEnv ltl.Environment, parallel bool) (ltl.Operator, ltl.Environment) {
 	if errEnv := ltl.EitherErroring(leftEnv, rightEnv); errEnv != nil {
 		return nil, errEnv
 	}
 	newEnv := leftEnv.Or(rightEnv)
+	// A child resolving Unknown must be remembered, since the other child
+	// resolving NotMatching would leave the Or Unknown.
+	if newLeft == nil && ltl.IsUnknown(leftEnv) {
+		return OrEnvironment(leftEnv, newRight), newEnv
+	}
+	if newRight == nil && ltl.IsUnknown(rightEnv) {
+		return OrEnvironment(rightEnv, newLeft), newEnv
+	}
+	if parallel {
+		return ParallelOr(newLeft, newRight), newEnv
+	}
 	return Or(newLeft, newRight), newEnv
 }
 
@@ -134,14 +217,136 @@ func (o *or) String() string {
 	return "OR"
 }
 
+// implies is the logical implication of its arguments, of kind IMPLIES, from
+// which RespondsTo and RespondsToWithin are built: it matches if its
+// antecedent does not match, or if its consequent matches.  Both arguments
+// consume the same input Tokens.  Unlike Or(Not(antecedent), consequent),
+// which continues with its consequent once its antecedent resolves,
+// implies resolves matching as soon as its antecedent resolves without
+// matching, since its consequent is then irrelevant.
+func implies(antecedent, consequent ltl.Operator) ltl.Operator {
+	if antecedent == nil {
+		return nil
+	}
+	if consequent == nil {
+		return Not(antecedent)
+	}
+	return &impliesOp{NewBinaryOperator(antecedent, consequent)}
+}
+
+type impliesOp struct {
+	BinaryOperator
+}
+
+func (i *impliesOp) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	newLeft, newRight, leftEnv, rightEnv := i.BinaryOperator.MatchBoth(tok)
+	if errEnv := ltl.EitherErroring(leftEnv, rightEnv); errEnv != nil {
+		return nil, errEnv
+	}
+	newEnv := leftEnv.Not().Or(rightEnv)
+	if newLeft == nil {
+		if !leftEnv.Matching() {
+			return nil, leftEnv.Not()
+		}
+		return AndEnvironment(leftEnv, newRight), leftEnv.And(rightEnv)
+	}
+	if newRight == nil {
+		if rightEnv.Matching() {
+			return nil, rightEnv
+		}
+		return OrEnvironment(rightEnv, Not(newLeft)), newEnv
+	}
+	return implies(newLeft, newRight), newEnv
+}
+
+func (i *impliesOp) String() string {
+	return "IMPLIES"
+}
+
+// FirstOf is an ordered choice between its arguments.  It matches if its left
+// argument matches, in which case it commits to the left argument, discarding
+// the right.  Only if the left argument terminates without matching does it
+// fall back to its right argument.  If the right argument matches while the
+// left is still pending, that match is held, and is reported only once the left
+// argument fails.  Unlike Or, FirstOf never combines the Environments of its
+// arguments, so bindings made by the left argument take priority over those
+// made by the right.
+func FirstOf(left, right ltl.Operator) ltl.Operator {
+	if left == nil {
+		return right
+	}
+	if right == nil {
+		return left
+	}
+	return &firstOf{NewBinaryOperator(left, right)}
+}
+
+type firstOf struct {
+	BinaryOperator
+}
+
+func (fo *firstOf) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	newLeft, leftEnv := ltl.Match(fo.Left, tok)
+	if leftEnv.Err() != nil || leftEnv.Matching() {
+		return newLeft, leftEnv
+	}
+	newRight, rightEnv := ltl.Match(fo.Right, tok)
+	if newLeft == nil || rightEnv.Err() != nil {
+		return newRight, rightEnv
+	}
+	if rightEnv.Matching() {
+		return &heldFirstOf{NewUnaryOperator(newLeft), rightEnv}, ltl.NotMatching
+	}
+	if newRight == nil {
+		return newLeft, leftEnv
+	}
+	return &firstOf{NewBinaryOperator(newLeft, newRight)}, ltl.NotMatching
+}
+
+func (fo *firstOf) String() string {
+	return "FIRST_OF"
+}
+
+// heldFirstOf is the continuation of a FirstOf whose right argument matched
+// while its left argument was still pending.  It reports the left argument's
+// match if there is one, and the held Environment otherwise.
+type heldFirstOf struct {
+	UnaryOperator
+	held ltl.Environment
+}
+
+func (hfo *heldFirstOf) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	newChild, env := ltl.Match(hfo.Child, tok)
+	if env.Err() != nil || env.Matching() {
+		return newChild, env
+	}
+	if newChild == nil {
+		return nil, hfo.held
+	}
+	return &heldFirstOf{NewUnaryOperator(newChild), hfo.held}, ltl.NotMatching
+}
+
+func (hfo *heldFirstOf) String() string {
+	return fmt.Sprintf("FIRST_OF(held %s)", hfo.held)
+}
+
+// Reducible returns true if the receiver's child and held Environment are
+// reducible.
+func (hfo *heldFirstOf) Reducible() bool {
+	return hfo.UnaryOperator.Reducible() && hfo.held.Reducible()
+}
+
 // Limit is equivalent to the provided Operator, except that if that Operator
-// does not resolve within the specified number of tokens, it returns a
-// non-Matching environment.
+// does not resolve within the specified number of tokens, Limit terminates.
+// If the Operator is not matching at that point, Limit returns its
+// Environment wrapped in ltl.LimitExceeded, so that expiry can be told apart
+// from a genuine mismatch with ltl.IsLimitExceeded, while its captures,
+// bindings, and pending references are kept.
 func Limit(n int64, child ltl.Operator) ltl.Operator {
 	if n == 0 || child == nil {
 		return nil
 	}
-	return &limit{UnaryOperator{child}, n}
+	return &limit{NewUnaryOperator(child), n}
 }
 
 type limit struct {
@@ -154,6 +359,9 @@ func (l *limit) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
 		return nil, ltl.NotMatching
 	}
 	op, env := l.Child.Match(tok)
+	if l.n == 1 && op != nil && !env.Matching() && !ltl.IsErroring(env) {
+		return nil, ltl.LimitExceededBy(env)
+	}
 	newOp := Limit(l.n-1, op)
 	return newOp, env
 }
@@ -162,12 +370,100 @@ func (l *limit) String() string {
 	return fmt.Sprintf("LIMIT(%d)", l.n)
 }
 
-// Next ignores a single input token then attempts to match its child.
+// LimitAfterStart is like Limit, except that its budget of n Tokens starts on
+// the first Token its child consumes, rather than on its first Token.  A Token
+// is consumed when it is matched against one of the child's terminals; Tokens
+// skipped by Next or Accept are not.  So, unlike Limit(n, Accept(k, child)),
+// LimitAfterStart(n, Accept(k, child)) grants child n Tokens of its own.
+func LimitAfterStart(n int64, child ltl.Operator) ltl.Operator {
+	if n <= 0 || child == nil {
+		return nil
+	}
+	return &deferredLimit{NewUnaryOperator(child), n, false, false}
+}
+
+// LimitConsumed is like Limit, except that it counts only those Tokens its
+// child consumes, as with LimitAfterStart, terminating its child on the nth
+// such Token.  Tokens its child skips, as under Next or Accept, do not count
+// against its budget, wherever in the child they occur.
+func LimitConsumed(n int64, child ltl.Operator) ltl.Operator {
+	if n <= 0 || child == nil {
+		return nil
+	}
+	return &deferredLimit{NewUnaryOperator(child), n, false, true}
+}
+
+// deferredLimit implements limits whose budgets are not spent on every Token.
+// If onlyConsumed is false, once started is set every Token counts.
+type deferredLimit struct {
+	UnaryOperator
+	n            int64
+	started      bool
+	onlyConsumed bool
+}
+
+func (dl *deferredLimit) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	counted := consumes(dl.Child) || (dl.started && !dl.onlyConsumed)
+	op, env := dl.Child.Match(tok)
+	if op == nil || ltl.IsErroring(env) {
+		return nil, env
+	}
+	if !counted {
+		return &deferredLimit{NewUnaryOperator(op), dl.n, dl.started, dl.onlyConsumed}, env
+	}
+	if dl.n == 1 {
+		return nil, ltl.LimitExceededBy(env)
+	}
+	return &deferredLimit{NewUnaryOperator(op), dl.n - 1, true, dl.onlyConsumed}, env
+}
+
+func (dl *deferredLimit) String() string {
+	if dl.onlyConsumed {
+		return fmt.Sprintf("LIMIT_CONSUMED(%d)", dl.n)
+	}
+	if dl.started {
+		return fmt.Sprintf("LIMIT_AFTER_START(%d, started)", dl.n)
+	}
+	return fmt.Sprintf("LIMIT_AFTER_START(%d)", dl.n)
+}
+
+// consumes returns true if the provided Operator would consume the next Token
+// it matches, matching it against at least one of its terminals, or false if
+// it would skip that Token, as Next and Accept do.  Operators not defined in
+// this package are assumed to consume each Token they match, unless all of
+// their children skip it.
+func consumes(op ltl.Operator) bool {
+	switch o := op.(type) {
+	case nil, *next, *accept:
+		return false
+	case *then:
+		return consumes(o.Left)
+	case *releaseStepOp:
+		return consumes(o.Left)
+	case *notFollowedBy:
+		return consumes(o.Left)
+	case *sequence:
+		return consumes(o.ChildSlice[0])
+	}
+	children := Children(op)
+	if len(children) == 0 {
+		return true
+	}
+	for _, child := range children {
+		if consumes(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// Next ignores a single input token then attempts to match its child.  At the
+// end of input, there is no next token, so Next resolves not matching.
 func Next(child ltl.Operator) ltl.Operator {
 	if child == nil {
 		return nil
 	}
-	return &next{UnaryOperator{child}}
+	return &next{NewUnaryOperator(child)}
 }
 
 type next struct {
@@ -175,6 +471,9 @@ type next struct {
 }
 
 func (n *next) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	if tok.EOI() {
+		return nil, ltl.NotMatching
+	}
 	return n.Child, ltl.NotMatching
 }
 
@@ -182,6 +481,34 @@ func (n *next) String() string {
 	return "NEXT"
 }
 
+// Accept unconditionally skips n input tokens, without matching, then
+// attempts to match its child.  Accept(1, child) is equivalent to Next(child).
+func Accept(n int64, child ltl.Operator) ltl.Operator {
+	if child == nil {
+		return nil
+	}
+	if n <= 0 {
+		return child
+	}
+	return &accept{NewUnaryOperator(child), n}
+}
+
+type accept struct {
+	UnaryOperator
+	n int64
+}
+
+func (a *accept) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	if tok.EOI() {
+		return nil, ltl.NotMatching
+	}
+	return Accept(a.n-1, a.Child), ltl.NotMatching
+}
+
+func (a *accept) String() string {
+	return fmt.Sprintf("ACCEPT(%d)", a.n)
+}
+
 // AndEnvironment defers its argument Environment for later ANDing with the
 // Environments produced by matching with its child.
 func AndEnvironment(env ltl.Environment, child ltl.Operator) ltl.Operator {
@@ -193,7 +520,13 @@ func AndEnvironment(env ltl.Environment, child ltl.Operator) ltl.Operator {
 	if env.Reducible() && env.Matching() {
 		return child
 	}
-	return &andEnvironment{UnaryOperator{child}, env}
+	// Short-circuit: if the attached environment is NotMatching and the child
+	// is reducible, the result is NotMatching, as False will return, without
+	// allocating.
+	if s, ok := env.(ltl.State); ok && !s.Matching() && ltl.Reducible(child) {
+		return False()
+	}
+	return &andEnvironment{NewUnaryOperator(child), env}
 }
 
 type andEnvironment struct {
@@ -205,14 +538,24 @@ type andEnvironment struct {
 func (ae *andEnvironment) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
 	// Short-circuit: if the bundled Environment is not matching and the
 	// child Operator is reducible, there's no need to recurse, since the
-	// bundled Environment is all it will ever be.
-	if !ae.env.Matching() && ltl.Reducible(ae.Child) {
+	// bundled Environment is all it will ever be.  An Unknown Environment
+	// may yet become NotMatching.
+	if !ae.env.Matching() && !ltl.IsUnknown(ae.env) && ltl.Reducible(ae.Child) {
 		return nil, ae.env
 	}
 	newOp, newEnv := ltl.Match(ae.Child, tok)
 	return AndEnvironment(ae.env, newOp), ae.env.And(newEnv)
 }
 
+// matchLookahead matches like Match, forwarding to a lookahead child.
+func (ae *andEnvironment) matchLookahead(tok ltl.Token) (ltl.Operator, ltl.Environment, []ltl.Token) {
+	if !ae.env.Matching() && !ltl.IsUnknown(ae.env) && ltl.Reducible(ae.Child) {
+		return nil, ae.env, nil
+	}
+	newOp, newEnv, toks := matchMaybeLookahead(ae.Child, tok)
+	return AndEnvironment(ae.env, newOp), ae.env.And(newEnv), toks
+}
+
 func (ae *andEnvironment) String() string {
 	return fmt.Sprintf("AND_ENVIRONMENT(%s)", ae.env)
 }
@@ -228,7 +571,13 @@ func OrEnvironment(env ltl.Environment, child ltl.Operator) ltl.Operator {
 	if env.Reducible() && !env.Matching() {
 		return child
 	}
-	return &orEnvironment{UnaryOperator{child}, env}
+	// Short-circuit: if the attached environment is Matching and the child is
+	// reducible, the result is Matching, as True will return, without
+	// allocating.
+	if s, ok := env.(ltl.State); ok && s.Matching() && ltl.Reducible(child) {
+		return True()
+	}
+	return &orEnvironment{NewUnaryOperator(child), env}
 }
 
 type orEnvironment struct {
@@ -237,6 +586,12 @@ type orEnvironment struct {
 }
 
 func (oe *orEnvironment) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	// Short-circuit: if the bundled Environment is Matching and the child
+	// Operator is reducible, there's no need to recurse, since the bundled
+	// Environment is all it will ever be.
+	if oe.env.Matching() && ltl.Reducible(oe.Child) {
+		return nil, oe.env
+	}
 	newOp, newEnv := ltl.Match(oe.Child, tok)
 	return OrEnvironment(oe.env, newOp), newEnv.Or(oe.env)
 }
@@ -249,12 +604,13 @@ func (oe *orEnvironment) String() string {
 // input Tokens to its left child until that Operator becomes nil, returning
 // not Matching until that time, then directs input Tokens to its right child,
 // returning the left child's final Environment ANDed with the right child's
-// current Environment.
+// current Environment.  At the end of input, both children are resolved: the
+// right child sees an empty input stream.
 func Then(left, right ltl.Operator) ltl.Operator {
 	if left == nil || right == nil {
 		return nil
 	}
-	return &then{BinaryOperator{left, right}}
+	return &then{NewBinaryOperator(left, right)}
 }
 
 type then struct {
@@ -262,11 +618,43 @@ type then struct {
 }
 
 func (t *then) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
-	op, env := ltl.Match(t.Left, tok)
-	if op != nil {
-		return Then(op, t.Right), env
+	op, env, _ := matchThen(t.Left, t.Right, tok, false)
+	return op, env
+}
+
+// matchLookahead matches like Match, but also matches a lookahead in its right
+// child, returning the Tokens consumed beyond its extent, so that a Then may
+// itself be the left child of another.
+func (t *then) matchLookahead(tok ltl.Token) (ltl.Operator, ltl.Environment, []ltl.Token) {
+	return matchThen(t.Left, t.Right, tok, true)
+}
+
+// matchThen matches the provided Token against Then(left, right), without
+// building it.  If lookahead is true, right may contain a lookahead, and the
+// Tokens consumed beyond the Then's extent are returned.
+func matchThen(left, right ltl.Operator, tok ltl.Token, lookahead bool) (ltl.Operator, ltl.Environment, []ltl.Token) {
+	// If the left child consumed Tokens beyond its extent, the right child must
+	// also see them.
+	op, env, toks := matchMaybeLookahead(left, tok)
+	if ltl.IsErroring(env) {
+		return nil, env, nil
+	}
+	if op != nil && !tok.EOI() {
+		return Then(op, right), env, nil
+	}
+	// At the end of input, the right child sees an empty input stream.
+	if len(toks) == 0 && tok.EOI() {
+		toks = []ltl.Token{tok}
 	}
-	return AndEnvironment(env, t.Right), ltl.NotMatching
+	right = AndEnvironment(env, right)
+	if len(toks) == 0 {
+		return right, ltl.NotMatching, nil
+	}
+	op, env, toks = replayTokens(right, toks, lookahead)
+	if tok.EOI() {
+		op = nil
+	}
+	return op, env, toks
 }
 
 func (t *then) String() string {
@@ -278,9 +666,7 @@ func (t *then) String() string {
 // to a THEN b THEN c THEN ... THEN z.
 func Sequence(children ...ltl.Operator) ltl.Operator {
 	return &sequence{
-		NaryOperator{
-			ChildSlice: children,
-		},
+		NewNaryOperator(children),
 	}
 }
 
@@ -298,6 +684,17 @@ func (s *sequence) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
 	return Then(s.ChildSlice[0], Sequence(s.ChildSlice[1:]...)).Match(tok)
 }
 
+// matchLookahead matches like Match, but as Then's matchLookahead.
+func (s *sequence) matchLookahead(tok ltl.Token) (ltl.Operator, ltl.Environment, []ltl.Token) {
+	if len(s.ChildSlice) == 1 {
+		return matchMaybeLookahead(s.ChildSlice[0], tok)
+	}
+	if len(s.ChildSlice) == 2 {
+		return matchThen(s.ChildSlice[0], s.ChildSlice[1], tok, true)
+	}
+	return matchThen(s.ChildSlice[0], Sequence(s.ChildSlice[1:]...), tok, true)
+}
+
 func (s *sequence) String() string {
 	return "SEQUENCE"
 }
@@ -307,12 +704,14 @@ func (s *sequence) String() string {
 // multiple Tokens before resolving, Eventually may maintain an instance of
 // its argument for each Token it accepts, returning the first to match.
 // Because of this, Eventually can be expensive to use if not limited, such
-// as with the Limit operation.
+// as with the Limit operation.  At the end of input, any pending instances of
+// its argument are resolved, but no new instance is started, so an Eventually
+// that has not yet matched resolves not matching.
 func Eventually(child ltl.Operator) ltl.Operator {
 	if child == nil {
 		return nil
 	}
-	return &eventually{UnaryOperator{child}}
+	return &eventually{NewUnaryOperator(child)}
 }
 
 type eventually struct {
@@ -320,16 +719,24 @@ type eventually struct {
 }
 
 func (e *eventually) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
-	return StopAtFirstMatch(tok, Or(e.Child, Next(e)))
+	if tok.EOI() {
+		return nil, ltl.NotMatching
+	}
+	// Equivalent to StopAtFirstMatch(tok, Or(e.Child, Next(e))), but without
+	// building the Or and Next only to discard them.
+	newChild, childEnv := e.Child.Match(tok)
+	return stopAtMatch(orResults(newChild, e, childEnv, ltl.NotMatching, false))
 }
 
 func (e *eventually) String() string {
 	return "EVENTUALLY"
 }
 
-// Globally matches as long as its child matches.
+// Globally matches as long as its child matches.  At the end of input, a
+// Globally whose child has held so far resolves matching.  If its child is
+// Unknown, Globally continues, since later input may show it not to match.
 func Globally(child ltl.Operator) ltl.Operator {
-	return &globally{UnaryOperator{child}}
+	return &globally{NewUnaryOperator(child)}
 }
 
 type globally struct {
@@ -337,12 +744,18 @@ type globally struct {
 }
 
 func (g *globally) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	if tok.EOI() {
+		return nil, ltl.Matching
+	}
 	op, env := g.Child.Match(tok)
 	if op == nil {
+		if ltl.IsUnknown(env) {
+			return AndEnvironment(env, g), env
+		}
 		if !env.Matching() {
 			return nil, env
 		}
-		return Globally(g.Child), env
+		return g, env
 	}
 	return Or(op, Then(op, g)), env
 }
@@ -351,9 +764,241 @@ func (g *globally) String() string {
 	return "GLOBALLY"
 }
 
+// RecentGlobally matches whenever its child has held on each of the last n
+// Tokens, and never terminates on its own.  An instance of its child is
+// started on each Token, and fed each later Token until it resolves or leaves
+// the window; the child holds on a Token if the instance started there
+// matches.  Until an instance resolves, its current Environment stands in for
+// it.  When matching, RecentGlobally returns the AND of its child's
+// Environments over the window.  At the end of input, its pending instances
+// are resolved, and it resolves as it then would on the last Token.  A
+// RecentGlobally with n <= 0 always matches, and likewise never terminates on
+// its own.
+func RecentGlobally(n int64, child ltl.Operator) ltl.Operator {
+	if n <= 0 {
+		return Globally(True())
+	}
+	return newRecentGlobally(n, child, heldWindow{}, nil)
+}
+
+// newRecentGlobally returns a recentGlobally with the provided window.
+func newRecentGlobally(n int64, child ltl.Operator, held heldWindow, pending []rgSlot) *recentGlobally {
+	children := []ltl.Operator{child}
+	for _, slot := range pending {
+		if slot.op != nil {
+			children = append(children, slot.op)
+		}
+	}
+	return &recentGlobally{NewNaryOperator(children), n, held, pending}
+}
+
+// restoreRecentGlobally returns a recentGlobally whose window has the
+// provided Environments, oldest first, with the provided live instances
+// standing for those marked live.
+func restoreRecentGlobally(n int64, child ltl.Operator, envs []ltl.Environment, live []bool, instances []ltl.Operator) *recentGlobally {
+	var held heldWindow
+	var pending []rgSlot
+	for idx, env := range envs {
+		switch {
+		case live[idx]:
+			pending = append(pending, rgSlot{instances[0], env})
+			instances = instances[1:]
+		case len(pending) == 0:
+			held = held.push(env)
+		default:
+			pending = append(pending, rgSlot{nil, env})
+		}
+	}
+	return newRecentGlobally(n, child, held, pending)
+}
+
+// recentGlobally's children are its child, followed by the live instances in
+// its pending slots, oldest first.
+type recentGlobally struct {
+	NaryOperator
+	n int64
+	// held holds the Environments of the window's oldest slots, whose
+	// instances have all resolved matching.
+	held heldWindow
+	// pending holds the window's remaining slots, oldest first, from the
+	// oldest whose instance has not resolved.
+	pending []rgSlot
+}
+
+// rgSlot is a RecentGlobally window slot: the instance of the child started
+// on a Token, or nil if it has resolved, and its current Environment.
+type rgSlot struct {
+	op  ltl.Operator
+	env ltl.Environment
+}
+
+// slots returns the Environments of the receiver's window, oldest first, and
+// whether each belongs to a live instance.
+func (rg *recentGlobally) slots() ([]ltl.Environment, []bool) {
+	envs := rg.held.envs()
+	live := make([]bool, len(envs), len(envs)+len(rg.pending))
+	for _, slot := range rg.pending {
+		envs = append(envs, slot.env)
+		live = append(live, slot.op != nil)
+	}
+	return envs, live
+}
+
+func (rg *recentGlobally) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	child := rg.ChildSlice[0]
+	pending := make([]rgSlot, 0, len(rg.pending)+1)
+	// failed is the index in pending of the newest instance to resolve not
+	// matching, which closes the window up to it.
+	failed := -1
+	var failedEnv ltl.Environment
+	match := func(slot rgSlot) error {
+		if slot.op != nil {
+			slot.op, slot.env = slot.op.Match(tok)
+			if ltl.IsErroring(slot.env) {
+				return slot.env.Err()
+			}
+			if slot.op == nil && !slot.env.Matching() {
+				failed, failedEnv = len(pending), slot.env
+			}
+		}
+		pending = append(pending, slot)
+		return nil
+	}
+	for _, slot := range rg.pending {
+		if err := match(slot); err != nil {
+			return nil, ltl.ErrEnv(err)
+		}
+	}
+	if !tok.EOI() {
+		if err := match(rgSlot{child, ltl.NotMatching}); err != nil {
+			return nil, ltl.ErrEnv(err)
+		}
+	}
+	held := rg.held
+	if failed >= 0 {
+		held, pending = heldWindow{}, pending[failed+1:]
+	}
+	if int64(held.len()+len(pending)) > rg.n {
+		if held.len() > 0 {
+			held = held.pop()
+		} else {
+			pending = pending[1:]
+		}
+	}
+	for len(pending) > 0 && pending[0].op == nil {
+		held, pending = held.push(pending[0].env), pending[1:]
+	}
+	var ret ltl.Operator
+	if !tok.EOI() {
+		ret = newRecentGlobally(rg.n, child, held, pending)
+	}
+	if failed >= 0 {
+		return ret, failedEnv
+	}
+	if int64(held.len()+len(pending)) < rg.n {
+		return ret, ltl.NotMatching
+	}
+	env := held.env()
+	for _, slot := range pending {
+		env = env.And(slot.env)
+	}
+	return ret, env
+}
+
+func (rg *recentGlobally) String() string {
+	return fmt.Sprintf("RECENT_GLOBALLY(%d)", rg.n)
+}
+
+// heldWindow is a queue of Environments which maintains their AND as they are
+// pushed and popped, in amortized constant time.  Its values are never
+// modified, so it may be shared between continuations.
+type heldWindow struct {
+	// front holds the oldest Environments, oldest first, each with the AND
+	// of it and those after it in front.
+	front []heldEnv
+	// back holds the newer Environments, newest first, and backEnv their AND,
+	// or nil if there are none.
+	back    *envList
+	backEnv ltl.Environment
+	backLen int
+}
+
+type heldEnv struct {
+	env, and ltl.Environment
+}
+
+type envList struct {
+	env  ltl.Environment
+	next *envList
+}
+
+func (hw heldWindow) len() int {
+	return len(hw.front) + hw.backLen
+}
+
+// push returns the receiver with env appended.
+func (hw heldWindow) push(env ltl.Environment) heldWindow {
+	hw.back = &envList{env, hw.back}
+	hw.backLen++
+	if hw.backEnv == nil {
+		hw.backEnv = env
+	} else {
+		hw.backEnv = hw.backEnv.And(env)
+	}
+	return hw
+}
+
+// pop returns the receiver without its oldest Environment.  The receiver must
+// not be empty.
+func (hw heldWindow) pop() heldWindow {
+	if len(hw.front) == 0 {
+		envs := hw.envs()
+		front := make([]heldEnv, len(envs))
+		for idx := len(envs) - 1; idx >= 0; idx-- {
+			and := envs[idx]
+			if idx < len(envs)-1 {
+				and = and.And(front[idx+1].and)
+			}
+			front[idx] = heldEnv{envs[idx], and}
+		}
+		hw = heldWindow{front: front}
+	}
+	hw.front = hw.front[1:]
+	return hw
+}
+
+// env returns the AND of the receiver's Environments, or Matching if it is
+// empty.
+func (hw heldWindow) env() ltl.Environment {
+	switch {
+	case len(hw.front) == 0 && hw.backEnv == nil:
+		return ltl.Matching
+	case len(hw.front) == 0:
+		return hw.backEnv
+	case hw.backEnv == nil:
+		return hw.front[0].and
+	}
+	return hw.front[0].and.And(hw.backEnv)
+}
+
+// envs returns the receiver's Environments, oldest first.
+func (hw heldWindow) envs() []ltl.Environment {
+	ret := make([]ltl.Environment, len(hw.front)+hw.backLen)
+	for idx, he := range hw.front {
+		ret[idx] = he.env
+	}
+	idx := len(ret) - 1
+	for el := hw.back; el != nil; el = el.next {
+		ret[idx] = el.env
+		idx--
+	}
+	return ret
+}
+
 // Until matches if its left argument holds until its right argument holds.   Its
 // right argument must ultimately hold, but may hold immediately.  Once its right
-// argument holds, Until terminates.
+// argument holds, Until terminates.  At the end of input, an Until whose right
+// argument has not yet held resolves not matching.
 func Until(left, right ltl.Operator) ltl.Operator {
 	if left == nil {
 		return right
@@ -361,7 +1006,7 @@ func Until(left, right ltl.Operator) ltl.Operator {
 	if right == nil {
 		return nil
 	}
-	return &until{BinaryOperator{left, right}}
+	return &until{NewBinaryOperator(left, right)}
 }
 
 type until struct {
@@ -369,7 +1014,14 @@ type until struct {
 }
 
 func (u *until) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
-	return StopAtFirstMatch(tok, Or(u.Right, Then(u.Left, u)))
+	if tok.EOI() {
+		return nil, ltl.NotMatching
+	}
+	// Equivalent to StopAtFirstMatch(tok, Or(u.Right, Then(u.Left, u))), but
+	// without building the Or and Then only to discard them.
+	newRight, rightEnv := u.Right.Match(tok)
+	newThen, thenEnv, _ := matchThen(u.Left, u, tok, false)
+	return stopAtMatch(orResults(newRight, newThen, rightEnv, thenEnv, false))
 }
 
 func (u *until) String() string {
@@ -378,19 +1030,111 @@ func (u *until) String() string {
 
 // Release matches if its right child holds up to and including the time that
 // its left child holds.  Its left child need never hold, in which case its
-// right child must continually hold.
+// right child must continually hold.  At the end of input, a Release whose
+// right child has held so far resolves matching.
 func Release(left, right ltl.Operator) ltl.Operator {
-	return &release{BinaryOperator{left, right}}
+	return &release{NewBinaryOperator(left, right)}
 }
 
 type release struct {
 	BinaryOperator
 }
 
+// Release is the dual of Until: where Until matches the first time its right
+// child holds, Release stops at the first time its right child fails to hold.
+// It is equivalent to Not(Until(Not(left), Not(right))), including in the
+// Tokens it captures.
 func (r *release) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
-	return Not(Until(Not(r.Left), Not(r.Right))).Match(tok)
+	if tok.EOI() {
+		return nil, ltl.Matching
+	}
+	// Equivalent to StopAtFirstNotMatch(tok, releaseAnd(r.Right,
+	// releaseStep(r.Left, r))), but without building the releaseAnd and
+	// releaseStep only to discard them.
+	newRight, rightEnv := r.Right.Match(tok)
+	newStep, stepEnv := matchReleaseStep(r.Left, r, tok)
+	return stopAtNotMatch(releaseResults(newRight, newStep, rightEnv, stepEnv))
+}
+
+// releaseAnd is the dual of Or, used by Release as Until uses Or.  Like And,
+// it matches if both its children match, but like Or, it forgets a child that
+// resolves, unless that child resolves Unknown.
+func releaseAnd(left, right ltl.Operator) ltl.Operator {
+	if left == nil {
+		return right
+	}
+	if right == nil {
+		return left
+	}
+	return &releaseAndOp{NewBinaryOperator(left, right)}
+}
+
+type releaseAndOp struct {
+	BinaryOperator
+}
+
+func (ra *releaseAndOp) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	newLeft, newRight, leftEnv, rightEnv := ra.BinaryOperator.matchBoth(tok, false)
+	return releaseResults(newLeft, newRight, leftEnv, rightEnv)
+}
+
+func (ra *releaseAndOp) String() string {
+	return "RELEASE_AND"
+}
+
+// releaseResults returns the continuation and Environment of a releaseAnd
+// whose children produced the provided continuations and Environments.
+func releaseResults(newLeft, newRight ltl.Operator, leftEnv, rightEnv ltl.Environment) (ltl.Operator, ltl.Environment) {
+	if errEnv := ltl.EitherErroring(leftEnv, rightEnv); errEnv != nil {
+		return nil, errEnv
+	}
+	newEnv := leftEnv.And(rightEnv)
+	if newLeft == nil && ltl.IsUnknown(leftEnv) {
+		return AndEnvironment(leftEnv, newRight), newEnv
+	}
+	if newRight == nil && ltl.IsUnknown(rightEnv) {
+		return AndEnvironment(rightEnv, newLeft), newEnv
+	}
+	return releaseAnd(newLeft, newRight), newEnv
 }
 
 func (r *release) String() string {
 	return "RELEASE"
 }
+
+// releaseStep is the dual of Then, used by Release.  It directs input Tokens to
+// its left child until that Operator becomes nil, returning the left child's
+// Environments until that time, then returns Matching and thereafter ORs the
+// left child's final Environment with its right child's Environments.
+func releaseStep(left, right ltl.Operator) ltl.Operator {
+	if left == nil || right == nil {
+		return nil
+	}
+	return &releaseStepOp{NewBinaryOperator(left, right)}
+}
+
+type releaseStepOp struct {
+	BinaryOperator
+}
+
+func (rs *releaseStepOp) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	return matchReleaseStep(rs.Left, rs.Right, tok)
+}
+
+// matchReleaseStep matches the provided Token against releaseStep(left,
+// right), without building it.
+func matchReleaseStep(left, right ltl.Operator, tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	op, env := ltl.Match(left, tok)
+	if tok.EOI() {
+		_, rightEnv := ltl.Match(right, tok)
+		return nil, env.Or(rightEnv)
+	}
+	if op != nil {
+		return releaseStep(op, right), env
+	}
+	return OrEnvironment(env, right), ltl.Matching
+}
+
+func (rs *releaseStepOp) String() string {
+	return "RELEASE_STEP"
+}
@@ -38,17 +38,17 @@ func benchmarkEggLeg(b *testing.B, count int, profFile string) {
 	}
 	tests := []struct {
 		input          string
-		op             ltl.Operator
+		factory        *ltl.OperatorFactory
 		wantMatchCount int
 	}{{
 		streamInput,
 		// The farthest-apart 'egg' and 'leg' are 21 characters apart.
-		Eventually(Then(sm("egg"), Limit(21, Eventually(sm("leg"))))),
+		ltl.NewOperatorFactory(Eventually(Then(sm("egg"), Limit(21, Eventually(sm("leg")))))),
 		6*count - 1, // First input has 5 matches; each subsequent has 6.
 	}}
 	for i := 0; i < b.N; i++ {
 		for _, test := range tests {
-			op := test.op
+			op := test.factory.New()
 			var env ltl.Environment
 			gotMatchCount := 0
 			for n := 0; n < count*len(test.input); n++ {
@@ -71,3 +71,101 @@ func benchmarkEggLeg(b *testing.B, count int, profFile string) {
 func BenchmarkEggLeg500(b *testing.B)   { benchmarkEggLeg(b, 500, noProf) }
 func BenchmarkEggLeg5000(b *testing.B)  { benchmarkEggLeg(b, 5000, noProf) }
 func BenchmarkEggLeg50000(b *testing.B) { benchmarkEggLeg(b, 50000, noProf) }
+
+// benchmarkTemporal matches op against a stream of count Tokens, none of which
+// resolve it, reporting allocations.
+func benchmarkTemporal(b *testing.B, op ltl.Operator, count int) {
+	toks := make([]ltl.Token, count)
+	for n := range toks {
+		toks[n] = rt.New('a', n)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		op := op
+		for _, tok := range toks {
+			if op == nil {
+				break
+			}
+			op, _ = op.Match(tok)
+		}
+	}
+}
+
+func isB(tok ltl.Token) (bool, error) {
+	return tok.(*rt.RuneToken).Value() == 'b', nil
+}
+
+func BenchmarkEventually(b *testing.B) {
+	benchmarkTemporal(b, Eventually(Predicate(isB, PredicateName("b"))), 1000)
+}
+
+func BenchmarkUntil(b *testing.B) {
+	benchmarkTemporal(b, Until(Not(Predicate(isB, PredicateName("b"))), Predicate(isB, PredicateName("b"))), 1000)
+}
+
+func isRune(r rune) func(ltl.Token) (bool, error) {
+	return func(tok ltl.Token) (bool, error) {
+		return tok.(*rt.RuneToken).Value() == r, nil
+	}
+}
+
+// instanceTokens returns a repeating input of RuneTokens over 'a', 'b', and
+// 'c'.
+func instanceTokens() []ltl.Token {
+	const input = "abcabbcacbbcaabc"
+	toks := make([]ltl.Token, 256)
+	for n := range toks {
+		toks[n] = rt.New(rune(input[n%len(input)]), n)
+	}
+	return toks
+}
+
+// matchInstances matches a fresh instance of op, beginning at each of the
+// provided Tokens, against all subsequent Tokens, until it resolves.
+func matchInstances(op ltl.Operator, toks []ltl.Token) {
+	for start := range toks {
+		op := op
+		for _, tok := range toks[start:] {
+			if op == nil {
+				break
+			}
+			op, _ = op.Match(tok)
+		}
+	}
+}
+
+func benchmarkInstances(b *testing.B, op ltl.Operator) {
+	toks := instanceTokens()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		matchInstances(op, toks)
+	}
+}
+
+var (
+	pa = Predicate(isRune('a'), PredicateName("a"))
+	pb = Predicate(isRune('b'), PredicateName("b"))
+	pc = Predicate(isRune('c'), PredicateName("c"))
+)
+
+func BenchmarkStateAnd(b *testing.B) {
+	benchmarkInstances(b, And(pa, Next(Or(pb, pc))))
+}
+
+func BenchmarkStateAndEventually(b *testing.B) {
+	benchmarkInstances(b, And(Not(pc), Eventually(And(pb, Next(pc)))))
+}
+
+func BenchmarkStateThen(b *testing.B) {
+	benchmarkInstances(b, Then(pa, Then(Or(pb, pc), Eventually(pa))))
+}
+
+func BenchmarkStateUntil(b *testing.B) {
+	benchmarkInstances(b, Until(Or(pa, pb), pc))
+}
+
+func BenchmarkStateGlobally(b *testing.B) {
+	benchmarkInstances(b, Limit(8, Globally(Not(pc))))
+}
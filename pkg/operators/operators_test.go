@@ -15,10 +15,20 @@
 package operators
 
 import (
+	"errors"
+	"fmt"
 	rtok "github.com/ilhamster/ltl/examples/runetoken"
+	"github.com/ilhamster/ltl/examples/signals"
 	smatch "github.com/ilhamster/ltl/examples/stringmatcher"
+	be "github.com/ilhamster/ltl/pkg/bindingenvironment"
+	"github.com/ilhamster/ltl/pkg/bindings"
 	"github.com/ilhamster/ltl/pkg/ltl"
+	"github.com/ilhamster/ltl/pkg/tags"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
+	"unicode"
 )
 
 var capture = true
@@ -27,6 +37,14 @@ func sm(s string) ltl.Operator {
 	return smatch.New(s, smatch.Capture(capture))
 }
 
+func isDigit(tok ltl.Token) (bool, error) {
+	rt, ok := tok.(*rtok.RuneToken)
+	if !ok {
+		return false, errors.New("expected *rtok.RuneToken")
+	}
+	return unicode.IsDigit(rt.Value()), nil
+}
+
 type testInput struct {
 	input     string
 	wantMatch bool
@@ -88,6 +106,76 @@ func TestOperators(t *testing.T) {
 			m("abc"), m("aabc"), nm("aac")),
 		tc(Until(Then(sm("a"), sm("b")), sm("c")),
 			m("abc"), m("ababc")),
+		tc(Accept(3, sm("d")),
+			m("abcd"), m("dddd"), nm("abcc"), nm("d")),
+		tc(Then(sm("a"), Accept(2, Then(sm("b"), sm("c")))),
+			m("axxbc"), nm("axbc")),
+		tc(Accept(0, sm("a")),
+			m("a"), nm("b")),
+		tc(True(),
+			m("a"), m("b")),
+		tc(False(),
+			nm("a"), nm("b")),
+		tc(AnyToken(),
+			m("a"), m("b")),
+		tc(Then(sm("a"), Then(AnyToken(), sm("c"))),
+			m("abc"), m("acc"), nm("ac")),
+		tc(Until(True(), sm("c")),
+			m("abc"), nm("ab")),
+		tc(Predicate(isDigit),
+			m("1"), nm("a")),
+		tc(Then(sm("a"), Until(Predicate(isDigit), sm("b"))),
+			m("a123b"), m("ab"), nm("a1c")),
+		tc(Then(NotFollowedBy(sm("a"), sm("b")), sm("c")),
+			m("ac"), nm("ab")),
+		tc(Then(NotFollowedBy(sm("a"), sm("bc")), sm("bd")),
+			m("abd"), nm("abc")),
+		tc(Then(sm("x"), Then(NotFollowedBy(sm("a"), sm("bcd")), sm("bce"))),
+			m("xabce"), nm("xabcd"), nm("xabcf")),
+		tc(Eventually(Then(NotFollowedBy(sm("a"), sm("b")), True())),
+			nm("abab"), m("abac")),
+		tc(Then(Then(NotFollowedBy(sm("a"), Next(Next(sm("x")))), sm("b")), sm("c")),
+			m("abcd"), nm("abcx"), nm("abdd")),
+		tc(Then(Then(sm("x"), NotFollowedBy(sm("a"), sm("b"))), sm("c")),
+			m("xac"), nm("xab")),
+		tc(Eventually(Then(NotFollowedBy(sm("a"), Next(Next(sm("x")))), Not(Then(sm("b"), sm("c"))))),
+			m("abcd"), nm("abcx")),
+		tc(implies(sm("a"), sm("b")),
+			m("b"), m("c"), nm("a")),
+		tc(implies(sm("a"), Next(sm("b"))),
+			m("ab"), nm("ac"), m("c")),
+		tc(implies(sm("ab"), Eventually(sm("c"))),
+			m("ac"), m("abc"), m("b"), nm("abb")),
+		tc(Precedes(sm("a"), sm("b")),
+			m("cab"), m("ccc"), nm("cb"), m("ab"), nm("b")),
+		tc(RespondsTo(sm("a"), sm("b")),
+			m("ab"), m("cacb"), m("aab"), nm("aba"), nm("ac")),
+		tc(RespondsToWithin(2, sm("a"), sm("b")),
+			m("abcab"), m("cab"), nm("acb")),
+		tc(RecentGlobally(2, sm("a")),
+			nm("a"), m("aa"), m("baaa"), nm("aab"), m("aabaa")),
+		tc(RecentGlobally(0, sm("a")),
+			m("b"), m("bbb")),
+		tc(RecentGlobally(2, Eventually(sm("c"))),
+			m("aac"), m("acac"), m("ac"), nm("aacb"), nm("aa")),
+		tc(RecentGlobally(2, Or(sm("b"), Then(sm("a"), Eventually(sm("b"))))),
+			m("aab"), m("abab"), nm("aaba"), nm("aa")),
+		tc(ParallelAnd(Eventually(sm("a")), Eventually(sm("bc"))),
+			m("xabc"), nm("xa")),
+		tc(ParallelOr(Then(sm("a"), sm("b")), Eventually(sm("c"))),
+			m("ab"), m("xxc"), nm("ax")),
+		tc(Globally(ParallelAnd(Not(sm("a")), ParallelOr(sm("b"), sm("c")))),
+			m("bcb"), nm("ba")),
+		tc(FirstOf(sm("ab"), sm("a")),
+			m("ab"), m("ac"), nm("a")),
+		tc(FirstOf(sm("a"), sm("b")),
+			m("a"), m("b"), nm("c")),
+		tc(FirstOf(sm("ab"), sm("cd")),
+			m("ab"), m("cd"), nm("ad")),
+		tc(Release(sm("b"), sm("a")),
+			m("aa"), nm("aab"), nm("ac"), nm("b")),
+		tc(Release(sm("b"), Or(sm("a"), sm("b"))),
+			m("ab"), m("b")),
 		tc(Then(Sequence(sm("e"), sm("g"), sm("g")), Eventually(Sequence(sm("l"), sm("e"), sm("g")))),
 			m("egg leg"), nm("egg"), nm("egg le")),
 		tc(Limit(5, Then(sm("a"), Eventually(sm("b")))),
@@ -119,3 +207,1128 @@ func TestOperators(t *testing.T) {
 		}
 	}
 }
+
+// describeEnv describes an Environment's state and captures, for comparing
+// equivalent operator trees.
+func describeEnv(env ltl.Environment) string {
+	if env == nil {
+		return "nil"
+	}
+	caps := be.Captures(env)
+	return fmt.Sprintf("%t/%t/%v/%v", env.Matching(), ltl.IsUnknown(env), caps.Ordered(true), caps.Ordered(false))
+}
+
+// Tests that Release behaves exactly as its dual, including in its captures,
+// on every input up to five Tokens long.
+func TestReleaseDuality(t *testing.T) {
+	children := []ltl.Operator{
+		sm("a"), sm("ab"), sm("ba"),
+		Globally(AnyToken()),
+		Then(sm("a"), sm("b")),
+		Eventually(sm("b")),
+		Next(sm("a")),
+		Release(sm("b"), AnyToken()),
+		Release(sm("ab"), Eventually(sm("b"))),
+		Until(sm("a"), sm("b")),
+		Or(sm("ab"), Next(sm("c"))),
+		And(Eventually(sm("a")), Not(sm("ba"))),
+	}
+	inputs := []string{""}
+	for prev := inputs; len(prev[0]) < 5; {
+		var longer []string
+		for _, in := range prev {
+			for _, ch := range "abc" {
+				longer = append(longer, in+string(ch))
+			}
+		}
+		inputs, prev = append(inputs, longer...), longer
+	}
+	for _, left := range children {
+		for _, right := range children {
+			for _, input := range inputs {
+				release, dual := Release(left, right), Not(Until(Not(left), Not(right)))
+				desc := fmt.Sprintf("%s RELEASE %s <- %q", PrettyPrint(left, Inline()), PrettyPrint(right, Inline()), input)
+				for idx, ch := range input {
+					if release == nil || dual == nil {
+						if release != dual {
+							t.Fatalf("%s: continuations differ in nilness at %d: %v vs %v", desc, idx, release, dual)
+						}
+						break
+					}
+					var relEnv, dualEnv ltl.Environment
+					release, relEnv = release.Match(rtok.New(ch, idx))
+					dual, dualEnv = dual.Match(rtok.New(ch, idx))
+					if (release == nil) != (dual == nil) {
+						t.Fatalf("%s: continuations differ in nilness at %d: %v vs %v", desc, idx, release, dual)
+					}
+					if got, want := describeEnv(relEnv), describeEnv(dualEnv); got != want {
+						t.Fatalf("%s: got %s at %d, dual got %s", desc, got, idx, want)
+					}
+				}
+				if release != nil && dual != nil {
+					if got, want := describeEnv(ltl.Finish(release)), describeEnv(ltl.Finish(dual)); got != want {
+						t.Fatalf("%s: got %s at end of input, dual got %s", desc, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestEndOfInput(t *testing.T) {
+	tests := []struct {
+		op        ltl.Operator
+		input     string
+		wantMatch bool
+	}{
+		{sm("a"), "", false},
+		{Not(sm("a")), "", true},
+		{Next(sm("a")), "", false},
+		{Accept(2, sm("a")), "a", false},
+		{Then(NotFollowedBy(sm("a"), sm("bc")), True()), "ab", true},
+		{Then(NotFollowedBy(sm("a"), Globally(sm("b"))), True()), "abb", false},
+		{Then(NotFollowedBy(sm("a"), sm("bc")), Globally(sm("b"))), "ab", true},
+		{Then(NotFollowedBy(sm("a"), Next(Next(sm("x")))), Not(Then(sm("b"), sm("c")))), "abcd", false},
+		{True(), "", true},
+		{False(), "", false},
+		{AnyToken(), "", false},
+		{Then(sm("a"), True()), "a", true},
+		{Globally(sm("a")), "", true},
+		{Globally(sm("a")), "aaa", true},
+		{Globally(sm("ab")), "aba", false},
+		{Eventually(sm("b")), "", false},
+		{Eventually(sm("b")), "aaa", false},
+		{Eventually(sm("ab")), "aa", false},
+		{Eventually(Then(sm("a"), Globally(sm("b")))), "ca", true},
+		{Not(Eventually(sm("b"))), "aaa", true},
+		{Until(sm("a"), sm("b")), "aaa", false},
+		{Release(sm("b"), sm("a")), "aaa", true},
+		{Release(sm("b"), sm("a")), "", true},
+		{Then(sm("a"), Globally(sm("b"))), "a", true},
+		{Then(sm("a"), Globally(sm("b"))), "abb", true},
+		{Then(sm("a"), Eventually(sm("b"))), "a", false},
+		{Then(sm("ab"), sm("c")), "a", false},
+		{Limit(5, Globally(sm("a"))), "aa", true},
+		{implies(sm("ab"), Eventually(sm("c"))), "a", true},
+		{RecentGlobally(2, sm("a")), "baa", true},
+		{RecentGlobally(2, sm("a")), "aab", false},
+		{RecentGlobally(2, Eventually(sm("c"))), "aac", true},
+		{RecentGlobally(2, Eventually(sm("c"))), "aacb", false},
+		{Precedes(sm("a"), sm("b")), "cc", true},
+		{RespondsTo(sm("a"), sm("b")), "cab", true},
+		{RespondsTo(sm("a"), sm("b")), "cabac", false},
+		{RespondsToWithin(2, sm("a"), sm("b")), "ca", false},
+		{implies(sm("a"), Eventually(sm("c"))), "ab", false},
+	}
+	for _, test := range tests {
+		t.Run(PrettyPrint(test.op, Inline())+" <- "+test.input+"$", func(t *testing.T) {
+			op := test.op
+			for idx, ch := range test.input {
+				if op == nil {
+					t.Fatalf("op became nil")
+				}
+				op, _ = ltl.Match(op, rtok.New(ch, idx))
+			}
+			if op == nil {
+				t.Fatalf("op became nil")
+			}
+			next, env := op.Match(ltl.EOIToken{})
+			if next != nil {
+				t.Fatalf("wanted nil op at end of input, got %s", next)
+			}
+			if finished := ltl.Finish(op); finished.Matching() != env.Matching() {
+				t.Fatalf("Finish() = %s, but matching EOI yielded %s", finished, env)
+			}
+			if env.Err() != nil {
+				t.Fatalf("unexpected error %s", env.Err())
+			}
+			if test.wantMatch != env.Matching() {
+				t.Fatalf("wanted match state %t, got %t", test.wantMatch, env.Matching())
+			}
+		})
+	}
+}
+
+// Tests that lookaheads nested in the left children of Thens match as they do
+// in the equivalent flat Sequences, resolving to the same Environments.
+func TestNestedLookahead(t *testing.T) {
+	nfb := func() ltl.Operator {
+		return NotFollowedBy(sm("a"), Next(Next(sm("x"))))
+	}
+	tests := []struct {
+		nested, flat ltl.Operator
+	}{
+		{Then(Then(nfb(), sm("b")), sm("c")), Sequence(nfb(), sm("b"), sm("c"))},
+		{Then(Then(nfb(), sm("b")), sm("c")), Then(nfb(), Then(sm("b"), sm("c")))},
+		{Then(Then(Then(nfb(), sm("b")), sm("c")), sm("d")), Sequence(nfb(), sm("b"), sm("c"), sm("d"))},
+		{Then(Sequence(nfb(), sm("b")), Eventually(sm("c"))), Sequence(nfb(), sm("b"), Eventually(sm("c")))},
+		{Then(Then(sm("b"), nfb()), sm("b")), Sequence(sm("b"), nfb(), sm("b"))},
+		{Then(Then(nfb(), Globally(sm("b"))), sm("c")), Then(nfb(), Then(Globally(sm("b")), sm("c")))},
+	}
+	inputs := []string{""}
+	prev := inputs
+	for l := 0; l < 4; l++ {
+		var next []string
+		for _, in := range prev {
+			for _, ch := range "abcdx" {
+				next = append(next, in+string(ch))
+			}
+		}
+		inputs = append(inputs, next...)
+		prev = next
+	}
+	for _, test := range tests {
+		name := PrettyPrint(test.nested, Inline()) + " vs " + PrettyPrint(test.flat, Inline())
+		t.Run(name, func(t *testing.T) {
+			for _, input := range inputs {
+				nested, flat := test.nested, test.flat
+				var nestedEnv, flatEnv ltl.Environment
+				for idx, ch := range input {
+					tok := rtok.New(ch, idx)
+					// A resolved Operator keeps its last Environment.
+					if nested != nil {
+						nested, nestedEnv = nested.Match(tok)
+					}
+					if flat != nil {
+						flat, flatEnv = flat.Match(tok)
+					}
+					if got, want := nestedEnv.Matching(), flatEnv.Matching(); got != want {
+						t.Fatalf("%q at %d: got match %t, wanted %t", input, idx, got, want)
+					}
+				}
+				if nested != nil || nestedEnv == nil {
+					nestedEnv = ltl.Finish(nested)
+				}
+				if flat != nil || flatEnv == nil {
+					flatEnv = ltl.Finish(flat)
+				}
+				if got, want := describeEnv(nestedEnv), describeEnv(flatEnv); got != want {
+					t.Fatalf("%q at end of input: got %s, wanted %s", input, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMisplacedLookahead(t *testing.T) {
+	nfb := NotFollowedBy(sm("a"), sm("b"))
+	tests := []struct {
+		op    ltl.Operator
+		input string
+	}{
+		{nfb, "ac"},
+		{Then(sm("x"), nfb), "xac"},
+		{Then(Limit(5, nfb), sm("c")), "ac"},
+		{Then(Tagged(nfb, tags.Label("nfb")), sm("c")), "ac"},
+		{Eventually(nfb), "ac"},
+	}
+	for _, test := range tests {
+		t.Run(PrettyPrint(test.op, Inline())+" <- "+test.input, func(t *testing.T) {
+			op := test.op
+			var env ltl.Environment
+			for idx, ch := range test.input {
+				if op == nil {
+					break
+				}
+				op, env = op.Match(rtok.New(ch, idx))
+			}
+			if !ltl.IsErroring(env) {
+				t.Errorf("Got %s, wanted an error", env)
+			}
+		})
+	}
+}
+
+func TestLimitExceeded(t *testing.T) {
+	tests := []struct {
+		op                ltl.Operator
+		input             string
+		wantLimitExceeded bool
+	}{
+		{Limit(2, Eventually(sm("b"))), "aa", true},
+		{Limit(2, Eventually(sm("b"))), "ab", false},
+		{Limit(2, sm("ab")), "ac", false},
+		{Limit(3, sm("ab")), "ab", false},
+		{Or(Limit(2, Eventually(sm("b"))), sm("aa")), "aa", false},
+		// An uncapturing sibling, whose Environment is reducible.
+		{Or(Limit(2, Eventually(sm("b"))), smatch.New("ac")), "aa", true},
+		{Or(smatch.New("ac"), Limit(2, Eventually(sm("b")))), "aa", true},
+		{Not(Limit(2, Eventually(sm("b")))), "aa", false},
+		{Limit(2, Accept(2, Eventually(sm("b")))), "xx", true},
+		{LimitAfterStart(2, Accept(2, Eventually(sm("b")))), "xx", false},
+		{LimitAfterStart(2, Accept(2, Eventually(sm("b")))), "xxaa", true},
+		{LimitAfterStart(2, Accept(2, Eventually(sm("b")))), "xxab", false},
+		{LimitConsumed(2, Then(sm("a"), Accept(2, Eventually(sm("b"))))), "axxc", true},
+	}
+	for _, test := range tests {
+		t.Run(PrettyPrint(test.op, Inline())+" <- "+test.input, func(t *testing.T) {
+			op := test.op
+			var env ltl.Environment
+			for idx, ch := range test.input {
+				op, env = ltl.Match(op, rtok.New(ch, idx))
+			}
+			if got := ltl.IsLimitExceeded(env); got != test.wantLimitExceeded {
+				t.Errorf("IsLimitExceeded(%s) = %t, wanted %t", env, got, test.wantLimitExceeded)
+			}
+		})
+	}
+}
+
+// Tests that an expired limit keeps its child's captures.
+func TestLimitExceededKeepsCaptures(t *testing.T) {
+	tests := []struct {
+		op      ltl.Operator
+		input   string
+		wantEnv string
+	}{
+		{Limit(2, Eventually(sm("a"))), "bb", "false/false/[]/[b (1)]"},
+		{Not(Limit(2, Eventually(sm("a")))), "bb", "true/false/[b (1)]/[]"},
+		{LimitAfterStart(2, Accept(1, Eventually(sm("a")))), "xbb", "false/false/[]/[b (2)]"},
+		{LimitConsumed(2, Accept(1, Eventually(sm("a")))), "xbb", "false/false/[]/[b (2)]"},
+	}
+	for _, test := range tests {
+		t.Run(PrettyPrint(test.op, Inline())+" <- "+test.input, func(t *testing.T) {
+			op := test.op
+			var env ltl.Environment
+			for idx, ch := range test.input {
+				op, env = ltl.Match(op, rtok.New(ch, idx))
+			}
+			if got := describeEnv(env); got != test.wantEnv {
+				t.Errorf("Got %s, wanted %s", got, test.wantEnv)
+			}
+			if _, isNot := test.op.(*not); !isNot && !ltl.IsLimitExceeded(env) {
+				t.Errorf("IsLimitExceeded(%s) = false, wanted true", env)
+			}
+		})
+	}
+}
+
+// Tests that RecentGlobally returns the AND of its child's Environments over
+// just its window.
+func TestRecentGloballyWindow(t *testing.T) {
+	tests := []struct {
+		op      ltl.Operator
+		input   string
+		wantEnv string
+	}{
+		{RecentGlobally(2, sm("a")), "aaa", "true/false/[a (1) a (2)]/[]"},
+		{RecentGlobally(3, sm("a")), "aaaaaaa", "true/false/[a (4) a (5) a (6)]/[]"},
+		{RecentGlobally(2, sm("a")), "aab", "false/false/[]/[b (2)]"},
+		{RecentGlobally(2, sm("a")), "aaba", "false/false/[]/[]"},
+		{RecentGlobally(2, Eventually(sm("c"))), "aacc", "true/false/[c (2) c (3)]/[]"},
+		{RecentGlobally(2, Or(sm("b"), Then(sm("a"), Eventually(sm("b"))))), "aaab", "true/false/[a (2) b (3)]/[]"},
+	}
+	for _, test := range tests {
+		t.Run(PrettyPrint(test.op, Inline())+" <- "+test.input, func(t *testing.T) {
+			op := test.op
+			var env ltl.Environment
+			for idx, ch := range test.input {
+				op, env = ltl.Match(op, rtok.New(ch, idx))
+			}
+			if got := describeEnv(env); got != test.wantEnv {
+				t.Errorf("Got %s, wanted %s", got, test.wantEnv)
+			}
+		})
+	}
+}
+
+func TestDeferredLimits(t *testing.T) {
+	tests := []struct {
+		op        ltl.Operator
+		input     string
+		wantMatch bool
+		wantNil   bool
+	}{
+		// LimitAfterStart's budget starts when its child first consumes a
+		// Token.
+		{LimitAfterStart(2, Accept(2, Globally(sm("a")))), "xxaa", true, true},
+		{LimitAfterStart(3, Accept(2, Globally(sm("a")))), "xxaa", true, false},
+		{LimitAfterStart(2, RecentGlobally(2, sm("a"))), "aa", true, true},
+		// LimitConsumed counts only consumed Tokens.
+		{LimitConsumed(2, Then(sm("a"), Accept(2, Globally(sm("b"))))), "axxb", true, true},
+		{LimitConsumed(3, Then(sm("a"), Accept(2, Globally(sm("b"))))), "axxb", true, false},
+		{LimitConsumed(1, Eventually(Next(sm("b")))), "ab", true, true},
+	}
+	for _, test := range tests {
+		t.Run(PrettyPrint(test.op, Inline())+" <- "+test.input, func(t *testing.T) {
+			op := test.op
+			var env ltl.Environment
+			for idx, ch := range test.input {
+				if op == nil {
+					t.Fatalf("op became nil")
+				}
+				op, env = op.Match(rtok.New(ch, idx))
+			}
+			if env.Matching() != test.wantMatch {
+				t.Errorf("Got match %t, wanted %t", env.Matching(), test.wantMatch)
+			}
+			if (op == nil) != test.wantNil {
+				t.Errorf("Got nil continuation %t, wanted %t", op == nil, test.wantNil)
+			}
+		})
+	}
+}
+
+func TestPredicate(t *testing.T) {
+	tests := []struct {
+		description  string
+		op           ltl.Operator
+		tok          ltl.Token
+		wantMatch    bool
+		wantErr      bool
+		wantCaptures int
+	}{
+		{"matching", Predicate(isDigit), rtok.New('1', 0), true, false, 0},
+		{"not matching", Predicate(isDigit), rtok.New('a', 0), false, false, 0},
+		{"end of input", Predicate(isDigit), ltl.EOIToken{}, false, false, 0},
+		{"bad token", Predicate(isDigit), strTok("1"), false, true, 0},
+		{"capturing", Predicate(isDigit, CapturePredicate(true)), rtok.New('1', 0), true, false, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			op, env := test.op.Match(test.tok)
+			if op != nil {
+				t.Fatalf("wanted nil op, got %s", op)
+			}
+			if (env.Err() != nil) != test.wantErr {
+				t.Fatalf("wanted error %t, got %v", test.wantErr, env.Err())
+			}
+			if env.Matching() != test.wantMatch {
+				t.Fatalf("wanted match state %t, got %t", test.wantMatch, env.Matching())
+			}
+			if got := len(be.Captures(env).Get(true)); got != test.wantCaptures {
+				t.Fatalf("wanted %d captures, got %d", test.wantCaptures, got)
+			}
+		})
+	}
+}
+
+type strTok string
+
+func (st strTok) String() string {
+	return string(st)
+}
+
+func (st strTok) EOI() bool {
+	return false
+}
+
+func TestFirstOf(t *testing.T) {
+	gen := smatch.Generator(smatch.Capture(capture))
+	g := func(s string) ltl.Operator {
+		op, err := gen(s)
+		if err != nil {
+			t.Fatalf("failed to generate matcher: %s", err)
+		}
+		return op
+	}
+	bind := func(val string) *bindings.Bindings {
+		ret, err := bindings.New(bindings.CollatedString("a", val, bindings.CaseInsensitive))
+		if err != nil {
+			t.Fatalf("failed to create bindings: %s", err)
+		}
+		return ret
+	}
+	tests := []struct {
+		op           ltl.Operator
+		input        string
+		wantMatch    bool
+		wantErr      bool
+		wantBindings *bindings.Bindings
+	}{
+		// Or combines both branches' bindings, which conflict.
+		{Or(Then(g("$a<-"), g("x")), Then(g("1"), g("$a<-"))), "1x", false, true, nil},
+		// FirstOf prefers the left branch's bindings.
+		{FirstOf(Then(g("$a<-"), g("x")), Then(g("1"), g("$a<-"))), "1x", true, false, bind("1")},
+		{FirstOf(Then(g("$a<-"), g("x")), Then(g("1"), g("$a<-"))), "1y", true, false, bind("y")},
+		{FirstOf(Then(g("$a<-"), g("xy")), Then(g("."), g("$a<-"))), "1xz", true, false, bind("x")},
+		{FirstOf(Then(g("$a<-"), g("xy")), Then(g("."), g("$a<-"))), "1xy", true, false, bind("1")},
+	}
+	for _, test := range tests {
+		t.Run(PrettyPrint(test.op, Inline())+" <- "+test.input, func(t *testing.T) {
+			op := test.op
+			var env ltl.Environment
+			for idx, ch := range test.input {
+				op, env = ltl.Match(op, rtok.New(ch, idx))
+			}
+			if (env.Err() != nil) != test.wantErr {
+				t.Fatalf("wanted error %t, got %v", test.wantErr, env.Err())
+			}
+			if env.Matching() != test.wantMatch {
+				t.Fatalf("wanted match state %t, got %t", test.wantMatch, env.Matching())
+			}
+			if test.wantMatch && !be.Bindings(env).Eq(test.wantBindings) {
+				t.Fatalf("wanted bindings %s, got %s", test.wantBindings, be.Bindings(env))
+			}
+		})
+	}
+}
+
+func TestFirstOfHeld(t *testing.T) {
+	// The right argument matches while the left is pending.
+	op, _ := FirstOf(sm("ab"), sm("a")).Match(rtok.New('a', 0))
+	for _, child := range Children(op) {
+		if child == nil {
+			t.Fatalf("Held FirstOf %s has a nil child", PrettyPrint(op, Inline()))
+		}
+	}
+	if got := PrettyPrint(op, Inline()); strings.Contains(got, "<nil>") {
+		t.Errorf("PrettyPrint() = %s, wanted no nil children", got)
+	}
+	if _, env := op.Match(rtok.New('c', 1)); !env.Matching() {
+		t.Errorf("Held FirstOf did not report its held match")
+	}
+}
+
+type timedTok struct {
+	s  string
+	ts time.Time
+}
+
+func (tt timedTok) String() string {
+	return fmt.Sprintf("%s@%s", tt.s, tt.ts.Format(time.StampMilli))
+}
+
+func (tt timedTok) EOI() bool {
+	return false
+}
+
+func (tt timedTok) Timestamp() time.Time {
+	return tt.ts
+}
+
+// timedToks parses input of the form "a@0 b@1.5", where each entry is a token
+// value and its timestamp in seconds.
+func timedToks(t *testing.T, s string) []ltl.Token {
+	t.Helper()
+	var ret []ltl.Token
+	for _, entry := range strings.Fields(s) {
+		parts := strings.SplitN(entry, "@", 2)
+		secs, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			t.Fatalf("Bad timed token %s: %s", entry, err)
+		}
+		ret = append(ret, timedTok{parts[0], time.Unix(0, 0).Add(time.Duration(secs * float64(time.Second)))})
+	}
+	return ret
+}
+
+func TestMetric(t *testing.T) {
+	is := func(s string) ltl.Operator {
+		return Predicate(func(tok ltl.Token) (bool, error) {
+			tt, ok := tok.(timedTok)
+			return ok && tt.s == s, nil
+		}, PredicateName(s))
+	}
+	tests := []struct {
+		op        ltl.Operator
+		input     string
+		wantMatch bool
+	}{
+		{EventuallyWithinDuration(time.Second, is("b")), "a@0 b@0.5", true},
+		{EventuallyWithinDuration(time.Second, is("b")), "a@0 b@1", true},
+		{EventuallyWithinDuration(time.Second, is("b")), "a@0 a@0.5 b@1.5", false},
+		{EventuallyWithinDuration(time.Second, is("b")), "b@10", true},
+		{EventuallyWithinDuration(time.Second, Then(is("b"), is("c"))), "a@0 b@1 c@3", true},
+		{EventuallyWithinDuration(time.Second, is("b")), "a@0 a@0.5", false},
+		{UntilWithin(time.Second, 2*time.Second, is("a"), is("b")), "a@0 b@0.5", false},
+		{UntilWithin(time.Second, 2*time.Second, is("a"), is("b")), "a@0 a@0.5 b@1.5", true},
+		{UntilWithin(time.Second, 2*time.Second, is("a"), is("b")), "a@0 c@0.5 b@1.5", false},
+		{UntilWithin(time.Second, 2*time.Second, is("a"), is("b")), "a@0 a@0.5 b@2.5", false},
+		{Then(is("a"), EventuallyWithinDuration(time.Second, is("b"))), "a@0 c@5 b@5.5", true},
+	}
+	for _, test := range tests {
+		t.Run(PrettyPrint(test.op, Inline())+" <- "+test.input, func(t *testing.T) {
+			op := test.op
+			var env ltl.Environment
+			for _, tok := range timedToks(t, test.input) {
+				if op == nil {
+					break
+				}
+				op, env = op.Match(tok)
+			}
+			if op != nil {
+				env = ltl.Finish(op)
+			}
+			if ltl.IsErroring(env) {
+				t.Fatalf("Unexpected error %s", env.Err())
+			}
+			if env.Matching() != test.wantMatch {
+				t.Errorf("Got match %t, wanted %t", env.Matching(), test.wantMatch)
+			}
+		})
+	}
+	if _, env := EventuallyWithinDuration(time.Second, is("b")).Match(strTok("b")); !ltl.IsErroring(env) {
+		t.Errorf("Expected an error matching an untimed token")
+	}
+}
+
+func TestCanonicalize(t *testing.T) {
+	a, b, c := sm("a"), sm("b"), sm("c")
+	tests := []struct {
+		op, want ltl.Operator
+	}{
+		{And(b, a), And(a, b)},
+		{Or(c, Or(b, a)), Or(Or(a, b), c)},
+		{And(Or(b, a), c), And(Or(a, b), c)},
+		{And(c, And(a, Or(b, a))), And(And(Or(a, b), a), c)},
+		{Not(Not(a)), a},
+		{Not(Not(Not(a))), Not(a)},
+		{Eventually(Not(Not(And(b, a)))), Eventually(And(a, b))},
+		{Sequence(a, Sequence(b, Sequence(c, a))), Sequence(a, b, c, a)},
+		{Then(Or(b, a), Limit(3, Or(c, b))), Then(Or(a, b), Limit(3, Or(b, c)))},
+		// signals matchers are not hashable.
+		{And(signals.NewMatcher("b"), signals.NewMatcher("a")), And(signals.NewMatcher("a"), signals.NewMatcher("b"))},
+	}
+	for _, test := range tests {
+		t.Run(PrettyPrint(test.op, Inline()), func(t *testing.T) {
+			got, want := PrettyPrint(Canonicalize(test.op), Inline()), PrettyPrint(test.want, Inline())
+			if got != want {
+				t.Errorf("Canonicalize() = %s, wanted %s", got, want)
+			}
+		})
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	a, b := sm("a"), sm("b")
+	same := []ltl.Operator{
+		And(a, b),
+		And(b, a),
+		Not(Not(And(b, a))),
+		Located(And(Located(b, Location{Start: 4, End: 7}), a), Location{Start: 0, End: 7}),
+	}
+	for _, op := range same[1:] {
+		if got, want := Fingerprint(op), Fingerprint(same[0]); got != want {
+			t.Errorf("Fingerprint(%s) = %s, wanted %s", PrettyPrint(op, Inline()), got, want)
+		}
+	}
+	for _, op := range []ltl.Operator{Or(a, b), And(a, a), Limit(3, And(a, b))} {
+		if Fingerprint(op) == Fingerprint(same[0]) {
+			t.Errorf("Fingerprint(%s) matched that of %s, wanted a difference", PrettyPrint(op, Inline()), PrettyPrint(same[0], Inline()))
+		}
+	}
+}
+
+func TestToDot(t *testing.T) {
+	op := Then(sm("a"), Eventually(sm(`"b"`)))
+	want := `digraph "ltl" {
+  ordering=out;
+  node [shape=box];
+  n0 [label="THEN"];
+  n1 [label="[a]"];
+  n0 -> n1;
+  n2 [label="EVENTUALLY"];
+  n3 [label="[\"b\"]"];
+  n2 -> n3;
+  n0 -> n2;
+}
+`
+	if got := ToDot(op); got != want {
+		t.Errorf("ToDot() = %s, wanted %s", got, want)
+	}
+	cont, _ := op.Match(rtok.New('a', 0))
+	got := ToDot(op, GraphName("g"), WithContinuation(cont))
+	for _, wantStr := range []string{`digraph "g" {`, `subgraph cluster_0 {`, `label="formula";`,
+		`subgraph cluster_1 {`, `label="continuation";`, `n4 -> n5;`, `n5 [label="EVENTUALLY"];`} {
+		if !strings.Contains(got, wantStr) {
+			t.Errorf("ToDot() with continuation = %s, wanted it to contain %s", got, wantStr)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	a, b, c := sm("a"), sm("b"), sm("c")
+	tests := []struct {
+		op      ltl.Operator
+		want    string
+		wantErr bool
+	}{
+		{a, "[a]", false},
+		{Then(a, Eventually(b)), "[a] THEN (EVENTUALLY [b])", false},
+		{Limit(3, Eventually(Or(a, Not(b)))), "(EVENTUALLY ([a] OR (NOT [b]))) LIMIT 3", false},
+		{Sequence(a, b, c), "[a] THEN ([b] THEN [c])", false},
+		{Release(Globally(a), Next(Until(b, c))), "(GLOBALLY [a]) RELEASE (NEXT ([b] UNTIL [c]))", false},
+		{implies(a, b), "", true},
+		{Then(a, True()), "", true},
+	}
+	for _, test := range tests {
+		t.Run(PrettyPrint(test.op, Inline()), func(t *testing.T) {
+			got, err := Format(test.op)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Format() yielded error %v, wanted error: %t", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("Format() = %s, wanted %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestWithHooks(t *testing.T) {
+	tests := []struct {
+		op    ltl.Operator
+		input string
+	}{
+		{Then(sm("a"), Eventually(sm("b"))), "acb"},
+		{Then(sm("a"), Eventually(sm("b"))), "acc"},
+		{Or(Globally(sm("a")), Until(sm("a"), sm("b"))), "aab"},
+		{Then(NotFollowedBy(sm("a"), sm("b")), sm("c")), "ac"},
+		{Then(NotFollowedBy(sm("a"), sm("b")), sm("c")), "ab"},
+		{Then(NotFollowedBy(sm("a"), sm("bc")), Globally(sm("b"))), "ab"},
+		{Limit(5, Not(Eventually(sm("b")))), "aaa"},
+	}
+	for _, test := range tests {
+		t.Run(PrettyPrint(test.op, Inline())+" <- "+test.input+"$", func(t *testing.T) {
+			before, after := 0, 0
+			hooked := WithHooks(test.op, Hooks{
+				BeforeMatch: func(op ltl.Operator, tok ltl.Token) {
+					before++
+				},
+				OnMatch: func(op ltl.Operator, tok ltl.Token, env ltl.Environment) {
+					if _, ok := op.(*hooked); ok {
+						t.Errorf("OnMatch received a hooked instance %s", op)
+					}
+					after++
+				},
+			})
+			op := test.op
+			for idx, ch := range test.input {
+				var env, hookedEnv ltl.Environment
+				op, env = ltl.Match(op, rtok.New(ch, idx))
+				hooked, hookedEnv = ltl.Match(hooked, rtok.New(ch, idx))
+				if (op == nil) != (hooked == nil) {
+					t.Fatalf("at %d, resolved: %t, hooked resolved: %t", idx, op == nil, hooked == nil)
+				}
+				if env.Matching() != hookedEnv.Matching() {
+					t.Fatalf("at %d, matching: %t, hooked matching: %t", idx, env.Matching(), hookedEnv.Matching())
+				}
+			}
+			if op != nil {
+				env, hookedEnv := ltl.Finish(op), ltl.Finish(hooked)
+				if env.Matching() != hookedEnv.Matching() {
+					t.Fatalf("at end, matching: %t, hooked matching: %t", env.Matching(), hookedEnv.Matching())
+				}
+			}
+			if after <= len(test.input) {
+				t.Errorf("OnMatch was invoked %d times, wanted more than %d", after, len(test.input))
+			}
+			if before != after {
+				t.Errorf("BeforeMatch was invoked %d times, but OnMatch %d times", before, after)
+			}
+		})
+	}
+}
+
+func TestWithArena(t *testing.T) {
+	tests := []struct {
+		op    ltl.Operator
+		input string
+	}{
+		{Then(sm("a"), Eventually(sm("b"))), "acb"},
+		{Or(Globally(sm("a")), Until(sm("a"), sm("b"))), "aab"},
+		{Then(NotFollowedBy(sm("a"), sm("b")), sm("c")), "ac"},
+		{Limit(5, Not(Eventually(sm("b")))), "aaa"},
+		{Tagged(Then(sm("a"), sm("b")), tags.Label("ab")), "ab"},
+	}
+	for _, test := range tests {
+		t.Run(PrettyPrint(test.op, Inline())+" <- "+test.input+"$", func(t *testing.T) {
+			a := be.NewArena()
+			defer a.Release()
+			op, inArena := test.op, WithArena(test.op, a)
+			for idx, ch := range test.input {
+				var env, arenaEnv ltl.Environment
+				tok := rtok.New(ch, idx)
+				op, env = ltl.Match(op, tok)
+				inArena, arenaEnv = ltl.Match(inArena, tok)
+				if (op == nil) != (inArena == nil) {
+					t.Fatalf("at %d, resolved: %t, in arena resolved: %t", idx, op == nil, inArena == nil)
+				}
+				if !ltl.EnvEq(env, arenaEnv) {
+					t.Fatalf("at %d, got %s in arena, wanted %s", idx, arenaEnv, env)
+				}
+			}
+			if op != nil {
+				if env, arenaEnv := ltl.Finish(op), ltl.Finish(inArena); !ltl.EnvEq(env, arenaEnv) {
+					t.Fatalf("at end, got %s in arena, wanted %s", arenaEnv, env)
+				}
+			}
+		})
+	}
+}
+
+func TestTagged(t *testing.T) {
+	tests := []struct {
+		op       ltl.Operator
+		input    string
+		wantTags string
+	}{
+		{Tagged(sm("a"), tags.Label("x")), "a", "[#x]"},
+		{Then(Tagged(sm("a"), tags.Label("x")), Tagged(sm("b"), tags.Label("y"))), "ab", "[#x #y]"},
+		{Or(Tagged(sm("a"), tags.Label("x")), Tagged(sm("b"), tags.Label("y"))), "b", "[#y]"},
+		{Not(Tagged(sm("a"), tags.Label("x"))), "b", "[]"},
+		{Eventually(Tagged(sm("b"), tags.Label("x"))), "ab", "[#x]"},
+	}
+	for _, test := range tests {
+		t.Run(PrettyPrint(test.op, Inline())+" <- "+test.input, func(t *testing.T) {
+			op := test.op
+			var env ltl.Environment
+			for idx, ch := range test.input {
+				if op == nil {
+					t.Fatalf("op became nil")
+				}
+				op, env = ltl.Match(op, rtok.New(ch, idx))
+			}
+			if !env.Matching() {
+				t.Fatalf("wanted a match, got %s", env)
+			}
+			if got := fmt.Sprint(be.Tags(env).Get(true)); got != test.wantTags {
+				t.Errorf("Got tags %s, wanted %s", got, test.wantTags)
+			}
+		})
+	}
+}
+
+func TestWithSpans(t *testing.T) {
+	is := func(s string) ltl.Operator {
+		return Predicate(func(tok ltl.Token) (bool, error) {
+			tt, ok := tok.(timedTok)
+			return ok && tt.s == s, nil
+		}, PredicateName(s))
+	}
+	tests := []struct {
+		op       ltl.Operator
+		input    string
+		wantSpan time.Duration
+	}{
+		{is("a"), "a@1", 0},
+		{Then(is("a"), Eventually(is("b"))), "a@0 c@5 b@5.5", 5500 * time.Millisecond},
+		{Then(is("a"), Then(Not(is("b")), is("c"))), "a@1 a@2 c@4", 3 * time.Second},
+		{Eventually(Then(is("a"), is("b"))), "c@0 a@1 b@1.25", 250 * time.Millisecond},
+	}
+	for _, test := range tests {
+		t.Run(PrettyPrint(test.op, Inline())+" <- "+test.input, func(t *testing.T) {
+			op := WithSpans(test.op)
+			var env ltl.Environment
+			for _, tok := range timedToks(t, test.input) {
+				if op == nil {
+					t.Fatalf("op became nil")
+				}
+				op, env = op.Match(tok)
+			}
+			if !env.Matching() {
+				t.Fatalf("wanted a match, got %s", env)
+			}
+			span, ok := be.Tags(env).Span(true)
+			if !ok || span != test.wantSpan {
+				t.Errorf("Got span %s, %t, wanted %s, true", span, ok, test.wantSpan)
+			}
+		})
+	}
+}
+
+// costed matches its child, attaching a cost payload to its matches.
+type costed struct {
+	UnaryOperator
+	cost int
+}
+
+var costOps = &ltl.PayloadOps{
+	And: func(a, b interface{}) interface{} { return a.(int) + b.(int) },
+	Or: func(a, b interface{}) interface{} {
+		if a.(int) < b.(int) {
+			return a
+		}
+		return b
+	},
+}
+
+func (c *costed) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	op, env := ltl.Match(c.Child, tok)
+	if env.Matching() {
+		env = ltl.Sideband(env, c.cost, costOps)
+	}
+	if op != nil {
+		op = &costed{NewUnaryOperator(op), c.cost}
+	}
+	return op, env
+}
+
+func (c *costed) String() string {
+	return fmt.Sprintf("COSTED(%d)", c.cost)
+}
+
+func TestSideband(t *testing.T) {
+	cost := func(op ltl.Operator, c int) ltl.Operator {
+		return &costed{NewUnaryOperator(op), c}
+	}
+	tests := []struct {
+		op       ltl.Operator
+		input    string
+		wantCost int
+	}{
+		{cost(sm("a"), 1), "a", 1},
+		{And(cost(sm("a"), 1), cost(sm("a"), 2)), "a", 3},
+		{Or(cost(sm("a"), 1), cost(sm("a"), 2)), "a", 1},
+		{Or(cost(sm("a"), 1), cost(sm("b"), 2)), "b", 2},
+		{Then(cost(sm("a"), 1), cost(sm("b"), 4)), "ab", 5},
+		{Eventually(cost(sm("b"), 3)), "aab", 3},
+	}
+	for _, test := range tests {
+		t.Run(PrettyPrint(test.op, Inline())+" <- "+test.input, func(t *testing.T) {
+			op := test.op
+			var env ltl.Environment
+			for idx, ch := range test.input {
+				if op == nil {
+					t.Fatalf("op became nil")
+				}
+				op, env = ltl.Match(op, rtok.New(ch, idx))
+			}
+			if !env.Matching() {
+				t.Fatalf("wanted a match, got %s", env)
+			}
+			got, ok := ltl.PayloadOf(env)
+			if !ok || got != test.wantCost {
+				t.Errorf("Got payload %v, %t, wanted %d, true", got, ok, test.wantCost)
+			}
+		})
+	}
+}
+
+func TestScoredPredicate(t *testing.T) {
+	// near scores runes by their distance from r.
+	near := func(r rune) ltl.Operator {
+		return ScoredPredicate(func(tok ltl.Token) (float64, error) {
+			d := float64(tok.(*rtok.RuneToken).Value() - r)
+			if d < 0 {
+				d = -d
+			}
+			return 1 - d/4, nil
+		}, 0.5, PredicateName(string(r)))
+	}
+	tests := []struct {
+		op        ltl.Operator
+		input     string
+		wantMatch bool
+		wantScore float64
+	}{
+		{near('c'), "c", true, 1},
+		{near('c'), "d", true, 0.75},
+		{near('c'), "g", false, 0},
+		{Not(near('c')), "d", false, 0.25},
+		{And(near('c'), near('e')), "d", true, 0.75},
+		{And(near('c'), near('f')), "d", true, 0.5},
+		{Or(near('a'), near('f')), "d", true, 0.5},
+		{Then(near('a'), near('c')), "bd", true, 0.75},
+		{And(near('c'), True()), "d", true, 0.75},
+		{Or(near('a'), True()), "d", true, 1},
+	}
+	for _, test := range tests {
+		t.Run(PrettyPrint(test.op, Inline())+" <- "+test.input, func(t *testing.T) {
+			op := test.op
+			var env ltl.Environment
+			for idx, ch := range test.input {
+				if op == nil {
+					t.Fatalf("op became nil")
+				}
+				op, env = ltl.Match(op, rtok.New(ch, idx))
+			}
+			if env.Matching() != test.wantMatch {
+				t.Errorf("Got matching %t, wanted %t", env.Matching(), test.wantMatch)
+			}
+			if got, ok := ltl.ScoreOf(env); !ok || got != test.wantScore {
+				t.Errorf("Got score %g, %t, wanted %g, true", got, ok, test.wantScore)
+			}
+		})
+	}
+}
+
+func TestSprint(t *testing.T) {
+	op := And(True(), Not(Then(True(), True())))
+	for _, opts := range [][]func(o *ppOpts){nil, {Inline()}, {Prefix("> "), Indent("\t")}} {
+		want := PrettyPrint(op, opts...)
+		if got := Sprint(op, opts...); got != want {
+			t.Errorf("Sprint() = %q, wanted %q", got, want)
+		}
+		if !strings.HasSuffix(want, "\n") {
+			want += "\n"
+		}
+		var buf strings.Builder
+		if err := Fprint(&buf, op, opts...); err != nil || buf.String() != want {
+			t.Errorf("Fprint() wrote %q (%v), wanted %q", buf.String(), err, want)
+		}
+		colored := Sprint(op, append(opts, Colorize())...)
+		stripped := strings.NewReplacer(ansiReset, "", ansiBold, "", ansiYellow, "").Replace(colored)
+		if colored == stripped || stripped != PrettyPrint(op, opts...) {
+			t.Errorf("Sprint(Colorize) = %q, wanted a colorized %q", colored, PrettyPrint(op, opts...))
+		}
+	}
+}
+
+// counter is a terminal Operator that counts the Tokens it has matched, and
+// so must be cloned for each stream.
+type counter struct {
+	count *int
+}
+
+func (c *counter) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	*c.count++
+	return nil, ltl.Matching
+}
+
+func (c *counter) String() string {
+	return "COUNTER"
+}
+
+func (c *counter) Reducible() bool {
+	return true
+}
+
+func (c *counter) Clone() (ltl.Operator, bool) {
+	return &counter{count: new(int)}, true
+}
+
+func TestOperatorFactory(t *testing.T) {
+	stateless := Eventually(And(sm("a"), Not(sm("b"))))
+	f := ltl.NewOperatorFactory(stateless)
+	if got := f.New(); got != stateless {
+		t.Errorf("New() = %p for a stateless tree, wanted the root %p", got, stateless)
+	}
+	c := &counter{count: new(int)}
+	stateful := Eventually(And(sm("a"), Limit(3, c)))
+	f = ltl.NewOperatorFactory(stateful)
+	first, second := f.New(), f.New()
+	if first == stateful || second == stateful || first == second {
+		t.Fatalf("New() returned shared instances of a stateful tree")
+	}
+	for _, op := range []ltl.Operator{first, second, first} {
+		op.Match(rtok.New('a', 0))
+	}
+	if *c.count != 0 {
+		t.Errorf("matching instances modified the factory's root: count = %d, wanted 0", *c.count)
+	}
+	if got, want := PrettyPrint(first, Inline()), PrettyPrint(stateful, Inline()); got != want {
+		t.Errorf("New() = %s, wanted %s", got, want)
+	}
+}
+
+func runeToks(s string) []ltl.Token {
+	var ret []ltl.Token
+	for idx, ch := range s {
+		ret = append(ret, rtok.New(ch, idx))
+	}
+	return ret
+}
+
+func TestRun(t *testing.T) {
+	for _, test := range []struct {
+		op        ltl.Operator
+		input     string
+		wantMatch bool
+	}{
+		{Then(sm("a"), sm("b")), "ab", true},
+		{Then(sm("a"), sm("b")), "abc", true},
+		{Then(sm("a"), sm("b")), "ac", false},
+		{Eventually(sm("b")), "aab", true},
+		// Unresolved by the input, so resolved at its end.
+		{Eventually(sm("b")), "aaa", false},
+		{Globally(sm("a")), "aaa", true},
+	} {
+		t.Run(PrettyPrint(test.op, Inline())+" <- "+test.input, func(t *testing.T) {
+			env, err := ltl.Run(test.op, runeToks(test.input))
+			if err != nil {
+				t.Fatalf("Run() yielded unexpected error %s", err)
+			}
+			if got := env.Matching(); got != test.wantMatch {
+				t.Errorf("Run() matched %t, wanted %t", got, test.wantMatch)
+			}
+		})
+	}
+}
+
+func TestMatchAll(t *testing.T) {
+	for _, test := range []struct {
+		op        ltl.Operator
+		input     string
+		wantSpans [][2]int
+	}{
+		{sm("a"), "abab", [][2]int{{0, 0}, {2, 2}}},
+		// EVENTUALLY resolves on its first match.
+		{Then(sm("a"), Eventually(sm("b"))), "aabb", [][2]int{{0, 2}, {1, 2}}},
+		{Globally(sm("b")), "abb", [][2]int{{1, 1}, {1, 2}, {2, 2}}},
+		{sm("x"), "abc", nil},
+	} {
+		t.Run(PrettyPrint(test.op, Inline())+" <- "+test.input, func(t *testing.T) {
+			res, err := ltl.MatchAll(test.op, runeToks(test.input))
+			if err != nil {
+				t.Fatalf("MatchAll() yielded unexpected error %s", err)
+			}
+			var gotSpans [][2]int
+			for _, r := range res {
+				if !r.Env.Matching() {
+					t.Errorf("MatchAll() yielded non-matching result %v", r)
+				}
+				gotSpans = append(gotSpans, [2]int{r.Start, r.End})
+			}
+			if got, want := fmt.Sprint(gotSpans), fmt.Sprint(test.wantSpans); got != want {
+				t.Errorf("MatchAll() yielded spans %s, wanted %s", got, want)
+			}
+		})
+	}
+}
+
+// opaque is a terminal Operator that is never Reducible.
+type opaque struct{}
+
+func (opaque) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	return nil, ltl.Matching
+}
+
+func (opaque) String() string {
+	return "IRREDUCIBLE"
+}
+
+func (opaque) Reducible() bool {
+	return false
+}
+
+func TestReducible(t *testing.T) {
+	for _, test := range []struct {
+		op   interface{ Reducible() bool }
+		want bool
+	}{
+		{And(sm("a"), Not(sm("b"))), true},
+		{And(sm("a"), Not(opaque{})), false},
+		{Sequence(sm("a"), sm("b"), Limit(3, sm("c"))), true},
+		{Sequence(sm("a"), sm("b"), Limit(3, opaque{})), false},
+		{FirstOf(sm("a"), opaque{}), false},
+		// Base types created without their constructors compute reducibility
+		// on demand.
+		{UnaryOperator{Child: opaque{}}, false},
+		{BinaryOperator{Left: sm("a"), Right: sm("b")}, true},
+		{NaryOperator{ChildSlice: []ltl.Operator{sm("a"), opaque{}}}, false},
+	} {
+		if got := test.op.Reducible(); got != test.want {
+			t.Errorf("%v.Reducible() = %t, wanted %t", test.op, got, test.want)
+		}
+	}
+}
+
+func TestStateOnlyAllocations(t *testing.T) {
+	// Formulas of non-capturing terminals, whose Environments are all States,
+	// should match without allocating, except where their continuations hold
+	// changing state, like Limit's count or Eventually's pending instances.
+	for _, op := range []ltl.Operator{
+		And(pa, Next(Or(pb, pc))),
+		Or(And(pa, pb), Next(Not(pc))),
+		Then(pa, Then(Or(pb, pc), Eventually(pa))),
+		Until(Or(pa, pb), pc),
+		Globally(Not(pc)),
+		Release(pa, Not(pc)),
+	} {
+		toks := instanceTokens()
+		if got := testing.AllocsPerRun(10, func() { matchInstances(op, toks) }); got != 0 {
+			t.Errorf("Matching %s allocated %g times, wanted 0", PrettyPrint(op, Inline()), got)
+		}
+	}
+}
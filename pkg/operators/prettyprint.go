@@ -17,16 +17,37 @@ package operators
 import (
 	"fmt"
 	"github.com/ilhamster/ltl/pkg/ltl"
+	"io"
 	"strings"
 )
 
+// ANSI escape sequences used by Colorize.
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiYellow = "\x1b[33m"
+)
+
 type ppOpts struct {
 	inline bool
 	infix  bool
+	color  bool
 	prefix string
 	indent string
 }
 
+// name returns the name of op, colorized if requested: Operators with
+// children in bold, and terminal Operators in yellow.
+func (po *ppOpts) name(op ltl.Operator, terminal bool) string {
+	if !po.color {
+		return op.String()
+	}
+	if terminal {
+		return ansiYellow + op.String() + ansiReset
+	}
+	return ansiBold + op.String() + ansiReset
+}
+
 func (po *ppOpts) withIndent() string {
 	return po.prefix + po.indent
 }
@@ -62,10 +83,18 @@ func Indent(i string) func(o *ppOpts) {
 	}
 }
 
+// Colorize specifies that output should be colorized for ANSI terminals.
+func Colorize() func(o *ppOpts) {
+	return func(o *ppOpts) {
+		o.color = true
+	}
+}
+
 func dup(po *ppOpts) func(o *ppOpts) {
 	return func(o *ppOpts) {
 		o.inline = po.inline
 		o.infix = po.infix
+		o.color = po.color
 		o.prefix = po.prefix
 		o.indent = po.indent
 	}
@@ -97,22 +126,22 @@ func PrettyPrint(op ltl.Operator, opts ...func(o *ppOpts)) string {
 			return "<nil>"
 		}
 		if !ok || len(ppo.Children()) == 0 {
-			return op.String()
+			return o.name(op, true)
 		}
 		var childStrs []string
 		for _, child := range ppo.Children() {
 			childStrs = append(childStrs, PrettyPrint(child, dup(o)))
 		}
-		return fmt.Sprintf("%s(%s)", op.String(), strings.Join(childStrs, ","))
+		return fmt.Sprintf("%s(%s)", o.name(op, false), strings.Join(childStrs, ","))
 	}
 	opStr := o.prefix
 	if op == nil {
 		return fmt.Sprintf("%s<nil>\n", opStr)
 	}
-	opStr = opStr + op.String() + "\n"
 	if !ok {
-		return opStr
+		return opStr + o.name(op, true) + "\n"
 	}
+	opStr = opStr + o.name(op, len(ppo.Children()) == 0) + "\n"
 	children := ppo.Children()
 	if len(children) == 2 {
 		l := PrettyPrint(children[0], dup(o), Prefix(o.withIndent()))
@@ -127,3 +156,20 @@ func PrettyPrint(op ltl.Operator, opts ...func(o *ppOpts)) string {
 	}
 	return opStr
 }
+
+// Sprint returns the pretty-printed form of the specified operator.  It is
+// equivalent to PrettyPrint.
+func Sprint(op ltl.Operator, opts ...func(o *ppOpts)) string {
+	return PrettyPrint(op, opts...)
+}
+
+// Fprint writes the pretty-printed form of the specified operator to the
+// provided Writer.  In Inline mode, a trailing newline is added.
+func Fprint(w io.Writer, op ltl.Operator, opts ...func(o *ppOpts)) error {
+	s := PrettyPrint(op, opts...)
+	if !strings.HasSuffix(s, "\n") {
+		s += "\n"
+	}
+	_, err := io.WriteString(w, s)
+	return err
+}
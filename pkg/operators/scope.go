@@ -0,0 +1,69 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operators
+
+import (
+	"fmt"
+	be "github.com/ilhamster/ltl/pkg/bindingenvironment"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	"sort"
+	"strings"
+)
+
+// Scope matches its child, confining the bindings its child makes for the
+// provided names to it: the Environments Scope produces neither bind nor
+// reference those names, so bindings made within the scope neither escape it
+// nor conflict with bindings made outside it.  References to the names that
+// are still pending within the scope can no longer be satisfied.
+func Scope(child ltl.Operator, names ...string) ltl.Operator {
+	if child == nil || len(names) == 0 {
+		return child
+	}
+	sorted := append([]string{}, names...)
+	sort.Strings(sorted)
+	return &scope{NewUnaryOperator(child), sorted}
+}
+
+// ScopedNames returns the names scoped by the provided Operator, in increasing
+// order, and true, if it is a Scope, or false otherwise.
+func ScopedNames(op ltl.Operator) ([]string, bool) {
+	if s, ok := op.(*scope); ok {
+		return append([]string{}, s.names...), true
+	}
+	return nil, false
+}
+
+type scope struct {
+	UnaryOperator
+	// names is sorted.
+	names []string
+}
+
+func (s *scope) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	op, env := ltl.Match(s.Child, tok)
+	env = be.Scope(env, s.names...)
+	if op == nil {
+		return nil, env
+	}
+	return &scope{NewUnaryOperator(op), s.names}, env
+}
+
+func (s *scope) String() string {
+	names := make([]string, len(s.names))
+	for idx, name := range s.names {
+		names[idx] = "$" + name
+	}
+	return fmt.Sprintf("SCOPE(%s)", strings.Join(names, ", "))
+}
@@ -0,0 +1,224 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operators
+
+import (
+	"fmt"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	"time"
+)
+
+// State is the complete internal state of an Operator defined in this package,
+// excluding its children, from which, with its children, it can be
+// reconstructed with FromState.  Unlike Kind, State distinguishes all the
+// Operators of this package, including those that only appear in
+// partially-evaluated continuations.  It supports checkpointing Operators.
+type State struct {
+	// Type identifies the Operator's type.  It is the Operator's Kind, or, for
+	// Operators of kind Other, the name of the internal type.
+	Type string
+	// Count is the count parameter of LIMIT, ACCEPT, LIMIT_AFTER_START,
+	// LIMIT_CONSUMED, and RECENT_GLOBALLY.
+	Count int64
+	// Parallel is set for a ParallelAnd or ParallelOr.
+	Parallel bool
+	// Started is set for a LIMIT_AFTER_START or UNTIL_WITHIN that has started
+	// counting.
+	Started bool
+	// Lo, Hi, and Start are the bounds and start time of an UNTIL_WITHIN.
+	Lo, Hi time.Duration
+	Start  time.Time
+	// Envs holds the Environments retained by the Operator, if any.
+	Envs []ltl.Environment
+	// Tokens holds the Tokens buffered by a LOOKAHEAD or REPLAY.
+	Tokens []ltl.Token
+	// Live marks those of the Envs of a RECENT_GLOBALLY held for instances of
+	// its child which have not resolved.  Those instances are its children
+	// after the first, in order.
+	Live []bool
+}
+
+// The Types of Operators of kind Other.
+const (
+	LimitAfterStartType = "LIMIT_AFTER_START"
+	LimitConsumedType   = "LIMIT_CONSUMED"
+	AndEnvironmentType  = "AND_ENVIRONMENT"
+	OrEnvironmentType   = "OR_ENVIRONMENT"
+	RecentGloballyType  = "RECENT_GLOBALLY"
+	ReleaseStepType     = "RELEASE_STEP"
+	ReleaseAndType      = "RELEASE_AND"
+	UntilWithinType     = "UNTIL_WITHIN"
+	LookaheadType       = "LOOKAHEAD"
+	ReplayType          = "REPLAY"
+	HeldFirstOfType     = "HELD_FIRST_OF"
+)
+
+// StateOf returns the State of the provided Operator, and true, if it is
+// defined in this package, or false otherwise.  Predicates are not supported,
+// since their functions cannot be captured in a State.
+func StateOf(op ltl.Operator) (State, bool) {
+	switch o := op.(type) {
+	case *and:
+		return State{Type: string(AndKind), Parallel: o.parallel}, true
+	case *or:
+		return State{Type: string(OrKind), Parallel: o.parallel}, true
+	case *heldFirstOf:
+		return State{Type: HeldFirstOfType, Envs: []ltl.Environment{o.held}}, true
+	case *limit:
+		return State{Type: string(LimitKind), Count: o.n}, true
+	case *accept:
+		return State{Type: string(AcceptKind), Count: o.n}, true
+	case *deferredLimit:
+		if o.onlyConsumed {
+			return State{Type: LimitConsumedType, Count: o.n}, true
+		}
+		return State{Type: LimitAfterStartType, Count: o.n, Started: o.started}, true
+	case *andEnvironment:
+		return State{Type: AndEnvironmentType, Envs: []ltl.Environment{o.env}}, true
+	case *orEnvironment:
+		return State{Type: OrEnvironmentType, Envs: []ltl.Environment{o.env}}, true
+	case *recentGlobally:
+		envs, live := o.slots()
+		return State{Type: RecentGloballyType, Count: o.n, Envs: envs, Live: live}, true
+	case *releaseStepOp:
+		return State{Type: ReleaseStepType}, true
+	case *releaseAndOp:
+		return State{Type: ReleaseAndType}, true
+	case *untilWithin:
+		return State{Type: UntilWithinType, Lo: o.lo, Hi: o.hi, Start: o.start, Started: o.started}, true
+	case *lookahead:
+		return State{Type: LookaheadType, Envs: []ltl.Environment{o.env}, Tokens: o.buf}, true
+	case *replay:
+		return State{Type: ReplayType, Tokens: o.buf}, true
+	case *predicate:
+		return State{}, false
+	}
+	if kind := KindOf(op); kind != Other {
+		return State{Type: string(kind)}, true
+	}
+	return State{}, false
+}
+
+// FromState returns the Operator with the provided State and children.
+func FromState(s State, children ...ltl.Operator) (ltl.Operator, error) {
+	arity := map[string]int{
+		string(TrueKind): 0, string(FalseKind): 0, string(AnyTokenKind): 0,
+		string(NotKind): 1, string(LimitKind): 1, string(NextKind): 1,
+		string(AcceptKind): 1, string(EventuallyKind): 1, string(GloballyKind): 1,
+		LimitAfterStartType: 1, LimitConsumedType: 1, AndEnvironmentType: 1,
+		OrEnvironmentType: 1, LookaheadType: 1, ReplayType: 1,
+		HeldFirstOfType: 1,
+		string(AndKind): 2, string(OrKind): 2, string(ImpliesKind): 2,
+		string(FirstOfKind): 2, string(ThenKind): 2, string(UntilKind): 2,
+		string(ReleaseKind): 2, string(NotFollowedByKind): 2, ReleaseStepType: 2,
+		ReleaseAndType: 2, UntilWithinType: 2,
+	}
+	if want, ok := arity[s.Type]; ok && len(children) != want {
+		return nil, fmt.Errorf("%s requires %d children, got %d", s.Type, want, len(children))
+	}
+	if (s.Type == string(SequenceKind) || s.Type == RecentGloballyType) && len(children) == 0 {
+		return nil, fmt.Errorf("%s requires at least one child", s.Type)
+	}
+	if s.Type == RecentGloballyType {
+		if len(s.Live) != len(s.Envs) {
+			return nil, fmt.Errorf("%s requires a liveness for each of its %d environments, got %d", s.Type, len(s.Envs), len(s.Live))
+		}
+		live := 0
+		for _, l := range s.Live {
+			if l {
+				live++
+			}
+		}
+		if len(children) != live+1 {
+			return nil, fmt.Errorf("%s with %d live instances requires %d children, got %d", s.Type, live, live+1, len(children))
+		}
+	}
+	wantEnvs := 0
+	switch s.Type {
+	case AndEnvironmentType, OrEnvironmentType, LookaheadType, HeldFirstOfType:
+		wantEnvs = 1
+	}
+	if wantEnvs > 0 && len(s.Envs) != wantEnvs {
+		return nil, fmt.Errorf("%s requires %d environments, got %d", s.Type, wantEnvs, len(s.Envs))
+	}
+	var child, left, right ltl.Operator
+	switch len(children) {
+	case 1:
+		child = children[0]
+	case 2:
+		left, right = children[0], children[1]
+	}
+	switch s.Type {
+	case string(TrueKind):
+		return True(), nil
+	case string(FalseKind):
+		return False(), nil
+	case string(AnyTokenKind):
+		return AnyToken(), nil
+	case string(NotKind):
+		return &not{NewUnaryOperator(child)}, nil
+	case string(LimitKind):
+		return &limit{NewUnaryOperator(child), s.Count}, nil
+	case string(NextKind):
+		return &next{NewUnaryOperator(child)}, nil
+	case string(AcceptKind):
+		return &accept{NewUnaryOperator(child), s.Count}, nil
+	case string(EventuallyKind):
+		return &eventually{NewUnaryOperator(child)}, nil
+	case string(GloballyKind):
+		return &globally{NewUnaryOperator(child)}, nil
+	case LimitAfterStartType:
+		return &deferredLimit{NewUnaryOperator(child), s.Count, s.Started, false}, nil
+	case LimitConsumedType:
+		return &deferredLimit{NewUnaryOperator(child), s.Count, false, true}, nil
+	case AndEnvironmentType:
+		return &andEnvironment{NewUnaryOperator(child), s.Envs[0]}, nil
+	case OrEnvironmentType:
+		return &orEnvironment{NewUnaryOperator(child), s.Envs[0]}, nil
+	case RecentGloballyType:
+		return restoreRecentGlobally(s.Count, children[0], s.Envs, s.Live, children[1:]), nil
+	case LookaheadType:
+		return &lookahead{NewUnaryOperator(child), s.Envs[0], s.Tokens}, nil
+	case ReplayType:
+		return &replay{NewUnaryOperator(child), s.Tokens}, nil
+	case HeldFirstOfType:
+		return &heldFirstOf{NewUnaryOperator(child), s.Envs[0]}, nil
+	case string(AndKind):
+		return &and{NewBinaryOperator(left, right), s.Parallel}, nil
+	case string(OrKind):
+		return &or{NewBinaryOperator(left, right), s.Parallel}, nil
+	case string(ImpliesKind):
+		return &impliesOp{NewBinaryOperator(left, right)}, nil
+	case string(FirstOfKind):
+		return &firstOf{NewBinaryOperator(left, right)}, nil
+	case string(ThenKind):
+		return &then{NewBinaryOperator(left, right)}, nil
+	case string(UntilKind):
+		return &until{NewBinaryOperator(left, right)}, nil
+	case string(ReleaseKind):
+		return &release{NewBinaryOperator(left, right)}, nil
+	case string(NotFollowedByKind):
+		return &notFollowedBy{NewBinaryOperator(left, right)}, nil
+	case ReleaseStepType:
+		return &releaseStepOp{NewBinaryOperator(left, right)}, nil
+	case ReleaseAndType:
+		return &releaseAndOp{NewBinaryOperator(left, right)}, nil
+	case UntilWithinType:
+		return &untilWithin{NewBinaryOperator(left, right), s.Lo, s.Hi, s.Start, s.Started}, nil
+	case string(SequenceKind):
+		return &sequence{NewNaryOperator(children)}, nil
+	}
+	return nil, fmt.Errorf("unknown operator type '%s'", s.Type)
+}
@@ -0,0 +1,96 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operators
+
+import (
+	"fmt"
+	be "github.com/ilhamster/ltl/pkg/bindingenvironment"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	"github.com/ilhamster/ltl/pkg/tags"
+	"strings"
+)
+
+// Tagged matches its child, attaching the provided Tags to every Environment
+// its child produces that matches, or may yet match once its references are
+// bound.  The Tags apply should that Environment match; retrieve them with
+// bindingenvironment.Tags.
+func Tagged(child ltl.Operator, ts ...tags.Tag) ltl.Operator {
+	if child == nil || len(ts) == 0 {
+		return child
+	}
+	return &tagged{NewUnaryOperator(child), ts, nil}
+}
+
+// TaggedBy is like Tagged, but attaches the Tags returned by f for the Token
+// on which each Environment is produced.
+func TaggedBy(child ltl.Operator, f func(tok ltl.Token) []tags.Tag) ltl.Operator {
+	if child == nil || f == nil {
+		return child
+	}
+	return &tagged{NewUnaryOperator(child), nil, f}
+}
+
+// WithSpans returns the provided operator tree with each of its leaves, such
+// as matchers, TaggedBy tags.ForToken.  Matching Environments produced by the
+// returned tree thus carry the range of indices, and of timestamps, of the
+// Tokens their leaves matched: for instance, for an Environment env matching
+// timestamped Tokens, tags.Span reports its wall-clock extent:
+//
+//	d, ok := be.Tags(env).Span(true)
+func WithSpans(op ltl.Operator) ltl.Operator {
+	children := Children(op)
+	if len(children) == 0 {
+		return TaggedBy(op, tags.ForToken)
+	}
+	newChildren := make([]ltl.Operator, len(children))
+	for idx, child := range children {
+		newChildren[idx] = WithSpans(child)
+	}
+	return WithChildren(op, newChildren...)
+}
+
+type tagged struct {
+	UnaryOperator
+	tags []tags.Tag
+	f    func(tok ltl.Token) []tags.Tag
+}
+
+func (t *tagged) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	op, env := ltl.Match(t.Child, tok)
+	if env.Matching() || be.PendingReferences(env).Length() > 0 {
+		ts := t.tags
+		if t.f != nil {
+			ts = append(ts[:len(ts):len(ts)], t.f(tok)...)
+		}
+		if len(ts) > 0 {
+			env = env.And(be.New(be.Tagged(ts...)))
+		}
+	}
+	if op == nil {
+		return nil, env
+	}
+	return &tagged{NewUnaryOperator(op), t.tags, t.f}, env
+}
+
+func (t *tagged) String() string {
+	tagStrs := make([]string, len(t.tags))
+	for idx, tag := range t.tags {
+		tagStrs[idx] = tag.String()
+	}
+	if t.f != nil {
+		tagStrs = append(tagStrs, "*")
+	}
+	return fmt.Sprintf("TAGGED(%s)", strings.Join(tagStrs, ", "))
+}
@@ -0,0 +1,187 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operators
+
+import (
+	"fmt"
+	be "github.com/ilhamster/ltl/pkg/bindingenvironment"
+	"github.com/ilhamster/ltl/pkg/ltl"
+)
+
+// A collection of terminal ltl.Operators that are independent of any
+// particular ltl.Token type.
+
+// True returns a terminal Operator which consumes a single Token and matches.
+// As a constant, it also matches at the end of input.
+func True() ltl.Operator {
+	return constant(ltl.Matching)
+}
+
+// False returns a terminal Operator which consumes a single Token and does not
+// match.
+func False() ltl.Operator {
+	return constant(ltl.NotMatching)
+}
+
+type constant ltl.State
+
+func (c constant) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	return nil, ltl.State(c)
+}
+
+func (c constant) String() string {
+	if c {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+// Reducible returns true for all constants.
+func (c constant) Reducible() bool {
+	return true
+}
+
+// AnyToken returns a terminal Operator which consumes a single Token and
+// matches.  Unlike True, it does not match at the end of input, since there is
+// no Token left to consume.
+func AnyToken() ltl.Operator {
+	return anyToken{}
+}
+
+type anyToken struct{}
+
+func (at anyToken) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	if tok.EOI() {
+		return nil, ltl.NotMatching
+	}
+	return nil, ltl.Matching
+}
+
+func (at anyToken) String() string {
+	return "ANY"
+}
+
+// Reducible returns true for AnyToken.
+func (at anyToken) Reducible() bool {
+	return true
+}
+
+type predicateConfig struct {
+	name    string
+	capture bool
+}
+
+// PredicateOption specifies a configuration option for a Predicate.
+type PredicateOption func(c *predicateConfig)
+
+// CapturePredicate specifies whether Tokens satisfying a Predicate should be
+// captured in the Environment.
+func CapturePredicate(capture bool) PredicateOption {
+	return func(c *predicateConfig) {
+		c.capture = capture
+	}
+}
+
+// PredicateName specifies the name with which a Predicate is printed.
+func PredicateName(name string) PredicateOption {
+	return func(c *predicateConfig) {
+		c.name = name
+	}
+}
+
+// Predicate returns a terminal Operator which consumes a single Token and
+// matches iff the provided function returns true for it.  If the function
+// returns an error, the Operator returns an Erroring Environment.  At the end
+// of input, the function is not invoked, and the Operator does not match.
+func Predicate(f func(ltl.Token) (bool, error), opts ...PredicateOption) ltl.Operator {
+	c := &predicateConfig{name: "PREDICATE"}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return &predicate{f, c}
+}
+
+type predicate struct {
+	f func(ltl.Token) (bool, error)
+	c *predicateConfig
+}
+
+func (p *predicate) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	if tok.EOI() {
+		return nil, ltl.NotMatching
+	}
+	matching, err := p.f(tok)
+	if err != nil {
+		return nil, ltl.ErrEnv(err)
+	}
+	if p.c.capture {
+		return nil, be.New(be.Matching(matching), be.Captured(tok))
+	}
+	return nil, ltl.State(matching)
+}
+
+func (p *predicate) String() string {
+	return fmt.Sprintf("[%s]", p.c.name)
+}
+
+// Reducible returns true iff the receiver does not capture Tokens.
+func (p *predicate) Reducible() bool {
+	return !p.c.capture
+}
+
+// ScoredPredicate returns a terminal Operator which consumes a single Token,
+// scoring it in [0, 1] with the provided function, as by string similarity.
+// It returns an ltl.Scored Environment with that score, which matches iff the
+// score is at least threshold.  If the function returns an error, the
+// Operator returns an Erroring Environment.  At the end of input, the function
+// is not invoked, and the Operator does not match, with score 0.
+func ScoredPredicate(f func(ltl.Token) (float64, error), threshold float64, opts ...PredicateOption) ltl.Operator {
+	c := &predicateConfig{name: "SCORED"}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return &scoredPredicate{f, threshold, c}
+}
+
+type scoredPredicate struct {
+	f         func(ltl.Token) (float64, error)
+	threshold float64
+	c         *predicateConfig
+}
+
+func (sp *scoredPredicate) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	if tok.EOI() {
+		return nil, ltl.Scored(ltl.NotMatching, 0)
+	}
+	score, err := sp.f(tok)
+	if err != nil {
+		return nil, ltl.ErrEnv(err)
+	}
+	var env ltl.Environment = ltl.State(score >= sp.threshold)
+	if sp.c.capture {
+		env = be.New(be.Matching(env.Matching()), be.Captured(tok))
+	}
+	return nil, ltl.Scored(env, score)
+}
+
+func (sp *scoredPredicate) String() string {
+	return fmt.Sprintf("[%s>=%g]", sp.c.name, sp.threshold)
+}
+
+// Reducible returns false for all ScoredPredicates, since their scores are
+// sideband state.
+func (sp *scoredPredicate) Reducible() bool {
+	return false
+}
@@ -0,0 +1,419 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"fmt"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	ops "github.com/ilhamster/ltl/pkg/operators"
+	"github.com/ilhamster/ltl/pkg/tags"
+	"strconv"
+	"strings"
+)
+
+// NodeKind identifies the kind of a Node.
+type NodeKind int
+
+const (
+	// MatcherNode is a matcher, such as '[a]#tag' or '"a"'.
+	MatcherNode NodeKind = iota
+	// RefNode is a reference to a named formula.
+	RefNode
+	// LetNode is 'LET name = expr IN body', with children expr and body.
+	LetNode
+	// NotNode is a NOT.
+	NotNode
+	// NextNode is a NEXT.
+	NextNode
+	// EventuallyNode is an EVENTUALLY.
+	EventuallyNode
+	// GloballyNode is a GLOBALLY.
+	GloballyNode
+	// ScopeNode is a SCOPE.
+	ScopeNode
+	// LimitNode is a LIMIT.
+	LimitNode
+	// OrNode is an OR.
+	OrNode
+	// AndNode is an AND.
+	AndNode
+	// UntilNode is an UNTIL.
+	UntilNode
+	// ReleaseNode is a RELEASE.
+	ReleaseNode
+	// ThenNode is a THEN.
+	ThenNode
+	// ErrorNode stands in for a subexpression containing a syntax error,
+	// when the Lexer is recovering from errors.
+	ErrorNode
+	// CustomNode is a custom operator defined in a Registry.
+	CustomNode
+)
+
+var nodeKindNames = map[NodeKind]string{
+	MatcherNode:    "MATCHER",
+	RefNode:        "REF",
+	LetNode:        "LET",
+	NotNode:        "NOT",
+	NextNode:       "NEXT",
+	EventuallyNode: "EVENTUALLY",
+	GloballyNode:   "GLOBALLY",
+	ScopeNode:      "SCOPE",
+	LimitNode:      "LIMIT",
+	OrNode:         "OR",
+	AndNode:        "AND",
+	UntilNode:      "UNTIL",
+	ReleaseNode:    "RELEASE",
+	ThenNode:       "THEN",
+	ErrorNode:      "ERROR",
+	CustomNode:     "CUSTOM",
+}
+
+func (nk NodeKind) String() string {
+	if name, ok := nodeKindNames[nk]; ok {
+		return name
+	}
+	return fmt.Sprintf("NodeKind(%d)", int(nk))
+}
+
+// Node is a node in the syntax tree of a parsed expression, as returned by
+// ParseAST.  Unlike the Operators ParseLTL returns, it preserves the structure
+// of the expression as written, including LETs and references to named
+// formulas, and does not depend on any particular matcher implementation.
+type Node struct {
+	Kind     NodeKind
+	Children []*Node
+	// Pos is the position in the expression at which the node begins.
+	Pos Position
+	// Text is the text of a MatcherNode, within its delimiters.
+	Text string
+	// Open and Close are the delimiters of a MatcherNode, such as '[' and
+	// ']', or '"' and '"' for a quoted string literal.
+	Open, Close rune
+	// Tags are the labels of a MatcherNode's tags.
+	Tags []string
+	// Name is the name of a RefNode, the name a LetNode defines, or the
+	// keyword of a CustomNode.
+	Name string
+	// Names are the names a ScopeNode scopes.
+	Names []string
+	// Num is a LimitNode's limit.
+	Num int64
+	// Bounds, if non-nil, are the inclusive lower and upper bounds of a
+	// bounded EventuallyNode, GloballyNode, or UntilNode, counted in Tokens
+	// after the current one.
+	Bounds *[2]int64
+	// ArgPos is the position of a LimitNode's limit, or of a bounded node's
+	// bounds.
+	ArgPos Position
+	// op is the Operator generated for a MatcherNode while lexing, if any,
+	// and raw its delimited text as written.
+	op  ltl.Operator
+	raw string
+	// def is a CustomNode's definition.
+	def *OperatorDef
+}
+
+// delimited returns the text of a MatcherNode within its delimiters, escaped
+// as needed.
+func (n *Node) delimited() string {
+	if n.raw != "" {
+		return n.raw
+	}
+	if n.Open == '"' {
+		return strconv.Quote(n.Text)
+	}
+	var sb strings.Builder
+	sb.WriteRune(n.Open)
+	for _, r := range n.Text {
+		if r == n.Open || r == n.Close || r == '\\' {
+			sb.WriteRune('\\')
+		}
+		sb.WriteRune(r)
+	}
+	sb.WriteRune(n.Close)
+	return sb.String()
+}
+
+func (n *Node) String() string {
+	switch n.Kind {
+	case MatcherNode:
+		ret := n.delimited()
+		for _, tag := range n.Tags {
+			ret += string(TagMarker) + tag
+		}
+		return ret
+	case RefNode:
+		return n.Name
+	case LetNode:
+		return fmt.Sprintf("LET(%s, %s, %s)", n.Name, n.Children[0], n.Children[1])
+	case ScopeNode:
+		return fmt.Sprintf("SCOPE(%v, %s)", n.Names, n.Children[0])
+	case LimitNode:
+		return fmt.Sprintf("LIMIT(%d, %s)", n.Num, n.Children[0])
+	}
+	ret := n.Kind.String()
+	if n.Kind == CustomNode {
+		ret = n.Name
+	}
+	if n.Bounds != nil {
+		ret += fmt.Sprintf("%c%d..%d%c", OpenBounds, n.Bounds[0], n.Bounds[1], CloseBounds)
+	}
+	if len(n.Children) > 0 {
+		ret += "("
+		for idx, child := range n.Children {
+			if idx > 0 {
+				ret += ", "
+			}
+			ret += child.String()
+		}
+		ret += ")"
+	}
+	return ret
+}
+
+// Lower converts the receiver into an ltl.Operator, using matcherGenerator to
+// convert the text of its bracketed matchers into Operators, and the provided
+// formulas to resolve references to names not defined by an enclosing LET.
+func (n *Node) Lower(matcherGenerator func(string) (ltl.Operator, error), formulas map[string]ltl.Operator) (ltl.Operator, error) {
+	return n.LowerWith(map[rune]func(string) (ltl.Operator, error){
+		OpenBracket: matcherGenerator,
+	}, formulas)
+}
+
+// LowerWith is like Lower, but converts the text of each matcher with the
+// matcher generator keyed by its open delimiter, for syntax trees lexed with
+// several kinds of Matchers.  Quoted string literals are converted with the
+// matcher generator keyed by OpenBracket.
+func (n *Node) LowerWith(matcherGenerators map[rune]func(string) (ltl.Operator, error), formulas map[string]ltl.Operator) (ltl.Operator, error) {
+	lw := &lowerer{matcherGenerators: matcherGenerators, formulas: formulas, quotedOpen: OpenBracket}
+	op, bad, err := lw.lower(n)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", bad.Pos, err)
+	}
+	return op, nil
+}
+
+// lowerer converts Nodes into Operators.
+type lowerer struct {
+	// matcherGenerators are keyed by the open delimiters of their matchers.
+	matcherGenerators map[rune]func(string) (ltl.Operator, error)
+	formulas          map[string]ltl.Operator
+	// quotedOpen is the open delimiter of the matchers whose generator
+	// generates quoted string literals.
+	quotedOpen rune
+	// If placeholders is true, matchers are lowered to placeholders rather
+	// than generated.
+	placeholders bool
+	// If cached is true, Operators generated while lexing are used.
+	cached         bool
+	trackLocations bool
+	// macros holds the in-scope LET definitions, innermost last.
+	macros []macro
+}
+
+// macro is a formula defined with 'LET name = expr IN ...'.
+type macro struct {
+	name string
+	op   ltl.Operator
+}
+
+// lower returns the Operator for the provided Node or, if it cannot be
+// lowered, the offending Node and an error.
+func (lw *lowerer) lower(n *Node) (ltl.Operator, *Node, error) {
+	switch n.Kind {
+	case MatcherNode:
+		return lw.lowerMatcher(n)
+	case RefNode:
+		for idx := len(lw.macros) - 1; idx >= 0; idx-- {
+			if lw.macros[idx].name == n.Name {
+				return lw.macros[idx].op, nil, nil
+			}
+		}
+		if op, ok := lw.formulas[n.Name]; ok {
+			return op, nil, nil
+		}
+		return nil, n, fmt.Errorf("formula %s is not defined at offset %d", n.Name, n.Pos.Offset)
+	case LetNode:
+		def, bad, err := lw.lower(n.Children[0])
+		if err != nil {
+			return nil, bad, err
+		}
+		lw.macros = append(lw.macros, macro{n.Name, def})
+		defer func() {
+			lw.macros = lw.macros[:len(lw.macros)-1]
+		}()
+		return lw.lower(n.Children[1])
+	case ErrorNode:
+		return nil, n, fmt.Errorf("syntax error at offset %d", n.Pos.Offset)
+	}
+	children := make([]ltl.Operator, len(n.Children))
+	for idx, child := range n.Children {
+		op, bad, err := lw.lower(child)
+		if err != nil {
+			return nil, bad, err
+		}
+		children[idx] = op
+	}
+	if err := n.checkArgs(); err != nil {
+		return nil, n, err
+	}
+	if n.Bounds != nil {
+		op, err := lowerBounded(n, children)
+		if err != nil {
+			return nil, n, err
+		}
+		return op, nil, nil
+	}
+	switch n.Kind {
+	case NotNode:
+		return ops.Not(children[0]), nil, nil
+	case NextNode:
+		return ops.Next(children[0]), nil, nil
+	case EventuallyNode:
+		return ops.Eventually(children[0]), nil, nil
+	case GloballyNode:
+		return ops.Globally(children[0]), nil, nil
+	case ScopeNode:
+		return ops.Scope(children[0], n.Names...), nil, nil
+	case LimitNode:
+		return ops.Limit(n.Num, children[0]), nil, nil
+	case OrNode:
+		return ops.Or(children[0], children[1]), nil, nil
+	case AndNode:
+		return ops.And(children[0], children[1]), nil, nil
+	case UntilNode:
+		return ops.Until(children[0], children[1]), nil, nil
+	case ReleaseNode:
+		return ops.Release(children[0], children[1]), nil, nil
+	case ThenNode:
+		return ops.Then(children[0], children[1]), nil, nil
+	case CustomNode:
+		if n.def == nil {
+			return nil, n, fmt.Errorf("custom operator %s at offset %d is not registered", n.Name, n.Pos.Offset)
+		}
+		if n.def.unary() {
+			return n.def.Unary(children[0]), nil, nil
+		}
+		return n.def.Binary(children[0], children[1]), nil, nil
+	}
+	return nil, n, fmt.Errorf("unsupported node kind %s", n.Kind)
+}
+
+// checkArgs returns an error if the receiver's LIMIT count or bounds are out of
+// range.
+func (n *Node) checkArgs() error {
+	if n.Kind == LimitNode && n.Num < 0 {
+		return fmt.Errorf("negative LIMIT %d at offset %d", n.Num, n.ArgPos.Offset)
+	}
+	if n.Bounds != nil {
+		if lo, hi := n.Bounds[0], n.Bounds[1]; lo < 0 || lo > hi {
+			return fmt.Errorf("invalid bounds %d..%d at offset %d", lo, hi, n.ArgPos.Offset)
+		}
+	}
+	return nil
+}
+
+// lowerBounded returns the Operator for a bounded EventuallyNode,
+// GloballyNode, or UntilNode with the provided lowered children.  Each is
+// built from its unbounded counterpart, skipping Tokens before its lower bound
+// with Accept and terminating after its upper bound with Limit.
+func lowerBounded(n *Node, children []ltl.Operator) (ltl.Operator, error) {
+	lo, hi := n.Bounds[0], n.Bounds[1]
+	switch n.Kind {
+	case EventuallyNode:
+		return ops.Accept(lo, ops.Limit(hi-lo+1, ops.Eventually(children[0]))), nil
+	case GloballyNode:
+		return ops.Accept(lo, ops.Limit(hi-lo+1, ops.Globally(children[0]))), nil
+	case UntilNode:
+		left, right := children[0], children[1]
+		until := ops.Accept(lo, ops.Limit(hi-lo+1, ops.Until(left, right)))
+		if lo == 0 {
+			return until, nil
+		}
+		// The left operand must also hold on every Token before the lower bound.
+		return ops.And(ops.Limit(lo, ops.Globally(left)), until), nil
+	}
+	return nil, fmt.Errorf("%s at offset %d cannot be bounded", n.Kind, n.Pos.Offset)
+}
+
+func (lw *lowerer) lowerMatcher(n *Node) (ltl.Operator, *Node, error) {
+	op := n.op
+	if lw.placeholders {
+		op = placeholder(n.delimited())
+	} else if !lw.cached || op == nil {
+		gen := lw.matcherGenerators[n.Open]
+		text := n.Text
+		if gen == nil && n.Open == '"' {
+			// Quoted string literals are matched literally as if bracketed.
+			gen, text = lw.matcherGenerators[lw.quotedOpen], literal(text)
+		}
+		if gen == nil {
+			return nil, n, fmt.Errorf("no matcher generator for matcher at offset %d", n.Pos.Offset)
+		}
+		var err error
+		op, err = gen(text)
+		if err != nil {
+			return nil, n, fmt.Errorf("failed to create matcher at offset %d: %s", n.Pos.Offset, err)
+		}
+	}
+	var ts []tags.Tag
+	for _, tag := range n.Tags {
+		ts = append(ts, tags.Label(tag))
+	}
+	op = ops.Tagged(op, ts...)
+	if lw.trackLocations {
+		text := n.delimited()
+		op = ops.Located(op, ops.Location{
+			Start: n.Pos.Offset,
+			End:   n.Pos.Offset + len(text),
+			Text:  text,
+		})
+	}
+	return op, nil, nil
+}
+
+// newNode returns a new Node of the provided kind and children, beginning at
+// the provided offset.
+func (l *Lexer) newNode(kind NodeKind, offset int, children ...*Node) *Node {
+	return &Node{
+		Kind:     kind,
+		Children: children,
+		Pos:      l.positionOf(offset),
+	}
+}
+
+// lower converts the provided Node, parsed by the receiver, into an Operator.
+func (l *Lexer) lower(n *Node) (ltl.Operator, error) {
+	lw := &lowerer{
+		matcherGenerators: map[rune]func(string) (ltl.Operator, error){},
+		formulas:          l.formulas,
+		quotedOpen:        l.openBracket,
+		cached:            true,
+		trackLocations:    l.trackLocations,
+	}
+	for open, kind := range l.matchers {
+		lw.matcherGenerators[open] = kind.matcherGenerator
+	}
+	op, bad, err := lw.lower(n)
+	if err != nil {
+		err = l.syntaxError(err, bad.Pos.Offset)
+		if l.recovering {
+			return nil, ErrorList{err.(*SyntaxError)}
+		}
+		return nil, err
+	}
+	return op, nil
+}
@@ -0,0 +1,145 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"bufio"
+	"container/list"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	"strings"
+	"sync"
+)
+
+// DefaultCacheSize is the number of expressions a Cache created by NewCache
+// holds.
+const DefaultCacheSize = 1024
+
+// Cache memoizes ParseLTL, keyed by expression, for a single set of tokens,
+// matcher generator, and Lexer options, so that services parsing the same
+// expressions repeatedly lex and parse each only once.  Since a Cache is
+// bound to one matcher generator, Operators generated by one generator are
+// never returned for another.  A Cache holds a bounded number of
+// expressions, evicting the least recently used when it is full.  A Cache is
+// safe for concurrent use.
+type Cache struct {
+	tokens           map[string]int
+	matcherGenerator func(string) (ltl.Operator, error)
+	opts             []func(l *Lexer)
+	size             int
+	mu               sync.Mutex
+	// entries maps each cached expression to its element in lru, which holds
+	// cacheEntries from most to least recently used.
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type cacheEntry struct {
+	expr    string
+	factory *ltl.OperatorFactory
+	err     error
+}
+
+// NewCache returns a new, empty Cache holding up to DefaultCacheSize
+// expressions, and parsing them with Lexers created by NewLexer with the
+// provided arguments.
+func NewCache(tokens map[string]int, matcherGenerator func(string) (ltl.Operator, error), opts ...func(l *Lexer)) *Cache {
+	return NewSizedCache(DefaultCacheSize, tokens, matcherGenerator, opts...)
+}
+
+// NewSizedCache is like NewCache, but the returned Cache holds up to the
+// provided number of expressions.  A size less than 1 is treated as 1.
+func NewSizedCache(size int, tokens map[string]int, matcherGenerator func(string) (ltl.Operator, error), opts ...func(l *Lexer)) *Cache {
+	if size < 1 {
+		size = 1
+	}
+	return &Cache{
+		tokens:           tokens,
+		matcherGenerator: matcherGenerator,
+		opts:             opts,
+		size:             size,
+		entries:          map[string]*list.Element{},
+		lru:              list.New(),
+	}
+}
+
+// ParseLTL returns the Operator parsed from the provided expression, or the
+// error parsing it, as ParseLTL would.  Each call returns a new instance of
+// the cached Operator, as an ltl.OperatorFactory would, so callers never
+// share Operator state modified by Match.
+func (c *Cache) ParseLTL(expr string) (ltl.Operator, error) {
+	entry, ok := c.lookup(expr)
+	if !ok {
+		// Parse without holding the lock; concurrent misses on the same
+		// expression parse it redundantly, but agree on the result.
+		entry = &cacheEntry{expr: expr}
+		op, err := c.parse(expr)
+		if err != nil {
+			entry.err = err
+		} else {
+			entry.factory = ltl.NewOperatorFactory(op)
+		}
+		c.insert(entry)
+	}
+	if entry.err != nil {
+		return nil, entry.err
+	}
+	return entry.factory.New(), nil
+}
+
+// Len returns the number of expressions cached in the receiver.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// lookup returns the entry cached for the provided expression, marking it
+// most recently used, and true, or false if there is none.
+func (c *Cache) lookup(expr string) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[expr]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return el.Value.(*cacheEntry), true
+}
+
+// insert caches the provided entry as the most recently used, evicting the
+// least recently used entry if the receiver is full.
+func (c *Cache) insert(entry *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[entry.expr]; ok {
+		el.Value = entry
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[entry.expr] = c.lru.PushFront(entry)
+	if c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).expr)
+	}
+}
+
+func (c *Cache) parse(expr string) (ltl.Operator, error) {
+	l, err := NewLexer(c.tokens, c.matcherGenerator, bufio.NewReader(strings.NewReader(expr)), c.opts...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseLTL(l)
+}
@@ -0,0 +1,124 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"fmt"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	"strings"
+)
+
+// Precedence is the precedence of a user-defined operator, given as that of
+// the built-in operators it binds like.  Since the grammar is fixed, custom
+// operators share the precedence levels of built-in ones.
+type Precedence int
+
+const (
+	// LikeUntil binary operators bind as loosely as UNTIL and RELEASE.
+	LikeUntil Precedence = iota
+	// LikeThen binary operators bind like THEN.
+	LikeThen
+	// LikeAnd binary operators bind like AND and OR.
+	LikeAnd
+	// LikeEventually unary operators bind as loosely as EVENTUALLY, so that
+	// 'OP [a] THEN [b]' is 'OP ([a] THEN [b])'.
+	LikeEventually
+	// LikeNot unary operators bind as tightly as NOT, so that
+	// 'OP [a] THEN [b]' is '(OP [a]) THEN [b]'.
+	LikeNot
+)
+
+// precedenceTokens maps each Precedence to the token lexed for its
+// operators.
+var precedenceTokens = map[Precedence]int{
+	LikeUntil:      UNTIL_LIKE,
+	LikeThen:       THEN_LIKE,
+	LikeAnd:        AND_LIKE,
+	LikeEventually: EVENTUALLY_LIKE,
+	LikeNot:        NOT_LIKE,
+}
+
+// OperatorDef defines a custom operator keyword.  Binary operators, with
+// precedence LikeUntil, LikeThen, or LikeAnd, are infix and left-associative,
+// and are constructed with Binary; unary operators, with precedence
+// LikeEventually or LikeNot, are prefix, and are constructed with Unary.
+type OperatorDef struct {
+	Keyword    string
+	Precedence Precedence
+	Unary      func(child ltl.Operator) ltl.Operator
+	Binary     func(left, right ltl.Operator) ltl.Operator
+}
+
+func (def *OperatorDef) unary() bool {
+	return def.Precedence == LikeEventually || def.Precedence == LikeNot
+}
+
+// Registry holds custom operator definitions, which lexers created with the
+// Operators option recognize alongside their tokens.  A Registry should not
+// be modified concurrently with its use in NewLexer.
+type Registry struct {
+	defs map[string]*OperatorDef
+}
+
+// NewRegistry returns a new, empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{defs: map[string]*OperatorDef{}}
+}
+
+// Register adds the provided operator definition to the receiver.  It
+// returns an error if the definition is incomplete, or if its keyword is
+// already registered.
+func (reg *Registry) Register(def OperatorDef) error {
+	if def.Keyword == "" {
+		return fmt.Errorf("custom operator has no keyword")
+	}
+	if _, ok := precedenceTokens[def.Precedence]; !ok {
+		return fmt.Errorf("custom operator %s has unknown precedence %d", def.Keyword, def.Precedence)
+	}
+	if def.unary() && def.Unary == nil || !def.unary() && def.Binary == nil {
+		return fmt.Errorf("custom operator %s has no constructor for its precedence", def.Keyword)
+	}
+	if _, ok := reg.defs[def.Keyword]; ok {
+		return fmt.Errorf("custom operator %s is already registered", def.Keyword)
+	}
+	reg.defs[def.Keyword] = &def
+	return nil
+}
+
+// Operators is an option for NewLexer, making the custom operators registered
+// in the provided Registry available to expressions lexed by the new Lexer.
+// Operators registered afterwards are not.  NewLexer returns an error if a
+// custom operator's keyword is also one of its tokens.
+func Operators(reg *Registry) func(l *Lexer) {
+	return func(l *Lexer) {
+		for keyword, def := range reg.defs {
+			l.operators[keyword] = def
+		}
+	}
+}
+
+// operator returns the custom operator definition for the provided keyword,
+// as lexed by the receiver, or nil if there is none.
+func (l *Lexer) operator(keyword string) *OperatorDef {
+	if l.caseInsensitive {
+		for kw, def := range l.operators {
+			if strings.EqualFold(kw, keyword) {
+				return def
+			}
+		}
+		return nil
+	}
+	return l.operators[keyword]
+}
@@ -0,0 +1,151 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	"io"
+	"os"
+	"unicode"
+)
+
+// ParseAll parses a document of named formulas, lexed by the provided Lexer,
+// returning a map from formula names to their Operators.  Each formula is
+// written as 'name := expr', where name is not a keyword, and formulas are
+// separated by FormulaSeparators or by newlines; a formula may span several
+// lines only within parentheses.  Comments and blank lines are ignored.  Each formula may refer by name to
+// those preceding it.  Errors in the document are, or wrap, *SyntaxErrors.
+func ParseAll(l *Lexer) (map[string]ltl.Operator, error) {
+	l.document = true
+	defer func() {
+		l.document = false
+	}()
+	ret := map[string]ltl.Operator{}
+	for {
+		name, ok := l.lexDefinition()
+		if !ok {
+			return nil, l.syntaxError(l.err, l.lastTokenStartOffset)
+		}
+		if name == "" {
+			return ret, nil
+		}
+		if _, ok := ret[name]; ok {
+			return nil, l.syntaxError(fmt.Errorf("formula %s redefined at offset %d", name, l.lastTokenStartOffset), l.lastTokenStartOffset)
+		}
+		l.node, l.depth = nil, 0
+		op, err := ParseLTL(l)
+		if err != nil {
+			return nil, fmt.Errorf("in formula %s: %w", name, err)
+		}
+		ret[name] = op
+		l.Define(name, op)
+	}
+}
+
+// ParseFile parses the document of named formulas in the file at the provided
+// path, as ParseAll does, using a Lexer created by NewLexer with the provided
+// token set, matcherGenerator, and options.
+func ParseFile(path string, tokens map[string]int, matcherGenerator func(string) (ltl.Operator, error), opts ...func(l *Lexer)) (map[string]ltl.Operator, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	l, err := NewLexer(tokens, matcherGenerator, bufio.NewReader(f), opts...)
+	if err != nil {
+		return nil, err
+	}
+	ret, err := ParseAll(l)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return ret, nil
+}
+
+// lexDefinition consumes any whitespace, separators, and comments, then a
+// formula name and DefinitionMarker, returning the name and true.  At the end
+// of the document, it returns an empty name and true; if a lexing error
+// occurred, it returns false.
+func (l *Lexer) lexDefinition() (string, bool) {
+	var r rune
+	for {
+		var c int
+		var err error
+		r, c, err = l.r.ReadRune()
+		l.offset += c
+		if err == io.EOF {
+			return "", true
+		}
+		if err != nil {
+			l.err = fmt.Errorf("read error at offset %d: %s", l.offset, err)
+			return "", false
+		}
+		if r == FormulaSeparator || unicode.Is(unicode.White_Space, r) {
+			continue
+		}
+		skipped, ok := l.skipComment(r)
+		if !ok {
+			return "", false
+		}
+		if !skipped {
+			l.lastTokenStartOffset = l.offset - c
+			break
+		}
+	}
+	name := ""
+	for isNameRune(r) {
+		name += string(r)
+		var c int
+		var err error
+		r, c, err = l.r.ReadRune()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			l.err = fmt.Errorf("read error at offset %d: %s", l.offset, err)
+			return "", false
+		}
+		l.offset += c
+	}
+	if name == "" {
+		l.err = fmt.Errorf("expected a formula name at offset %d", l.offset)
+		return "", false
+	}
+	if l.isKeyword(name) {
+		l.err = fmt.Errorf("invalid formula name %q ending at offset %d", name, l.offset)
+		return "", false
+	}
+	// Skip any spaces between the name and the DefinitionMarker.
+	for r == ' ' || r == '\t' {
+		var c int
+		var err error
+		r, c, err = l.r.ReadRune()
+		if err != nil {
+			break
+		}
+		l.offset += c
+	}
+	if !l.startsMarker(r, DefinitionMarker) {
+		l.err = fmt.Errorf("expected '%s' after formula %s at offset %d", DefinitionMarker, name, l.offset)
+		return "", false
+	}
+	return name, true
+}
+
+func isNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
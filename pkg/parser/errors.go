@@ -0,0 +1,188 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Position identifies a location in a lexed expression.
+type Position struct {
+	// Offset is the byte offset of the location.
+	Offset int
+	// Line and Column are the 1-based line and column, in runes, of the
+	// location.
+	Line, Column int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("line %d, column %d", p.Line, p.Column)
+}
+
+// SyntaxError is the error returned by ParseLTL and ParseAll when an
+// expression cannot be lexed or parsed.  It identifies the Position of the
+// offending token, and can render the line containing it with a caret beneath
+// that token.
+type SyntaxError struct {
+	Position
+	// Text is the text of the line containing the offending token.
+	Text string
+	// Err is the underlying lexing or parsing error.
+	Err error
+}
+
+func (se *SyntaxError) Error() string {
+	return fmt.Sprintf("%s (%s)", se.Err, se.Position)
+}
+
+// Unwrap returns the underlying error.
+func (se *SyntaxError) Unwrap() error {
+	return se.Err
+}
+
+// Caret returns the line containing the offending token, followed on the next
+// line by a caret beneath the token.
+func (se *SyntaxError) Caret() string {
+	var pad strings.Builder
+	col := 1
+	for _, r := range se.Text {
+		if col >= se.Column {
+			break
+		}
+		// Preserve tabs so the caret lines up however they are displayed.
+		if r == '\t' {
+			pad.WriteRune('\t')
+		} else {
+			pad.WriteRune(' ')
+		}
+		col++
+	}
+	for ; col < se.Column; col++ {
+		pad.WriteRune(' ')
+	}
+	return se.Text + "\n" + pad.String() + "^"
+}
+
+// lineStart returns the offset of the start of the line containing the
+// provided offset in the receiver's input, clamping the offset to the input
+// read so far.
+func (l *Lexer) lineStart(offset int) (start, clamped int) {
+	src := l.source.String()
+	if offset > len(src) {
+		offset = len(src)
+	}
+	return strings.LastIndexByte(src[:offset], '\n') + 1, offset
+}
+
+// positionOf returns the Position of the provided offset in the receiver's
+// input.
+func (l *Lexer) positionOf(offset int) Position {
+	start, offset := l.lineStart(offset)
+	src := l.source.String()
+	return Position{
+		Offset: offset,
+		Line:   strings.Count(src[:start], "\n") + 1,
+		Column: utf8.RuneCountInString(src[start:offset]) + 1,
+	}
+}
+
+// LastTokenStartPosition returns the Position of the start of the last lexed
+// token.
+func (l *Lexer) LastTokenStartPosition() Position {
+	return l.positionOf(l.lastTokenStartOffset)
+}
+
+// syntaxError wraps the provided error in a SyntaxError at the provided
+// offset, unless it already is one.  It does not consume any input.
+func (l *Lexer) syntaxError(err error, offset int) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*SyntaxError); ok {
+		return err
+	}
+	pos := l.positionOf(offset)
+	start, offset := l.lineStart(offset)
+	// Peek at the rest of the offending line, if it has not yet been read;
+	// peeked input is recorded in source.
+	for n := 1; !strings.Contains(l.source.String()[offset:], "\n"); n *= 2 {
+		if _, err := l.r.Peek(n); err != nil {
+			break
+		}
+	}
+	text := l.source.String()[start:]
+	if end := strings.IndexByte(text, '\n'); end >= 0 {
+		text = text[:end]
+	}
+	return &SyntaxError{pos, strings.TrimSuffix(text, "\r"), err}
+}
+
+// report records the provided error, at the provided offset.  The receiver's
+// error is the first reported; if it is recovering, all reported errors are
+// also collected.
+func (l *Lexer) report(err error, offset int) {
+	if l.recovering {
+		l.diagnostics = append(l.diagnostics, l.syntaxError(err, offset).(*SyntaxError))
+	}
+	if l.err == nil {
+		l.err = err
+	}
+}
+
+// result returns the syntax tree and error of the last parse.
+func (l *Lexer) result() (*Node, error) {
+	if l.recovering {
+		if len(l.diagnostics) > 0 {
+			return nil, l.diagnostics
+		}
+		return l.node, nil
+	}
+	if l.err != nil {
+		return nil, l.syntaxError(l.err, l.lastTokenStartOffset)
+	}
+	return l.node, nil
+}
+
+// skipWord consumes the rest of a word following a lexing error, returning
+// false at EOF or on a read error.
+func (l *Lexer) skipWord() bool {
+	for {
+		r, c, err := l.r.ReadRune()
+		if err != nil {
+			return false
+		}
+		if !isNameRune(r) {
+			l.r.UnreadRune()
+			return true
+		}
+		l.offset += c
+	}
+}
+
+// ErrorList is the error returned by ParseLTL when its Lexer is recovering
+// from errors, holding every SyntaxError found, in order.
+type ErrorList []*SyntaxError
+
+func (el ErrorList) Error() string {
+	switch len(el) {
+	case 0:
+		return "no errors"
+	case 1:
+		return el[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", el[0], len(el)-1)
+}
@@ -0,0 +1,62 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"bufio"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	ops "github.com/ilhamster/ltl/pkg/operators"
+	"strings"
+)
+
+// Fingerprint returns a hash, as a hexadecimal string, of the canonical form
+// of the provided expression, parsed with DefaultTokens.  Expressions differing
+// only in whitespace, comments, redundant parentheses, LET definitions, or
+// respects ignored by operators.Canonicalize share a fingerprint.  No matcher
+// generator is needed: the text of each matcher, rather than the Operator
+// generated from it, is fingerprinted.  So parser.Fingerprint and
+// operators.Fingerprint do not agree for the same formula.
+func Fingerprint(expr string) (string, error) {
+	l, err := NewLexer(DefaultTokens, nil, bufio.NewReader(strings.NewReader(expr)))
+	if err != nil {
+		return "", err
+	}
+	n, err := ParseAST(l)
+	if err != nil {
+		return "", err
+	}
+	lw := &lowerer{placeholders: true}
+	op, bad, err := lw.lower(n)
+	if err != nil {
+		return "", l.syntaxError(err, bad.Pos.Offset)
+	}
+	return ops.Fingerprint(op), nil
+}
+
+// placeholder stands in for a matcher, printing as its delimited text, in
+// expressions lowered without matcher generators.  It never matches.
+type placeholder string
+
+func (p placeholder) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	return nil, ltl.NotMatching
+}
+
+func (p placeholder) String() string {
+	return string(p)
+}
+
+func (p placeholder) Reducible() bool {
+	return true
+}
@@ -0,0 +1,208 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Precedence levels of the grammar's operators, from loosest to tightest.
+const (
+	letLevel = iota
+	limitLevel
+	globallyLevel
+	eventuallyLevel
+	untilLevel
+	thenLevel
+	andLevel
+	notLevel
+	atomLevel
+	// noFollow is the level following a subexpression ending an expression,
+	// or a parenthesized one.
+	noFollow = -1
+)
+
+var customLevels = map[Precedence]int{
+	LikeUntil:      untilLevel,
+	LikeThen:       thenLevel,
+	LikeAnd:        andLevel,
+	LikeEventually: eventuallyLevel,
+	LikeNot:        notLevel,
+}
+
+// level returns the precedence level of the provided Node.
+func level(n *Node) int {
+	switch n.Kind {
+	case LetNode:
+		return letLevel
+	case LimitNode:
+		return limitLevel
+	case GloballyNode:
+		return globallyLevel
+	case EventuallyNode:
+		return eventuallyLevel
+	case UntilNode, ReleaseNode:
+		return untilLevel
+	case ThenNode:
+		return thenLevel
+	case AndNode, OrNode:
+		return andLevel
+	case NotNode, NextNode, ScopeNode:
+		return notLevel
+	case CustomNode:
+		if n.def != nil {
+			return customLevels[n.def.Precedence]
+		}
+		return notLevel
+	}
+	return atomLevel
+}
+
+// isPrefix returns true if the provided Node begins with a keyword and ends
+// with a subexpression, which extends as far right as the grammar allows.
+func isPrefix(n *Node) bool {
+	switch n.Kind {
+	case LetNode, NotNode, NextNode, EventuallyNode, GloballyNode, ScopeNode:
+		return true
+	case CustomNode:
+		return len(n.Children) == 1
+	}
+	return false
+}
+
+type formatOpts struct {
+	width  int
+	indent string
+}
+
+// FormatWidth is an option for Node.Format and FormatExpr, wrapping lines
+// longer than the provided width where possible.  By default, or if width is
+// not positive, lines are not wrapped.
+func FormatWidth(width int) func(o *formatOpts) {
+	return func(o *formatOpts) {
+		o.width = width
+	}
+}
+
+// FormatIndent is an option for Node.Format and FormatExpr, setting the
+// indentation of each level of wrapped lines.  The default is two spaces.
+func FormatIndent(indent string) func(o *formatOpts) {
+	return func(o *formatOpts) {
+		o.indent = indent
+	}
+}
+
+// Format returns the receiver as an expression in canonical form: keywords
+// are spelled as in DefaultTokens' long forms, operators are separated by
+// single spaces, and subexpressions are parenthesized only where the
+// grammar's precedence requires it.  If a FormatWidth is provided, binary
+// operators beginning subexpressions too long for a line are moved onto new
+// lines, indented by the FormatIndent for each level of nesting.
+func (n *Node) Format(opts ...func(o *formatOpts)) string {
+	o := &formatOpts{indent: "  "}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o.format(n, letLevel, noFollow, "")
+}
+
+// FormatExpr parses the provided expression with DefaultTokens and returns it
+// in the canonical form produced by Node.Format.  Comments are not preserved.
+func FormatExpr(expr string, opts ...func(o *formatOpts)) (string, error) {
+	l, err := NewLexer(DefaultTokens, nil, bufio.NewReader(strings.NewReader(expr)))
+	if err != nil {
+		return "", err
+	}
+	n, err := ParseAST(l)
+	if err != nil {
+		return "", err
+	}
+	return n.Format(opts...), nil
+}
+
+// format formats the provided Node, in a context requiring at least the
+// provided precedence level and followed by an operator of level follow,
+// parenthesizing it if necessary.  Continuation lines begin with indent.
+func (o *formatOpts) format(n *Node, minLevel, follow int, indent string) string {
+	var parens bool
+	if isPrefix(n) {
+		// A following operator binding more tightly than a prefix operator
+		// would be absorbed into its operand.
+		parens = follow >= level(n)
+	} else {
+		parens = level(n) < minLevel
+	}
+	if parens {
+		return "(" + o.layout(n, noFollow, indent+o.indent) + ")"
+	}
+	return o.layout(n, follow, indent)
+}
+
+// layout formats the provided Node without enclosing parentheses, on one line
+// if it fits, and otherwise wrapped.
+func (o *formatOpts) layout(n *Node, follow int, indent string) string {
+	oneLine := o
+	if o.width > 0 {
+		oneLine = &formatOpts{indent: o.indent}
+	}
+	flat := oneLine.layoutWith(n, follow, indent, " ")
+	if o.width <= 0 || utf8.RuneCountInString(indent)+utf8.RuneCountInString(flat) <= o.width {
+		return flat
+	}
+	return o.layoutWith(n, follow, indent, "\n"+indent)
+}
+
+// layoutWith formats the provided Node without enclosing parentheses,
+// separating a binary operator from its left operand, and a LET from its
+// body, with sep.
+func (o *formatOpts) layoutWith(n *Node, follow int, indent, sep string) string {
+	keyword := n.Kind.String()
+	if n.Kind == CustomNode {
+		keyword = n.Name
+	}
+	if n.Bounds != nil {
+		if n.Bounds[0] == 0 {
+			keyword += fmt.Sprintf("%s%d", BoundsMarker, n.Bounds[1])
+		} else {
+			keyword += fmt.Sprintf("%c%d..%d%c", OpenBounds, n.Bounds[0], n.Bounds[1], CloseBounds)
+		}
+	}
+	lvl := level(n)
+	switch {
+	case n.Kind == MatcherNode || n.Kind == RefNode || n.Kind == ErrorNode:
+		return n.String()
+	case n.Kind == LetNode:
+		return fmt.Sprintf("LET %s = %s IN%s%s", n.Name,
+			o.format(n.Children[0], letLevel, noFollow, indent+o.indent), sep,
+			o.format(n.Children[1], letLevel, follow, indent))
+	case n.Kind == ScopeNode:
+		names := make([]string, len(n.Names))
+		for idx, name := range n.Names {
+			names[idx] = "$" + name
+		}
+		return fmt.Sprintf("SCOPE(%s) %s", strings.Join(names, ", "),
+			o.format(n.Children[0], lvl, follow, indent+o.indent))
+	case n.Kind == LimitNode:
+		return fmt.Sprintf("%s LIMIT %d", o.format(n.Children[0], limitLevel+1, limitLevel, indent), n.Num)
+	case isPrefix(n):
+		return keyword + " " + o.format(n.Children[0], lvl, follow, indent+o.indent)
+	}
+	// Binary operators are left-associative.
+	return o.format(n.Children[0], lvl, lvl, indent) + sep + keyword + " " +
+		o.format(n.Children[1], lvl+1, follow, indent+o.indent)
+}
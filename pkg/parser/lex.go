@@ -17,9 +17,11 @@ package parser
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"github.com/ilhamster/ltl/pkg/ltl"
 	"io"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -120,29 +122,109 @@ var (
 		"UNTIL":      UNTIL,
 		"RELEASE":    RELEASE,
 		"GLOBALLY":   GLOBALLY,
+		"SCOPE":      SCOPE,
+		"LET":        LET,
+		"IN":         IN,
+		"=":          ASSIGN,
+		// Symbolic spellings.
+		"!":  NOT,
+		"&":  AND,
+		"&&": AND,
+		"|":  OR,
+		"||": OR,
+		"U":  UNTIL,
+		"R":  RELEASE,
+		"G":  GLOBALLY,
+		"F":  EVENTUALLY,
+		"X":  NEXT,
 	}
-	// OpenParen is a default open-parenthesis symbol.
+	// OpenParen is a default open-parenthesis symbol.  NewLexer uses the
+	// values of OpenParen and CloseParen at the time of its call unless the
+	// WithParens option is provided.
 	OpenParen rune = '('
 	// CloseParen is a default close-parenthesis symbol.
 	CloseParen rune = ')'
-	// OpenBracket is a default open-bracket symbol.  In this lexer, brackets
+	// OpenBracket is a default open-bracket symbol.  NewLexer uses the values
+	// of OpenBracket and CloseBracket at the time of its call unless the
+	// WithBrackets option is provided.  In this lexer, brackets
 	// enclose text to be sent to a 'matcher' (a terminal ltl.Operator).  This
-	// text may itself contain brackets, but they must be balanced.
+	// text may itself contain brackets, but they must be balanced unless
+	// escaped with a backslash, as in '[a\]]'.  A backslash also escapes
+	// another backslash; escaping backslashes are removed from the text sent to
+	// the matcher, but others, such as the '\' in '[\$a]', are left in place.
 	OpenBracket rune = '['
 	// CloseBracket is a default close-bracket symbol.
 	CloseBracket rune = ']'
+	// TagMarker is a default tag symbol.  Immediately following a matcher's
+	// close bracket, it introduces a label, made of letters, digits, '_', and
+	// '-', attached with tags.Label to the matcher's matching Environments.  A
+	// matcher may carry several tags, as in '[error]#critical#page'.
+	TagMarker rune = '#'
+	// LineCommentMarkers are default markers introducing comments that extend
+	// to the end of the line.  Since a TagMarker immediately following a
+	// matcher's close bracket introduces a tag, a '#' comment following a
+	// matcher must be separated from it by whitespace.
+	LineCommentMarkers = []string{"#", "//"}
+	// BlockCommentStart and BlockCommentEnd are default markers enclosing
+	// comments, which may span lines.
+	BlockCommentStart = "/*"
+	// BlockCommentEnd ends a comment begun with BlockCommentStart.
+	BlockCommentEnd = "*/"
+	// FormulaSeparator is a default symbol separating the formulas of a
+	// document parsed with ParseAll.  Outside of parentheses, newlines also
+	// separate formulas.
+	FormulaSeparator rune = ';'
+	// DefinitionMarker is a default symbol separating the name of a formula in
+	// a document parsed with ParseAll from its expression.
+	DefinitionMarker = ":="
 )
 
 // Lexer is a lexer used by ParseLTL to parse expression strings into LTL
 // Operations.
 type Lexer struct {
-	r                    *bufio.Reader
-	matcherGenerator     func(string) (ltl.Operator, error)
+	r *bufio.Reader
+	// openParen and closeParen delimit parenthesized subexpressions, and
+	// openBracket and closeBracket the matchers generated by the matcher
+	// generator provided to NewLexer.
+	openParen, closeParen     rune
+	openBracket, closeBracket rune
+	// matchers maps the open rune of each kind of matcher to its
+	// description; closers holds the distinct close runes.
+	matchers             map[rune]*matcherKind
+	closers              map[rune]bool
 	rootPrefixTree       *prefixNode
 	currentPrefixTree    *prefixNode
 	lastTokenStartOffset int
 	offset               int
-	op                   ltl.Operator
+	trackLocations       bool
+	caseInsensitive      bool
+	// If document is true, the receiver is lexing a document of named
+	// formulas, and a FormulaSeparator or newline outside of parentheses ends
+	// the current formula.  depth is the current parenthesis depth.
+	document bool
+	depth    int
+	// names holds every formula name the receiver may lex as an IDENT: those
+	// provided to Define and those following a LET.  If expectName is true,
+	// the next word is such a name, following a LET.  formulas holds those
+	// provided to Define.
+	names      map[string]bool
+	expectName bool
+	formulas   map[string]ltl.Operator
+	// operators holds the custom operators the receiver lexes, by keyword.
+	operators map[string]*OperatorDef
+	// If boundable is true, the last token was a keyword, like EVENTUALLY,
+	// that may be immediately followed by bounds.
+	boundable bool
+	// source holds the input read so far.
+	source strings.Builder
+	// If recovering is true, the receiver continues past errors, collecting
+	// them in diagnostics.  lexFailed is true if the last call to Lex
+	// reported a lexing error.
+	recovering  bool
+	diagnostics ErrorList
+	lexFailed   bool
+	// node is the syntax tree of the last parsed expression.
+	node *Node
 	// yyLexer.Lex returns only an int, not also an error.  So, to signal a
 	// lexing error, Lexer::Lex must set an error (to be retrieved later with
 	// Lexer::Error).  If Lex sets a non-nil error, it should immediately return
@@ -151,24 +233,170 @@ type Lexer struct {
 }
 
 // NewLexer returns a new lexer, using the token set in tokens, and the
-// matcherGenerator function to convert matcher strings to Operators.
-func NewLexer(tokens map[string]int, matcherGenerator func(string) (ltl.Operator, error), r *bufio.Reader) (*Lexer, error) {
+// matcherGenerator function to convert matcher strings to Operators.  If only
+// syntax trees are to be parsed, with ParseAST, matcherGenerator may be nil.
+func NewLexer(tokens map[string]int, matcherGenerator func(string) (ltl.Operator, error), r *bufio.Reader, opts ...func(l *Lexer)) (*Lexer, error) {
+	l := &Lexer{
+		matchers:     map[rune]*matcherKind{},
+		closers:      map[rune]bool{},
+		openParen:    OpenParen,
+		closeParen:   CloseParen,
+		openBracket:  OpenBracket,
+		closeBracket: CloseBracket,
+		offset:       0,
+		names:        map[string]bool{},
+		formulas:     map[string]ltl.Operator{},
+		operators:    map[string]*OperatorDef{},
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	if l.matchers[l.openBracket] == nil {
+		Matchers(l.openBracket, l.closeBracket, matcherGenerator)(l)
+	}
+	if len(l.operators) > 0 {
+		withOperators := make(map[string]int, len(tokens)+len(l.operators))
+		for str, value := range tokens {
+			withOperators[str] = value
+		}
+		for keyword, def := range l.operators {
+			if _, ok := tokens[keyword]; ok {
+				return nil, fmt.Errorf("custom operator %s conflicts with a token", keyword)
+			}
+			withOperators[keyword] = precedenceTokens[def.Precedence]
+		}
+		tokens = withOperators
+	}
+	if l.caseInsensitive {
+		upper := map[string]int{}
+		for str, value := range tokens {
+			str = strings.ToUpper(str)
+			if prev, ok := upper[str]; ok && prev != value {
+				return nil, fmt.Errorf("token %s has conflicting case-insensitive definitions", str)
+			}
+			upper[str] = value
+		}
+		tokens = upper
+	}
 	p, err := newPrefixTree(tokens)
 	if err != nil {
 		return nil, err
 	}
-	return &Lexer{
-		r:                 r,
-		matcherGenerator:  matcherGenerator,
-		rootPrefixTree:    p,
-		currentPrefixTree: p,
-		offset:            0,
-	}, nil
+	l.rootPrefixTree, l.currentPrefixTree = p, p
+	// Record the input as it is read, to describe the positions of errors.
+	l.r = bufio.NewReader(io.TeeReader(r, &l.source))
+	return l, nil
+}
+
+// CaseInsensitiveKeywords specifies that keywords are matched regardless of
+// case, so that 'eventually [a] then [b]' parses.  Single-letter keywords,
+// like 'X' for NEXT, then also match their lower-case letters, which can thus
+// no longer name formulas.  Formula names remain case-sensitive.
+func CaseInsensitiveKeywords() func(l *Lexer) {
+	return func(l *Lexer) {
+		l.caseInsensitive = true
+	}
+}
+
+// fold returns the provided rune as it appears in the receiver's keyword
+// prefix tree.
+func (l *Lexer) fold(r rune) rune {
+	if l.caseInsensitive {
+		return unicode.ToUpper(r)
+	}
+	return r
+}
+
+// isKeyword returns true if the provided word is a token in the receiver's
+// token set, such as a keyword or a custom operator.
+func (l *Lexer) isKeyword(word string) bool {
+	folded := strings.Map(l.fold, word)
+	return l.rootPrefixTree.lookup(folded) != yyErrCode
+}
+
+// matcherKind describes one kind of matcher: its close delimiter, and the
+// function converting its text to Operators.
+type matcherKind struct {
+	close            rune
+	matcherGenerator func(string) (ltl.Operator, error)
+}
+
+// Matchers specifies that text enclosed by the provided open and close runes
+// is a matcher, to be converted to an Operator by the provided
+// matcherGenerator, so that several kinds of matcher, such as '[...]' string
+// matchers and '/.../' regular expressions, can be mixed in one expression.
+// Matchers with distinct open and close runes may nest, if balanced; those
+// with the same open and close rune may contain it only when escaped.  As in
+// bracketed matchers, a backslash escapes the open rune, the close rune, or
+// another backslash, and is removed from the text provided to
+// matcherGenerator; other backslashes are left in place.  Since a '#' comment or a tag may follow a matcher, and '//' and
+// '/*' begin comments, '#' may not delimit matchers, and a '/'-delimited
+// matcher may not begin with '/' or '*'.
+func Matchers(open, close rune, matcherGenerator func(string) (ltl.Operator, error)) func(l *Lexer) {
+	return func(l *Lexer) {
+		l.matchers[open] = &matcherKind{close, matcherGenerator}
+		if open != close {
+			l.closers[close] = true
+		}
+	}
+}
+
+// TrackLocations specifies whether the matchers the receiver lexes are wrapped
+// with operators.Located, so that the errors they produce while matching
+// identify where in the expression they were written.  Since static analyses
+// and transformations generally do not handle Located Operators, it is off by
+// default.
+func (l *Lexer) TrackLocations(track bool) {
+	l.trackLocations = track
+}
+
+// Recover specifies whether ParseLTL, using the receiver, continues past
+// syntax errors, resynchronizing at the next token that can follow an
+// expression, such as a binary keyword or a close parenthesis, to report all
+// syntax errors in an expression at once, as an ErrorList.  It is off by
+// default.
+func (l *Lexer) Recover(recover bool) {
+	l.recovering = recover
 }
 
 // Lex consumes input until a token has been identified, and returns it.  It
 // updates the provided lvalue with any token data.
 func (l *Lexer) Lex(lvalue *yySymType) int {
+	l.lexFailed = false
+	if !l.recovering {
+		if l.err != nil {
+			// Stop parsing at the first error.
+			return -1
+		}
+		tok := l.lex(lvalue)
+		lvalue.pos = l.lastTokenStartOffset
+		return tok
+	}
+	prevErr := l.err
+	l.err = nil
+	tok := l.lex(lvalue)
+	lvalue.pos = l.lastTokenStartOffset
+	lexErr := l.err
+	l.err = prevErr
+	if lexErr != nil {
+		l.report(lexErr, l.lastTokenStartOffset)
+		l.lexFailed = true
+		// Skip the rest of the offending word, so it isn't reported again.
+		if !l.skipWord() {
+			return -1
+		}
+		return yyErrCode
+	}
+	return tok
+}
+
+func (l *Lexer) lex(lvalue *yySymType) int {
+	if l.boundable {
+		l.boundable = false
+		if tok, ok := l.lexBounds(lvalue); ok {
+			return tok
+		}
+	}
 	var r rune
 	var c int
 	var err error
@@ -184,97 +412,562 @@ func (l *Lexer) Lex(lvalue *yySymType) int {
 			l.err = fmt.Errorf("read error at offset %d: %s", l.offset, err)
 			return yyErrCode
 		}
-		if !unicode.Is(unicode.White_Space, r) {
+		if l.document && l.depth == 0 && (r == FormulaSeparator || r == '\n') {
+			return -1
+		}
+		if unicode.Is(unicode.White_Space, r) {
+			continue
+		}
+		skipped, ok := l.skipComment(r)
+		if !ok {
+			return yyErrCode
+		}
+		if !skipped {
 			break
 		}
 	}
 	l.lastTokenStartOffset = l.offset - 1
 	switch {
-	case r == OpenParen:
+	case r == l.openParen:
+		l.depth++
 		return LPAREN
-	case r == CloseParen:
+	case r == l.closeParen:
+		l.depth--
 		return RPAREN
-	case r == OpenBracket:
-		matcherStr := ""
-		bracketDepth := 1
+	case l.matchers[r] != nil:
+		return l.lexMatcher(r, lvalue)
+	case r == '"':
+		return l.lexQuoted(lvalue)
+	case l.closers[r]:
+		l.err = fmt.Errorf("unexpected '%c' at offset %d", r, l.offset)
+		return yyErrCode
+	case unicode.IsDigit(r) || r == '-' && l.digitFollows():
+		return l.lexNumber(string(r), lvalue)
+	default:
+		l.r.UnreadRune()
+		l.offset -= c
+		var prev rune
+		word := ""
 		for {
-			if bracketDepth == 0 {
-				matcherStr = strings.TrimSuffix(matcherStr, "]")
-				break
+			r, c, err := l.r.ReadRune()
+			if err != nil && err != io.EOF {
+				l.err = fmt.Errorf("read error at offset %d: %s", l.offset, err)
+				return yyErrCode
+			}
+			// kw is nil once word can only be a formula name.
+			kw := l.currentPrefixTree
+			complete := (kw != nil && kw.value != yyErrCode) || l.isName(word)
+			extendable := (kw != nil && kw.advance(l.fold(r)) != nil) || l.isNamePrefix(word+string(r))
+			// A keyword ends at whitespace or EOF, or, if it can't be extended,
+			// wherever a symbolic rune, like a parenthesis, bracket, or the '!'
+			// of a symbolic keyword, meets a word rune or another symbolic rune.
+			// So neither 'NOT([a])' nor '![a]' require whitespace.
+			delimited := err == nil &&
+				(isSymbolRune(prev) || isSymbolRune(r)) &&
+				complete && !extendable
+			if err == io.EOF || unicode.Is(unicode.White_Space, r) || delimited {
+				if err == nil {
+					l.r.UnreadRune()
+				}
+				l.currentPrefixTree = l.rootPrefixTree
+				return l.lexWord(word, kw, lvalue)
 			}
-			r, c, err = l.r.ReadRune()
-			if err == io.EOF {
-				l.err = fmt.Errorf("unexpected EOF at offset %d", l.offset)
+			if !extendable {
+				l.offset += c
+				l.currentPrefixTree = l.rootPrefixTree
+				l.err = fmt.Errorf("lexing error at offset %d: %w %q", l.offset, ErrUnknownKeyword, word+string(r))
 				return yyErrCode
 			}
 			l.offset += c
-			switch r {
-			case OpenBracket:
-				bracketDepth++
-			case CloseBracket:
-				bracketDepth--
+			if kw != nil {
+				l.currentPrefixTree = kw.advance(l.fold(r))
+			}
+			word += string(r)
+			prev = r
+		}
+	}
+}
+
+// lexWord returns the token for the provided complete word, whose keyword
+// prefixNode, if any, is kw, updating the provided lvalue with any token data.
+func (l *Lexer) lexWord(word string, kw *prefixNode, lvalue *yySymType) int {
+	ret := yyErrCode
+	if kw != nil {
+		ret = kw.value
+	}
+	if l.expectName {
+		valid := ret == yyErrCode && l.isName(word)
+		l.expectName = false
+		if !valid {
+			l.err = fmt.Errorf("invalid formula name %q ending at offset %d", word, l.offset)
+			return yyErrCode
+		}
+		l.names[word] = true
+		lvalue.name = word
+		return IDENT
+	}
+	switch {
+	case ret == SCOPE:
+		return l.lexScopeNames(lvalue)
+	case ret == LET:
+		l.expectName = true
+	case ret == EVENTUALLY || ret == GLOBALLY || ret == UNTIL:
+		l.boundable = true
+	case ret == UNTIL_LIKE || ret == THEN_LIKE || ret == AND_LIKE || ret == EVENTUALLY_LIKE || ret == NOT_LIKE:
+		lvalue.name = word
+	case ret == yyErrCode && l.names[word]:
+		lvalue.name = word
+		return IDENT
+	case ret == yyErrCode:
+		l.err = fmt.Errorf("lexing error at offset %d: %w %q", l.offset, ErrUnknownKeyword, word)
+	}
+	return ret
+}
+
+// skipComment consumes the comment begun by the provided, already-read rune,
+// if any, returning true if a comment was skipped.  It returns false for its
+// second return value if a lexing error occurred.
+func (l *Lexer) skipComment(r rune) (skipped, ok bool) {
+	for _, marker := range LineCommentMarkers {
+		if l.startsMarker(r, marker) {
+			return true, l.skipThrough("\n", true)
+		}
+	}
+	if l.startsMarker(r, BlockCommentStart) {
+		return true, l.skipThrough(BlockCommentEnd, false)
+	}
+	return false, true
+}
+
+// startsMarker returns true if the provided, already-read rune, followed by
+// the unread input, begins with the provided marker.  If so, the rest of the
+// marker is consumed.
+func (l *Lexer) startsMarker(r rune, marker string) bool {
+	if marker == "" || !strings.HasPrefix(marker, string(r)) {
+		return false
+	}
+	rest := marker[len(string(r)):]
+	if peeked, err := l.r.Peek(len(rest)); err != nil || string(peeked) != rest {
+		return false
+	}
+	l.r.Discard(len(rest))
+	l.offset += len(rest)
+	return true
+}
+
+// skipThrough consumes input through the next occurrence of the provided
+// terminator, returning false if a lexing error occurred.  If line is true, the
+// comment is a line comment: its terminating newline is left unread, so that it
+// can end a formula in a document, and reaching EOF is not an error.
+func (l *Lexer) skipThrough(terminator string, line bool) bool {
+	consumed := ""
+	for !strings.HasSuffix(consumed, terminator) {
+		r, c, err := l.r.ReadRune()
+		if err == io.EOF {
+			if line {
+				return true
+			}
+			l.err = fmt.Errorf("unterminated comment at offset %d", l.offset)
+			return false
+		}
+		if err != nil {
+			l.err = fmt.Errorf("read error at offset %d: %s", l.offset, err)
+			return false
+		}
+		if line && r == '\n' {
+			l.r.UnreadRune()
+			return true
+		}
+		l.offset += c
+		// Only the tail of the comment, as long as the terminator, is needed.
+		consumed += string(r)
+		if len(consumed) > len(terminator) {
+			consumed = consumed[len(consumed)-len(terminator):]
+		}
+	}
+	return true
+}
+
+// lexMatcher consumes the text of a matcher following the provided open
+// rune, setting its MatcherNode in the provided lvalue and returning MATCHER, or
+// yyErrCode if a lexing error occurred.
+func (l *Lexer) lexMatcher(open rune, lvalue *yySymType) int {
+	kind := l.matchers[open]
+	matcherStr := ""
+	depth := 1
+	escaped := false
+	for depth > 0 {
+		r, c, err := l.r.ReadRune()
+		if err == io.EOF {
+			l.err = fmt.Errorf("unexpected EOF at offset %d", l.offset)
+			return yyErrCode
+		}
+		if err != nil {
+			l.err = fmt.Errorf("read error at offset %d: %s", l.offset, err)
+			return yyErrCode
+		}
+		l.offset += c
+		switch {
+		case escaped:
+			escaped = false
+			// Other escape sequences are left for the matcher generator.
+			if r != open && r != kind.close && r != '\\' {
+				matcherStr += "\\"
 			}
+		case r == '\\':
+			escaped = true
+			continue
+		case r == kind.close:
+			depth--
+		case r == open:
+			depth++
+		}
+		if depth > 0 {
 			matcherStr += string(r)
 		}
-		op, err := l.matcherGenerator(matcherStr)
+	}
+	return l.matcherNode(open, kind.close, matcherStr, kind.matcherGenerator, lvalue)
+}
+
+// lexQuoted consumes a quoted string literal, with Go-style escapes,
+// following a '"', setting its MatcherNode in the provided lvalue and
+// returning MATCHER, or yyErrCode if a lexing error occurred.  Its text is
+// matched literally by the bracketed matchers' generator.
+func (l *Lexer) lexQuoted(lvalue *yySymType) int {
+	escaped := false
+	for {
+		r, c, err := l.r.ReadRune()
+		if err == io.EOF || r == '\n' {
+			l.err = fmt.Errorf("unterminated string literal at offset %d", l.offset)
+			return yyErrCode
+		}
+		if err != nil {
+			l.err = fmt.Errorf("read error at offset %d: %s", l.offset, err)
+			return yyErrCode
+		}
+		l.offset += c
+		if escaped {
+			escaped = false
+		} else if r == '\\' {
+			escaped = true
+		} else if r == '"' {
+			break
+		}
+	}
+	text, err := strconv.Unquote(l.source.String()[l.lastTokenStartOffset:l.offset])
+	if err != nil {
+		l.err = fmt.Errorf("invalid string literal ending at offset %d: %s", l.offset, err)
+		return yyErrCode
+	}
+	var gen func(string) (ltl.Operator, error)
+	if kind := l.matchers[l.openBracket]; kind != nil && kind.matcherGenerator != nil {
+		gen = func(s string) (ltl.Operator, error) {
+			return kind.matcherGenerator(literal(s))
+		}
+	}
+	return l.matcherNode('"', '"', text, gen, lvalue)
+}
+
+// literal returns the provided matcher text with a leading '$' or '@', which
+// would otherwise bind or reference, escaped.
+func literal(text string) string {
+	if strings.HasPrefix(text, "$") || strings.HasPrefix(text, "@") {
+		return "\\" + text
+	}
+	return text
+}
+
+// matcherNode creates a MatcherNode, ending at the current offset, with the
+// provided delimiters and text, generating its Operator with the provided
+// matcher generator, if any.  It then consumes any tags following the matcher,
+// setting the MatcherNode in the provided lvalue and returning MATCHER, or
+// yyErrCode if an error occurred.
+func (l *Lexer) matcherNode(open, close rune, text string, gen func(string) (ltl.Operator, error), lvalue *yySymType) int {
+	n := l.newNode(MatcherNode, l.lastTokenStartOffset)
+	n.Text = text
+	n.Open, n.Close = open, close
+	n.raw = l.source.String()[l.lastTokenStartOffset:l.offset]
+	if gen != nil {
+		op, err := gen(text)
 		if err != nil {
 			l.err = fmt.Errorf("failed to create matcher ending at offset %d: %s", l.offset, err)
 			return yyErrCode
 		}
-		lvalue.op = op
-		return MATCHER
-	case r == CloseBracket:
-		l.err = fmt.Errorf("unexpected '%c' at offset %d", CloseBracket, l.offset)
+		n.op = op
+	}
+	ts, ok := l.lexTags()
+	if !ok {
 		return yyErrCode
-	case unicode.IsDigit(r):
-		l.r.UnreadRune()
-		var num string
-		for {
-			r, c, err := l.r.ReadRune()
-			if err != nil && err != io.EOF {
-				l.err = fmt.Errorf("read error at offset %d: %s", l.offset, err)
-				return yyErrCode
-			}
-			if !unicode.IsDigit(r) {
+	}
+	n.Tags = ts
+	lvalue.node = n
+	return MATCHER
+}
+
+// digitFollows returns true if the next unread rune, following the
+// single-byte rune just read, is a decimal digit.
+func (l *Lexer) digitFollows() bool {
+	// Peeking prevents unreading, so peek from before the rune just read,
+	// then read it again.
+	l.r.UnreadRune()
+	next, err := l.r.Peek(2)
+	l.r.ReadRune()
+	return err == nil && next[1] >= '0' && next[1] <= '9'
+}
+
+var decimalRE = regexp.MustCompile(`^-?[0-9]+(_[0-9]+)*$`)
+
+// parseNumber parses a numeric literal: a decimal or, with a '0x' prefix,
+// hexadecimal integer, optionally negative, whose digits may be separated by
+// single underscores.
+func parseNumber(s string) (int64, error) {
+	unsigned := strings.TrimPrefix(s, "-")
+	if strings.HasPrefix(unsigned, "0x") || strings.HasPrefix(unsigned, "0X") {
+		return strconv.ParseInt(s, 0, 64)
+	}
+	if !decimalRE.MatchString(s) {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	return strconv.ParseInt(strings.ReplaceAll(s, "_", ""), 10, 64)
+}
+
+// lexNumber consumes the remainder of a numeric literal, or of a range
+// literal such as '3..7', whose already-read first rune is lit, setting it
+// in the provided lvalue and returning NUM or RANGE, or yyErrCode if a lexing
+// error occurred.
+func (l *Lexer) lexNumber(lit string, lvalue *yySymType) int {
+	for {
+		r, c, err := l.r.ReadRune()
+		if err != nil && err != io.EOF {
+			l.err = fmt.Errorf("read error at offset %d: %s", l.offset, err)
+			return yyErrCode
+		}
+		// A '-' may also begin a range's upper bound.
+		numeric := unicode.IsDigit(r) || unicode.IsLetter(r) || r == '_' || r == '.' ||
+			r == '-' && strings.HasSuffix(lit, "..")
+		if err == io.EOF || !numeric {
+			if err == nil {
 				l.r.UnreadRune()
 			}
-			if err == io.EOF || !unicode.IsDigit(r) {
-				lvalue.num, err = strconv.ParseInt(num, 10, 64)
-				if err != nil {
-					l.err = fmt.Errorf("failed to parse number %s: %s", num, err)
-					return yyErrCode
-				}
-				return NUM
-			}
-			l.offset += c
-			num = num + string(r)
+			break
+		}
+		l.offset += c
+		lit += string(r)
+	}
+	if idx := strings.Index(lit, ".."); idx >= 0 {
+		lo, loErr := parseNumber(lit[:idx])
+		hi, hiErr := parseNumber(lit[idx+2:])
+		if loErr != nil || hiErr != nil || lo > hi {
+			l.err = fmt.Errorf("invalid range %s ending at offset %d", lit, l.offset)
+			return yyErrCode
+		}
+		lvalue.bounds = [2]int64{lo, hi}
+		return RANGE
+	}
+	num, err := parseNumber(lit)
+	if err != nil {
+		l.err = fmt.Errorf("failed to parse number %s: %s", lit, err)
+		return yyErrCode
+	}
+	lvalue.num = num
+	return NUM
+}
+
+// ErrUnknownKeyword is wrapped by the errors reported for words that are
+// neither keywords nor formula names.
+var ErrUnknownKeyword = errors.New("unknown keyword")
+
+// BoundsMarker introduces an upper bound, such as the '<=5' of
+// 'EVENTUALLY<=5 [a]'.
+var BoundsMarker = "<="
+
+// OpenBounds and CloseBounds enclose a range of bounds, such as the '{3..7}'
+// of 'GLOBALLY{3..7} [a]'.
+var OpenBounds, CloseBounds rune = '{', '}'
+
+// maxBoundsLen is the longest bounds, including any whitespace preceding
+// them, that the lexer looks ahead for.
+const maxBoundsLen = 64
+
+var rangeRE = regexp.MustCompile(`^-?[0-9][0-9A-Za-z_]*\.\.-?[0-9][0-9A-Za-z_]*`)
+
+// WithParens is an option for NewLexer, setting the runes delimiting
+// parenthesized subexpressions, and SCOPE names, in place of OpenParen and
+// CloseParen.
+func WithParens(open, close rune) func(l *Lexer) {
+	return func(l *Lexer) {
+		l.openParen, l.closeParen = open, close
+	}
+}
+
+// WithBrackets is an option for NewLexer, setting the runes delimiting the
+// matchers generated by its matcher generator, in place of OpenBracket and
+// CloseBracket.
+func WithBrackets(open, close rune) func(l *Lexer) {
+	return func(l *Lexer) {
+		l.openBracket, l.closeBracket = open, close
+	}
+}
+
+// lexBounds consumes the bounds, if any, following a bounded keyword, possibly
+// after whitespace: either a BoundsMarker and an upper bound, or a range
+// literal between OpenBounds and CloseBounds.  Bounds take precedence over any
+// matcher or parenthesized subexpression sharing their delimiters.  If bounds
+// were found, lexBounds returns true and either BOUND, setting them in the
+// provided lvalue, or yyErrCode if they were invalid.
+func (l *Lexer) lexBounds(lvalue *yySymType) (int, bool) {
+	peeked, _ := l.r.Peek(maxBoundsLen)
+	ahead := strings.TrimLeftFunc(string(peeked), unicode.IsSpace)
+	space := len(peeked) - len(ahead)
+	open, close := string(OpenBounds), string(CloseBounds)
+	isRange := func() bool {
+		if !strings.HasPrefix(ahead, open) {
+			return false
 		}
+		rng := rangeRE.FindString(ahead[len(open):])
+		return rng != "" && strings.HasPrefix(ahead[len(open)+len(rng):], close)
+	}
+	var marker int
+	switch {
+	case strings.HasPrefix(ahead, BoundsMarker):
+		marker = len(BoundsMarker)
+	case isRange():
+		marker = len(open)
 	default:
-		l.r.UnreadRune()
+		return 0, false
+	}
+	l.r.Discard(space)
+	l.offset += space
+	l.lastTokenStartOffset = l.offset
+	l.r.Discard(marker)
+	l.offset += marker
+	r, c, err := l.r.ReadRune()
+	if err != nil || !(unicode.IsDigit(r) || r == '-') {
+		l.err = fmt.Errorf("missing bound at offset %d", l.offset)
+		return yyErrCode, true
+	}
+	l.offset += c
+	tok := l.lexNumber(string(r), lvalue)
+	switch {
+	case tok == NUM && marker == len(BoundsMarker):
+		lvalue.bounds = [2]int64{0, lvalue.num}
+		return BOUND, true
+	case tok == RANGE && marker == len(open):
+		// The closing delimiter follows the range literal.
+		l.r.Discard(len(close))
+		l.offset += len(close)
+		return BOUND, true
+	case tok == yyErrCode:
+		return tok, true
+	}
+	l.err = fmt.Errorf("invalid bounds ending at offset %d", l.offset)
+	return yyErrCode, true
+}
+
+// lexScopeNames consumes the parenthesized, comma-separated list of names,
+// such as '($a, $b)', following a SCOPE keyword, setting them in the provided
+// lvalue and returning SCOPE, or yyErrCode if a lexing error occurred.
+func (l *Lexer) lexScopeNames(lvalue *yySymType) int {
+	list := ""
+	open := false
+	for {
+		r, c, err := l.r.ReadRune()
+		if err == io.EOF {
+			l.err = fmt.Errorf("unexpected EOF in SCOPE names at offset %d", l.offset)
+			return yyErrCode
+		}
+		if err != nil {
+			l.err = fmt.Errorf("read error at offset %d: %s", l.offset, err)
+			return yyErrCode
+		}
+		l.offset += c
+		if !open {
+			if r == l.openParen {
+				open = true
+			} else if !unicode.Is(unicode.White_Space, r) {
+				l.err = fmt.Errorf("expected '%c' after SCOPE at offset %d", l.openParen, l.offset)
+				return yyErrCode
+			}
+			continue
+		}
+		if r == l.closeParen {
+			break
+		}
+		list += string(r)
+	}
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if !strings.HasPrefix(name, "$") || len(name) == 1 {
+			l.err = fmt.Errorf("invalid SCOPE name %q ending at offset %d", name, l.offset)
+			return yyErrCode
+		}
+		names = append(names, strings.TrimPrefix(name, "$"))
+	}
+	lvalue.names = names
+	return SCOPE
+}
+
+// lexTags consumes any tags immediately following a matcher, returning their
+// labels and true, or false if a lexing error occurred.
+func (l *Lexer) lexTags() ([]string, bool) {
+	var ret []string
+	for {
+		r, c, err := l.r.ReadRune()
+		if err == io.EOF {
+			return ret, true
+		}
+		if err != nil {
+			l.err = fmt.Errorf("read error at offset %d: %s", l.offset, err)
+			return nil, false
+		}
+		if r != TagMarker {
+			l.r.UnreadRune()
+			return ret, true
+		}
+		l.offset += c
+		name := ""
 		for {
 			r, c, err := l.r.ReadRune()
 			if err != nil && err != io.EOF {
 				l.err = fmt.Errorf("read error at offset %d: %s", l.offset, err)
-				return yyErrCode
+				return nil, false
 			}
-			if err == io.EOF || unicode.Is(unicode.White_Space, r) {
-				ret := l.currentPrefixTree.value
-				l.currentPrefixTree = l.rootPrefixTree
-				return ret
-			}
-			next := l.currentPrefixTree.advance(r)
-			if next == nil {
-				l.err = fmt.Errorf("lexing error at offset %d", l.offset)
-				return yyErrCode
+			if err == io.EOF || !isTagRune(r) {
+				if err == nil {
+					l.r.UnreadRune()
+				}
+				break
 			}
 			l.offset += c
-			l.currentPrefixTree = next
+			name += string(r)
+		}
+		if name == "" {
+			l.err = fmt.Errorf("empty tag at offset %d", l.offset)
+			return nil, false
 		}
+		ret = append(ret, name)
 	}
 }
 
+// isSymbolRune returns true if r is neither whitespace nor a word rune, like
+// those of 'NOT' or 'AND'.  Symbolic runes include delimiters and those of
+// symbolic keywords like '!' or '&&'.
+func isSymbolRune(r rune) bool {
+	return r != 0 && !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' &&
+		!unicode.Is(unicode.White_Space, r)
+}
+
+func isTagRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-'
+}
+
 func (l *Lexer) Error(e string) {
-	l.err = fmt.Errorf("parse error at offset %d: %s", l.offset, e)
+	if l.lexFailed {
+		// Lex has already reported the error.
+		return
+	}
+	l.report(fmt.Errorf("parse error at offset %d: %s", l.offset, e), l.lastTokenStartOffset)
 }
 
 // Offset returns the current offset of the receiving Lexer.  After ParseLTL(),
@@ -0,0 +1,295 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/ilhamster/ltl/pkg/binder"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	ops "github.com/ilhamster/ltl/pkg/operators"
+	"strings"
+)
+
+// DiagnosticKind identifies the kind of problem a Diagnostic describes.
+type DiagnosticKind int
+
+const (
+	// BindingDiagnostic warns of a binder that may be evaluated repeatedly.
+	BindingDiagnostic DiagnosticKind = iota
+	// SyntaxDiagnostic reports an expression that cannot be lexed or parsed.
+	SyntaxDiagnostic
+	// KeywordDiagnostic reports a word that is neither a keyword nor a
+	// formula name.
+	KeywordDiagnostic
+	// MatcherDiagnostic reports matcher text the matcher generator rejects.
+	MatcherDiagnostic
+	// ArgumentDiagnostic reports a LIMIT count or bounds out of range.
+	ArgumentDiagnostic
+)
+
+// Severity is the severity of a Diagnostic.
+type Severity int
+
+const (
+	// SeverityWarning marks a risky, but valid, expression.
+	SeverityWarning Severity = iota
+	// SeverityError marks an expression that cannot be converted into an
+	// Operator.
+	SeverityError
+)
+
+// Diagnostic describes a problem with an expression: an error, as returned
+// by Check, or a warning about a risky pattern, as returned by Check and
+// Lint.
+type Diagnostic struct {
+	Kind     DiagnosticKind
+	Severity Severity
+	// Pos is the position of the problem in the expression.  It is unset in
+	// the Diagnostics returned by Lint, which has no expression.
+	Pos Position
+	// Binder is the binding Operator at issue in a BindingDiagnostic, e.g.
+	// '[$a<-]'.
+	Binder string
+	// Within is the enclosing subexpression that may evaluate Binder
+	// repeatedly.
+	Within string
+	// Message describes the problem.
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	var ret string
+	if d.Pos.Line > 0 {
+		ret = d.Pos.String() + ": "
+	}
+	if d.Kind == BindingDiagnostic {
+		return ret + fmt.Sprintf("%s in %s: %s", d.Binder, d.Within, d.Message)
+	}
+	return ret + d.Message
+}
+
+// ParseLTLWithDiagnostics parses an expression like ParseLTL, also returning
+// Diagnostics about risky binding patterns found in the parsed expression.
+func ParseLTLWithDiagnostics(l *Lexer) (ltl.Operator, []Diagnostic, error) {
+	op, err := ParseLTL(l)
+	if err != nil {
+		return nil, nil, err
+	}
+	return op, Lint(op), nil
+}
+
+// Lint returns Diagnostics for each binder in the provided operator tree that
+// may be evaluated repeatedly, and so may bind its key more than once.  When
+// the repeated bindings are conjoined, as under GLOBALLY, on the left of
+// UNTIL, or on the right of RELEASE, differing values produce an Erroring
+// Environment; under EVENTUALLY, or on the right of UNTIL, the value bound
+// depends on which attempt resolves first.  Each binder is reported once, in
+// its innermost such context.
+func Lint(op ltl.Operator) []Diagnostic {
+	var ret []Diagnostic
+	lint(op, nil, "", &ret)
+	return ret
+}
+
+const (
+	conjoinedMsg   = "may bind repeatedly; conflicting values will produce an error"
+	alternativeMsg = "may bind on several attempts; the value bound depends on which resolves first"
+)
+
+func lint(op, within ltl.Operator, msg string, ret *[]Diagnostic) {
+	if op == nil {
+		return
+	}
+	if _, ok := op.(*binder.Binder); ok {
+		if within != nil {
+			*ret = append(*ret, Diagnostic{
+				Binder:  op.String(),
+				Within:  ops.PrettyPrint(within, ops.Inline()),
+				Message: msg,
+			})
+		}
+		return
+	}
+	children := ops.Children(op)
+	for idx, child := range children {
+		childWithin, childMsg := within, msg
+		if m := repeatedMsg(lintKinds[ops.KindOf(op)], idx); m != "" {
+			childWithin, childMsg = op, m
+		}
+		lint(child, childWithin, childMsg, ret)
+	}
+}
+
+// lintKinds maps the kinds of Operator that may evaluate their children
+// repeatedly to the corresponding NodeKinds.
+var lintKinds = map[ops.Kind]NodeKind{
+	ops.GloballyKind:   GloballyNode,
+	ops.EventuallyKind: EventuallyNode,
+	ops.UntilKind:      UntilNode,
+	ops.ReleaseKind:    ReleaseNode,
+}
+
+// repeatedMsg returns the message describing the risk of a binder in the
+// idxth child of an operator of the provided kind, or "" if that child is
+// evaluated only once.
+func repeatedMsg(kind NodeKind, idx int) string {
+	switch kind {
+	case GloballyNode:
+		return conjoinedMsg
+	case EventuallyNode:
+		return alternativeMsg
+	case UntilNode:
+		if idx == 1 {
+			return alternativeMsg
+		}
+		return conjoinedMsg
+	case ReleaseNode:
+		if idx == 1 {
+			return conjoinedMsg
+		}
+	}
+	return ""
+}
+
+// Check validates the provided expression, parsed with DefaultTokens, without
+// converting it into an Operator, and returns Diagnostics for each problem
+// found.  Errors, including every syntax error and unknown keyword, each
+// matcher the provided matcher generator rejects, and each LIMIT count or
+// bounds out of range, are reported as by ParseLTL with recovery enabled; if the expression parses, warnings are also
+// returned for the risky binding patterns Lint reports.  matcherGenerator may
+// be nil, in which case matchers are not checked, nor binders identified.
+// An expression with no Diagnostics of SeverityError parses successfully.
+func Check(expr string, matcherGenerator func(string) (ltl.Operator, error)) []Diagnostic {
+	l, err := NewLexer(DefaultTokens, nil, bufio.NewReader(strings.NewReader(expr)))
+	if err != nil {
+		return []Diagnostic{{Kind: SyntaxDiagnostic, Severity: SeverityError, Message: err.Error()}}
+	}
+	l.Recover(true)
+	n, err := ParseAST(l)
+	if err != nil {
+		el, ok := err.(ErrorList)
+		if !ok {
+			return []Diagnostic{{Kind: SyntaxDiagnostic, Severity: SeverityError, Message: err.Error()}}
+		}
+		var ret []Diagnostic
+		for _, se := range el {
+			kind := SyntaxDiagnostic
+			if errors.Is(se, ErrUnknownKeyword) {
+				kind = KeywordDiagnostic
+			}
+			ret = append(ret, Diagnostic{Kind: kind, Severity: SeverityError, Pos: se.Position, Message: se.Err.Error()})
+		}
+		return ret
+	}
+	c := &checker{gen: matcherGenerator, reported: map[[2]*Node]bool{}}
+	c.check(n, nil, "", true)
+	return c.diags
+}
+
+// checker walks a syntax tree for Check.
+type checker struct {
+	gen    func(string) (ltl.Operator, error)
+	macros []checkedMacro
+	diags  []Diagnostic
+	// reported holds the pairs of binder and context already reported.
+	reported map[[2]*Node]bool
+}
+
+// checkedMacro is a LET definition in scope during a check.
+type checkedMacro struct {
+	name string
+	def  *Node
+}
+
+// check checks the provided Node, which lies within the provided repeating
+// context, if any, with the provided risk message.  If generate is false,
+// the Node's matchers have already been checked, and are generated only to
+// identify binders.
+func (c *checker) check(n, within *Node, msg string, generate bool) {
+	if err := n.checkArgs(); err != nil && generate {
+		c.diags = append(c.diags, Diagnostic{Kind: ArgumentDiagnostic, Severity: SeverityError, Pos: n.ArgPos, Message: err.Error()})
+	}
+	switch n.Kind {
+	case MatcherNode:
+		c.checkMatcher(n, within, msg, generate)
+		return
+	case RefNode:
+		// References are checked in their own context.
+		for idx := len(c.macros) - 1; idx >= 0; idx-- {
+			if c.macros[idx].name == n.Name {
+				macros := c.macros
+				c.macros = c.macros[:idx]
+				c.check(macros[idx].def, within, msg, false)
+				c.macros = macros
+				return
+			}
+		}
+		return
+	case LetNode:
+		c.check(n.Children[0], within, msg, generate)
+		c.macros = append(c.macros, checkedMacro{n.Name, n.Children[0]})
+		c.check(n.Children[1], within, msg, generate)
+		c.macros = c.macros[:len(c.macros)-1]
+		return
+	}
+	for idx, child := range n.Children {
+		childWithin, childMsg := within, msg
+		if m := repeatedMsg(n.Kind, idx); m != "" {
+			childWithin, childMsg = n, m
+		}
+		c.check(child, childWithin, childMsg, generate)
+	}
+}
+
+func (c *checker) checkMatcher(n, within *Node, msg string, generate bool) {
+	if c.gen == nil {
+		return
+	}
+	text := n.Text
+	switch n.Open {
+	case OpenBracket:
+	case '"':
+		text = literal(text)
+	default:
+		// Other kinds of matchers have no generator.
+		return
+	}
+	op, err := c.gen(text)
+	if err != nil {
+		if generate {
+			c.diags = append(c.diags, Diagnostic{
+				Kind:     MatcherDiagnostic,
+				Severity: SeverityError,
+				Pos:      n.Pos,
+				Message:  fmt.Sprintf("invalid matcher %s: %s", n.delimited(), err),
+			})
+		}
+		return
+	}
+	if _, ok := op.(*binder.Binder); !ok || within == nil || c.reported[[2]*Node{n, within}] {
+		return
+	}
+	c.reported[[2]*Node{n, within}] = true
+	c.diags = append(c.diags, Diagnostic{
+		Kind:     BindingDiagnostic,
+		Severity: SeverityWarning,
+		Pos:      n.Pos,
+		Binder:   op.String(),
+		Within:   within.String(),
+		Message:  msg,
+	})
+}
@@ -0,0 +1,61 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"github.com/ilhamster/ltl/pkg/ltl"
+	"strings"
+)
+
+// Define makes the provided Operator available, under the provided name, to
+// expressions subsequently parsed with the receiver: the name may appear
+// wherever a matcher may, and is replaced with the Operator.  ParseAll defines
+// each formula in a document, so that later formulas may refer to earlier
+// ones.  Names defined with LET within an expression take precedence.
+func (l *Lexer) Define(name string, op ltl.Operator) {
+	l.names[name] = true
+	l.formulas[name] = op
+}
+
+// isName returns true if the provided word may be lexed as a formula name:
+// any name may follow a LET, but otherwise only those already defined.
+func (l *Lexer) isName(word string) bool {
+	if l.expectName {
+		return word != "" && isNameString(word)
+	}
+	return l.names[word]
+}
+
+// isNamePrefix returns true if the provided word may begin a formula name.
+func (l *Lexer) isNamePrefix(word string) bool {
+	if l.expectName {
+		return isNameString(word)
+	}
+	for name := range l.names {
+		if strings.HasPrefix(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+func isNameString(s string) bool {
+	for _, r := range s {
+		if !isNameRune(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -16,57 +16,115 @@
 package parser
 import (
     "github.com/ilhamster/ltl/pkg/ltl"
-    ops "github.com/ilhamster/ltl/pkg/operators"
 )
 %}
 
 // yySymType
 %union{
-    op ltl.Operator
+    node *Node
     num int64
+    names []string
+    name string
+    // bounds are the inclusive lower and upper bounds of a RANGE.
+    bounds [2]int64
+    // pos is the offset at which the token begins.
+    pos int
 }
 
-%type <op> line expr
+%type <node> line expr
 
-%token <op> MATCHER
+%token <node> MATCHER
 
 %token <num> NUM
 
-%token LPAREN RPAREN
+%token <bounds> RANGE BOUND
+
+%token <names> SCOPE
+
+%token <name> IDENT
+
+%token <name> UNTIL_LIKE THEN_LIKE AND_LIKE EVENTUALLY_LIKE NOT_LIKE
+
+%token LPAREN RPAREN ASSIGN IN
 
+%nonassoc LET
 %nonassoc LIMIT
 %nonassoc GLOBALLY
-%nonassoc EVENTUALLY
-%left UNTIL RELEASE
-%left THEN SEQUENCE
-%left OR AND
-%left NEXT NOT
+%nonassoc EVENTUALLY EVENTUALLY_LIKE
+%left UNTIL RELEASE UNTIL_LIKE
+%left THEN SEQUENCE THEN_LIKE
+%left OR AND AND_LIKE
+%left NEXT NOT NOT_LIKE
 
 %start line 
 
 %%
 
-line : expr                { setOp(yylex, $1) }
+line : expr                { setNode(yylex, $1) }
      ;
 
 expr : LPAREN expr RPAREN  { $$ = $2 }
      | MATCHER             { $$ = $1 }
-     | NOT expr            { $$ = ops.Not($2) }
-     | NEXT expr           { $$ = ops.Next($2) }
-     | EVENTUALLY expr     { $$ = ops.Eventually($2) }
-     | GLOBALLY expr       { $$ = ops.Globally($2) }
-     | expr LIMIT NUM      { $$ = ops.Limit($3, $1) }
-     | expr OR expr        { $$ = ops.Or($1, $3) }
-     | expr AND expr       { $$ = ops.And($1, $3) }
-     | expr UNTIL expr     { $$ = ops.Until($1, $3) }
-     | expr RELEASE expr   { $$ = ops.Release($1, $3) }
-     | expr THEN expr      { $$ = ops.Then($1, $3) }
+     | error               { $$ = errorNode(yylex) }
+     | IDENT               { $$ = node(yylex, RefNode, $<pos>1); $$.Name = $1 }
+     | LET IDENT ASSIGN expr IN expr %prec LET
+                           { $$ = node(yylex, LetNode, $<pos>1, $4, $6); $$.Name = $2 }
+     | NOT expr            { $$ = node(yylex, NotNode, $<pos>1, $2) }
+     | NEXT expr           { $$ = node(yylex, NextNode, $<pos>1, $2) }
+     | EVENTUALLY expr     { $$ = node(yylex, EventuallyNode, $<pos>1, $2) }
+     | EVENTUALLY BOUND expr %prec EVENTUALLY
+                           { $$ = bounded(yylex, node(yylex, EventuallyNode, $<pos>1, $3), $2, $<pos>2) }
+     | GLOBALLY expr       { $$ = node(yylex, GloballyNode, $<pos>1, $2) }
+     | GLOBALLY BOUND expr %prec GLOBALLY
+                           { $$ = bounded(yylex, node(yylex, GloballyNode, $<pos>1, $3), $2, $<pos>2) }
+     | SCOPE expr %prec NOT { $$ = node(yylex, ScopeNode, $<pos>1, $2); $$.Names = $1 }
+     | expr LIMIT NUM      { $$ = limit(yylex, $1, $3, $<pos>3) }
+     | expr OR expr        { $$ = node(yylex, OrNode, $1.Pos.Offset, $1, $3) }
+     | expr AND expr       { $$ = node(yylex, AndNode, $1.Pos.Offset, $1, $3) }
+     | expr UNTIL expr     { $$ = node(yylex, UntilNode, $1.Pos.Offset, $1, $3) }
+     | expr UNTIL BOUND expr %prec UNTIL
+                           { $$ = bounded(yylex, node(yylex, UntilNode, $1.Pos.Offset, $1, $4), $3, $<pos>3) }
+     | expr RELEASE expr   { $$ = node(yylex, ReleaseNode, $1.Pos.Offset, $1, $3) }
+     | expr THEN expr      { $$ = node(yylex, ThenNode, $1.Pos.Offset, $1, $3) }
+     | EVENTUALLY_LIKE expr { $$ = custom(yylex, $1, $<pos>1, $2) }
+     | NOT_LIKE expr       { $$ = custom(yylex, $1, $<pos>1, $2) }
+     | expr UNTIL_LIKE expr { $$ = custom(yylex, $2, $1.Pos.Offset, $1, $3) }
+     | expr THEN_LIKE expr { $$ = custom(yylex, $2, $1.Pos.Offset, $1, $3) }
+     | expr AND_LIKE expr  { $$ = custom(yylex, $2, $1.Pos.Offset, $1, $3) }
      ;
 
 %%
 
-func setOp(l yyLexer, op ltl.Operator) {
-    l.(*Lexer).op = op
+func setNode(l yyLexer, n *Node) {
+    l.(*Lexer).node = n
+}
+
+func node(l yyLexer, kind NodeKind, offset int, children ...*Node) *Node {
+    return l.(*Lexer).newNode(kind, offset, children...)
+}
+
+func bounded(l yyLexer, n *Node, bounds [2]int64, offset int) *Node {
+    n.Bounds = &bounds
+    n.ArgPos = l.(*Lexer).positionOf(offset)
+    return n
+}
+
+func limit(l yyLexer, child *Node, num int64, offset int) *Node {
+    n := node(l, LimitNode, child.Pos.Offset, child)
+    n.Num = num
+    n.ArgPos = l.(*Lexer).positionOf(offset)
+    return n
+}
+
+func custom(l yyLexer, keyword string, offset int, children ...*Node) *Node {
+    n := node(l, CustomNode, offset, children...)
+    n.Name = keyword
+    n.def = l.(*Lexer).operator(keyword)
+    return n
+}
+
+func errorNode(l yyLexer) *Node {
+    return l.(*Lexer).newNode(ErrorNode, l.(*Lexer).lastTokenStartOffset)
 }
 
 type yyLex struct {
@@ -75,10 +133,23 @@ type yyLex struct {
 }
 
 // ParseLTL parses an expression, lexed by the provided Lexer, into an LTL
-// Operator.
+// Operator.  If the expression cannot be parsed, the returned error is a
+// *SyntaxError or, if the Lexer is recovering from errors, an ErrorList.
 func ParseLTL(l *Lexer) (ltl.Operator, error) {
+    n, err := ParseAST(l)
+    if err != nil {
+        return nil, err
+    }
+    return l.lower(n)
+}
+
+// ParseAST parses an expression, lexed by the provided Lexer, into its syntax
+// tree, which Node.Lower converts into an LTL Operator.  If the Lexer has no
+// matcher generator, matchers are not converted into Operators while lexing.
+// Errors are returned as by ParseLTL.
+func ParseAST(l *Lexer) (*Node, error) {
     yyErrorVerbose = true
     p := &yyParserImpl{}
     p.Parse(l)
-    return l.op, l.err
+    return l.result()
 }
@@ -16,10 +16,20 @@ package parser
 
 import (
 	"bufio"
+	"errors"
+	"fmt"
+	rtok "github.com/ilhamster/ltl/examples/runetoken"
+	"github.com/ilhamster/ltl/examples/signals"
 	"github.com/ilhamster/ltl/examples/stringmatcher"
+	be "github.com/ilhamster/ltl/pkg/bindingenvironment"
 	"github.com/ilhamster/ltl/pkg/ltl"
 	ops "github.com/ilhamster/ltl/pkg/operators"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -65,6 +75,48 @@ func TestParser(t *testing.T) {
 		true,
 		4,
 		5, // After the 'W'
+	}, {
+		"unknown keyword adjacent to a bracket",
+		"[a] ANDY[b]",
+		true,
+		4,
+		8, // After the 'Y'
+	}, {
+		"unterminated comment",
+		"[a] /* AND [b]",
+		true,
+		0,
+		14, // At the end of the input
+	}, {
+		"undefined formula",
+		"(LET a = [a] IN a) AND a",
+		true,
+		23,
+		24, // After the second 'a'
+	}, {
+		"keyword as formula name",
+		"LET AND = [a] IN [b]",
+		true,
+		4,
+		7, // After the 'AND'
+	}, {
+		"unterminated string literal",
+		"[a] AND \"b\nc\"",
+		true,
+		8,
+		10, // After the 'b'
+	}, {
+		"matcher error without whitespace",
+		"NOT([a])AND[$]",
+		true,
+		11,
+		14, // After the [$]
+	}, {
+		"scope names error",
+		"SCOPE(a) [a]",
+		true,
+		0,
+		8, // Past the ')'
 	}}
 	for _, test := range tests {
 		t.Run(test.description, func(t *testing.T) {
@@ -118,6 +170,69 @@ func TestParsingAsString(t *testing.T) {
 	}, {
 		"NOT [a] AND [b]",
 		"AND(NOT([a]),[b])",
+	}, {
+		"[error]#critical THEN [b]#x#y-z",
+		"THEN(TAGGED(#critical)([error]),TAGGED(#x, #y-z)([b]))",
+	}, {
+		"SCOPE($b, $a) [$a<-] THEN [$b]",
+		"THEN(SCOPE($a, $b)([$a<-]),[$b])",
+	}, {
+		"SCOPE ($a) ([$a<-] THEN [$a])",
+		"SCOPE($a)(THEN([$a<-],[$a]))",
+	}, {
+		"![a] && [b] || ![c]",
+		"OR(AND(NOT([a]),[b]),NOT([c]))",
+	}, {
+		"[a]&[b]|[c]",
+		"OR(AND([a],[b]),[c])",
+	}, {
+		"!!([a] U [b])",
+		"NOT(NOT(UNTIL([a],[b])))",
+	}, {
+		"G [a] R [b]",
+		"GLOBALLY(RELEASE([a],[b]))",
+	}, {
+		"F X [a]",
+		"EVENTUALLY(NEXT([a]))",
+	}, {
+		"NOT([a])",
+		"NOT([a])",
+	}, {
+		"([a])AND([b])",
+		"AND([a],[b])",
+	}, {
+		"EVENTUALLY[a]THEN[b]",
+		"EVENTUALLY(THEN([a],[b]))",
+	}, {
+		"[a]THEN![b]",
+		"THEN([a],NOT([b]))",
+	}, {
+		"SCOPE($a)([$a<-]THEN[$a])",
+		"SCOPE($a)(THEN([$a<-],[$a]))",
+	}, {
+		"# Requests are eventually answered.\n[req] THEN // the request\nEVENTUALLY [resp]#ok # tagged",
+		"THEN([req],EVENTUALLY(TAGGED(#ok)([resp])))",
+	}, {
+		"NOT/* inline */[a] /* spanning\n * lines */ AND [b]/**/",
+		"AND(NOT([a]),[b])",
+	}, {
+		"LET req = [method] IN req THEN EVENTUALLY NOT req",
+		"THEN([method],EVENTUALLY(NOT([method])))",
+	}, {
+		"LET a = [a] IN LET ab = a THEN [b] IN ab OR (LET a = [c] IN a AND ab)",
+		"OR(THEN([a],[b]),AND([c],THEN([a],[b])))",
+	}, {
+		"LET INPUT=[i] IN (INPUT)AND[j]",
+		"AND([i],[j])",
+	}, {
+		`[a\]b] THEN [\[] THEN [\\] THEN [[x]]`,
+		`THEN(THEN(THEN([a]b],[[]),[\]),[[x]])`,
+	}, {
+		`[\$a] OR [\@b] OR [$c<-]`,
+		`OR(OR([$a],[@b]),[$c<-])`,
+	}, {
+		`"ab" THEN "[\"\u00e9\t]"#q`,
+		"THEN([ab],TAGGED(#q)([[\"é\t]]))",
 	}}
 	for _, test := range tests {
 		op, _, _, err := parse(test.input)
@@ -129,3 +244,932 @@ func TestParsingAsString(t *testing.T) {
 		}
 	}
 }
+
+func TestParseLTLWithDiagnostics(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{{
+		"[$a<-] THEN [$a]",
+		nil,
+	}, {
+		"[$a<-] UNTIL NOT [$a]",
+		[]string{"[$a<-] in UNTIL([$a<-],NOT([$a])): " + conjoinedMsg},
+	}, {
+		"[a] THEN GLOBALLY ([$a<-] THEN [b])",
+		[]string{"[$a<-] in GLOBALLY(THEN([$a<-],[b])): " + conjoinedMsg},
+	}, {
+		"EVENTUALLY ([$a<-] THEN [$b<-])",
+		[]string{
+			"[$a<-] in EVENTUALLY(THEN([$a<-],[$b<-])): " + alternativeMsg,
+			"[$b<-] in EVENTUALLY(THEN([$a<-],[$b<-])): " + alternativeMsg,
+		},
+	}, {
+		"[$a<-] RELEASE [$b<-]",
+		[]string{"[$b<-] in RELEASE([$a<-],[$b<-]): " + conjoinedMsg},
+	}}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			l, err := NewLexer(DefaultTokens, stringmatcher.Generator(),
+				bufio.NewReader(strings.NewReader(test.input)))
+			if err != nil {
+				t.Fatalf("Failed to create lexer: %s", err)
+			}
+			_, diags, err := ParseLTLWithDiagnostics(l)
+			if err != nil {
+				t.Fatalf("Failed to parse: %s", err)
+			}
+			var got []string
+			for _, d := range diags {
+				got = append(got, d.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("Got diagnostics %v, wanted %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	for _, input := range []string{
+		"[a] THEN [b]",
+		"[a] UNTIL [b] THEN [c]",
+		"[a] THEN [b] UNTIL [c]",
+		"(EVENTUALLY [a] AND NOT [b]) LIMIT 10",
+		"NOT [a] THEN NEXT GLOBALLY [b]",
+		"[$a<-] THEN ([$b<-] RELEASE [$a]) OR [c[d]]",
+		"[a]#critical THEN NOT [b]#x#y_z",
+		"[$a<-] THEN SCOPE($a, $b) ([$a<<-] THEN [$b<-])",
+		"[$id<-/[0-9]+/] THEN [$id]",
+		"[@p<-] THEN EVENTUALLY [@p+3]",
+	} {
+		t.Run(input, func(t *testing.T) {
+			op, _, _, err := parse(input)
+			if err != nil {
+				t.Fatalf("Failed to parse: %s", err)
+			}
+			formatted, err := ops.Format(op)
+			if err != nil {
+				t.Fatalf("Format() yielded unexpected error %s", err)
+			}
+			reparsed, _, _, err := parse(formatted)
+			if err != nil {
+				t.Fatalf("Failed to parse formatted '%s': %s", formatted, err)
+			}
+			if got, want := ops.PrettyPrint(reparsed, ops.Inline()), ops.PrettyPrint(op, ops.Inline()); got != want {
+				t.Errorf("Formatted '%s' parsed as %s, wanted %s", formatted, got, want)
+			}
+		})
+	}
+}
+
+func TestTags(t *testing.T) {
+	op, _, _, err := parse("[a]#first THEN ([b]#second OR [c]#third)")
+	if err != nil {
+		t.Fatalf("Failed to parse: %s", err)
+	}
+	var env ltl.Environment
+	for idx, ch := range "ab" {
+		op, env = ltl.Match(op, rtok.New(ch, idx))
+	}
+	if !env.Matching() {
+		t.Fatalf("Wanted a match, got %s", env)
+	}
+	if got, want := fmt.Sprint(be.Tags(env).Get(true)), "[#first #second]"; got != want {
+		t.Errorf("Got tags %s, wanted %s", got, want)
+	}
+	for _, input := range []string{"[a]# THEN [b]", "[a]#!"} {
+		if _, _, _, err := parse(input); err == nil {
+			t.Errorf("Parsing '%s' yielded no error", input)
+		}
+	}
+}
+
+func TestTrackLocations(t *testing.T) {
+	const expr = "[a] THEN ([b]#x OR [$c<-])"
+	l, err := NewLexer(DefaultTokens, stringmatcher.Generator(),
+		bufio.NewReader(strings.NewReader(expr)))
+	if err != nil {
+		t.Fatalf("Failed to create lexer: %s", err)
+	}
+	l.TrackLocations(true)
+	op, err := ParseLTL(l)
+	if err != nil {
+		t.Fatalf("Failed to parse: %s", err)
+	}
+	if got, err := ops.Format(op); err != nil || got != expr {
+		t.Errorf("Format() = %q, %v, wanted %q", got, err, expr)
+	}
+	// Matching anything but a RuneToken errors at the first matcher consulted.
+	bad := signals.NewToken("a")
+	tests := []struct {
+		input   []ltl.Token
+		wantLoc ops.Location
+	}{
+		{[]ltl.Token{bad}, ops.Location{Start: 0, End: 3, Text: "[a]"}},
+		{[]ltl.Token{rtok.New('a', 0), bad}, ops.Location{Start: 10, End: 13, Text: "[b]"}},
+	}
+	for idx, test := range tests {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			op := op
+			var env ltl.Environment
+			for _, tok := range test.input {
+				op, env = ltl.Match(op, tok)
+			}
+			var le *ops.LocationError
+			if !errors.As(env.Err(), &le) {
+				t.Fatalf("Got %v, wanted a LocationError", env.Err())
+			}
+			if le.Location != test.wantLoc {
+				t.Errorf("Got location %v, wanted %v", le.Location, test.wantLoc)
+			}
+			if !errors.Is(env.Err(), ltl.ErrTokenType) {
+				t.Errorf("Got error %v, wanted one wrapping %v", env.Err(), ltl.ErrTokenType)
+			}
+		})
+	}
+}
+
+func TestParseAll(t *testing.T) {
+	const doc = `# Request handling.
+requested := [req]
+answered := [req] THEN EVENTUALLY [resp] // one per line
+multiline := ([a]
+  THEN [b]) ; short := NOT [c];
+reused := requested AND LET x = short IN x
+
+/* Blank lines and comments are skipped. */
+last:=[d]`
+	want := map[string]string{
+		"requested": "[req]",
+		"answered":  "THEN([req],EVENTUALLY([resp]))",
+		"multiline": "THEN([a],[b])",
+		"short":     "NOT([c])",
+		"last":      "[d]",
+		"reused":    "AND([req],NOT([c]))",
+	}
+	l, err := NewLexer(DefaultTokens, stringmatcher.Generator(),
+		bufio.NewReader(strings.NewReader(doc)))
+	if err != nil {
+		t.Fatalf("Failed to create lexer: %s", err)
+	}
+	got, err := ParseAll(l)
+	if err != nil {
+		t.Fatalf("ParseAll() yielded unexpected error %s", err)
+	}
+	if len(got) != len(want) {
+		t.Errorf("ParseAll() yielded %d formulas, wanted %d", len(got), len(want))
+	}
+	for name, wantStr := range want {
+		if gotStr := ops.PrettyPrint(got[name], ops.Inline()); gotStr != wantStr {
+			t.Errorf("Formula %s was %s, wanted %s", name, gotStr, wantStr)
+		}
+	}
+	for _, bad := range []string{
+		"a := [a]\na := [b]",
+		"a := [a] THEN\n[b]",
+		"a := b\nb := [b]",
+		"a [a]",
+		":= [a]",
+		"LET := [x]",
+		"F := [x]",
+	} {
+		t.Run(bad, func(t *testing.T) {
+			l, err := NewLexer(DefaultTokens, stringmatcher.Generator(),
+				bufio.NewReader(strings.NewReader(bad)))
+			if err != nil {
+				t.Fatalf("Failed to create lexer: %s", err)
+			}
+			if _, err := ParseAll(l); err == nil {
+				t.Errorf("ParseAll() yielded no error, wanted one")
+			}
+		})
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "parser")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "formulas.ltl")
+	if err := ioutil.WriteFile(path, []byte("a := [a]\nb := [b] OR [c]\n"), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %s", path, err)
+	}
+	got, err := ParseFile(path, DefaultTokens, stringmatcher.Generator())
+	if err != nil {
+		t.Fatalf("ParseFile() yielded unexpected error %s", err)
+	}
+	if len(got) != 2 || ops.PrettyPrint(got["b"], ops.Inline()) != "OR([b],[c])" {
+		t.Errorf("ParseFile() = %v, wanted formulas a and b", got)
+	}
+	if _, err := ParseFile(filepath.Join(dir, "missing.ltl"), DefaultTokens, stringmatcher.Generator()); err == nil {
+		t.Errorf("ParseFile() of a missing file yielded no error, wanted one")
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	tests := []struct {
+		description string
+		input       string
+		all         bool
+		wantPos     Position
+		wantCaret   string
+	}{{
+		"lexing error",
+		"[a] THEN\n  [b] WHEREUPON [c]",
+		false,
+		Position{Offset: 15, Line: 2, Column: 7},
+		"  [b] WHEREUPON [c]\n      ^",
+	}, {
+		"parse error",
+		"[a] [b]",
+		false,
+		Position{Offset: 4, Line: 1, Column: 5},
+		"[a] [b]\n    ^",
+	}, {
+		"tabs and wide runes",
+		"\t[é] AND AND [b]",
+		false,
+		Position{Offset: 10, Line: 1, Column: 10},
+		"\t[é] AND AND [b]\n\t        ^",
+	}, {
+		"document error",
+		"a := [a]\nb := [b]\n  c = [c]\nd := [d]",
+		true,
+		Position{Offset: 20, Line: 3, Column: 3},
+		"  c = [c]\n  ^",
+	}}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			l, err := NewLexer(DefaultTokens, stringmatcher.Generator(),
+				bufio.NewReader(strings.NewReader(test.input)))
+			if err != nil {
+				t.Fatalf("Failed to create lexer: %s", err)
+			}
+			if test.all {
+				_, err = ParseAll(l)
+			} else {
+				_, err = ParseLTL(l)
+			}
+			var se *SyntaxError
+			if !errors.As(err, &se) {
+				t.Fatalf("Got error %v, wanted a SyntaxError", err)
+			}
+			if se.Position != test.wantPos {
+				t.Errorf("Got position %+v, wanted %+v", se.Position, test.wantPos)
+			}
+			if got := se.Caret(); got != test.wantCaret {
+				t.Errorf("Caret() = %q, wanted %q", got, test.wantCaret)
+			}
+		})
+	}
+}
+
+func TestRecover(t *testing.T) {
+	tests := []struct {
+		input   string
+		wantPos []Position
+	}{{
+		"[a] AND [b]",
+		nil,
+	}, {
+		"[a] AND AND [b]\nTHEN ([c] OR) WHEREUPON [d]",
+		[]Position{
+			{Offset: 8, Line: 1, Column: 9},
+			{Offset: 28, Line: 2, Column: 13},
+			{Offset: 30, Line: 2, Column: 15},
+		},
+	}, {
+		"([a] [b]) AND (NOT) THEN [c]",
+		[]Position{
+			{Offset: 5, Line: 1, Column: 6},
+			{Offset: 18, Line: 1, Column: 19},
+		},
+	}}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			l, err := NewLexer(DefaultTokens, stringmatcher.Generator(),
+				bufio.NewReader(strings.NewReader(test.input)))
+			if err != nil {
+				t.Fatalf("Failed to create lexer: %s", err)
+			}
+			l.Recover(true)
+			op, err := ParseLTL(l)
+			if test.wantPos == nil {
+				if op == nil || err != nil {
+					t.Fatalf("ParseLTL() = %v, %v, wanted an Operator and no error", op, err)
+				}
+				return
+			}
+			el, ok := err.(ErrorList)
+			if op != nil || !ok {
+				t.Fatalf("ParseLTL() = %v, %v, wanted no Operator and an ErrorList", op, err)
+			}
+			var gotPos []Position
+			for _, se := range el {
+				gotPos = append(gotPos, se.Position)
+			}
+			if fmt.Sprint(gotPos) != fmt.Sprint(test.wantPos) {
+				t.Errorf("Got errors at %v, wanted %v", gotPos, test.wantPos)
+			}
+		})
+	}
+}
+
+func TestParseAST(t *testing.T) {
+	const expr = "LET x = [a]#t IN\n  NOT x THEN (y OR [b]) LIMIT 3"
+	l, err := NewLexer(DefaultTokens, nil, bufio.NewReader(strings.NewReader(expr)))
+	if err != nil {
+		t.Fatalf("Failed to create lexer: %s", err)
+	}
+	l.Define("y", ops.True())
+	n, err := ParseAST(l)
+	if err != nil {
+		t.Fatalf("ParseAST() yielded unexpected error %s", err)
+	}
+	if got, want := n.String(), "LET(x, [a]#t, LIMIT(3, THEN(NOT(x), OR(y, [b]))))"; got != want {
+		t.Errorf("ParseAST() = %s, wanted %s", got, want)
+	}
+	then := n.Children[1].Children[0]
+	if then.Kind != ThenNode || then.Pos != (Position{Offset: 19, Line: 2, Column: 3}) {
+		t.Errorf("Got %s at %+v, wanted THEN at line 2, column 3", then.Kind, then.Pos)
+	}
+	if _, err := n.Lower(nil, nil); err == nil {
+		t.Errorf("Lower() without a matcher generator yielded no error, wanted one")
+	}
+	if _, err := n.Lower(stringmatcher.Generator(), nil); err == nil {
+		t.Errorf("Lower() without formula y yielded no error, wanted one")
+	}
+	op, err := n.Lower(stringmatcher.Generator(), map[string]ltl.Operator{"y": ops.True()})
+	if err != nil {
+		t.Fatalf("Lower() yielded unexpected error %s", err)
+	}
+	if got, want := ops.PrettyPrint(op, ops.Inline()), "LIMIT(3)(THEN(NOT(TAGGED(#t)([a])),OR(TRUE,[b])))"; got != want {
+		t.Errorf("Lower() = %s, wanted %s", got, want)
+	}
+}
+
+func TestMatchers(t *testing.T) {
+	regex := func(s string) (ltl.Operator, error) {
+		re, err := regexp.Compile("^(?:" + s + ")$")
+		if err != nil {
+			return nil, err
+		}
+		return ops.Predicate(func(tok ltl.Token) (bool, error) {
+			rt, ok := tok.(*rtok.RuneToken)
+			if !ok {
+				return false, fmt.Errorf("unsupported token %v", tok)
+			}
+			return re.MatchString(string(rt.Value())), nil
+		}, ops.PredicateName("/"+s+"/")), nil
+	}
+	parseWith := func(input string) (ltl.Operator, error) {
+		l, err := NewLexer(DefaultTokens, stringmatcher.Generator(),
+			bufio.NewReader(strings.NewReader(input)),
+			Matchers('/', '/', regex), Matchers('{', '}', regex))
+		if err != nil {
+			return nil, err
+		}
+		return ParseLTL(l)
+	}
+	op, err := parseWith(`[a] THEN /[\/b]/#re THEN {[c-d]{1,2}}`)
+	if err != nil {
+		t.Fatalf("Failed to parse: %s", err)
+	}
+	if got, want := ops.PrettyPrint(op, ops.Inline()), `THEN(THEN([a],TAGGED(#re)([/[/b]/])),[/[c-d]{1,2}/])`; got != want {
+		t.Errorf("Parsed %s, wanted %s", got, want)
+	}
+	var env ltl.Environment
+	for idx, ch := range "abc" {
+		op, env = ltl.Match(op, rtok.New(ch, idx))
+	}
+	if env.Err() != nil || !env.Matching() {
+		t.Errorf("Got env %v matching 'abc', wanted a match", env)
+	}
+	for _, bad := range []string{"[a] AND /(/", "[a] AND }", "[a] AND {b"} {
+		if _, err := parseWith(bad); err == nil {
+			t.Errorf("Parsing %q yielded no error, wanted one", bad)
+		}
+	}
+}
+
+func TestQuotedLiterals(t *testing.T) {
+	// Quoted text is matched literally, even with a leading '$'.
+	op, _, _, err := parse(`"$a" THEN "]"`)
+	if err != nil {
+		t.Fatalf("Failed to parse: %s", err)
+	}
+	var env ltl.Environment
+	for idx, ch := range "$a]" {
+		op, env = ltl.Match(op, rtok.New(ch, idx))
+	}
+	if env.Err() != nil || !env.Matching() {
+		t.Errorf("Got env %v matching '$a]', wanted a match", env)
+	}
+}
+
+func TestCaseInsensitiveKeywords(t *testing.T) {
+	parseWith := func(input string, opts ...func(l *Lexer)) (ltl.Operator, error) {
+		l, err := NewLexer(DefaultTokens, stringmatcher.Generator(),
+			bufio.NewReader(strings.NewReader(input)), opts...)
+		if err != nil {
+			return nil, err
+		}
+		return ParseLTL(l)
+	}
+	const input = "eventually [a] Then NOT([b]) and g [c]"
+	if _, err := parseWith(input); err == nil {
+		t.Errorf("Parsing %q with case-sensitive keywords yielded no error, wanted one", input)
+	}
+	op, err := parseWith(input, CaseInsensitiveKeywords())
+	if err != nil {
+		t.Fatalf("Failed to parse: %s", err)
+	}
+	if got, want := ops.PrettyPrint(op, ops.Inline()), "EVENTUALLY(THEN([a],AND(NOT([b]),GLOBALLY([c]))))"; got != want {
+		t.Errorf("Parsed %s, wanted %s", got, want)
+	}
+	if _, err := NewLexer(map[string]int{"and": AND, "AND": OR}, stringmatcher.Generator(),
+		bufio.NewReader(strings.NewReader("")), CaseInsensitiveKeywords()); err == nil {
+		t.Errorf("NewLexer() with conflicting keywords yielded no error, wanted one")
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	for _, test := range []struct {
+		input   string
+		wantTok int
+		wantNum int64
+		wantRng [2]int64
+		wantErr bool
+	}{
+		{input: "10", wantTok: NUM, wantNum: 10},
+		{input: "010", wantTok: NUM, wantNum: 10},
+		{input: "1_000", wantTok: NUM, wantNum: 1000},
+		{input: "-3", wantTok: NUM, wantNum: -3},
+		{input: "0x1F", wantTok: NUM, wantNum: 31},
+		{input: "0x_ff", wantTok: NUM, wantNum: 255},
+		{input: "3..7", wantTok: RANGE, wantRng: [2]int64{3, 7}},
+		{input: "-2..0x10", wantTok: RANGE, wantRng: [2]int64{-2, 16}},
+		{input: "1__0", wantErr: true},
+		{input: "1_", wantErr: true},
+		{input: "12ab", wantErr: true},
+		{input: "7..3", wantErr: true},
+		{input: "3..", wantErr: true},
+	} {
+		l, err := NewLexer(DefaultTokens, nil, bufio.NewReader(strings.NewReader(test.input)))
+		if err != nil {
+			t.Fatalf("NewLexer() yielded unexpected error %s", err)
+		}
+		var lvalue yySymType
+		tok := l.Lex(&lvalue)
+		if test.wantErr {
+			if l.err == nil {
+				t.Errorf("Lexing %q yielded no error, wanted one", test.input)
+			}
+			continue
+		}
+		if l.err != nil {
+			t.Errorf("Lexing %q yielded unexpected error %s", test.input, l.err)
+			continue
+		}
+		if tok != test.wantTok || lvalue.num != test.wantNum || lvalue.bounds != test.wantRng {
+			t.Errorf("Lexing %q yielded token %d (%d, %v), wanted %d (%d, %v)", test.input,
+				tok, lvalue.num, lvalue.bounds, test.wantTok, test.wantNum, test.wantRng)
+		}
+	}
+	for _, bad := range []string{"[a] LIMIT -1", "[a] LIMIT 1..2"} {
+		if _, _, _, err := parse(bad); err == nil {
+			t.Errorf("Parsing %q yielded no error, wanted one", bad)
+		}
+	}
+	// Errors in arguments are reported at the argument, not its operand.
+	const negative = "[a] LIMIT -1"
+	if _, _, _, err := parse(negative); err == nil || !strings.Contains(err.Error(), "at offset 10") {
+		t.Errorf("Parsing %q yielded error %v, wanted one at offset 10", negative, err)
+	}
+}
+
+func TestBounds(t *testing.T) {
+	// matches returns whether op matches the input, one rune per Token.
+	matches := func(op ltl.Operator, input string) bool {
+		var env ltl.Environment
+		for idx, ch := range input {
+			if op == nil {
+				break
+			}
+			op, env = ltl.Match(op, rtok.New(ch, idx))
+		}
+		if op != nil {
+			env = ltl.Finish(op)
+		}
+		return env != nil && env.Err() == nil && env.Matching()
+	}
+	for _, test := range []struct {
+		input       string
+		wantAST     string
+		matching    []string
+		notMatching []string
+	}{{
+		"EVENTUALLY<=2 [a]",
+		"EVENTUALLY{0..2}([a])",
+		[]string{"a", "bba"},
+		[]string{"bbba", "bbb"},
+	}, {
+		"F{1..2} [a]",
+		"EVENTUALLY{1..2}([a])",
+		[]string{"ba", "bba"},
+		[]string{"abb", "bbba"},
+	}, {
+		"GLOBALLY{1..0x2} [a]",
+		"GLOBALLY{1..2}([a])",
+		[]string{"baa", "baab"},
+		[]string{"bab", "bba", "aba"},
+	}, {
+		"[a] UNTIL<=1 [b]",
+		"UNTIL{0..1}([a], [b])",
+		[]string{"b", "ab"},
+		[]string{"aab", "cb"},
+	}, {
+		"[a] UNTIL{2..3} [b]",
+		"UNTIL{2..3}([a], [b])",
+		[]string{"aab", "aaab", "aabb"},
+		[]string{"abb", "ab", "aaaab"},
+	}, {
+		// Bounds may be separated from their keyword by whitespace.
+		"GLOBALLY {1..2} [a]",
+		"GLOBALLY{1..2}([a])",
+		[]string{"baa"},
+		[]string{"bab"},
+	}, {
+		"[a] UNTIL <=1 [b]",
+		"UNTIL{0..1}([a], [b])",
+		[]string{"ab"},
+		[]string{"aab"},
+	}, {
+		// Brackets always hold a matcher, even next to a bounded keyword.
+		"GLOBALLY[a] THEN [b]",
+		"GLOBALLY(THEN([a], [b]))",
+		nil,
+		nil,
+	}, {
+		"GLOBALLY[1..2]",
+		"GLOBALLY([1..2])",
+		[]string{"1..2"},
+		nil,
+	}, {
+		"[a] UNTIL[b]",
+		"UNTIL([a], [b])",
+		[]string{"ab"},
+		nil,
+	}} {
+		l, err := NewLexer(DefaultTokens, stringmatcher.Generator(),
+			bufio.NewReader(strings.NewReader(test.input)))
+		if err != nil {
+			t.Fatalf("NewLexer() yielded unexpected error %s", err)
+		}
+		n, err := ParseAST(l)
+		if err != nil {
+			t.Errorf("ParseAST(%q) yielded unexpected error %s", test.input, err)
+			continue
+		}
+		if got := n.String(); got != test.wantAST {
+			t.Errorf("ParseAST(%q) = %s, wanted %s", test.input, got, test.wantAST)
+		}
+		op, err := l.lower(n)
+		if err != nil {
+			t.Errorf("Lowering %q yielded unexpected error %s", test.input, err)
+			continue
+		}
+		for _, in := range test.matching {
+			if !matches(op, in) {
+				t.Errorf("%q didn't match %q, but should have", test.input, in)
+			}
+		}
+		for _, in := range test.notMatching {
+			if matches(op, in) {
+				t.Errorf("%q matched %q, but shouldn't have", test.input, in)
+			}
+		}
+	}
+	for _, bad := range []string{"EVENTUALLY<=1..2 [a]", "GLOBALLY<= [a]", "F<=-1 [a]", "F{-1..2} [a]", "[a] LIMIT<=2"} {
+		if _, _, _, err := parse(bad); err == nil {
+			t.Errorf("Parsing %q yielded no error, wanted one", bad)
+		}
+	}
+}
+
+func TestCustomOperators(t *testing.T) {
+	reg := NewRegistry()
+	for _, def := range []OperatorDef{
+		{Keyword: "?:", Precedence: LikeUntil, Binary: ops.FirstOf},
+		{Keyword: "WEAKLY", Precedence: LikeEventually, Unary: ops.Not},
+		{Keyword: "SKIP", Precedence: LikeNot, Unary: ops.Next},
+	} {
+		if err := reg.Register(def); err != nil {
+			t.Fatalf("Register(%s) yielded unexpected error %s", def.Keyword, err)
+		}
+	}
+	for _, def := range []OperatorDef{
+		{Keyword: "SKIP", Precedence: LikeNot, Unary: ops.Next},
+		{Keyword: "BOTH", Precedence: LikeAnd, Unary: ops.Next},
+		{Precedence: LikeNot, Unary: ops.Next},
+	} {
+		if err := reg.Register(def); err == nil {
+			t.Errorf("Register(%s) yielded no error, wanted one", def.Keyword)
+		}
+	}
+	for _, test := range []struct {
+		input, wantAST, wantOp string
+	}{{
+		"[a] THEN [b] ?: SKIP [c] THEN [d]",
+		"?:(THEN([a], [b]), THEN(SKIP([c]), [d]))",
+		"FIRST_OF(THEN([a],[b]),THEN(NEXT([c]),[d]))",
+	}, {
+		"WEAKLY [a] THEN [b]",
+		"WEAKLY(THEN([a], [b]))",
+		"NOT(THEN([a],[b]))",
+	}} {
+		l, err := NewLexer(DefaultTokens, stringmatcher.Generator(),
+			bufio.NewReader(strings.NewReader(test.input)), Operators(reg))
+		if err != nil {
+			t.Fatalf("NewLexer() yielded unexpected error %s", err)
+		}
+		n, err := ParseAST(l)
+		if err != nil {
+			t.Fatalf("ParseAST(%q) yielded unexpected error %s", test.input, err)
+		}
+		if got := n.String(); got != test.wantAST {
+			t.Errorf("ParseAST(%q) = %s, wanted %s", test.input, got, test.wantAST)
+		}
+		op, err := l.lower(n)
+		if err != nil {
+			t.Fatalf("Lowering %q yielded unexpected error %s", test.input, err)
+		}
+		if got := ops.PrettyPrint(op, ops.Inline()); got != test.wantOp {
+			t.Errorf("Lowering %q yielded %s, wanted %s", test.input, got, test.wantOp)
+		}
+	}
+	conflicting := NewRegistry()
+	if err := conflicting.Register(OperatorDef{Keyword: "AND", Precedence: LikeAnd, Binary: ops.And}); err != nil {
+		t.Fatalf("Register(AND) yielded unexpected error %s", err)
+	}
+	if _, err := NewLexer(DefaultTokens, stringmatcher.Generator(),
+		bufio.NewReader(strings.NewReader("")), Operators(conflicting)); err == nil {
+		t.Errorf("NewLexer() with a conflicting custom operator yielded no error, wanted one")
+	}
+}
+
+func TestDelimiterOptions(t *testing.T) {
+	const input = "{<a> THEN GLOBALLY{1..2} <b>} AND SCOPE{$x} <$x>"
+	l, err := NewLexer(DefaultTokens, stringmatcher.Generator(),
+		bufio.NewReader(strings.NewReader(input)), WithBrackets('<', '>'), WithParens('{', '}'))
+	if err != nil {
+		t.Fatalf("NewLexer() yielded unexpected error %s", err)
+	}
+	n, err := ParseAST(l)
+	if err != nil {
+		t.Fatalf("ParseAST(%q) yielded unexpected error %s", input, err)
+	}
+	if got, want := n.String(), "AND(THEN(<a>, GLOBALLY{1..2}(<b>)), SCOPE([x], <$x>))"; got != want {
+		t.Errorf("ParseAST(%q) = %s, wanted %s", input, got, want)
+	}
+	if _, err := l.lower(n); err != nil {
+		t.Errorf("Lowering %q yielded unexpected error %s", input, err)
+	}
+	// Other lexers are unaffected.
+	if _, _, _, err := parse("([a] THEN [b])"); err != nil {
+		t.Errorf("Parsing with default delimiters yielded unexpected error %s", err)
+	}
+}
+
+// statefulMatcher wraps a matcher, claiming to hold state modified by Match,
+// so that it is copied by ltl.Clone.
+type statefulMatcher struct {
+	ltl.Operator
+}
+
+func (sm *statefulMatcher) Clone() (ltl.Operator, bool) {
+	return &statefulMatcher{sm.Operator}, true
+}
+
+func TestCache(t *testing.T) {
+	gen := stringmatcher.Generator()
+	statefulGen := func(s string) (ltl.Operator, error) {
+		op, err := gen(s)
+		if err != nil {
+			return nil, err
+		}
+		return &statefulMatcher{op}, nil
+	}
+	c := NewCache(DefaultTokens, statefulGen)
+	const expr = "[a] THEN EVENTUALLY [b]"
+	var wg sync.WaitGroup
+	results := make([]ltl.Operator, 8)
+	for idx := range results {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			op, err := c.ParseLTL(expr)
+			if err != nil {
+				t.Errorf("ParseLTL(%q) yielded unexpected error %s", expr, err)
+			}
+			results[idx] = op
+		}(idx)
+	}
+	wg.Wait()
+	for _, op := range results[1:] {
+		if op == results[0] || ops.Children(op)[0] == ops.Children(results[0])[0] {
+			t.Errorf("ParseLTL(%q) returned the same Operator twice, wanted copies", expr)
+		}
+		if got, want := ops.PrettyPrint(op, ops.Inline()), "THEN([a],EVENTUALLY([b]))"; got != want {
+			t.Errorf("ParseLTL(%q) = %s, wanted %s", expr, got, want)
+		}
+	}
+	if _, err := c.ParseLTL("[a] AND"); err == nil {
+		t.Errorf("ParseLTL(%q) yielded no error, wanted one", "[a] AND")
+	}
+	if _, err := c.ParseLTL("[a] AND"); err == nil {
+		t.Errorf("Cached ParseLTL(%q) yielded no error, wanted one", "[a] AND")
+	}
+	if got, want := c.Len(), 2; got != want {
+		t.Errorf("Cache holds %d expressions, wanted %d", got, want)
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	parses := 0
+	gen := stringmatcher.Generator()
+	countingGen := func(s string) (ltl.Operator, error) {
+		parses++
+		return gen(s)
+	}
+	c := NewSizedCache(2, DefaultTokens, countingGen)
+	for _, test := range []struct {
+		expr       string
+		wantParses int
+	}{
+		{"[a]", 1},
+		{"[b]", 2},
+		{"[a]", 2},
+		// [b] is the least recently used, and is evicted.
+		{"[c]", 3},
+		{"[a]", 3},
+		{"[b]", 4},
+	} {
+		if _, err := c.ParseLTL(test.expr); err != nil {
+			t.Fatalf("ParseLTL(%q) yielded unexpected error %s", test.expr, err)
+		}
+		if parses != test.wantParses {
+			t.Errorf("After ParseLTL(%q), parsed %d matchers, wanted %d", test.expr, parses, test.wantParses)
+		}
+		if got, want := c.Len(), 2; got > want {
+			t.Errorf("Cache holds %d expressions, wanted at most %d", got, want)
+		}
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	fingerprint := func(expr string) string {
+		fp, err := Fingerprint(expr)
+		if err != nil {
+			t.Fatalf("Fingerprint(%q) yielded unexpected error %s", expr, err)
+		}
+		return fp
+	}
+	want := fingerprint("[a] THEN ([b] AND [c])")
+	for _, expr := range []string{
+		"[a]   THEN\n([b] AND [c])",
+		"([a]) THEN (([c]) AND [b]) // Comment",
+		"LET x = [b] IN [a] THEN (x AND [c])",
+	} {
+		if got := fingerprint(expr); got != want {
+			t.Errorf("Fingerprint(%q) = %s, wanted %s", expr, got, want)
+		}
+	}
+	for _, expr := range []string{"([a] THEN [b]) AND [c]", "[a] THEN ([b] AND [d])", "[a] THEN ([b] AND [c]#t)"} {
+		if fingerprint(expr) == want {
+			t.Errorf("Fingerprint(%q) = %s, wanted a different fingerprint", expr, want)
+		}
+	}
+	if _, err := Fingerprint("[a] AND"); err == nil {
+		t.Errorf("Fingerprint(%q) yielded no error, wanted one", "[a] AND")
+	}
+}
+
+func TestFormatExpr(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		opts  []func(o *formatOpts)
+		want  string
+	}{
+		{input: "(([a]))   THEN\n[b]", want: "[a] THEN [b]"},
+		{input: "([a] THEN [b]) THEN [c]", want: "[a] THEN [b] THEN [c]"},
+		{input: "[a] THEN ([b] THEN [c])", want: "[a] THEN ([b] THEN [c])"},
+		{input: "(EVENTUALLY [a]) LIMIT 10", want: "EVENTUALLY [a] LIMIT 10"},
+		{input: "(EVENTUALLY [a]) THEN [b]", want: "(EVENTUALLY [a]) THEN [b]"},
+		{input: "[a] THEN (EVENTUALLY [b])", want: "[a] THEN EVENTUALLY [b]"},
+		{input: "([a] THEN F [b]) THEN [c]", want: "[a] THEN (EVENTUALLY [b]) THEN [c]"},
+		{input: "NOT ([a] AND [b])", want: "NOT ([a] AND [b])"},
+		{input: "(! [a]) && [b]", want: "NOT [a] AND [b]"},
+		{input: "NOT (EVENTUALLY [a]) AND [b]", want: "NOT (EVENTUALLY [a]) AND [b]"},
+		{input: "(LET x = [a] IN x) LIMIT 2", want: "(LET x = [a] IN x) LIMIT 2"},
+		{input: "SCOPE($a) [$a]#t U<=3 \"b\"", want: "SCOPE($a) [$a]#t UNTIL<=3 \"b\""},
+		{input: "G{1..2} [a]", want: "GLOBALLY{1..2} [a]"},
+		{
+			input: "[first] THEN [second] THEN ([third] OR EVENTUALLY [fourth])",
+			opts:  []func(o *formatOpts){FormatWidth(24)},
+			want:  "[first] THEN [second]\nTHEN [third]\n  OR EVENTUALLY [fourth]",
+		}, {
+			input: "[first] AND [second] THEN [third]",
+			opts:  []func(o *formatOpts){FormatWidth(16), FormatIndent("    ")},
+			want:  "[first]\nAND [second]\nTHEN [third]",
+		},
+	} {
+		got, err := FormatExpr(test.input, test.opts...)
+		if err != nil {
+			t.Errorf("FormatExpr(%q) yielded unexpected error %s", test.input, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("FormatExpr(%q) = %q, wanted %q", test.input, got, test.want)
+		}
+		// Formatting must preserve the syntax tree, and be idempotent.
+		inputFP, formattedFP := mustAST(t, test.input), mustAST(t, got)
+		if inputFP != formattedFP {
+			t.Errorf("FormatExpr(%q) parses as %s, wanted %s", test.input, formattedFP, inputFP)
+		}
+		if again, err := FormatExpr(got, test.opts...); err != nil || again != got {
+			t.Errorf("FormatExpr(%q) = %q, %v, wanted it unchanged", got, again, err)
+		}
+	}
+}
+
+func mustAST(t *testing.T, expr string) string {
+	l, err := NewLexer(DefaultTokens, nil, bufio.NewReader(strings.NewReader(expr)))
+	if err != nil {
+		t.Fatalf("NewLexer() yielded unexpected error %s", err)
+	}
+	n, err := ParseAST(l)
+	if err != nil {
+		t.Fatalf("ParseAST(%q) yielded unexpected error %s", expr, err)
+	}
+	return n.String()
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{{
+		"[$a<-] THEN [$a]",
+		nil,
+	}, {
+		"[a] AND\n  [b] WHEREUPON [c]\n  THEN [d] THEN [e] OR )",
+		[]string{
+			"line 2, column 7: lexing error at offset 15: unknown keyword \"W\"",
+			"line 3, column 24: parse error at offset 52: syntax error: unexpected RPAREN",
+		},
+	}, {
+		"[a] THEN [$] THEN \"$\"",
+		[]string{"line 1, column 10: invalid matcher [$]: " + mustGenErr(t, "$")},
+	}, {
+		"LET x = [$a<-] IN [b] THEN GLOBALLY (x THEN [c])",
+		[]string{"line 1, column 9: [$a<-] in GLOBALLY(THEN(x, [c])): " + conjoinedMsg},
+	}, {
+		"[$a<-] UNTIL{1..2} NOT [$b<-]",
+		[]string{
+			"line 1, column 1: [$a<-] in UNTIL{1..2}([$a<-], NOT([$b<-])): " + conjoinedMsg,
+			"line 1, column 24: [$b<-] in UNTIL{1..2}([$a<-], NOT([$b<-])): " + alternativeMsg,
+		},
+	}, {
+		"[a] LIMIT -1",
+		[]string{"line 1, column 11: negative LIMIT -1 at offset 10"},
+	}, {
+		"EVENTUALLY<=-3 [a]",
+		[]string{"line 1, column 11: invalid bounds 0..-3 at offset 10"},
+	}, {
+		"LET x = [a] LIMIT -1 IN x THEN x",
+		[]string{"line 1, column 19: negative LIMIT -1 at offset 18"},
+	}}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			var got []string
+			for _, d := range Check(test.input, stringmatcher.Generator()) {
+				got = append(got, d.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("Check(%q) = %q, wanted %q", test.input, got, test.want)
+			}
+		})
+	}
+}
+
+func mustGenErr(t *testing.T, text string) string {
+	_, err := stringmatcher.Generator()(text)
+	if err == nil {
+		t.Fatalf("Generating a matcher for %q yielded no error, wanted one", text)
+	}
+	return err.Error()
+}
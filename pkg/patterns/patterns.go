@@ -0,0 +1,218 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package patterns provides the classic property specification patterns
+// (absence, existence, universality, precedence, and response), each
+// restricted to a scope (globally, before R, after Q, between Q and R, or after
+// Q until R), built from the operators in package operators.
+//
+// A pattern is evaluated over each segment of its input delimited by its
+// scope.  Each segment is treated as a finite input: when a segment closes, the
+// pattern's body is resolved as at the end of input.  Scope delimiters are
+// evaluated against single Tokens; only their matching state is used.  The
+// pattern arguments P and S are generally single-Token matchers, but may be
+// any Operator.
+//
+// The returned Operators report, at each Token, whether the property holds
+// for the input seen so far, and should be closed out with ltl.Finish.
+package patterns
+
+import (
+	"fmt"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	ops "github.com/ilhamster/ltl/pkg/operators"
+)
+
+// Scope delimits the segments of the input to which a pattern applies.
+type Scope struct {
+	name          string
+	open, close   ltl.Operator
+	closeRequired bool
+	repeat        bool
+}
+
+func (s Scope) String() string {
+	return s.name
+}
+
+// Globally applies a pattern to the entire input.
+func Globally() Scope {
+	return Scope{name: "GLOBALLY"}
+}
+
+// Before applies a pattern to the input preceding the first Token at which r
+// holds.  If r never holds, the pattern is vacuously satisfied.
+func Before(r ltl.Operator) Scope {
+	return Scope{name: "BEFORE", close: r, closeRequired: true}
+}
+
+// After applies a pattern to the input starting at the first Token at which q
+// holds.  If q never holds, the pattern is vacuously satisfied.
+func After(q ltl.Operator) Scope {
+	return Scope{name: "AFTER", open: q}
+}
+
+// Between applies a pattern to each segment of the input starting at a Token
+// at which q holds (and r does not) and ending just before the next Token at
+// which r holds.  A segment that is never closed by r is vacuously satisfied.
+func Between(q, r ltl.Operator) Scope {
+	return Scope{name: "BETWEEN", open: q, close: r, closeRequired: true, repeat: true}
+}
+
+// AfterUntil is like Between, except that a segment that is never closed by r
+// must also satisfy the pattern.
+func AfterUntil(q, r ltl.Operator) Scope {
+	return Scope{name: "AFTER_UNTIL", open: q, close: r, repeat: true}
+}
+
+// Absence holds if p never holds within the scope.
+func Absence(p ltl.Operator, scope Scope) ltl.Operator {
+	return scoped(ops.Globally(ops.Not(p)), scope)
+}
+
+// Existence holds if p holds at some point within the scope.
+func Existence(p ltl.Operator, scope Scope) ltl.Operator {
+	return scoped(ops.Eventually(p), scope)
+}
+
+// Universality holds if p holds throughout the scope.
+func Universality(p ltl.Operator, scope Scope) ltl.Operator {
+	return scoped(ops.Globally(p), scope)
+}
+
+// Precedence holds if, within the scope, p does not hold until s has held; that
+// is, if s precedes p.  s need never hold if p does not.
+func Precedence(s, p ltl.Operator, scope Scope) ltl.Operator {
+	return scoped(ops.Precedes(s, p), scope)
+}
+
+// Response holds if, within the scope, every time p holds, s holds at the same
+// time or later; that is, if s responds to p.
+func Response(p, s ltl.Operator, scope Scope) ltl.Operator {
+	return scoped(ops.RespondsTo(p, s), scope)
+}
+
+func holds(op ltl.Operator, tok ltl.Token) bool {
+	_, env := ltl.Match(op, tok)
+	return env.Matching()
+}
+
+// scoped returns an Operator applying body to each segment delimited by scope.
+func scoped(body ltl.Operator, scope Scope) ltl.Operator {
+	if scope.open == nil && scope.close == nil {
+		return body
+	}
+	s := &scopedOp{UnaryOperator: ops.NewUnaryOperator(body), scope: scope}
+	if scope.open == nil {
+		s.inSeg, s.seg = true, body
+	}
+	return s
+}
+
+// scopedOp tracks the segments of a scope.  While no segment is open, it
+// awaits the scope's open delimiter.  While a segment is open, seg holds the
+// body's continuation and segEnv its most recent Environment; seg may be nil
+// if the body resolved before the segment closed.
+type scopedOp struct {
+	ops.UnaryOperator
+	scope  Scope
+	inSeg  bool
+	seg    ltl.Operator
+	segEnv ltl.Environment
+}
+
+// finish returns the final Environment of the current segment.
+func (s *scopedOp) finish() ltl.Environment {
+	if s.seg != nil {
+		return ltl.Finish(s.seg)
+	}
+	return s.segEnv
+}
+
+func (s *scopedOp) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	if tok.EOI() {
+		if !s.inSeg || s.scope.closeRequired {
+			return nil, ltl.Matching
+		}
+		return nil, s.finish()
+	}
+	closing := s.scope.close != nil && holds(s.scope.close, tok)
+	if !s.inSeg {
+		if closing || !holds(s.scope.open, tok) {
+			return s, ltl.Matching
+		}
+		if s.scope.close == nil {
+			// Without a closing delimiter, the segment lasts forever.
+			return ltl.Match(s.Child, tok)
+		}
+		return s.step(s.Child, tok)
+	}
+	if closing {
+		env := s.finish()
+		if ltl.IsErroring(env) || !env.Matching() || !s.scope.repeat {
+			return nil, env
+		}
+		return &scopedOp{UnaryOperator: s.UnaryOperator, scope: s.scope}, ltl.Matching
+	}
+	if s.seg == nil {
+		return s, s.report(s.segEnv)
+	}
+	return s.step(s.seg, tok)
+}
+
+// step feeds tok to the open segment's body, whose continuation is seg.
+func (s *scopedOp) step(seg ltl.Operator, tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	newSeg, segEnv := seg.Match(tok)
+	if ltl.IsErroring(segEnv) {
+		return nil, segEnv
+	}
+	if newSeg == nil && !segEnv.Matching() && !s.scope.closeRequired {
+		// The segment has failed, and need not close to count.
+		return nil, segEnv
+	}
+	return &scopedOp{
+		UnaryOperator: s.UnaryOperator,
+		scope:         s.scope,
+		inSeg:         true,
+		seg:           newSeg,
+		segEnv:        segEnv,
+	}, s.report(segEnv)
+}
+
+// report returns the Environment to report while a segment is open.  If the
+// segment must close before it counts, the property holds vacuously until
+// then.
+func (s *scopedOp) report(segEnv ltl.Environment) ltl.Environment {
+	if s.scope.closeRequired {
+		return ltl.Matching
+	}
+	return segEnv
+}
+
+func (s *scopedOp) String() string {
+	if s.inSeg {
+		return fmt.Sprintf("%s(in segment)", s.scope)
+	}
+	return s.scope.String()
+}
+
+// Clone implements ltl.Cloner.
+func (s *scopedOp) Clone() (ltl.Operator, bool) {
+	child, childCopied := ltl.Clone(s.Child)
+	seg, segCopied := ltl.Clone(s.seg)
+	if !childCopied && !segCopied {
+		return s, false
+	}
+	return &scopedOp{ops.NewUnaryOperator(child), s.scope, s.inSeg, seg, s.segEnv}, true
+}
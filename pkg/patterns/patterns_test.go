@@ -0,0 +1,120 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package patterns
+
+import (
+	"fmt"
+	"github.com/ilhamster/ltl/examples/signals"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	"strings"
+	"testing"
+)
+
+var p, q, r, s = signals.NewMatcher("p"), signals.NewMatcher("q"), signals.NewMatcher("r"), signals.NewMatcher("s")
+
+type testInput struct {
+	input     string
+	wantMatch bool
+}
+
+// m and nm accept inputs of the form "p;q,r;;s", where each semicolon-delimited
+// entry is a Token holding the comma-delimited signals.
+func m(s string) testInput {
+	return testInput{s, true}
+}
+
+func nm(s string) testInput {
+	return testInput{s, false}
+}
+
+// run applies the input to op and returns the final Environment.
+func run(op ltl.Operator, input string) ltl.Environment {
+	var env ltl.Environment
+	for _, tok := range strings.Split(input, ";") {
+		op, env = op.Match(signals.NewToken(strings.Split(tok, ",")...))
+		if op == nil {
+			return env
+		}
+	}
+	return ltl.Finish(op)
+}
+
+func TestPatterns(t *testing.T) {
+	tests := []struct {
+		desc   string
+		op     ltl.Operator
+		inputs []testInput
+	}{
+		{"absence globally", Absence(p, Globally()),
+			[]testInput{m(";;"), nm(";p;")}},
+		{"absence before", Absence(p, Before(r)),
+			[]testInput{m(";;r;p"), nm(";p;r"), m(";p;"), m("r;p")}},
+		{"absence after", Absence(p, After(q)),
+			[]testInput{m("p;q;"), nm("q;;p"), nm("q,p"), m("p;p")}},
+		{"absence between", Absence(p, Between(q, r)),
+			[]testInput{m("q;;r;p"), nm("q;p;r"), m("q;p"), m("p;q;r;p"), nm("q;r;q;p;r"), m("q,r;p;r")}},
+		{"absence after until", Absence(p, AfterUntil(q, r)),
+			[]testInput{m("q;;r;p"), nm("q;p;r"), nm("q;p"), m("p;q;r;p")}},
+		{"existence globally", Existence(p, Globally()),
+			[]testInput{m(";p;"), nm(";;")}},
+		{"existence before", Existence(p, Before(r)),
+			[]testInput{m(";p;r"), nm(";;r;p"), m(";;"), nm("p,r")}},
+		{"existence after", Existence(p, After(q)),
+			[]testInput{m("q;;p"), m("q,p"), nm("p;q;"), m(";;")}},
+		{"existence between", Existence(p, Between(q, r)),
+			[]testInput{m("q;p;r"), nm("q;;r"), m("q;;"), nm("q;p;r;q;r"), m("q;p;r;q;")}},
+		{"existence after until", Existence(p, AfterUntil(q, r)),
+			[]testInput{m("q;p;r"), nm("q;;r"), nm("q;;"), m(";;")}},
+		{"universality globally", Universality(p, Globally()),
+			[]testInput{m("p;p;p"), nm("p;;p")}},
+		{"universality before", Universality(p, Before(r)),
+			[]testInput{m("p;p;r;"), nm("p;;r"), m("p;;p"), m("r")}},
+		{"universality after", Universality(p, After(q)),
+			[]testInput{m(";q,p;p"), nm(";q,p;"), nm(";q;p"), m(";;")}},
+		{"universality between", Universality(p, Between(q, r)),
+			[]testInput{m("q,p;p;r;;"), nm("q,p;;r"), m("q,p;;")}},
+		{"precedence globally", Precedence(s, p, Globally()),
+			[]testInput{m(";s;p"), m("s,p"), nm(";p;s"), m(";;")}},
+		{"precedence before", Precedence(s, p, Before(r)),
+			[]testInput{m(";s;p;r"), nm(";p;s;r"), m(";p;s"), m("r;p")}},
+		{"precedence after", Precedence(s, p, After(q)),
+			[]testInput{m("p;q;s;p"), nm("p;q;p;s"), m("p;p")}},
+		{"precedence between", Precedence(s, p, Between(q, r)),
+			[]testInput{m("q;s;p;r;p"), nm("q;p;r"), m("q;p"), nm("q;s;r;q;p;r")}},
+		{"response globally", Response(p, s, Globally()),
+			[]testInput{m("p;;s"), m("p,s"), nm("p;;s;p"), m(";;"), m("p;p;s")}},
+		{"response before", Response(p, s, Before(r)),
+			[]testInput{m("p;s;r"), nm("p;;r;s"), m("p;;"), m("r;p")}},
+		{"response after", Response(p, s, After(q)),
+			[]testInput{m("p;q;p;s"), nm("q;p"), m("p;;")}},
+		{"response between", Response(p, s, Between(q, r)),
+			[]testInput{m("q;p;s;r"), nm("q;p;r;s"), m("q;p;"), m("p;q;r")}},
+		{"response after until", Response(p, s, AfterUntil(q, r)),
+			[]testInput{m("q;p;s;r"), nm("q;p;r;s"), nm("q;p;"), m("p;q;r")}},
+	}
+	for _, test := range tests {
+		for _, ti := range test.inputs {
+			t.Run(fmt.Sprintf("%s on '%s'", test.desc, ti.input), func(t *testing.T) {
+				env := run(test.op, ti.input)
+				if ltl.IsErroring(env) {
+					t.Fatalf("Unexpected error %s", env.Err())
+				}
+				if env.Matching() != ti.wantMatch {
+					t.Errorf("Got match %t, wanted %t", env.Matching(), ti.wantMatch)
+				}
+			})
+		}
+	}
+}
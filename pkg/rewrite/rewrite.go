@@ -0,0 +1,224 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rewrite provides transformations of operator trees built from
+// package operators, returning new, equivalent trees.
+//
+// Many textbook equivalences do not hold for streaming operators whose
+// arguments may consume multiple Tokens.  For instance, OR drops a terminated
+// argument's Environment and continues with the other, whereas AND retains it,
+// so De Morgan's laws only hold when both arguments resolve on the same Token.
+// Such rewrites are therefore only applied to subtrees known to accept exactly
+// one Token: the built-in terminals (TRUE, FALSE, ANY, and predicates), and
+// NOT, AND, OR, IMPLIES and FIRST_OF over them.  Since other leaf Operators,
+// such as matchers, may accept multiple Tokens, they are not assumed to accept
+// one unless the AssumeSingleTokenLeaves option is provided.
+package rewrite
+
+import (
+	"github.com/ilhamster/ltl/pkg/ltl"
+	ops "github.com/ilhamster/ltl/pkg/operators"
+)
+
+type config struct {
+	singleTokenLeaves bool
+}
+
+// Option configures a rewrite.
+type Option func(c *config)
+
+// AssumeSingleTokenLeaves specifies that leaf Operators not defined in package
+// operators, such as matchers, each accept exactly one Token and then resolve.
+func AssumeSingleTokenLeaves() Option {
+	return func(c *config) {
+		c.singleTokenLeaves = true
+	}
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// singleToken returns true if op is known to accept exactly one Token.
+func (c *config) singleToken(op ltl.Operator) bool {
+	switch ops.KindOf(op) {
+	case ops.TrueKind, ops.FalseKind, ops.AnyTokenKind, ops.PredicateKind:
+		return true
+	case ops.NotKind, ops.AndKind, ops.OrKind, ops.ImpliesKind, ops.FirstOfKind:
+		for _, child := range ops.Children(op) {
+			if !c.singleToken(child) {
+				return false
+			}
+		}
+		return true
+	case ops.Other:
+		return c.singleTokenLeaves && op != nil && len(ops.Children(op)) == 0
+	}
+	return false
+}
+
+// mapChildren returns op with each of its children replaced by f(child).
+func mapChildren(op ltl.Operator, f func(ltl.Operator) ltl.Operator) ltl.Operator {
+	children := ops.Children(op)
+	if len(children) == 0 {
+		return op
+	}
+	newChildren := make([]ltl.Operator, len(children))
+	changed := false
+	for idx, child := range children {
+		newChildren[idx] = f(child)
+		changed = changed || newChildren[idx] != child
+	}
+	if !changed {
+		return op
+	}
+	return ops.WithChildren(op, newChildren...)
+}
+
+// NNF returns op in negation normal form, with negations pushed inward, toward
+// the leaves, as far as they can be while preserving op's behavior.
+func NNF(op ltl.Operator, opts ...Option) ltl.Operator {
+	return newConfig(opts).nnf(op)
+}
+
+func (c *config) nnf(op ltl.Operator) ltl.Operator {
+	if ops.KindOf(op) == ops.NotKind {
+		return c.negate(ops.Children(op)[0])
+	}
+	return mapChildren(op, c.nnf)
+}
+
+// negate returns the negation normal form of NOT op.
+func (c *config) negate(op ltl.Operator) ltl.Operator {
+	children := ops.Children(op)
+	switch ops.KindOf(op) {
+	case ops.NotKind:
+		return c.nnf(children[0])
+	case ops.TrueKind:
+		return ops.False()
+	case ops.FalseKind:
+		return ops.True()
+	case ops.AndKind:
+		if c.singleToken(op) {
+			return ops.Or(c.negate(children[0]), c.negate(children[1]))
+		}
+	case ops.OrKind:
+		if c.singleToken(op) {
+			return ops.And(c.negate(children[0]), c.negate(children[1]))
+		}
+	case ops.ImpliesKind:
+		if c.singleToken(op) {
+			return ops.And(c.nnf(children[0]), c.negate(children[1]))
+		}
+	case ops.EventuallyKind:
+		if c.singleToken(children[0]) {
+			return ops.Globally(c.negate(children[0]))
+		}
+	case ops.GloballyKind:
+		if c.singleToken(children[0]) {
+			return ops.Eventually(c.negate(children[0]))
+		}
+	case ops.UntilKind:
+		if c.singleToken(children[0]) && c.singleToken(children[1]) {
+			return ops.Release(c.negate(children[0]), c.negate(children[1]))
+		}
+	case ops.ReleaseKind:
+		if c.singleToken(children[0]) && c.singleToken(children[1]) {
+			return ops.Until(c.negate(children[0]), c.negate(children[1]))
+		}
+	}
+	return ops.Not(c.nnf(op))
+}
+
+// Simplify returns op with redundancies removed.  The following rewrites are
+// always applied:
+//
+//	NOT NOT x  -> x
+//	NOT TRUE   -> FALSE
+//	NOT FALSE  -> TRUE
+//	x AND TRUE -> x
+//	x OR FALSE -> x
+//	x AND x    -> x
+//	x OR x     -> x
+//
+// The following are applied only where x (and y) accept exactly one Token:
+//
+//	x AND FALSE      -> FALSE
+//	x OR TRUE        -> TRUE
+//	x AND (x OR y)   -> x
+//	x OR (x AND y)   -> x
+//
+// Operators are considered identical if they print identically with
+// operators.PrettyPrint.  The commutative forms of all rewrites are also
+// applied.
+func Simplify(op ltl.Operator, opts ...Option) ltl.Operator {
+	return newConfig(opts).simplify(op)
+}
+
+func same(a, b ltl.Operator) bool {
+	if a == b {
+		return true
+	}
+	return ops.PrettyPrint(a, ops.Inline()) == ops.PrettyPrint(b, ops.Inline())
+}
+
+func (c *config) simplify(op ltl.Operator) ltl.Operator {
+	op = mapChildren(op, c.simplify)
+	children := ops.Children(op)
+	switch ops.KindOf(op) {
+	case ops.NotKind:
+		switch ops.KindOf(children[0]) {
+		case ops.NotKind:
+			return ops.Children(children[0])[0]
+		case ops.TrueKind:
+			return ops.False()
+		case ops.FalseKind:
+			return ops.True()
+		}
+	case ops.AndKind:
+		return c.simplifyJunction(op, children[0], children[1], ops.TrueKind, ops.FalseKind, ops.OrKind)
+	case ops.OrKind:
+		return c.simplifyJunction(op, children[0], children[1], ops.FalseKind, ops.TrueKind, ops.AndKind)
+	}
+	return op
+}
+
+// simplifyJunction simplifies op, an AND or OR of left and right, given the
+// Kinds of its identity element, its annihilating element, and its dual.
+func (c *config) simplifyJunction(op, left, right ltl.Operator, identity, annihilator, dual ops.Kind) ltl.Operator {
+	for _, pair := range [][2]ltl.Operator{{left, right}, {right, left}} {
+		x, y := pair[0], pair[1]
+		if ops.KindOf(y) == identity {
+			return x
+		}
+		if ops.KindOf(y) == annihilator && c.singleToken(x) {
+			return y
+		}
+		if ops.KindOf(y) == dual && c.singleToken(y) {
+			for _, child := range ops.Children(y) {
+				if same(x, child) {
+					return x
+				}
+			}
+		}
+	}
+	if same(left, right) {
+		return left
+	}
+	return op
+}
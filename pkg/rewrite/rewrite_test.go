@@ -0,0 +1,159 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rewrite
+
+import (
+	rtok "github.com/ilhamster/ltl/examples/runetoken"
+	smatch "github.com/ilhamster/ltl/examples/stringmatcher"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	ops "github.com/ilhamster/ltl/pkg/operators"
+	"testing"
+)
+
+func sm(s string) ltl.Operator {
+	return smatch.New(s)
+}
+
+var a, b = sm("a"), sm("b")
+
+func pp(op ltl.Operator) string {
+	return ops.PrettyPrint(op, ops.Inline())
+}
+
+// run applies input to op, returning the Environments it produces, including
+// its final Environment at the end of input.
+func run(op ltl.Operator, input string) []bool {
+	var ret []bool
+	var env ltl.Environment
+	for idx, ch := range input {
+		op, env = ltl.Match(op, rtok.New(ch, idx))
+		ret = append(ret, env.Matching())
+	}
+	return append(ret, ltl.Finish(op).Matching())
+}
+
+// checkEquivalent verifies that got behaves like want on a set of inputs.
+func checkEquivalent(t *testing.T, want, got ltl.Operator) {
+	t.Helper()
+	for _, input := range []string{"", "a", "b", "c", "ab", "ba", "abc", "cba", "aabb", "bbaa", "acbca"} {
+		wantRes, gotRes := run(want, input), run(got, input)
+		for idx := range wantRes {
+			if wantRes[idx] != gotRes[idx] {
+				t.Errorf("On input '%s', %s produced %v but %s produced %v", input, pp(want), wantRes, pp(got), gotRes)
+				break
+			}
+		}
+	}
+}
+
+func TestNNF(t *testing.T) {
+	p := ops.Predicate(func(tok ltl.Token) (bool, error) {
+		return tok.String() == "a", nil
+	}, ops.PredicateName("p"))
+	// IMPLIES has no constructor, but appears within RespondsTo.
+	implies, err := ops.FromState(ops.State{Type: string(ops.ImpliesKind)}, a, b)
+	if err != nil {
+		t.Fatalf("FromState() yielded unexpected error %s", err)
+	}
+	tests := []struct {
+		op   ltl.Operator
+		opts []Option
+		want ltl.Operator
+	}{
+		{ops.Not(ops.Not(a)), nil, a},
+		{ops.Not(ops.And(a, b)), nil, ops.Not(ops.And(a, b))},
+		{ops.Not(ops.And(a, b)), []Option{AssumeSingleTokenLeaves()}, ops.Or(ops.Not(a), ops.Not(b))},
+		{ops.Not(ops.Or(p, ops.True())), nil, ops.And(ops.Not(p), ops.False())},
+		{ops.Not(ops.Eventually(ops.Or(a, b))), []Option{AssumeSingleTokenLeaves()},
+			ops.Globally(ops.And(ops.Not(a), ops.Not(b)))},
+		{ops.Not(ops.Globally(ops.Not(a))), []Option{AssumeSingleTokenLeaves()}, ops.Eventually(a)},
+		{ops.Not(ops.Until(a, b)), []Option{AssumeSingleTokenLeaves()}, ops.Release(ops.Not(a), ops.Not(b))},
+		{ops.Not(ops.Release(a, ops.Not(b))), []Option{AssumeSingleTokenLeaves()}, ops.Until(ops.Not(a), b)},
+		{ops.Not(implies), []Option{AssumeSingleTokenLeaves()}, ops.And(a, ops.Not(b))},
+		{ops.Not(ops.Eventually(ops.Then(a, b))), []Option{AssumeSingleTokenLeaves()}, ops.Not(ops.Eventually(ops.Then(a, b)))},
+		{ops.Not(ops.Then(a, ops.Not(ops.Not(b)))), nil, ops.Not(ops.Then(a, b))},
+	}
+	for _, test := range tests {
+		t.Run(pp(test.op), func(t *testing.T) {
+			got := NNF(test.op, test.opts...)
+			if pp(got) != pp(test.want) {
+				t.Fatalf("NNF() = %s, wanted %s", pp(got), pp(test.want))
+			}
+			checkEquivalent(t, test.op, got)
+		})
+	}
+}
+
+func TestSimplify(t *testing.T) {
+	tests := []struct {
+		op   ltl.Operator
+		opts []Option
+		want ltl.Operator
+	}{
+		{ops.Not(ops.Not(sm("ab"))), nil, sm("ab")},
+		{ops.Not(ops.True()), nil, ops.False()},
+		{ops.And(sm("ab"), ops.True()), nil, sm("ab")},
+		{ops.And(ops.True(), sm("ab")), nil, sm("ab")},
+		{ops.Or(ops.False(), sm("ab")), nil, sm("ab")},
+		{ops.And(sm("ab"), sm("ab")), nil, sm("ab")},
+		{ops.Or(ops.Eventually(a), ops.Eventually(a)), nil, ops.Eventually(a)},
+		{ops.And(sm("ab"), ops.False()), nil, ops.And(sm("ab"), ops.False())},
+		{ops.And(a, ops.False()), []Option{AssumeSingleTokenLeaves()}, ops.False()},
+		{ops.Or(ops.True(), a), []Option{AssumeSingleTokenLeaves()}, ops.True()},
+		{ops.And(a, ops.Or(b, a)), nil, ops.And(a, ops.Or(b, a))},
+		{ops.And(a, ops.Or(b, a)), []Option{AssumeSingleTokenLeaves()}, a},
+		{ops.Or(ops.And(a, b), a), []Option{AssumeSingleTokenLeaves()}, a},
+		{ops.Then(ops.Not(ops.Not(ops.And(a, ops.True()))), ops.Or(b, ops.Not(ops.True()))), nil, ops.Then(a, b)},
+	}
+	for _, test := range tests {
+		t.Run(pp(test.op), func(t *testing.T) {
+			got := Simplify(test.op, test.opts...)
+			if pp(got) != pp(test.want) {
+				t.Fatalf("Simplify() = %s, wanted %s", pp(got), pp(test.want))
+			}
+			checkEquivalent(t, test.op, got)
+		})
+	}
+}
+
+func TestRewriter(t *testing.T) {
+	limitEventually := KindRule(ops.EventuallyKind, func(op ltl.Operator, _ []ltl.Operator) ltl.Operator {
+		return ops.Limit(10, op)
+	})
+	swapUntil := KindRule(ops.UntilKind, func(_ ltl.Operator, children []ltl.Operator) ltl.Operator {
+		return ops.Release(children[1], children[0])
+	})
+	tests := []struct {
+		rw   *Rewriter
+		op   ltl.Operator
+		want ltl.Operator
+	}{
+		{NewRewriter(limitEventually), ops.Eventually(a), ops.Limit(10, ops.Eventually(a))},
+		{NewRewriter(limitEventually), ops.Then(ops.Eventually(a), ops.Eventually(ops.Eventually(b))),
+			ops.Then(ops.Limit(10, ops.Eventually(a)), ops.Limit(10, ops.Eventually(ops.Limit(10, ops.Eventually(b)))))},
+		{NewRewriter(limitEventually), ops.Globally(a), ops.Globally(a)},
+		{NewRewriter().Register(swapUntil).Register(SimplifyRule()),
+			ops.Until(ops.Not(ops.Not(a)), ops.And(b, ops.True())), ops.Release(b, a)},
+		{NewRewriter(SimplifyRule(), limitEventually),
+			ops.Eventually(ops.Or(a, ops.False())), ops.Limit(10, ops.Eventually(a))},
+	}
+	for _, test := range tests {
+		t.Run(pp(test.op), func(t *testing.T) {
+			if got := test.rw.Rewrite(test.op); pp(got) != pp(test.want) {
+				t.Fatalf("Rewrite() = %s, wanted %s", pp(got), pp(test.want))
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rewrite
+
+import (
+	"github.com/ilhamster/ltl/pkg/ltl"
+	ops "github.com/ilhamster/ltl/pkg/operators"
+)
+
+// Rule is a user-defined rewrite of a single Operator.  If the rule applies to
+// the provided Operator, it returns the Operator's replacement and true;
+// otherwise it returns false.
+type Rule func(op ltl.Operator) (ltl.Operator, bool)
+
+// KindRule returns a Rule applying to Operators of the specified Kind.
+// replace is provided the matched Operator and its children, and returns the
+// matched Operator's replacement.
+func KindRule(kind ops.Kind, replace func(op ltl.Operator, children []ltl.Operator) ltl.Operator) Rule {
+	return func(op ltl.Operator) (ltl.Operator, bool) {
+		if op == nil || ops.KindOf(op) != kind {
+			return nil, false
+		}
+		return replace(op, ops.Children(op)), true
+	}
+}
+
+// SimplifyRule returns a Rule applying Simplify, with the provided Options, to
+// each Operator.
+func SimplifyRule(opts ...Option) Rule {
+	return func(op ltl.Operator) (ltl.Operator, bool) {
+		return Simplify(op, opts...), true
+	}
+}
+
+// Rewriter applies a set of registered Rules to operator trees.
+type Rewriter struct {
+	rules []Rule
+}
+
+// NewRewriter returns a new Rewriter applying the provided Rules.
+func NewRewriter(rules ...Rule) *Rewriter {
+	return &Rewriter{rules: rules}
+}
+
+// Register adds a Rule to the receiver, to be applied after any already
+// registered.  It returns the receiver.
+func (rw *Rewriter) Register(rule Rule) *Rewriter {
+	rw.rules = append(rw.rules, rule)
+	return rw
+}
+
+// Rewrite applies the receiver's Rules to the provided operator tree,
+// returning the rewritten tree.  Rules are applied bottom-up: each Operator's
+// children are rewritten before it is.  Each Operator is offered to every
+// Rule in registration order, each Rule seeing the result of the previous
+// ones.  Replacements are not themselves rewritten further, so a Rule may
+// safely wrap the Operator it matches, as in
+//
+//	NewRewriter(KindRule(operators.EventuallyKind,
+//		func(op ltl.Operator, _ []ltl.Operator) ltl.Operator {
+//			return operators.Limit(1000, op)
+//		}))
+func (rw *Rewriter) Rewrite(op ltl.Operator) ltl.Operator {
+	if op == nil {
+		return nil
+	}
+	op = mapChildren(op, rw.Rewrite)
+	for _, rule := range rw.rules {
+		if newOp, ok := rule(op); ok {
+			op = newOp
+		}
+	}
+	return op
+}
@@ -0,0 +1,259 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package robustness evaluates operator trees built from package operators
+// under the quantitative semantics of signal temporal logic (STL): rather
+// than whether a finite input satisfies a formula, it reports a real number,
+// the formula's robustness, indicating how strongly the input satisfies it,
+// if positive, or violates it, if not.
+//
+// The robustness of a leaf, such as a matcher, on a Token is that reported by
+// ltl.RobustnessOf for the Environment it returns, or, if it is not Robust,
+// +Inf if it matches, NaN if it is ltl.Unknown, and -Inf otherwise.  Leaves
+// are assumed to accept a single Token.  Robustness propagates through the operators as in STL:
+//
+//	Not:        the negation of its child's
+//	And:        the minimum of its children's
+//	Or:         the maximum of its children's
+//	Implies:    the maximum of its antecedent's negation and its consequent's
+//	Next:       its child's on the following Token
+//	Eventually: the maximum of its child's from each remaining Token
+//	Globally:   the minimum of its child's from each remaining Token
+//	Until:      the maximum, over each remaining Token, of the minimum of its
+//	            right child's there and its left child's on every Token before
+//	Release:    the dual of Until
+//	Then:       the minimum of its left child's, and its right child's once
+//	            its left child's input is consumed
+//
+// Unlike matching, which resolves as soon as it can, robustness evaluation
+// considers the entire input: Eventually, for instance, reports how strongly
+// its child is satisfied at best, not merely the first time it is.  Then and
+// Sequence are supported only when each child but the last accepts a fixed
+// number of Tokens, and other operators are not supported.
+package robustness
+
+import (
+	"fmt"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	ops "github.com/ilhamster/ltl/pkg/operators"
+	"math"
+)
+
+// Evaluate returns the robustness of the provided operator tree on the
+// provided input, which should not include an end-of-input Token.  If any
+// leaf returns an Erroring Environment, or the tree uses an unsupported
+// operator, Evaluate returns an error.
+func Evaluate(op ltl.Operator, toks []ltl.Token) (float64, error) {
+	e := &evaluator{toks: toks, memo: map[key]float64{}}
+	return e.eval(op, 0)
+}
+
+// key identifies a subformula at a position in the input.
+type key struct {
+	op  ltl.Operator
+	pos int
+}
+
+type evaluator struct {
+	toks []ltl.Token
+	// memo stores the robustness of each subformula at each position.
+	memo map[key]float64
+}
+
+// token returns the Token at the provided position, or an end-of-input Token
+// past the end of the input.
+func (e *evaluator) token(pos int) ltl.Token {
+	if pos < len(e.toks) {
+		return e.toks[pos]
+	}
+	return ltl.EOIToken{}
+}
+
+func (e *evaluator) eval(op ltl.Operator, pos int) (float64, error) {
+	if op == nil {
+		return math.Inf(-1), nil
+	}
+	if len(ops.Children(op)) == 0 {
+		// Leaves need not be comparable, and are cheap to evaluate.
+		return e.evalUncached(op, pos)
+	}
+	k := key{op, pos}
+	if rho, ok := e.memo[k]; ok {
+		return rho, nil
+	}
+	rho, err := e.evalUncached(op, pos)
+	if err != nil {
+		return 0, err
+	}
+	e.memo[k] = rho
+	return rho, nil
+}
+
+func (e *evaluator) evalUncached(op ltl.Operator, pos int) (float64, error) {
+	children := ops.Children(op)
+	switch ops.KindOf(op) {
+	case ops.NotKind:
+		rho, err := e.eval(children[0], pos)
+		return -rho, err
+	case ops.AndKind:
+		return e.combine(math.Min, children[0], children[1], pos)
+	case ops.OrKind:
+		return e.combine(math.Max, children[0], children[1], pos)
+	case ops.ImpliesKind:
+		return e.combine(func(a, b float64) float64 {
+			return math.Max(-a, b)
+		}, children[0], children[1], pos)
+	case ops.NextKind:
+		if pos >= len(e.toks) {
+			return math.Inf(-1), nil
+		}
+		return e.eval(children[0], pos+1)
+	case ops.EventuallyKind:
+		return e.fold(math.Max, math.Inf(-1), children[0], pos)
+	case ops.GloballyKind:
+		return e.fold(math.Min, math.Inf(1), children[0], pos)
+	case ops.UntilKind:
+		return e.until(children[0], children[1], pos, false)
+	case ops.ReleaseKind:
+		return e.until(children[0], children[1], pos, true)
+	case ops.ThenKind, ops.SequenceKind:
+		return e.then(children, pos)
+	case ops.TrueKind, ops.FalseKind, ops.AnyTokenKind, ops.PredicateKind, ops.Other:
+		if len(children) == 0 {
+			return e.leaf(op, pos)
+		}
+	}
+	return 0, fmt.Errorf("cannot evaluate the robustness of operator %s", op)
+}
+
+// leaf returns the robustness of the provided leaf on the Token at pos.
+func (e *evaluator) leaf(op ltl.Operator, pos int) (float64, error) {
+	_, env := op.Match(e.token(pos))
+	if err := env.Err(); err != nil {
+		return 0, err
+	}
+	if rho, ok := ltl.RobustnessOf(env); ok {
+		return rho, nil
+	}
+	if ltl.IsUnknown(env) {
+		return math.NaN(), nil
+	}
+	if env.Matching() {
+		return math.Inf(1), nil
+	}
+	return math.Inf(-1), nil
+}
+
+// combine returns f of the robustnesses of a and b at pos.
+func (e *evaluator) combine(f func(a, b float64) float64, a ltl.Operator, b ltl.Operator, pos int) (float64, error) {
+	aRho, err := e.eval(a, pos)
+	if err != nil {
+		return 0, err
+	}
+	bRho, err := e.eval(b, pos)
+	if err != nil {
+		return 0, err
+	}
+	return f(aRho, bRho), nil
+}
+
+// fold returns f over the robustnesses of op at each position from pos to
+// the end of the input, starting from init.
+func (e *evaluator) fold(f func(a, b float64) float64, init float64, op ltl.Operator, pos int) (float64, error) {
+	ret := init
+	for ; pos < len(e.toks); pos++ {
+		rho, err := e.eval(op, pos)
+		if err != nil {
+			return 0, err
+		}
+		ret = f(ret, rho)
+	}
+	return ret, nil
+}
+
+// until returns the robustness of left UNTIL right at pos, or, if release
+// is true, of left RELEASE right.
+func (e *evaluator) until(left, right ltl.Operator, pos int, release bool) (float64, error) {
+	outer, inner := math.Max, math.Min
+	ret, prefix := math.Inf(-1), math.Inf(1)
+	if release {
+		outer, inner = inner, outer
+		ret, prefix = prefix, ret
+	}
+	for ; pos < len(e.toks); pos++ {
+		rightRho, err := e.eval(right, pos)
+		if err != nil {
+			return 0, err
+		}
+		ret = outer(ret, inner(rightRho, prefix))
+		leftRho, err := e.eval(left, pos)
+		if err != nil {
+			return 0, err
+		}
+		prefix = inner(prefix, leftRho)
+	}
+	return ret, nil
+}
+
+// then returns the robustness of the concatenation of the provided children
+// at pos.
+func (e *evaluator) then(children []ltl.Operator, pos int) (float64, error) {
+	ret := math.Inf(1)
+	for idx, child := range children {
+		rho, err := e.eval(child, pos)
+		if err != nil {
+			return 0, err
+		}
+		ret = math.Min(ret, rho)
+		if idx == len(children)-1 {
+			break
+		}
+		n, ok := extent(child)
+		if !ok {
+			return 0, fmt.Errorf("cannot evaluate the robustness of a concatenation of %s, which accepts a variable number of Tokens", child)
+		}
+		pos += n
+	}
+	return ret, nil
+}
+
+// extent returns the number of Tokens the provided operator tree accepts, and
+// true, if it is fixed, or false otherwise.
+func extent(op ltl.Operator) (int, bool) {
+	children := ops.Children(op)
+	switch ops.KindOf(op) {
+	case ops.NotKind:
+		return extent(children[0])
+	case ops.AndKind, ops.OrKind, ops.ImpliesKind:
+		left, leftOk := extent(children[0])
+		right, rightOk := extent(children[1])
+		return left, leftOk && rightOk && left == right
+	case ops.NextKind:
+		n, ok := extent(children[0])
+		return n + 1, ok
+	case ops.ThenKind, ops.SequenceKind:
+		ret := 0
+		for _, child := range children {
+			n, ok := extent(child)
+			if !ok {
+				return 0, false
+			}
+			ret += n
+		}
+		return ret, true
+	case ops.TrueKind, ops.FalseKind, ops.AnyTokenKind, ops.PredicateKind, ops.Other:
+		return 1, len(children) == 0
+	}
+	return 0, false
+}
@@ -0,0 +1,96 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package robustness
+
+import (
+	"github.com/ilhamster/ltl/examples/signals"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	ops "github.com/ilhamster/ltl/pkg/operators"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// xs returns ValueTokens with the provided values of signal x.
+func xs(vals ...float64) []ltl.Token {
+	var toks []ltl.Token
+	for _, v := range vals {
+		toks = append(toks, signals.ValueToken{"x": v})
+	}
+	return toks
+}
+
+func TestEvaluate(t *testing.T) {
+	above, below := signals.Above, signals.Below
+	inf := math.Inf(1)
+	tests := []struct {
+		op      ltl.Operator
+		input   []ltl.Token
+		wantRho float64
+	}{
+		{above("x", 1), xs(3), 2},
+		{ops.Not(above("x", 1)), xs(3), -2},
+		{ops.And(above("x", 1), below("x", 4)), xs(3), 1},
+		{ops.Or(above("x", 1), below("x", 4)), xs(3), 2},
+		{ops.RespondsTo(above("x", 1), below("x", 2)), xs(3), -1},
+		{ops.Next(above("x", 1)), xs(3, 5), 4},
+		{ops.Next(above("x", 1)), xs(3), -inf},
+		{ops.Eventually(above("x", 1)), xs(0, 4, 2), 3},
+		{ops.Eventually(above("x", 1)), xs(0, 0.5), -0.5},
+		{ops.Globally(above("x", 1)), xs(2, 4, 3), 1},
+		{ops.Globally(above("x", 1)), xs(2, 0.5, 3), -0.5},
+		{ops.Globally(above("x", 1)), nil, inf},
+		{ops.Until(above("x", 1), above("x", 5)), xs(2, 3, 7), 1},
+		{ops.Until(above("x", 1), above("x", 5)), xs(2, 0, 7), -1},
+		{ops.Release(above("x", 5), above("x", 1)), xs(2, 3, 7), 1},
+		{ops.Then(above("x", 1), above("x", 2)), xs(3, 2.5), 0.5},
+		{ops.Then(above("x", 1), ops.Globally(above("x", 2))), xs(3, 4, 5), 2},
+		{ops.Sequence(above("x", 1), above("x", 2), above("x", 3)), xs(9, 9, 4), 1},
+		{ops.And(above("x", 1), ops.True()), xs(3), 2},
+		{ops.Globally(ops.Or(ops.Not(above("x", 5)), ops.Next(below("x", 5)))), xs(6, 4, 7, 1), 1},
+		{ops.RespondsTo(above("x", 5), below("x", 5)), xs(6, 4, 7, 1), 4},
+	}
+	for _, test := range tests {
+		var inputs []string
+		for _, tok := range test.input {
+			inputs = append(inputs, strconv.FormatFloat(tok.(signals.ValueToken)["x"], 'g', -1, 64))
+		}
+		t.Run(ops.PrettyPrint(test.op, ops.Inline())+" <- "+strings.Join(inputs, ";"), func(t *testing.T) {
+			rho, err := Evaluate(test.op, test.input)
+			if err != nil {
+				t.Fatalf("Evaluate() yielded unexpected error %s", err)
+			}
+			if rho != test.wantRho {
+				t.Errorf("Got robustness %g, wanted %g", rho, test.wantRho)
+			}
+		})
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	tests := []ltl.Operator{
+		ops.Limit(2, signals.Above("x", 1)),
+		ops.Then(ops.Eventually(signals.Above("x", 1)), signals.Above("x", 1)),
+		signals.NewMatcher("a"),
+	}
+	for _, op := range tests {
+		t.Run(ops.PrettyPrint(op, ops.Inline()), func(t *testing.T) {
+			if _, err := Evaluate(op, xs(1, 2)); err == nil {
+				t.Errorf("Evaluate() yielded no error")
+			}
+		})
+	}
+}
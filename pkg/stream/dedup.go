@@ -0,0 +1,199 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stream
+
+import (
+	"fmt"
+	be "github.com/ilhamster/ltl/pkg/bindingenvironment"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	ops "github.com/ilhamster/ltl/pkg/operators"
+	"github.com/ilhamster/ltl/pkg/tags"
+	"strings"
+)
+
+// dedup merges live instances whose states are equivalent into the one that
+// began earliest, retiring the others.  Two instances are equivalent if their
+// continuations, and the Environments those retain, are identical apart from
+// captured Tokens and tags; the surviving instance captures the Tokens, and
+// carries the tags, of both.
+func (r *Runner) dedup() {
+	seen := map[string]int{}
+	for idx := range r.instances {
+		inst := &r.instances[idx]
+		if inst.op == nil {
+			continue
+		}
+		k := stateKey(inst.op)
+		first, ok := seen[k]
+		if !ok {
+			seen[k] = idx
+			continue
+		}
+		older := &r.instances[first]
+		if merged, changed := mergeStates(older.op, inst.op); changed {
+			older.op = merged
+		}
+		inst.op = nil
+	}
+}
+
+// stateKey returns a canonical encoding of the state of the provided
+// continuation, excluding captured Tokens and tags.  Operators not defined in package
+// operators are distinguished by their type and String.
+func stateKey(op ltl.Operator) string {
+	sb := &strings.Builder{}
+	writeOpKey(sb, op)
+	return sb.String()
+}
+
+func writeOpKey(sb *strings.Builder, op ltl.Operator) {
+	s, ok := ops.StateOf(op)
+	if !ok {
+		fmt.Fprintf(sb, "%T:%s", op, op)
+	} else {
+		fmt.Fprintf(sb, "%s/%d/%t/%t/%d/%d/%d", s.Type, s.Count, s.Parallel, s.Started, s.Lo, s.Hi, s.Start.UnixNano())
+		for _, env := range s.Envs {
+			sb.WriteString("{")
+			writeEnvKey(sb, env)
+			sb.WriteString("}")
+		}
+		for _, tok := range s.Tokens {
+			fmt.Fprintf(sb, "<%T:%s>", tok, tok)
+		}
+	}
+	sb.WriteString("(")
+	for _, child := range ops.Children(op) {
+		writeOpKey(sb, child)
+		sb.WriteString(",")
+	}
+	sb.WriteString(")")
+}
+
+func writeEnvKey(sb *strings.Builder, env ltl.Environment) {
+	if env == nil {
+		sb.WriteString("nil")
+		return
+	}
+	s, ok := be.StateOf(env)
+	if !ok {
+		fmt.Fprintf(sb, "%T:%s", env, env)
+		return
+	}
+	fmt.Fprintf(sb, "%s/%t/%t/%s/%s", s.Type, s.Matching, s.HasRefs, s.Bound, s.Referenced)
+	if s.Type != be.NodeState {
+		sb.WriteString("(")
+		writeEnvKey(sb, s.Left)
+		sb.WriteString(",")
+		writeEnvKey(sb, s.Right)
+		sb.WriteString(")")
+	}
+}
+
+// mergeStates returns a, with the Tokens captured and the tags carried by the
+// corresponding Environments of b, which must have the same stateKey, added to
+// those of its own Environments, and true if any were added.
+func mergeStates(a, b ltl.Operator) (ltl.Operator, bool) {
+	sa, okA := ops.StateOf(a)
+	sb, okB := ops.StateOf(b)
+	if !okA || !okB || sa.Type != sb.Type || len(sa.Envs) != len(sb.Envs) {
+		return a, false
+	}
+	childrenA, childrenB := ops.Children(a), ops.Children(b)
+	if len(childrenA) != len(childrenB) {
+		return a, false
+	}
+	changed := false
+	children := make([]ltl.Operator, len(childrenA))
+	for idx := range childrenA {
+		var c bool
+		children[idx], c = mergeStates(childrenA[idx], childrenB[idx])
+		changed = changed || c
+	}
+	envs := append([]ltl.Environment(nil), sa.Envs...)
+	for idx := range envs {
+		var c bool
+		envs[idx], c = mergeEnvs(envs[idx], sb.Envs[idx])
+		changed = changed || c
+	}
+	if !changed {
+		return a, false
+	}
+	sa.Envs = envs
+	ret, err := ops.FromState(sa, children...)
+	if err != nil {
+		return a, false
+	}
+	return ret, true
+}
+
+// mergeEnvs returns a, with the Tokens captured and the tags carried by b,
+// which must have the same key, added to its own, and true if any were added.
+func mergeEnvs(a, b ltl.Environment) (ltl.Environment, bool) {
+	sa, okA := be.StateOf(a)
+	sb, okB := be.StateOf(b)
+	if !okA || !okB || sa.Type != sb.Type {
+		return a, false
+	}
+	changed := false
+	if sa.Type == be.NodeState {
+		var addedM, addedNM bool
+		sa.CapturedMatching, addedM = unionTokens(sa.CapturedMatching, sb.CapturedMatching)
+		sa.CapturedNotMatching, addedNM = unionTokens(sa.CapturedNotMatching, sb.CapturedNotMatching)
+		changed = unionTags(&sa, sb) || addedM || addedNM
+	} else {
+		var c bool
+		sa.Left, changed = mergeEnvs(sa.Left, sb.Left)
+		sa.Right, c = mergeEnvs(sa.Right, sb.Right)
+		changed = changed || c
+	}
+	if !changed {
+		return a, false
+	}
+	ret, err := be.FromState(sa)
+	if err != nil {
+		return a, false
+	}
+	return ret, true
+}
+
+// unionTokens returns the union of a and b, and true if it has Tokens not in
+// a.
+func unionTokens(a, b []ltl.Token) ([]ltl.Token, bool) {
+	have := make(map[ltl.Token]struct{}, len(a))
+	for _, tok := range a {
+		have[tok] = struct{}{}
+	}
+	ret := a
+	for _, tok := range b {
+		if _, ok := have[tok]; !ok {
+			ret = append(ret, tok)
+			have[tok] = struct{}{}
+		}
+	}
+	return ret, len(ret) > len(a)
+}
+
+// unionTags sets the tags of a to the union of those of a and b, merging tags
+// of the same Kind, and returns true if they changed.
+func unionTags(a *be.State, b be.State) bool {
+	ta := tags.New().Tag(true, a.TagsMatching...).Tag(false, a.TagsNotMatching...)
+	tb := tags.New().Tag(true, b.TagsMatching...).Tag(false, b.TagsNotMatching...)
+	union := ta.Union(tb)
+	if union.Eq(ta) {
+		return false
+	}
+	a.TagsMatching, a.TagsNotMatching = union.Get(true), union.Get(false)
+	return true
+}
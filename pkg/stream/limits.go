@@ -0,0 +1,206 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stream
+
+import (
+	"errors"
+	"fmt"
+	be "github.com/ilhamster/ltl/pkg/bindingenvironment"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	ops "github.com/ilhamster/ltl/pkg/operators"
+)
+
+// ErrLimitExceeded is matched, under errors.Is, by the error a Runner fails
+// with when one of its limits is exceeded under the FailOnLimit LimitPolicy.
+var ErrLimitExceeded = errors.New("stream limit exceeded")
+
+// LimitError is the error a Runner fails with when one of its limits is
+// exceeded under the FailOnLimit LimitPolicy.
+type LimitError struct {
+	// Resource names the limited resource: "live instances", "retained
+	// environment nodes", or "retained captures".
+	Resource string
+	// Used is the amount of the resource in use, and Max its limit.
+	Used, Max int
+}
+
+func (le *LimitError) Error() string {
+	return fmt.Sprintf("%s: %d %s exceed the maximum of %d", ErrLimitExceeded, le.Used, le.Resource, le.Max)
+}
+
+// Is returns true for ErrLimitExceeded.
+func (le *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+// LimitPolicy specifies how a Runner responds when the total resources held
+// by its live instances exceed one of its limits.
+type LimitPolicy int
+
+const (
+	// DropOldest retires the oldest live instances until no limit is exceeded.
+	// It is the default.
+	DropOldest LimitPolicy = iota
+	// FailOnLimit fails the Runner: the limit is reported to any OnError
+	// function, all live instances are retired, no further Tokens are
+	// processed, and Err returns an error wrapping ErrLimitExceeded.
+	FailOnLimit
+	// Block refuses to begin new instances while a limit is reached, letting
+	// existing instances proceed until they resolve.  Matches beginning at the
+	// Tokens so skipped are missed.  Block cannot bound the growth of existing
+	// instances, so it should be used with MaxLength when MaxEnvSize or
+	// MaxCaptures are set.
+	Block
+)
+
+// MaxEnvSize specifies the maximum total number of Environment nodes the live
+// instances of a Runner may retain.  By default, it is unbounded.
+func MaxEnvSize(n int) Option {
+	return func(c *config) {
+		c.maxEnvSize = n
+	}
+}
+
+// MaxCaptures specifies the maximum total number of captured Tokens the live
+// instances of a Runner may retain.  By default, it is unbounded.
+func MaxCaptures(n int) Option {
+	return func(c *config) {
+		c.maxCaptures = n
+	}
+}
+
+// OnLimit specifies the LimitPolicy a Runner applies when its MaxInstances,
+// MaxEnvSize, or MaxCaptures limits are exceeded.
+func OnLimit(p LimitPolicy) Option {
+	return func(c *config) {
+		c.onLimit = p
+	}
+}
+
+// usage is the resources held by one or more live instances.
+type usage struct {
+	instances, envSize, captures int
+}
+
+func (u *usage) add(o usage, sign int) {
+	u.instances += sign * o.instances
+	u.envSize += sign * o.envSize
+	u.captures += sign * o.captures
+}
+
+// exceeded returns a LimitError for the first limit u exceeds, or nil if none
+// is.  If reached is true, limits merely reached also count: a new instance
+// would exceed them.
+func (c *config) exceeded(u usage, reached bool) *LimitError {
+	slack := 0
+	if reached {
+		slack = 1
+	}
+	switch {
+	case c.maxInstances > 0 && u.instances+slack > c.maxInstances:
+		return &LimitError{"live instances", u.instances + slack, c.maxInstances}
+	case c.maxEnvSize > 0 && u.envSize+slack > c.maxEnvSize:
+		return &LimitError{"retained environment nodes", u.envSize, c.maxEnvSize}
+	case c.maxCaptures > 0 && u.captures+slack > c.maxCaptures:
+		return &LimitError{"retained captures", u.captures, c.maxCaptures}
+	}
+	return nil
+}
+
+// enforce applies the receiver's limits to its live instances.  Retained
+// Environments are only measured after matching, when post is true.
+func (r *Runner) enforce(post bool) {
+	sizes := post && (r.c.maxEnvSize > 0 || r.c.maxCaptures > 0)
+	if r.c.maxInstances <= 0 && !sizes {
+		return
+	}
+	var total usage
+	per := make([]usage, len(r.instances))
+	for idx, inst := range r.instances {
+		if inst.op == nil {
+			continue
+		}
+		per[idx].instances = 1
+		if sizes {
+			retained(inst.op, &per[idx])
+		}
+		total.add(per[idx], 1)
+	}
+	if r.c.onLimit == Block {
+		if post {
+			r.blocked = r.c.exceeded(total, true) != nil
+		}
+		return
+	}
+	for idx := 0; idx < len(r.instances); idx++ {
+		le := r.c.exceeded(total, false)
+		if le == nil {
+			return
+		}
+		if r.c.onLimit == FailOnLimit {
+			r.fail(le)
+			return
+		}
+		if r.instances[idx].op != nil {
+			r.instances[idx].op = nil
+			total.add(per[idx], -1)
+		}
+	}
+}
+
+// fail fails the receiver with the provided error.
+func (r *Runner) fail(err error) {
+	r.err = err
+	for idx := range r.instances {
+		r.instances[idx].op = nil
+	}
+	if r.c.onError != nil {
+		r.c.onError(NewMatch(r.pos, r.pos, ltl.ErrEnv(err)))
+	}
+}
+
+// Err returns the error with which the receiver failed, or nil if it has not.
+func (r *Runner) Err() error {
+	return r.err
+}
+
+// retained adds the Environment nodes, and captured Tokens, retained by the
+// provided continuation to u.
+func retained(op ltl.Operator, u *usage) {
+	if s, ok := ops.StateOf(op); ok {
+		for _, env := range s.Envs {
+			retainedEnv(env, u)
+		}
+	}
+	for _, child := range ops.Children(op) {
+		retained(child, u)
+	}
+}
+
+func retainedEnv(env ltl.Environment, u *usage) {
+	if env == nil {
+		return
+	}
+	u.envSize++
+	s, ok := be.StateOf(env)
+	if !ok {
+		return
+	}
+	u.captures += len(s.CapturedMatching) + len(s.CapturedNotMatching)
+	if s.Type != be.NodeState {
+		retainedEnv(s.Left, u)
+		retainedEnv(s.Right, u)
+	}
+}
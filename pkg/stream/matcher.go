@@ -0,0 +1,78 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stream
+
+import (
+	"context"
+	"github.com/ilhamster/ltl/pkg/ltl"
+)
+
+// Matcher monitors channels of Tokens for matches of an LTL formula, driving a
+// Runner on its own goroutine.
+type Matcher struct {
+	op   ltl.Operator
+	opts []Option
+}
+
+// NewMatcher returns a new Matcher for the provided Operator.  The provided
+// Options configure the Runner of each call to Run; any OnError function is
+// invoked on that call's goroutine.
+func NewMatcher(op ltl.Operator, opts ...Option) *Matcher {
+	return &Matcher{
+		op:   op,
+		opts: opts,
+	}
+}
+
+// Run starts a goroutine feeding the Tokens received from in to a new Runner,
+// and returns a channel on which that Runner's matches are sent.  When in is
+// closed, the Runner is finished, its remaining matches sent, and the returned
+// channel closed.  If the Runner fails, as under FailOnLimit, or ctx is done
+// first, the goroutine stops without finishing the Runner, discarding any
+// unsent matches, and closes the returned channel.  Run may be called several
+// times, including concurrently.
+func (m *Matcher) Run(ctx context.Context, in <-chan ltl.Token) <-chan Match {
+	out := make(chan Match)
+	go func() {
+		defer close(out)
+		stopped := false
+		r := New(m.op, func(match Match) {
+			if stopped {
+				return
+			}
+			select {
+			case out <- match:
+			case <-ctx.Done():
+				stopped = true
+			}
+		}, m.opts...)
+		for !stopped {
+			select {
+			case <-ctx.Done():
+				return
+			case tok, ok := <-in:
+				if !ok {
+					r.Finish()
+					return
+				}
+				r.Match(tok)
+				if r.Err() != nil {
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
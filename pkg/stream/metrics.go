@@ -0,0 +1,162 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stream
+
+import (
+	"expvar"
+	be "github.com/ilhamster/ltl/pkg/bindingenvironment"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	ops "github.com/ilhamster/ltl/pkg/operators"
+)
+
+// The names under which a Runner reports its Stats to a Metrics.
+const (
+	// Counters.
+	TokensMetric           = "tokens"
+	InstancesStartedMetric = "instances_started"
+	MatchesMetric          = "matches"
+	// Gauges.
+	LiveInstancesMetric = "live_instances"
+	EnvNodesMetric      = "retained_env_nodes"
+	MaxEnvDepthMetric   = "max_env_depth"
+	MaxBindingsMetric   = "max_bindings_per_env"
+	CapturesMetric      = "retained_captures"
+)
+
+// Metrics receives the measurements of a Runner.  It is small enough to be
+// bridged to most metrics systems, such as Prometheus or expvar.
+type Metrics interface {
+	// AddCounter adds delta to the named counter.
+	AddCounter(name string, delta int64)
+	// SetGauge sets the named gauge to value.
+	SetGauge(name string, value int64)
+}
+
+// WithMetrics specifies a Metrics to which a Runner reports its Stats after
+// each call to Match or Finish.  Since measuring a Runner walks everything its
+// live instances retain, this slows matching considerably.
+func WithMetrics(m Metrics) Option {
+	return func(c *config) {
+		c.metrics = m
+	}
+}
+
+// Stats describes the work done by a Runner, and the resources held by its
+// live instances.
+type Stats struct {
+	// Tokens is the number of Tokens matched, over all streams.
+	Tokens int64
+	// InstancesStarted is the number of instances begun, over all streams.
+	InstancesStarted int64
+	// Matches is the number of matches reported, over all streams.
+	Matches int64
+	// LiveInstances is the number of live instances.
+	LiveInstances int
+	// EnvNodes is the total number of Environment nodes retained.
+	EnvNodes int
+	// MaxEnvDepth is the depth of the deepest Environment tree retained.
+	MaxEnvDepth int
+	// MaxBindings is the largest number of names bound by any retained
+	// Environment.
+	MaxBindings int
+	// Captures is the total number of captured Tokens retained.
+	Captures int
+}
+
+// Stats returns the receiver's current Stats.
+func (r *Runner) Stats() Stats {
+	s := r.stats
+	var u usage
+	for _, inst := range r.instances {
+		if inst.op == nil {
+			continue
+		}
+		s.LiveInstances++
+		retained(inst.op, &u)
+		measure(inst.op, &s)
+	}
+	s.EnvNodes, s.Captures = u.envSize, u.captures
+	return s
+}
+
+// reportMetrics sends the receiver's Stats to its Metrics, if it has one.
+func (r *Runner) reportMetrics() {
+	m := r.c.metrics
+	if m == nil {
+		return
+	}
+	s := r.Stats()
+	m.AddCounter(TokensMetric, s.Tokens-r.reported.Tokens)
+	m.AddCounter(InstancesStartedMetric, s.InstancesStarted-r.reported.InstancesStarted)
+	m.AddCounter(MatchesMetric, s.Matches-r.reported.Matches)
+	m.SetGauge(LiveInstancesMetric, int64(s.LiveInstances))
+	m.SetGauge(EnvNodesMetric, int64(s.EnvNodes))
+	m.SetGauge(MaxEnvDepthMetric, int64(s.MaxEnvDepth))
+	m.SetGauge(MaxBindingsMetric, int64(s.MaxBindings))
+	m.SetGauge(CapturesMetric, int64(s.Captures))
+	r.reported = s
+}
+
+// measure updates the maxima in s with the Environments retained by the
+// provided continuation.
+func measure(op ltl.Operator, s *Stats) {
+	if state, ok := ops.StateOf(op); ok {
+		for _, env := range state.Envs {
+			if d := envDepth(env); d > s.MaxEnvDepth {
+				s.MaxEnvDepth = d
+			}
+			if es, ok := be.StateOf(env); ok && es.Bound.Length() > s.MaxBindings {
+				s.MaxBindings = es.Bound.Length()
+			}
+		}
+	}
+	for _, child := range ops.Children(op) {
+		measure(child, s)
+	}
+}
+
+func envDepth(env ltl.Environment) int {
+	if env == nil {
+		return 0
+	}
+	s, ok := be.StateOf(env)
+	if !ok || s.Type == be.NodeState {
+		return 1
+	}
+	left, right := envDepth(s.Left), envDepth(s.Right)
+	if left > right {
+		return left + 1
+	}
+	return right + 1
+}
+
+// ExpvarMetrics returns a Metrics publishing into the provided expvar.Map.
+func ExpvarMetrics(m *expvar.Map) Metrics {
+	return expvarMetrics{m}
+}
+
+type expvarMetrics struct {
+	m *expvar.Map
+}
+
+func (em expvarMetrics) AddCounter(name string, delta int64) {
+	em.m.Add(name, delta)
+}
+
+func (em expvarMetrics) SetGauge(name string, value int64) {
+	v := new(expvar.Int)
+	v.Set(value)
+	em.m.Set(name, v)
+}
@@ -0,0 +1,443 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package stream provides a Runner, which monitors a continuing stream of
+// Tokens for matches of an LTL formula starting at any point in the stream.
+//
+// A Runner begins a fresh instance of its formula at each Token, and feeds
+// each Token to every live instance, retiring instances as they resolve.
+// Since every live instance must be matched against every Token, the cost of
+// a Runner grows with the number of live instances; formulas that can remain
+// pending indefinitely, such as those using EVENTUALLY or GLOBALLY, should be
+// bounded, either within the formula with operators.Limit or with the
+// MaxInstances and MaxLength Options.  The MaxEnvSize and MaxCaptures Options
+// bound the memory retained by live instances, with a LimitPolicy determining
+// what happens when a limit is hit.
+//
+// A Matcher drives a Runner from a channel of Tokens, sending its matches on
+// another channel.
+package stream
+
+import (
+	"github.com/ilhamster/ltl/pkg/analysis"
+	be "github.com/ilhamster/ltl/pkg/bindingenvironment"
+	"github.com/ilhamster/ltl/pkg/bindings"
+	"github.com/ilhamster/ltl/pkg/captures"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	ops "github.com/ilhamster/ltl/pkg/operators"
+	"github.com/ilhamster/ltl/pkg/tags"
+)
+
+// Match describes a match reported by a Runner, or, more generally, the
+// outcome of matching a formula over a span of Tokens.
+type Match struct {
+	// Start is the index of the Token on which the matching instance began.
+	// Tokens are indexed from 0 in the order they are provided to the Runner.
+	Start int
+	// End is the index of the Token on which the instance matched.  For a match
+	// at the end of input, it is the index of the last Token.
+	End int
+	// Env is the matching Environment.
+	Env ltl.Environment
+	// Matching and Err are the matching state and error of Env.
+	Matching bool
+	Err      error
+	// Bindings, Captures, and Tags are the Bindings, Captures, and Tags of Env,
+	// or nil if it is not a binding Environment.
+	Bindings *bindings.Bindings
+	Captures *captures.Captures
+	Tags     *tags.Tags
+}
+
+// NewMatch returns a new Match for the provided span and Environment.
+func NewMatch(start, end int, env ltl.Environment) Match {
+	return Match{
+		Start:    start,
+		End:      end,
+		Env:      env,
+		Matching: env.Matching(),
+		Err:      env.Err(),
+		Bindings: be.Bindings(env),
+		Captures: be.Captures(env),
+		Tags:     be.Tags(env),
+	}
+}
+
+// FromResult returns a Match for the provided ltl.MatchResult.
+func FromResult(r ltl.MatchResult) Match {
+	return NewMatch(r.Start, r.End, r.Env)
+}
+
+// Captured returns the Tokens captured under the receiver's matching state,
+// in stream order.
+func (m Match) Captured() []ltl.Token {
+	return m.Captures.Ordered(m.Matching)
+}
+
+// Tagged returns the Tags applying under the receiver's matching state, in
+// order of Kind.
+func (m Match) Tagged() []tags.Tag {
+	return m.Tags.Get(m.Matching)
+}
+
+// Policy specifies which matches a Runner reports.  Since a Runner begins an
+// instance at every Token, and an instance may match many times, matches
+// commonly overlap; a Policy suppresses overlapping matches as they arise.
+type Policy int
+
+const (
+	// AllMatches reports every match of every instance.  It is the default.
+	AllMatches Policy = iota
+	// EarliestOnly reports only the first match of each instance, retiring the
+	// instance as it does so.
+	EarliestOnly
+	// NonOverlapping reports the first match to end, retiring all other live
+	// instances, which would overlap it.  If several instances match on the
+	// same Token, the one that began earliest is reported.
+	NonOverlapping
+	// LeftmostLongest reports, of each set of overlapping matches, the one that
+	// began earliest and, of those, the one that ended last.  Since it cannot
+	// be known whether a longer match is yet to come until an instance
+	// resolves, matches are reported only once the instance producing them,
+	// and all instances that began before it, have resolved.
+	LeftmostLongest
+)
+
+type config struct {
+	policy       Policy
+	maxInstances int
+	maxLength    int
+	maxEnvSize   int
+	maxCaptures  int
+	onLimit      LimitPolicy
+	dedup        bool
+	retireDead   bool
+	arenas       bool
+	onError      func(Match)
+	metrics      Metrics
+}
+
+// Option configures a Runner.
+type Option func(c *config)
+
+// WithPolicy specifies the Policy with which a Runner reports matches.
+func WithPolicy(p Policy) Option {
+	return func(c *config) {
+		c.policy = p
+	}
+}
+
+// MaxInstances specifies the maximum number of live instances a Runner
+// maintains.  When a new instance would exceed it, the Runner's LimitPolicy is
+// applied; under the default, DropOldest, the oldest live instance is retired,
+// though under LeftmostLongest any match it has already produced remains
+// eligible to be reported.  By default, the number of live instances is
+// unbounded.
+func MaxInstances(n int) Option {
+	return func(c *config) {
+		c.maxInstances = n
+	}
+}
+
+// MaxLength specifies the maximum number of Tokens an instance may consume.
+// An instance that has consumed this many Tokens without resolving is
+// retired.  By default, instances are not retired until they resolve.
+func MaxLength(n int) Option {
+	return func(c *config) {
+		c.maxLength = n
+	}
+}
+
+// Deduplicate specifies whether a Runner merges live instances that have
+// reached equivalent states, keeping memory bounded when many instances
+// converge.  An instance is merged into the equivalent instance that began
+// earliest, which captures the Tokens captured, and carries the tags attached,
+// by both; subsequent matches are
+// reported once, with the earlier Start.  Computing equivalence costs time
+// proportional to the size of each live instance at every Token.  By default,
+// instances are not deduplicated.
+func Deduplicate(dedup bool) Option {
+	return func(c *config) {
+		c.dedup = dedup
+	}
+}
+
+// RetireDead specifies whether a Runner retires live instances as soon as
+// analysis.Dead determines that they can never match, rather than waiting for
+// them to resolve.  This bounds the lifetime of instances of formulas, such as
+// those using GLOBALLY, whose continuations can linger after all hope of a
+// match is lost.  Analysis is costly, growing exponentially with the number of
+// distinct leaves in the formula, though its results are cached by instance
+// state.  By default, dead instances are not detected.
+func RetireDead(retire bool) Option {
+	return func(c *config) {
+		c.retireDead = retire
+	}
+}
+
+// Arenas specifies whether a Runner allocates the binding Environments of each
+// instance with a bindingenvironment.Arena, released when the instance is
+// retired.  This reduces garbage collection pressure under formulas that
+// build many binding Environments, at the cost of instrumenting each instance
+// with operators.WithArena as it begins.  By default, Arenas are not used.
+func Arenas(arenas bool) Option {
+	return func(c *config) {
+		c.arenas = arenas
+	}
+}
+
+// OnError specifies a function to be invoked with each Erroring Environment
+// produced by an instance.  The erroring instance is retired.  By default,
+// erroring instances are retired silently.
+func OnError(onError func(Match)) Option {
+	return func(c *config) {
+		c.onError = onError
+	}
+}
+
+type instance struct {
+	op    ltl.Operator
+	start int
+	// best is the longest match of the instance, under LeftmostLongest, not yet
+	// reported.
+	best *Match
+	// arena, if non-nil, allocates the instance's binding Environments.
+	arena *be.Arena
+}
+
+// Runner monitors a stream of Tokens for matches of an LTL formula.  A Runner
+// is not safe for concurrent use.
+type Runner struct {
+	op        ltl.Operator
+	factory   *ltl.OperatorFactory
+	onMatch   func(Match)
+	c         *config
+	instances []instance
+	pos       int
+	// blocked is set when, under Block, a limit is reached.
+	blocked bool
+	err     error
+	// dead caches, by stateKey, whether instance states are dead.
+	dead map[string]bool
+	// stats holds the receiver's counters, and reported the Stats last sent to
+	// its Metrics.
+	stats, reported Stats
+}
+
+// New returns a new Runner monitoring for matches of the provided Operator,
+// invoking onMatch for every matching Environment reported under its Policy.
+func New(op ltl.Operator, onMatch func(Match), opts ...Option) *Runner {
+	c := &config{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return &Runner{
+		op:      op,
+		factory: ltl.NewOperatorFactory(op),
+		onMatch: onMatch,
+		c:       c,
+	}
+}
+
+// Match begins a new instance of the receiver's formula at the provided Token,
+// then matches the Token against all live instances, reporting any matches.
+// If the receiver has failed, Match does nothing.
+func (r *Runner) Match(tok ltl.Token) {
+	if r.err != nil {
+		return
+	}
+	if r.op != nil && !r.blocked {
+		r.instances = append(r.instances, r.newInstance())
+		r.stats.InstancesStarted++
+	}
+	r.enforce(false)
+	for idx := range r.instances {
+		inst := &r.instances[idx]
+		if inst.op == nil {
+			continue
+		}
+		var env ltl.Environment
+		inst.op, env = inst.op.Match(tok)
+		r.report(inst, env)
+		if r.c.maxLength > 0 && r.pos-inst.start+1 >= r.c.maxLength {
+			inst.op = nil
+		}
+	}
+	if r.c.dedup {
+		r.dedup()
+	}
+	if r.c.retireDead {
+		r.retireDeadInstances()
+	}
+	r.enforce(true)
+	r.settle()
+	r.pos++
+	r.stats.Tokens++
+	r.reportMetrics()
+}
+
+// newInstance returns a new instance beginning at the current Token.
+func (r *Runner) newInstance() instance {
+	inst := instance{op: r.factory.New(), start: r.pos}
+	if r.c.arenas {
+		inst.arena = be.NewArena()
+		inst.op = ops.WithArena(inst.op, inst.arena)
+	}
+	return inst
+}
+
+// Finish resolves all live instances at the end of input, reporting any
+// matches, and retires them.  The Runner may then be reused for a new stream,
+// whose Tokens are indexed from 0.
+func (r *Runner) Finish() {
+	r.pos--
+	for idx := range r.instances {
+		inst := &r.instances[idx]
+		if inst.op == nil {
+			continue
+		}
+		env := ltl.Finish(inst.op)
+		inst.op = nil
+		r.report(inst, env)
+	}
+	r.settle()
+	r.instances = nil
+	r.pos = 0
+	r.blocked = false
+	r.reportMetrics()
+}
+
+// report handles env, produced by inst on the current Token, under the
+// receiver's Policy.  Erroring instances are retired.
+func (r *Runner) report(inst *instance, env ltl.Environment) {
+	m := NewMatch(inst.start, r.pos, env)
+	if ltl.IsErroring(env) {
+		if r.c.onError != nil {
+			r.c.onError(m)
+		}
+		inst.op = nil
+		return
+	}
+	if !env.Matching() {
+		return
+	}
+	switch r.c.policy {
+	case EarliestOnly:
+		inst.op = nil
+	case NonOverlapping:
+		for idx := range r.instances {
+			r.instances[idx].op = nil
+		}
+	case LeftmostLongest:
+		inst.best = &m
+		return
+	}
+	r.emit(m)
+}
+
+// settle drops retired instances, first reporting, under LeftmostLongest, the
+// pending matches of those that began before all other instances.
+func (r *Runner) settle() {
+	kept := r.instances[:0]
+	floor := -1
+	for _, inst := range r.instances {
+		// Retired instances, and those dropped below, need their Arenas no
+		// longer.
+		if inst.op == nil || inst.start <= floor {
+			inst.arena.Release()
+		}
+		if inst.start <= floor {
+			continue
+		}
+		if inst.op == nil {
+			if inst.best == nil {
+				continue
+			}
+			if len(kept) == 0 {
+				r.emit(*inst.best)
+				floor = inst.best.End
+				continue
+			}
+		}
+		kept = append(kept, inst)
+	}
+	// Clear dropped instances, so that they may be collected.
+	for idx := len(kept); idx < len(r.instances); idx++ {
+		r.instances[idx] = instance{}
+	}
+	r.instances = kept
+}
+
+func (r *Runner) emit(m Match) {
+	r.stats.Matches++
+	if r.onMatch != nil {
+		r.onMatch(m)
+	}
+}
+
+// maxDeadCache is the number of instance states whose deadness a Runner
+// caches; when it is reached, the cache is cleared.
+const maxDeadCache = 4096
+
+// retireDeadInstances retires all live instances that can never match.
+// Instances whose analysis fails are left live.
+func (r *Runner) retireDeadInstances() {
+	for idx := range r.instances {
+		inst := &r.instances[idx]
+		if inst.op == nil {
+			continue
+		}
+		k := stateKey(inst.op)
+		dead, ok := r.dead[k]
+		if !ok {
+			dead, _ = analysis.Dead(inst.op)
+			if r.dead == nil || len(r.dead) >= maxDeadCache {
+				r.dead = map[string]bool{}
+			}
+			r.dead[k] = dead
+		}
+		if dead {
+			inst.op = nil
+		}
+	}
+}
+
+// InstanceProgress describes the progress of a live instance.
+type InstanceProgress struct {
+	// Start is the index of the Token on which the instance began.
+	Start int
+	analysis.Progress
+}
+
+// Progress returns the progress of each live instance, in order of Start.
+func (r *Runner) Progress() []InstanceProgress {
+	var ret []InstanceProgress
+	for _, inst := range r.instances {
+		if inst.op != nil {
+			ret = append(ret, InstanceProgress{inst.start, analysis.ProgressOf(r.op, inst.op)})
+		}
+	}
+	return ret
+}
+
+// Live returns the number of live instances.
+func (r *Runner) Live() int {
+	ret := 0
+	for _, inst := range r.instances {
+		if inst.op != nil {
+			ret++
+		}
+	}
+	return ret
+}
@@ -0,0 +1,390 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stream
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	rtok "github.com/ilhamster/ltl/examples/runetoken"
+	smatch "github.com/ilhamster/ltl/examples/stringmatcher"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	ops "github.com/ilhamster/ltl/pkg/operators"
+	"github.com/ilhamster/ltl/pkg/parser"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, s string, opts ...smatch.Option) ltl.Operator {
+	t.Helper()
+	l, err := parser.NewLexer(parser.DefaultTokens, smatch.Generator(opts...),
+		bufio.NewReader(strings.NewReader(s)))
+	if err != nil {
+		t.Fatalf("Failed to create lexer: %s", err)
+	}
+	op, err := parser.ParseLTL(l)
+	if err != nil {
+		t.Fatalf("Failed to parse '%s': %s", s, err)
+	}
+	return op
+}
+
+// run streams input through a Runner for expr, returning the spans of its
+// matches, the number of errors it reported, and its final live count.
+func run(t *testing.T, expr, input string, opts ...Option) ([]string, int, int) {
+	t.Helper()
+	var spans []string
+	errs := 0
+	opts = append(opts, OnError(func(Match) { errs++ }))
+	r := New(parse(t, expr), func(m Match) {
+		spans = append(spans, fmt.Sprintf("%d-%d", m.Start, m.End))
+	}, opts...)
+	for idx, ch := range input {
+		r.Match(rtok.New(ch, idx))
+	}
+	live := r.Live()
+	r.Finish()
+	return spans, errs, live
+}
+
+func TestRunner(t *testing.T) {
+	tests := []struct {
+		expr, input string
+		opts        []Option
+		wantSpans   []string
+		wantErrs    int
+		wantLive    int
+	}{{
+		expr:      "[a] THEN [b]",
+		input:     "abcab",
+		wantSpans: []string{"0-1", "3-4"},
+		wantLive:  1,
+	}, {
+		expr:      "[a] THEN [b]",
+		input:     "abcab",
+		opts:      []Option{RetireDead(true)},
+		wantSpans: []string{"0-1", "3-4"},
+	}, {
+		expr:     "([a] THEN EVENTUALLY [b]) AND GLOBALLY NOT [c]",
+		input:    "aacb",
+		wantLive: 1,
+	}, {
+		expr:  "([a] THEN EVENTUALLY [b]) AND GLOBALLY NOT [c]",
+		input: "aacb",
+		opts:  []Option{RetireDead(true)},
+	}, {
+		expr:      "[$a<-] THEN (NOT [$a]) THEN [$a]",
+		input:     "abacc",
+		wantSpans: []string{"0-2"},
+		wantLive:  2,
+	}, {
+		expr:      "[$a<-] THEN (NOT [$a]) THEN [$a]",
+		input:     "abacc",
+		opts:      []Option{Arenas(true)},
+		wantSpans: []string{"0-2"},
+		wantLive:  2,
+	}, {
+		expr:      "[$a<-] THEN GLOBALLY [c]",
+		input:     "acca",
+		opts:      []Option{Arenas(true), WithPolicy(LeftmostLongest)},
+		wantSpans: []string{"0-2", "3-3"},
+		wantLive:  1,
+	}, {
+		expr:      "[a] THEN EVENTUALLY [b]",
+		input:     "aacb",
+		wantSpans: []string{"0-3", "1-3"},
+		wantLive:  1,
+	}, {
+		expr:      "[a] THEN EVENTUALLY [b]",
+		input:     "aacb",
+		opts:      []Option{MaxLength(3)},
+		wantSpans: []string{"1-3"},
+		wantLive:  1,
+	}, {
+		expr:      "[a] THEN EVENTUALLY [b]",
+		input:     "aacb",
+		opts:      []Option{MaxInstances(1)},
+		wantSpans: nil,
+		wantLive:  1,
+	}, {
+		expr:      "[a] THEN GLOBALLY [c]",
+		input:     "acc",
+		wantSpans: []string{"0-1", "0-2", "0-2"},
+		wantLive:  2,
+	}, {
+		expr:      "[$a<-] THEN GLOBALLY [c]",
+		input:     "acca",
+		wantSpans: []string{"0-1", "0-2", "1-2", "3-3"},
+		wantLive:  1,
+	}, {
+		expr:      "[$a<-] THEN GLOBALLY [c]",
+		input:     "acca",
+		opts:      []Option{WithPolicy(EarliestOnly)},
+		wantSpans: []string{"0-1", "1-2", "3-3"},
+		wantLive:  1,
+	}, {
+		expr:      "[$a<-] THEN GLOBALLY [c]",
+		input:     "acca",
+		opts:      []Option{WithPolicy(NonOverlapping)},
+		wantSpans: []string{"0-1", "3-3"},
+		wantLive:  1,
+	}, {
+		expr:      "[$a<-] THEN GLOBALLY [c]",
+		input:     "acca",
+		opts:      []Option{WithPolicy(LeftmostLongest)},
+		wantSpans: []string{"0-2", "3-3"},
+		wantLive:  1,
+	}, {
+		expr:      "[$a<-] THEN GLOBALLY [c]",
+		input:     "acca",
+		opts:      []Option{WithPolicy(LeftmostLongest), MaxLength(2)},
+		wantSpans: []string{"0-1", "3-3"},
+		wantLive:  1,
+	}, {
+		expr:      "[a] THEN EVENTUALLY [b]",
+		input:     "aaacb",
+		opts:      []Option{Deduplicate(true)},
+		wantSpans: []string{"0-4"},
+		wantLive:  1,
+	}, {
+		expr:      "[a] THEN EVENTUALLY [b]",
+		input:     "aacb",
+		opts:      []Option{MaxInstances(1), OnLimit(Block)},
+		wantSpans: []string{"0-3"},
+	}, {
+		expr:     "[a] THEN EVENTUALLY [b]",
+		input:    "aacb",
+		opts:     []Option{MaxInstances(1), OnLimit(FailOnLimit)},
+		wantErrs: 1,
+	}, {
+		expr:      "[$x<-] THEN EVENTUALLY [$x]",
+		input:     "abcab",
+		wantSpans: []string{"0-3", "1-4"},
+		wantLive:  5,
+	}, {
+		expr:     "[$x<-] THEN EVENTUALLY [$x]",
+		input:    "abcab",
+		opts:     []Option{MaxEnvSize(2)},
+		wantLive: 2,
+	}, {
+		expr:      "[$x<-] THEN EVENTUALLY [$x]",
+		input:     "abcab",
+		opts:      []Option{MaxEnvSize(2), OnLimit(Block)},
+		wantSpans: []string{"0-3", "1-4"},
+		wantLive:  2,
+	}, {
+		expr:     "[$a<-] THEN [$a<-]",
+		input:    "12",
+		wantErrs: 1,
+		wantLive: 1,
+	}}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s <- %s", test.expr, test.input), func(t *testing.T) {
+			spans, errs, live := run(t, test.expr, test.input, test.opts...)
+			if strings.Join(spans, " ") != strings.Join(test.wantSpans, " ") {
+				t.Errorf("Got matches %v, wanted %v", spans, test.wantSpans)
+			}
+			if errs != test.wantErrs {
+				t.Errorf("Got %d errors, wanted %d", errs, test.wantErrs)
+			}
+			if live != test.wantLive {
+				t.Errorf("Got %d live instances, wanted %d", live, test.wantLive)
+			}
+		})
+	}
+}
+
+func TestDeduplicate(t *testing.T) {
+	var got []string
+	r := New(parse(t, "[a] THEN EVENTUALLY [b]", smatch.Capture(true)), func(m Match) {
+		var caps []string
+		for _, tok := range m.Captured() {
+			caps = append(caps, tok.String())
+		}
+		got = append(got, fmt.Sprintf("%d-%d %v", m.Start, m.End, caps))
+	}, Deduplicate(true))
+	for idx, ch := range "aaacb" {
+		r.Match(rtok.New(ch, idx))
+		if r.Live() > 2 {
+			t.Fatalf("Got %d live instances after token %d, wanted at most 2", r.Live(), idx)
+		}
+	}
+	want := []string{"0-4 [a (0) a (1) a (2) b (4)]"}
+	if strings.Join(got, "; ") != strings.Join(want, "; ") {
+		t.Errorf("Got matches %v, wanted %v", got, want)
+	}
+}
+
+func TestDeduplicateTags(t *testing.T) {
+	var got []string
+	// Each instance's Environments carry Index tags for the Tokens it matched,
+	// so equivalent instances differ only in their tags.
+	r := New(ops.WithSpans(parse(t, "[a] THEN EVENTUALLY [b]")), func(m Match) {
+		var tagged []string
+		for _, tag := range m.Tagged() {
+			tagged = append(tagged, tag.String())
+		}
+		got = append(got, fmt.Sprintf("%d-%d %v", m.Start, m.End, tagged))
+	}, Deduplicate(true))
+	for idx, ch := range "aaacb" {
+		r.Match(rtok.New(ch, idx))
+		if r.Live() > 2 {
+			t.Fatalf("Got %d live instances after token %d, wanted at most 2", r.Live(), idx)
+		}
+	}
+	want := []string{"0-4 [0-4]"}
+	if strings.Join(got, "; ") != strings.Join(want, "; ") {
+		t.Errorf("Got matches %v, wanted %v", got, want)
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	m := NewMatcher(parse(t, "[a] THEN EVENTUALLY [b]"))
+	in := make(chan ltl.Token)
+	out := m.Run(context.Background(), in)
+	go func() {
+		for idx, ch := range "aacbab" {
+			in <- rtok.New(ch, idx)
+		}
+		close(in)
+	}()
+	var got []string
+	for match := range out {
+		got = append(got, fmt.Sprintf("%d-%d", match.Start, match.End))
+	}
+	want := []string{"0-3", "1-3", "4-5"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Got matches %v, wanted %v", got, want)
+	}
+}
+
+func TestMatcherCancel(t *testing.T) {
+	m := NewMatcher(parse(t, "[a]"))
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan ltl.Token, 2)
+	in <- rtok.New('a', 0)
+	in <- rtok.New('a', 1)
+	out := m.Run(ctx, in)
+	if match := <-out; match.Start != 0 {
+		t.Errorf("Got first match at %d, wanted 0", match.Start)
+	}
+	// The second match is never read, and the input never closed; cancellation
+	// must nonetheless stop the Matcher and close its output.
+	cancel()
+	for range out {
+	}
+}
+
+func TestFailOnLimit(t *testing.T) {
+	var errs []string
+	r := New(parse(t, "[$x<-] THEN EVENTUALLY [$x]", smatch.Capture(true)), nil,
+		MaxCaptures(2), OnLimit(FailOnLimit), OnError(func(m Match) {
+			errs = append(errs, m.Env.Err().Error())
+		}))
+	for idx, ch := range "abcab" {
+		r.Match(rtok.New(ch, idx))
+	}
+	if !errors.Is(r.Err(), ErrLimitExceeded) {
+		t.Fatalf("Got error %v, wanted %v", r.Err(), ErrLimitExceeded)
+	}
+	var le *LimitError
+	if !errors.As(r.Err(), &le) || le.Used != 3 || le.Max != 2 {
+		t.Errorf("Got error %v, wanted a LimitError for 3 of 2", r.Err())
+	}
+	want := []string{"stream limit exceeded: 3 retained captures exceed the maximum of 2"}
+	if strings.Join(errs, "; ") != strings.Join(want, "; ") {
+		t.Errorf("Got errors %v, wanted %v", errs, want)
+	}
+	if r.Live() != 0 {
+		t.Errorf("Got %d live instances after failure, wanted 0", r.Live())
+	}
+}
+
+func TestMatchContents(t *testing.T) {
+	var got []string
+	r := New(parse(t, "[$x<-] THEN [$x]", smatch.Capture(true)), func(m Match) {
+		var caps []string
+		for _, tok := range m.Captured() {
+			caps = append(caps, tok.String())
+		}
+		got = append(got, fmt.Sprintf("%d-%d %s %v", m.Start, m.End, m.Bindings, caps))
+	})
+	for idx, ch := range "xaab" {
+		r.Match(rtok.New(ch, idx))
+	}
+	r.Finish()
+	want := []string{"1-2 [x:a] [a (1) a (2)]"}
+	if strings.Join(got, "; ") != strings.Join(want, "; ") {
+		t.Errorf("Got matches %v, wanted %v", got, want)
+	}
+}
+
+func TestFromResult(t *testing.T) {
+	var toks []ltl.Token
+	for idx, ch := range "xaab" {
+		toks = append(toks, rtok.New(ch, idx))
+	}
+	res, err := ltl.MatchAll(parse(t, "[$x<-] THEN [$x] THEN [b]", smatch.Capture(true)), toks)
+	if err != nil {
+		t.Fatalf("MatchAll() yielded unexpected error %s", err)
+	}
+	var got []string
+	for _, r := range res {
+		m := FromResult(r)
+		got = append(got, fmt.Sprintf("%d-%d %t %v %s %v", m.Start, m.End, m.Matching, m.Err, m.Bindings, m.Captured()))
+	}
+	want := []string{"1-3 true <nil> [x:a] [a (1) a (2) b (3)]"}
+	if strings.Join(got, "; ") != strings.Join(want, "; ") {
+		t.Errorf("Got matches %v, wanted %v", got, want)
+	}
+	m := NewMatch(0, 0, ltl.ErrEnv(errors.New("oops")))
+	if m.Matching || m.Err == nil || m.Bindings != nil || m.Captured() != nil || m.Tagged() != nil {
+		t.Errorf("NewMatch() for an erroring Environment = %+v, wanted an unbound error", m)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	r := New(parse(t, "[a] THEN [b] THEN [c]"), nil)
+	for idx, ch := range "xaab" {
+		r.Match(rtok.New(ch, idx))
+	}
+	var got []string
+	for _, p := range r.Progress() {
+		got = append(got, fmt.Sprintf("%d: %s", p.Start, p))
+	}
+	want := []string{"2: 2 of 3 steps matched", "3: failed after 1 of 3 steps"}
+	if strings.Join(got, "; ") != strings.Join(want, "; ") {
+		t.Errorf("Got progress %v, wanted %v", got, want)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	m := new(expvar.Map).Init()
+	r := New(parse(t, "[$x<-] THEN EVENTUALLY [$x]", smatch.Capture(true)), nil,
+		WithMetrics(ExpvarMetrics(m)))
+	for idx, ch := range "abab" {
+		r.Match(rtok.New(ch, idx))
+	}
+	want := `{"instances_started": 4, "live_instances": 4, "matches": 2, "max_bindings_per_env": 1, "max_env_depth": 1, "retained_captures": 4, "retained_env_nodes": 4, "tokens": 4}`
+	if got := m.String(); got != want {
+		t.Errorf("Got metrics %s, wanted %s", got, want)
+	}
+	r.Finish()
+	if got := r.Stats(); got.LiveInstances != 0 || got.Tokens != 4 {
+		t.Errorf("Got stats %+v after Finish, wanted no live instances and 4 Tokens", got)
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tags provides a utility type for tagging Environments with values
+// describing their matches, such as labels or the span of tokens they cover.
+package tags
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Tag is a value attached to an Environment.
+type Tag interface {
+	fmt.Stringer
+	// Kind identifies the Tag's kind.  A Tags holds at most one Tag of each
+	// kind under each matching state.
+	Kind() string
+	// Merge returns the combination of the receiver and the provided Tag,
+	// which is of the same Kind.
+	Merge(o Tag) Tag
+}
+
+// Tags stores sets of Tags attached to Environments.
+type Tags struct {
+	// tags stores two sets of Tags, by Kind: one applying if the Environment
+	// matches, and one applying if it does not match.
+	tags map[bool]map[string]Tag
+}
+
+// New returns a new, empty Tags set.
+func New() *Tags {
+	return &Tags{
+		tags: map[bool]map[string]Tag{
+			true:  nil,
+			false: nil,
+		},
+	}
+}
+
+// Get returns the Tags applying under the provided matching state, in order
+// of Kind.
+func (t *Tags) Get(matching bool) []Tag {
+	if t == nil {
+		return nil
+	}
+	var ret []Tag
+	for _, tag := range t.tags[matching] {
+		ret = append(ret, tag)
+	}
+	sort.Slice(ret, func(a, b int) bool {
+		return ret[a].Kind() < ret[b].Kind()
+	})
+	return ret
+}
+
+// Lookup returns the Tag of the specified Kind applying under the provided
+// matching state, and true, or false if there is none.
+func (t *Tags) Lookup(matching bool, kind string) (Tag, bool) {
+	if t == nil {
+		return nil, false
+	}
+	tag, ok := t.tags[matching][kind]
+	return tag, ok
+}
+
+// Tag attaches the provided Tags under the specified matching state, merging
+// them with any of the same Kind.  It returns itself, for chaining.
+func (t *Tags) Tag(matching bool, tags ...Tag) *Tags {
+	if t.tags[matching] == nil {
+		t.tags[matching] = map[string]Tag{}
+	}
+	for _, tag := range tags {
+		if old, ok := t.tags[matching][tag.Kind()]; ok {
+			tag = old.Merge(tag)
+		}
+		t.tags[matching][tag.Kind()] = tag
+	}
+	return t
+}
+
+// Union returns a new Tags comprised of the union of the receiver and the
+// argument, merging Tags of the same Kind.
+func (t *Tags) Union(ot *Tags) *Tags {
+	if t == nil {
+		return ot
+	}
+	if ot == nil {
+		return t
+	}
+	ret := New()
+	for _, tags := range []*Tags{t, ot} {
+		for matchingState, byKind := range tags.tags {
+			for _, tag := range byKind {
+				ret.Tag(matchingState, tag)
+			}
+		}
+	}
+	return ret
+}
+
+// Not returns a new Tags in which the Tags' matching states are inverted.
+func (t *Tags) Not() *Tags {
+	if t == nil {
+		return nil
+	}
+	ret := New()
+	ret.tags[true] = t.tags[false]
+	ret.tags[false] = t.tags[true]
+	return ret
+}
+
+// Eq returns true if the receiver and argument hold Tags of the same Kinds,
+// printing alike, under each matching state.
+func (t *Tags) Eq(ot *Tags) bool {
+	for _, matching := range []bool{true, false} {
+		tags, otags := t.Get(matching), ot.Get(matching)
+		if len(tags) != len(otags) {
+			return false
+		}
+		for idx := range tags {
+			if tags[idx].Kind() != otags[idx].Kind() ||
+				tags[idx].String() != otags[idx].String() {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Reducible returns true if the receiver contains no Tags.
+func (t *Tags) Reducible() bool {
+	return t == nil || (len(t.tags[true]) == 0 && len(t.tags[false]) == 0)
+}
+
+// Label returns a Tag carrying the provided name.  Labels of different names
+// are of different Kinds, so any number may be attached.
+func Label(name string) Tag {
+	return label(name)
+}
+
+// LabelName returns the name of the provided Tag, and true, if it is a Label,
+// or false otherwise.
+func LabelName(t Tag) (string, bool) {
+	l, ok := t.(label)
+	return string(l), ok
+}
+
+type label string
+
+func (l label) String() string {
+	return "#" + string(l)
+}
+
+func (l label) Kind() string {
+	return l.String()
+}
+
+func (l label) Merge(o Tag) Tag {
+	return l
+}
+
+// IndexKind is the Kind of Tags returned by Index.
+const IndexKind = "index"
+
+// Index returns a Tag recording the index of a token.  Index Tags merge into
+// the range of indices they span.
+func Index(idx int) Tag {
+	return indexTag{idx, idx}
+}
+
+type indexTag struct {
+	start, end int
+}
+
+func (it indexTag) String() string {
+	return fmt.Sprintf("%d-%d", it.start, it.end)
+}
+
+func (it indexTag) Kind() string {
+	return IndexKind
+}
+
+func (it indexTag) Merge(o Tag) Tag {
+	oit, ok := o.(indexTag)
+	if !ok {
+		return it
+	}
+	if oit.start < it.start {
+		it.start = oit.start
+	}
+	if oit.end > it.end {
+		it.end = oit.end
+	}
+	return it
+}
+
+// IndexRange returns the range of indices, inclusive, spanned by the Index
+// Tags applying under the provided matching state, and true, or false if
+// there are none.
+func (t *Tags) IndexRange(matching bool) (start, end int, ok bool) {
+	tag, ok := t.Lookup(matching, IndexKind)
+	if !ok {
+		return 0, 0, false
+	}
+	it := tag.(indexTag)
+	return it.start, it.end, true
+}
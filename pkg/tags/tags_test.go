@@ -0,0 +1,97 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tags
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTags(t *testing.T) {
+	for idx, test := range []struct {
+		tags                          *Tags
+		wantMatching, wantNotMatching string
+	}{
+		{nil, "[]", "[]"},
+		{New().Tag(true, Label("b"), Label("a")), "[#a #b]", "[]"},
+		{New().Tag(true, Index(3), Index(1)).Tag(false, Label("a")), "[1-3]", "[#a]"},
+		{New().Tag(true, Index(3), Label("a")).Union(
+			New().Tag(true, Index(5), Label("a")),
+		), "[#a 3-5]", "[]"},
+		{New().Tag(true, Label("a")).Tag(false, Index(2)).Not(), "[2-2]", "[#a]"},
+	} {
+		t.Run(fmt.Sprintf("case %d", idx), func(t *testing.T) {
+			if got := fmt.Sprint(test.tags.Get(true)); got != test.wantMatching {
+				t.Errorf("Got matching tags %s, wanted %s", got, test.wantMatching)
+			}
+			if got := fmt.Sprint(test.tags.Get(false)); got != test.wantNotMatching {
+				t.Errorf("Got not-matching tags %s, wanted %s", got, test.wantNotMatching)
+			}
+		})
+	}
+}
+
+func TestIndexRange(t *testing.T) {
+	tags := New().Tag(true, Index(4)).Union(New().Tag(true, Index(2), Index(7)))
+	if start, end, ok := tags.IndexRange(true); !ok || start != 2 || end != 7 {
+		t.Errorf("IndexRange() = %d, %d, %t, wanted 2, 7, true", start, end, ok)
+	}
+	if _, _, ok := tags.IndexRange(false); ok {
+		t.Errorf("IndexRange() found a range under the not-matching state")
+	}
+}
+
+type timedTok struct {
+	idx int
+	ts  time.Time
+}
+
+func (tt timedTok) String() string {
+	return fmt.Sprintf("%d", tt.idx)
+}
+
+func (tt timedTok) EOI() bool {
+	return false
+}
+
+func (tt timedTok) Index() int {
+	return tt.idx
+}
+
+func (tt timedTok) Timestamp() time.Time {
+	return tt.ts
+}
+
+func TestTemporal(t *testing.T) {
+	at := func(idx int, secs float64) timedTok {
+		return timedTok{idx, time.Unix(0, 0).Add(time.Duration(secs * float64(time.Second)))}
+	}
+	tags := New().Tag(true, ForToken(at(3, 2))...).Union(
+		New().Tag(true, ForToken(at(1, 0.5))...).Tag(true, Duration(time.Second), Duration(time.Millisecond)),
+	)
+	if span, ok := tags.Span(true); !ok || span != 1500*time.Millisecond {
+		t.Errorf("Span() = %s, %t, wanted 1.5s, true", span, ok)
+	}
+	if start, end, ok := tags.IndexRange(true); !ok || start != 1 || end != 3 {
+		t.Errorf("IndexRange() = %d, %d, %t, wanted 1, 3, true", start, end, ok)
+	}
+	if d, ok := tags.LongestDuration(true); !ok || d != time.Second {
+		t.Errorf("LongestDuration() = %s, %t, wanted 1s, true", d, ok)
+	}
+	if _, ok := tags.Span(false); ok {
+		t.Errorf("Span() found a span under the not-matching state")
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tags
+
+import (
+	"fmt"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	"time"
+)
+
+// TimeKind is the Kind of Tags returned by Time.
+const TimeKind = "time"
+
+// Time returns a Tag recording the timestamp of a token.  Time Tags merge
+// into the range of time they span.
+func Time(ts time.Time) Tag {
+	return timeTag{ts, ts}
+}
+
+type timeTag struct {
+	start, end time.Time
+}
+
+func (tt timeTag) String() string {
+	return fmt.Sprintf("%s-%s", tt.start.Format(time.RFC3339Nano), tt.end.Format(time.RFC3339Nano))
+}
+
+func (tt timeTag) Kind() string {
+	return TimeKind
+}
+
+func (tt timeTag) Merge(o Tag) Tag {
+	ott, ok := o.(timeTag)
+	if !ok {
+		return tt
+	}
+	if ott.start.Before(tt.start) {
+		tt.start = ott.start
+	}
+	if ott.end.After(tt.end) {
+		tt.end = ott.end
+	}
+	return tt
+}
+
+// TimeRange returns the range of time, inclusive, spanned by the Time Tags
+// applying under the provided matching state, and true, or false if there are
+// none.
+func (t *Tags) TimeRange(matching bool) (start, end time.Time, ok bool) {
+	tag, ok := t.Lookup(matching, TimeKind)
+	if !ok {
+		return time.Time{}, time.Time{}, false
+	}
+	tt := tag.(timeTag)
+	return tt.start, tt.end, true
+}
+
+// Span returns the wall-clock time elapsed between the earliest and latest
+// Time Tags applying under the provided matching state, and true, or false if
+// there are none.
+func (t *Tags) Span(matching bool) (time.Duration, bool) {
+	start, end, ok := t.TimeRange(matching)
+	return end.Sub(start), ok
+}
+
+// DurationKind is the Kind of Tags returned by Duration.
+const DurationKind = "duration"
+
+// Duration returns a Tag recording a duration, such as the time taken by a
+// step of a match.  Duration Tags merge into the longest of them.
+func Duration(d time.Duration) Tag {
+	return durationTag(d)
+}
+
+type durationTag time.Duration
+
+func (dt durationTag) String() string {
+	return time.Duration(dt).String()
+}
+
+func (dt durationTag) Kind() string {
+	return DurationKind
+}
+
+func (dt durationTag) Merge(o Tag) Tag {
+	if odt, ok := o.(durationTag); ok && odt > dt {
+		return odt
+	}
+	return dt
+}
+
+// LongestDuration returns the longest Duration Tag applying under the provided
+// matching state, and true, or false if there is none.
+func (t *Tags) LongestDuration(matching bool) (time.Duration, bool) {
+	tag, ok := t.Lookup(matching, DurationKind)
+	if !ok {
+		return 0, false
+	}
+	return time.Duration(tag.(durationTag)), true
+}
+
+// ForToken returns Tags locating the provided token in its stream: an Index
+// Tag if it has an Index() method, as runetoken.RuneTokens do, and a Time Tag
+// if it is an ltl.TimedToken.
+func ForToken(tok ltl.Token) []Tag {
+	var ret []Tag
+	if it, ok := tok.(interface{ Index() int }); ok {
+		ret = append(ret, Index(it.Index()))
+	}
+	if tt, ok := tok.(ltl.TimedToken); ok {
+		ret = append(ret, Time(tt.Timestamp()))
+	}
+	return ret
+}
@@ -0,0 +1,213 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package trace records how an operator tree evaluates its input, for
+// debugging complex formulas.  An operator tree instrumented with Instrument
+// behaves exactly as the original, but records into a Trace, for each Token,
+// which subformula instances consumed it and what each produced.
+//
+// Tracing is costly, and retains every Environment produced, so it should not
+// be left enabled in production.
+package trace
+
+import (
+	"fmt"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	ops "github.com/ilhamster/ltl/pkg/operators"
+	"strings"
+	"sync"
+)
+
+// Event records a single Match call on an instance of a subformula.
+type Event struct {
+	// Index is the index of the Token, counting from 0 the Tokens provided to
+	// the root of the instrumented tree, including any end-of-input Token.
+	Index int
+	// Token is the consumed Token.
+	Token ltl.Token
+	// Path identifies the subformula: "" is the root, and "/1/0" is the first
+	// child of the second child of the root.
+	Path string
+	// Instance is the instance of the subformula that consumed the Token: the
+	// subformula itself, or one of its continuations, printed inline.
+	Instance string
+	// Env is the Environment the instance produced.
+	Env ltl.Environment
+	// Resolved is true if the instance resolved, returning no continuation.
+	Resolved bool
+}
+
+func (e Event) String() string {
+	res := ""
+	if e.Resolved {
+		res = " (resolved)"
+	}
+	return fmt.Sprintf("'%s' %s -> %s%s", e.Path, e.Instance, e.Env, res)
+}
+
+// Trace holds the Events recorded by an instrumented operator tree.  Trace is
+// safe for concurrent use.
+type Trace struct {
+	mu     sync.Mutex
+	index  int
+	events []Event
+}
+
+// Instrument returns an operator tree equivalent to the provided one, which
+// records its evaluation into the returned Trace.  NotFollowedBy subformulas
+// themselves are not traced, though their children are.
+func Instrument(op ltl.Operator) (ltl.Operator, *Trace) {
+	t := &Trace{index: -1}
+	if op == nil {
+		return nil, t
+	}
+	return &traced{ops.NewUnaryOperator(t.instrument(op, "")), t, "", true}, t
+}
+
+func (t *Trace) instrument(op ltl.Operator, path string) ltl.Operator {
+	if op == nil {
+		return nil
+	}
+	children := ops.Children(op)
+	if len(children) > 0 {
+		newChildren := make([]ltl.Operator, len(children))
+		for idx, child := range children {
+			childPath := fmt.Sprintf("%s/%d", path, idx)
+			newChildren[idx] = t.wrap(t.instrument(child, childPath), childPath)
+		}
+		op = ops.WithChildren(op, newChildren...)
+	}
+	return op
+}
+
+func (t *Trace) wrap(op ltl.Operator, path string) ltl.Operator {
+	if op == nil || ops.KindOf(op) == ops.NotFollowedByKind {
+		// Then relies on NotFollowedBy's continuations being unwrapped.
+		return op
+	}
+	return &traced{ops.NewUnaryOperator(op), t, path, false}
+}
+
+// Events returns all recorded Events, in the order they were recorded.  Since
+// an instance records its Event once its children have returned, the Events
+// for each Token are recorded bottom-up.
+func (t *Trace) Events() []Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Event(nil), t.events...)
+}
+
+// ForToken returns the Events recorded for the Token at the specified index.
+func (t *Trace) ForToken(index int) []Event {
+	var ret []Event
+	for _, e := range t.Events() {
+		if e.Index == index {
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
+
+// Reset discards all recorded Events, and restarts Token indexing.
+func (t *Trace) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.index = -1
+	t.events = nil
+}
+
+// String renders the receiver's Events, grouped by Token.
+func (t *Trace) String() string {
+	sb := &strings.Builder{}
+	last := -1
+	for _, e := range t.Events() {
+		if e.Index != last {
+			fmt.Fprintf(sb, "token %d (%s):\n", e.Index, e.Token)
+			last = e.Index
+		}
+		fmt.Fprintf(sb, "  %s\n", e)
+	}
+	return sb.String()
+}
+
+func (t *Trace) record(e Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e.Index = t.index
+	t.events = append(t.events, e)
+}
+
+func (t *Trace) advance() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.index++
+}
+
+// traced records the Match calls on its child, and its child's continuations,
+// into a Trace.
+type traced struct {
+	ops.UnaryOperator
+	t    *Trace
+	path string
+	// root is set for the root of the instrumented tree, which advances the
+	// Token index.
+	root bool
+}
+
+func (tr *traced) Match(tok ltl.Token) (ltl.Operator, ltl.Environment) {
+	if tr.root {
+		tr.t.advance()
+	}
+	op, env := tr.Child.Match(tok)
+	tr.t.record(Event{
+		Token:    tok,
+		Path:     tr.path,
+		Instance: describe(tr.Child),
+		Env:      env,
+		Resolved: op == nil,
+	})
+	if op == nil {
+		return nil, env
+	}
+	return &traced{ops.NewUnaryOperator(op), tr.t, tr.path, tr.root}, env
+}
+
+// describe prints the provided Operator inline, omitting tracing wrappers.
+func describe(op ltl.Operator) string {
+	if tr, ok := op.(*traced); ok {
+		return describe(tr.Child)
+	}
+	children := ops.Children(op)
+	if len(children) == 0 {
+		return ops.PrettyPrint(op, ops.Inline())
+	}
+	childStrs := make([]string, len(children))
+	for idx, child := range children {
+		childStrs[idx] = describe(child)
+	}
+	return fmt.Sprintf("%s(%s)", op, strings.Join(childStrs, ","))
+}
+
+func (tr *traced) String() string {
+	return fmt.Sprintf("TRACED(%s)", tr.path)
+}
+
+// Clone implements ltl.Cloner.  Clones record into the receiver's Trace.
+func (tr *traced) Clone() (ltl.Operator, bool) {
+	child, copied := ltl.Clone(tr.Child)
+	if !copied {
+		return tr, false
+	}
+	return &traced{ops.NewUnaryOperator(child), tr.t, tr.path, tr.root}, true
+}
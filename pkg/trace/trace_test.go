@@ -0,0 +1,94 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"bufio"
+	rtok "github.com/ilhamster/ltl/examples/runetoken"
+	smatch "github.com/ilhamster/ltl/examples/stringmatcher"
+	"github.com/ilhamster/ltl/pkg/ltl"
+	ops "github.com/ilhamster/ltl/pkg/operators"
+	"github.com/ilhamster/ltl/pkg/parser"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, s string) ltl.Operator {
+	t.Helper()
+	l, err := parser.NewLexer(parser.DefaultTokens, smatch.Generator(),
+		bufio.NewReader(strings.NewReader(s)))
+	if err != nil {
+		t.Fatalf("Failed to create lexer: %s", err)
+	}
+	op, err := parser.ParseLTL(l)
+	if err != nil {
+		t.Fatalf("Failed to parse '%s': %s", s, err)
+	}
+	return op
+}
+
+func TestTrace(t *testing.T) {
+	op, tr := Instrument(parse(t, "[a] THEN ([b] OR [c])"))
+	var env ltl.Environment
+	for idx, ch := range "ac" {
+		if op == nil {
+			t.Fatalf("Instrumented operator resolved early")
+		}
+		op, env = op.Match(rtok.New(ch, idx))
+	}
+	if op != nil || !env.Matching() {
+		t.Fatalf("Instrumented operator did not resolve matching")
+	}
+	want := `token 0 (a (0)):
+  '/0' [a] -> ((Matching/true)) (resolved)
+  '' THEN([a],OR([b],[c])) -> NotMatching
+token 1 (c (1)):
+  '/1/0' [b] -> ((NotMatching/false)) (resolved)
+  '/1/1' [c] -> ((Matching/true)) (resolved)
+  '/1' OR([b],[c]) -> ((Matching/true)) (resolved)
+  '' OR([b],[c]) -> ((Matching/true)) (resolved)
+`
+	if got := tr.String(); got != want {
+		t.Errorf("Trace was\n%s\nwanted\n%s", got, want)
+	}
+	if got := len(tr.ForToken(1)); got != 4 {
+		t.Errorf("Got %d events for token 1, wanted 4", got)
+	}
+	tr.Reset()
+	if got := len(tr.Events()); got != 0 {
+		t.Errorf("Got %d events after Reset, wanted 0", got)
+	}
+}
+
+func TestTraceNotFollowedBy(t *testing.T) {
+	formula := ops.Then(ops.NotFollowedBy(parse(t, "[a]"), parse(t, "[b]")), parse(t, "[c]"))
+	for _, input := range []string{"ac", "ab"} {
+		op, _ := Instrument(formula)
+		orig := formula
+		var env, origEnv ltl.Environment
+		for idx, ch := range input {
+			tok := rtok.New(ch, idx)
+			if op != nil {
+				op, env = op.Match(tok)
+			}
+			if orig != nil {
+				orig, origEnv = orig.Match(tok)
+			}
+		}
+		if env == nil || env.Matching() != origEnv.Matching() {
+			t.Errorf("On '%s', instrumented tree matched %t, original %t", input, env.Matching(), origEnv.Matching())
+		}
+	}
+}
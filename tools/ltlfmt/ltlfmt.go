@@ -0,0 +1,95 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Binary ltlfmt formats LTL expressions canonically.  With no arguments, it
+// formats the expression read from standard input; otherwise, it formats the
+// expression in each named file, writing the result to standard output or,
+// with -w, back to the file.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/ilhamster/ltl/pkg/parser"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+var (
+	width  = flag.Int("width", 80, "The width beyond which lines are wrapped; 0 disables wrapping.")
+	indent = flag.String("indent", "  ", "The indentation of each level of wrapped lines.")
+	write  = flag.Bool("w", false, "Write the result back to each named file, instead of to standard output.")
+)
+
+func format(name string, in []byte) (string, error) {
+	out, err := parser.FormatExpr(string(in), parser.FormatWidth(*width), parser.FormatIndent(*indent))
+	if err != nil {
+		var se *parser.SyntaxError
+		if errors.As(err, &se) {
+			return "", fmt.Errorf("%s: %s\n%s", name, err, se.Caret())
+		}
+		return "", fmt.Errorf("%s: %s", name, err)
+	}
+	return out + "\n", nil
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		if *write {
+			log.Fatal("-w requires named files")
+		}
+		in, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatal(err)
+		}
+		out, err := format("<stdin>", in)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Print(out)
+		return
+	}
+	failed := false
+	for _, name := range flag.Args() {
+		in, err := ioutil.ReadFile(name)
+		if err != nil {
+			log.Print(err)
+			failed = true
+			continue
+		}
+		out, err := format(name, in)
+		if err != nil {
+			log.Print(err)
+			failed = true
+			continue
+		}
+		if !*write {
+			fmt.Print(out)
+			continue
+		}
+		if out == string(in) {
+			continue
+		}
+		if err := ioutil.WriteFile(name, []byte(out), 0644); err != nil {
+			log.Print(err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -17,6 +17,7 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"flag"
 	"fmt"
 	rt "github.com/ilhamster/ltl/examples/runetoken"
@@ -60,6 +61,10 @@ func (lif *ltlif) setOp(expression string) {
 	op, err := lif.parse(expression)
 	if err != nil {
 		fmt.Printf("Parse error: %s\n", err.Error())
+		var se *parser.SyntaxError
+		if errors.As(err, &se) {
+			fmt.Println(se.Caret())
+		}
 		return
 	}
 	lif.op = op